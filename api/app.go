@@ -24,30 +24,19 @@ import (
 	"strings"
 )
 
-func write(w io.Writer, content []byte) error {
-	n, err := w.Write(content)
-	if err != nil {
-		return err
-	}
-	if n != len(content) {
-		return io.ErrShortWrite
-	}
-	return nil
-}
-
-func getApp(name string, u *auth.User) (app.App, error) {
+func getApp(name string, u *auth.User, perm auth.Permission) (app.App, error) {
 	app := app.App{Name: name}
 	err := app.Get()
 	if err != nil {
 		return app, &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", name)}
 	}
+	if !u.CanAccessApp(app.Name) {
+		return app, &errors.Http{Code: http.StatusForbidden, Message: "This token does not have access to this app"}
+	}
 	if u.IsAdmin() {
 		return app, nil
 	}
-	if !auth.CheckUserAccess(app.Teams, u) {
-		return app, &errors.Http{Code: http.StatusForbidden, Message: "User does not have access to this app"}
-	}
-	return app, nil
+	return app, checkPermission(app.Teams, u, perm, "User does not have access to this app")
 }
 
 func cloneRepository(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -58,35 +47,30 @@ func cloneRepository(w http.ResponseWriter, r *http.Request, t *auth.Token) erro
 	if err != nil {
 		return &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", instance.Name)}
 	}
-	err = write(&logWriter, []byte("\n ---> Tsuru receiving push\n"))
-	if err != nil {
-		return err
-	}
-	err = write(&logWriter, []byte("\n ---> Replicating the application repository across units\n"))
-	if err != nil {
-		return err
-	}
-	out, err := repository.CloneOrPull(&instance) // should iterate over the machines
-	if err != nil {
-		return &errors.Http{Code: http.StatusInternalServerError, Message: string(out)}
-	}
-	err = write(&logWriter, out)
-	if err != nil {
-		return err
-	}
-	err = write(&logWriter, []byte("\n ---> Installing dependencies\n"))
+	return deployRef(&instance, &logWriter, t.UserEmail, r.URL.Query().Get("ref"))
+}
+
+func deploy(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
 	if err != nil {
 		return err
 	}
-	err = instance.InstallDeps(&logWriter)
+	instance, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppDeploy)
 	if err != nil {
 		return err
 	}
-	err = instance.Restart(&logWriter)
-	if err != nil {
-		return err
+	w.Header().Set("Content-Type", "text")
+	logWriter := app.LogWriter{App: &instance, Writer: w}
+	return deployRef(&instance, &logWriter, u.Email, r.URL.Query().Get("ref"))
+}
+
+func deployRef(a *app.App, w io.Writer, user, ref string) error {
+	err := a.Deploy(w, user, ref)
+	if err == repository.ErrInvalidRef {
+		msg := fmt.Sprintf("Invalid ref: %q.", ref)
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
 	}
-	return write(&logWriter, []byte("\n ---> Deploy done!\n\n"))
+	return err
 }
 
 func appIsAvailable(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -107,7 +91,7 @@ func forceDeleteApp(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return err
 	}
-	a, err := getApp(r.URL.Query().Get(":app"), u)
+	a, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppDelete)
 	if err != nil {
 		return err
 	}
@@ -121,7 +105,7 @@ func appDelete(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	a, err := getApp(r.URL.Query().Get(":app"), u)
+	a, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppDelete)
 	if err != nil {
 		return err
 	}
@@ -146,10 +130,16 @@ func appList(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	apps, err := app.List(u)
+	all, err := app.List(u)
 	if err != nil {
 		return err
 	}
+	var apps []app.App
+	for _, a := range all {
+		if u.CanAccessApp(a.Name) {
+			apps = append(apps, a)
+		}
+	}
 	if len(apps) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return nil
@@ -162,7 +152,7 @@ func appInfo(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	app, err := getApp(r.URL.Query().Get(":app"), u)
+	app, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppRead)
 	if err != nil {
 		return err
 	}
@@ -203,6 +193,13 @@ func createApp(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		msg := "In order to create an app, you should be member of at least one team"
 		return &errors.Http{Code: http.StatusForbidden, Message: msg}
 	}
+	teams = teamsWithPermission(teams, u, auth.PermAppCreate)
+	if len(teams) < 1 {
+		return permissionDenied(auth.PermAppCreate)
+	}
+	if !u.CanAccessApp(a.Name) {
+		return &errors.Http{Code: http.StatusForbidden, Message: "This token does not have access to this app"}
+	}
 	err = app.CreateApp(&a, japp.Units, teams)
 	if err != nil {
 		log.Printf("Got error while creating app: %s", err)
@@ -261,11 +258,15 @@ func addUnits(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppUnits)
 	if err != nil {
 		return err
 	}
-	return app.AddUnits(n)
+	err = app.AddUnits(n, r.URL.Query().Get("process"))
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: e.Message}
+	}
+	return err
 }
 
 func removeUnits(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -278,11 +279,11 @@ func removeUnits(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppUnits)
 	if err != nil {
 		return err
 	}
-	return app.RemoveUnits(uint(n))
+	return app.RemoveUnits(uint(n), r.URL.Query().Get("process"))
 }
 
 func grantAccessToTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -293,7 +294,7 @@ func grantAccessToTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) er
 	appName := r.URL.Query().Get(":app")
 	teamName := r.URL.Query().Get(":team")
 	team := new(auth.Team)
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppAccess)
 	if err != nil {
 		return err
 	}
@@ -352,7 +353,7 @@ func revokeAccessFromTeam(w http.ResponseWriter, r *http.Request, t *auth.Token)
 	appName := r.URL.Query().Get(":app")
 	teamName := r.URL.Query().Get(":team")
 	team := new(auth.Team)
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppAccess)
 	if err != nil {
 		return err
 	}
@@ -405,7 +406,7 @@ func runCommand(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppRun)
 	if err != nil {
 		return err
 	}
@@ -426,7 +427,7 @@ func getEnv(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppRead)
 	if err != nil {
 		return err
 	}
@@ -465,7 +466,7 @@ func setEnv(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppEnvSet)
 	if err != nil {
 		return err
 	}
@@ -495,7 +496,7 @@ func unsetEnv(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	if err != nil {
 		return err
 	}
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppEnvSet)
 	if err != nil {
 		return err
 	}
@@ -520,7 +521,7 @@ func setCName(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	app, err := getApp(appName, u)
+	app, err := getApp(appName, u, auth.PermAppCName)
 	if err != nil {
 		return err
 	}
@@ -551,7 +552,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 		return err
 	}
 	appName := r.URL.Query().Get(":app")
-	a, err := getApp(appName, u)
+	a, err := getApp(appName, u, auth.PermAppRead)
 	if err != nil {
 		return err
 	}
@@ -590,8 +591,8 @@ func getServiceInstace(instanceName, appName string, u *auth.User) (service.Serv
 		err = &errors.Http{Code: http.StatusNotFound, Message: "Instance not found"}
 		return instance, app, err
 	}
-	if !auth.CheckUserAccess(instance.Teams, u) {
-		err = &errors.Http{Code: http.StatusForbidden, Message: "This user does not have access to this instance"}
+	err = checkPermission(instance.Teams, u, auth.PermServiceInstanceBind, "This user does not have access to this instance")
+	if err != nil {
 		return instance, app, err
 	}
 	err = conn.Apps().Find(bson.M{"name": appName}).One(&app)
@@ -599,8 +600,12 @@ func getServiceInstace(instanceName, appName string, u *auth.User) (service.Serv
 		err = &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
 		return instance, app, err
 	}
-	if !auth.CheckUserAccess(app.Teams, u) {
-		err = &errors.Http{Code: http.StatusForbidden, Message: "This user does not have access to this app"}
+	if !u.CanAccessApp(app.Name) {
+		err = &errors.Http{Code: http.StatusForbidden, Message: "This token does not have access to this app"}
+		return instance, app, err
+	}
+	err = checkPermission(app.Teams, u, auth.PermAppBind, "This user does not have access to this app")
+	if err != nil {
 		return instance, app, err
 	}
 	return instance, app, nil
@@ -616,6 +621,10 @@ func bindServiceInstance(w http.ResponseWriter, r *http.Request, t *auth.Token)
 	if err != nil {
 		return err
 	}
+	if !instance.HasAnyTeam(a.Teams) {
+		msg := "This app does not belong to any team with access to this service instance."
+		return &errors.Http{Code: http.StatusForbidden, Message: msg}
+	}
 	err = instance.BindApp(&a)
 	if err != nil {
 		return err
@@ -643,16 +652,68 @@ func unbindServiceInstance(w http.ResponseWriter, r *http.Request, t *auth.Token
 }
 
 func restart(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	var batchSize int
+	if batch := r.URL.Query().Get("batch"); batch != "" {
+		var err error
+		if batchSize, err = strconv.Atoi(batch); err != nil || batchSize < 0 {
+			msg := "The batch size must be a non-negative integer."
+			return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	instance, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppRestart)
+	if err != nil {
+		return err
+	}
 	w.Header().Set("Content-Type", "text")
+	return instance.RollingRestart(w, batchSize)
+}
+
+func deployList(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
-	instance, err := getApp(r.URL.Query().Get(":app"), u)
+	a, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppRead)
+	if err != nil {
+		return err
+	}
+	deploys, err := a.Deploys()
 	if err != nil {
 		return err
 	}
-	return instance.Restart(w)
+	if len(deploys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deploys)
+}
+
+func rollback(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	version, err := strconv.Atoi(r.URL.Query().Get(":version"))
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "The version must be an integer."}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	instance, err := getApp(r.URL.Query().Get(":app"), u, auth.PermAppDeploy)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text")
+	logWriter := app.LogWriter{App: &instance, Writer: w}
+	err = instance.Rollback(&logWriter, version, u.Email)
+	if err == app.ErrDeployNotFound {
+		msg := fmt.Sprintf("App %s does not have the version %d.", instance.Name, version)
+		return &errors.Http{Code: http.StatusNotFound, Message: msg}
+	}
+	return err
 }
 
 func addLog(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
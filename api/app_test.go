@@ -6,6 +6,7 @@ package main
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
@@ -31,6 +32,8 @@ import (
 	"time"
 )
 
+const commit = "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9"
+
 type testHandler struct {
 	body    [][]byte
 	method  []string
@@ -99,7 +102,12 @@ func (s *S) TestCloneRepositoryHandlerShouldAddLogs(c *gocheck.C) {
 post-restart:
   - pos.sh
 `
+	s.provisioner.PrepareOutput(nil)            // save head
 	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
 	s.provisioner.PrepareOutput(nil)            // pre-restart
@@ -115,6 +123,7 @@ post-restart:
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
 	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, gocheck.IsNil)
@@ -141,7 +150,12 @@ func (s *S) TestCloneRepositoryHandler(c *gocheck.C) {
 post-restart:
   - pos.sh
 `
+	s.provisioner.PrepareOutput(nil)            // save head
 	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
 	s.provisioner.PrepareOutput(nil)            // pre-restart
@@ -157,6 +171,7 @@ post-restart:
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
 	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, gocheck.IsNil)
@@ -185,7 +200,12 @@ func (s *S) TestCloneRepositoryRunsCloneOrPullThenPreRestartThenRestartThenPosRe
 post-restart:
   - pos.sh
 `
+	s.provisioner.PrepareOutput(nil)            // save head
 	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
 	s.provisioner.PrepareOutput(nil)            // install
 	s.provisioner.PrepareOutput([]byte(output)) // loadHooks
 	s.provisioner.PrepareOutput(nil)            // pre-restart
@@ -201,6 +221,7 @@ post-restart:
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
 	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
 	request, err := http.NewRequest("GET", url, nil)
 	c.Assert(err, gocheck.IsNil)
@@ -212,6 +233,164 @@ post-restart:
 	c.Assert(str, gocheck.Matches, ".*\"git clone\" output.*")
 }
 
+func (s *S) TestCloneRepositoryRecordsTheDeploy(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)            // save head
+	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
+	s.provisioner.PrepareOutput(nil)            // install
+	s.provisioner.PrepareOutput(nil)            // loadHooks
+	a := app.App{
+		Name:      "someapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = cloneRepository(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, 1)
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(d.User, gocheck.Equals, s.user.Email)
+	c.Assert(d.Success, gocheck.Equals, true)
+	c.Assert(d.Log, gocheck.Equals, recorder.Body.String())
+}
+
+func (s *S) TestCloneRepositoryWithRef(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)            // save head
+	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
+	s.provisioner.PrepareOutput(nil)            // install
+	s.provisioner.PrepareOutput(nil)            // loadHooks
+	a := app.App{
+		Name:      "someapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s&ref=refs/heads/release-1.2", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = cloneRepository(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("cd /home/application/current && git checkout -q origin/release-1.2", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Ref, gocheck.Equals, "refs/heads/release-1.2")
+}
+
+func (s *S) TestCloneRepositoryWithInvalidRef(c *gocheck.C) {
+	a := app.App{Name: "someapp", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/repository/clone?:appname=%s&ref=-f", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = cloneRepository(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `Invalid ref: "-f".`)
+}
+
+func (s *S) TestDeployHandler(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)            // save head
+	s.provisioner.PrepareOutput(nil)            // clone
+	s.provisioner.PrepareOutput(nil)            // checkout
+	s.provisioner.PrepareOutput([]byte(commit)) // rev-parse
+	s.provisioner.PrepareOutput(nil)            // backup apprc
+	s.provisioner.PrepareOutput(nil)            // apprc
+	s.provisioner.PrepareOutput(nil)            // install
+	s.provisioner.PrepareOutput(nil)            // loadHooks
+	a := app.App{
+		Name:      "someapp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy?:app=%s&ref=1.0", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploy(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
+	result := strings.Replace(recorder.Body.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, ".*# ---> Deploy done!##$")
+	expected := "cd /home/application/current && git checkout -q $(git rev-parse -q --verify origin/1.0 || echo 1.0)"
+	c.Assert(s.provisioner.GetCmds(expected, &a), gocheck.HasLen, 1)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Ref, gocheck.Equals, "1.0")
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(d.User, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestDeployHandlerWithInvalidRef(c *gocheck.C) {
+	a := app.App{Name: "someapp", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy?:app=%s&ref=master..other", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploy(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestDeployHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploy?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deploy(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestCloneRepositoryShouldReturnNotFoundWhenAppDoesNotExist(c *gocheck.C) {
 	request, err := http.NewRequest("GET", "/apps/abc/repository/clone?:appname=abc", nil)
 	c.Assert(err, gocheck.IsNil)
@@ -576,6 +755,64 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(a.Units, gocheck.HasLen, 3)
 }
 
+func (s *S) TestAddUnitsWithProcess(c *gocheck.C) {
+	a := app.App{
+		Name:      "armorandsword",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "armorandsword/0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareOutput([]byte("web: python app.py\nworker: python worker.py\n"))
+	body := strings.NewReader("2")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:app=armorandsword&process=worker", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addUnits(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 3)
+	c.Assert(a.Units[1].ProcessName, gocheck.Equals, "worker")
+	c.Assert(a.Units[2].ProcessName, gocheck.Equals, "worker")
+}
+
+func (s *S) TestAddUnitsWithProcessWithoutProcfile(c *gocheck.C) {
+	a := app.App{
+		Name:      "armorandsword",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units:     []app.Unit{{Name: "armorandsword/0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.PrepareFailure("ExecuteCommand", stderrors.New("exit status 1"))
+	body := strings.NewReader("2")
+	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:app=armorandsword&process=worker", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = addUnits(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The app has no Procfile. Units of a single process type require a Procfile in the root of the app.")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+}
+
 func (s *S) TestAddUnitsReturns404IfAppDoesNotExist(c *gocheck.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("PUT", "/apps/armorandsword/units?:app=armorandsword", body)
@@ -657,7 +894,7 @@ func (s *S) TestRemoveUnits(c *gocheck.C) {
 	err = s.provisioner.Provision(&a)
 	c.Assert(err, gocheck.IsNil)
 	defer s.provisioner.Destroy(&a)
-	s.provisioner.AddUnits(&a, 3)
+	s.provisioner.AddUnits(&a, 3, "")
 	body := strings.NewReader("2")
 	request, err := http.NewRequest("DELETE", "/apps/velha/units?:app=velha", body)
 	c.Assert(err, gocheck.IsNil)
@@ -671,6 +908,38 @@ func (s *S) TestRemoveUnits(c *gocheck.C) {
 	c.Assert(s.provisioner.GetUnits(&a), gocheck.HasLen, 2)
 }
 
+func (s *S) TestRemoveUnitsWithProcess(c *gocheck.C) {
+	a := app.App{
+		Name:      "velha",
+		Framework: "python",
+		Teams:     []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "velha/0", ProcessName: "web"},
+			{Name: "velha/1", ProcessName: "worker"},
+			{Name: "velha/2", ProcessName: "web"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	err = s.provisioner.Provision(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.provisioner.Destroy(&a)
+	s.provisioner.AddUnits(&a, 3, "")
+	body := strings.NewReader("1")
+	request, err := http.NewRequest("DELETE", "/apps/velha/units?:app=velha&process=worker", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = removeUnits(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.Units, gocheck.HasLen, 2)
+	c.Assert(a.Units[0].Name, gocheck.Equals, "velha/0")
+	c.Assert(a.Units[1].Name, gocheck.Equals, "velha/2")
+}
+
 func (s *S) TestRemoveUnitsReturns404IfAppDoesNotExist(c *gocheck.C) {
 	body := strings.NewReader("1")
 	request, err := http.NewRequest("DELETE", "/apps/fetisha/units?:app=fetisha", body)
@@ -2104,6 +2373,40 @@ func (s *S) TestBindHandler(c *gocheck.C) {
 	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
 }
 
+func (s *S) TestBindHandlerReturns403IfTheAppTeamsDoNotHaveAccessToTheInstance(c *gocheck.C) {
+	t := auth.Team{Name: "anotherteam", Users: []string{s.user.Email}}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(t.Name)
+	instance := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		TeamOwner:   s.team.Name,
+		Teams:       []string{s.team.Name},
+	}
+	err = instance.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a := app.App{
+		Name:  "painkiller",
+		Teams: []string{t.Name},
+		Units: []app.Unit{{Ip: "127.0.0.1", Machine: 1}},
+	}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/services/instances/%s/%s?:instance=%s&:app=%s", instance.Name, a.Name, instance.Name, a.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = bindServiceInstance(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "This app does not belong to any team with access to this service instance.")
+}
+
 func (s *S) TestBindHandlerReturns404IfTheInstanceDoesNotExist(c *gocheck.C) {
 	a := app.App{
 		Name:      "serviceApp",
@@ -2200,7 +2503,7 @@ func (s *S) TestUnbindHandler(c *gocheck.C) {
 	defer gts.Close()
 	var called int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "DELETE" && r.URL.Path == "/resources/my-mysql/hostname/127.0.0.1" {
+		if r.Method == "DELETE" && r.URL.Path == "/resources/my-mysql/bind" && r.URL.Query().Get("unit-host") == "127.0.0.1" {
 			atomic.StoreInt32(&called, 1)
 		}
 	}))
@@ -2383,6 +2686,49 @@ func (s *S) TestRestartHandler(c *gocheck.C) {
 	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
 }
 
+func (s *S) TestRestartHandlerInBatches(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // loadHooks
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{
+			{Name: "stress/0", State: "started"},
+			{Name: "stress/1", State: "started"},
+		},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "stress/0", provision.StatusStarted)
+	s.provisioner.SetUnitStatus(&a, "stress/1", provision.StatusStarted)
+	url := fmt.Sprintf("/apps/%s/restart?:app=%s&batch=1", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = restart(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	result := strings.Replace(recorder.Body.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, ".*# ---> Restarting units stress/0# ---> Restarting units stress/1#.*")
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"stress/0", "stress/1"})
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 0)
+}
+
+func (s *S) TestRestartHandlerInvalidBatchSize(c *gocheck.C) {
+	for _, batch := range []string{"two", "-1"} {
+		url := "/apps/stress/restart?:app=stress&batch=" + batch
+		request, err := http.NewRequest("GET", url, nil)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = restart(recorder, request, s.token)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, gocheck.Equals, "The batch size must be a non-negative integer.")
+	}
+}
+
 func (s *S) TestRestartHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
 	request, err := http.NewRequest("GET", "/apps/unknown/restart?:app=unknown", nil)
 	c.Assert(err, gocheck.IsNil)
@@ -2411,6 +2757,140 @@ func (s *S) TestRestartHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *go
 	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
 }
 
+func (s *S) TestDeployListHandler(c *gocheck.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = s.conn.Deploys().Insert(
+		app.Deploy{App: a.Name, Version: 1, Commit: commit, User: s.user.Email, Success: true},
+		app.Deploy{App: a.Name, Version: 2, Error: "Failed to update the repository"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployList(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var deploys []app.Deploy
+	err = json.NewDecoder(recorder.Body).Decode(&deploys)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 2)
+	c.Assert(deploys[0].Version, gocheck.Equals, 2)
+	c.Assert(deploys[0].Success, gocheck.Equals, false)
+	c.Assert(deploys[1].Version, gocheck.Equals, 1)
+	c.Assert(deploys[1].Commit, gocheck.Equals, commit)
+	c.Assert(deploys[1].User, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestDeployListHandlerWithoutDeploys(c *gocheck.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployList(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestDeployListHandlerReturns403IfTheUserDoesNotHaveAccessToTheApp(c *gocheck.C) {
+	a := app.App{Name: "nightmist"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/deploys?:app=%s", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = deployList(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestRollbackHandler(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // checkout
+	s.provisioner.PrepareOutput(nil) // install
+	s.provisioner.PrepareOutput(nil) // loadHooks
+	a := app.App{
+		Name:  "stress",
+		Teams: []string{s.team.Name},
+		Units: []app.Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	err = s.conn.Deploys().Insert(app.Deploy{App: a.Name, Version: 1, Commit: commit, Success: true})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	url := fmt.Sprintf("/apps/%s/rollback/1?:app=%s&:version=1", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "text")
+	result := strings.Replace(recorder.Body.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, "^# ---> Rolling back to version 1.*# ---> Rollback done!##$")
+	cmds := s.provisioner.GetCmds("cd /home/application/current && git checkout -q "+commit, &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	var d app.Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name, "version": 2}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(d.User, gocheck.Equals, s.user.Email)
+}
+
+func (s *S) TestRollbackHandlerInvalidVersion(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/apps/stress/rollback/abc?:app=stress&:version=abc", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "The version must be an integer.")
+}
+
+func (s *S) TestRollbackHandlerVersionNotFound(c *gocheck.C) {
+	a := app.App{Name: "stress", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	url := fmt.Sprintf("/apps/%s/rollback/3?:app=%s&:version=3", a.Name, a.Name)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "App stress does not have the version 3.")
+}
+
+func (s *S) TestRollbackHandlerReturns404IfTheAppDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/apps/unknown/rollback/1?:app=unknown&:version=1", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = rollback(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
 func (s *S) TestAddLogHandler(c *gocheck.C) {
 	a := app.App{
 		Name:      "myapp",
@@ -2462,7 +2942,7 @@ func (s *S) TestgetAppOrErrorWhenUserIsAdmin(c *gocheck.C) {
 		err = s.conn.Users().Remove(bson.M{"email": admin.Email})
 		c.Assert(err, gocheck.IsNil)
 	}(admin, adminTeam)
-	app, err := getApp(a.Name, &admin)
+	app, err := getApp(a.Name, &admin, auth.PermAppRead)
 	c.Assert(err, gocheck.IsNil)
 	err = a.Get()
 	c.Assert(err, gocheck.IsNil)
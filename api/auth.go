@@ -39,6 +39,9 @@ func CreateUser(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return &errors.Http{Code: http.StatusBadRequest, Message: err.Error()}
 	}
+	if err = nativeSchemeRequired(); err != nil {
+		return err
+	}
 	if !validation.ValidateEmail(u.Email) {
 		return &errors.Http{Code: http.StatusPreconditionFailed, Message: emailError}
 	}
@@ -71,34 +74,107 @@ func login(w http.ResponseWriter, r *http.Request) error {
 		msg := "You must provide a password to login"
 		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
 	}
-	u, err := auth.GetUserByEmail(r.URL.Query().Get(":email"))
+	if err = nativeSchemeRequired(); err != nil {
+		return err
+	}
+	params := map[string]string{"email": r.URL.Query().Get(":email"), "password": password}
+	u, err := auth.NativeScheme{}.Authenticate(params)
 	if err != nil {
-		if e, ok := err.(*errors.ValidationError); ok {
-			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
-		}
-		return &errors.Http{Code: http.StatusNotFound, Message: "User not found"}
+		return authenticationError(err)
 	}
-	t, err := u.CreateToken(password)
+	return writeToken(w, u)
+}
+
+// AuthScheme returns the name of the authentication scheme used by the
+// server, and the information that clients need to authenticate with it.
+func AuthScheme(w http.ResponseWriter, r *http.Request) error {
+	name, scheme, err := auth.ActiveScheme()
 	if err != nil {
-		switch err.(type) {
-		case *errors.ValidationError:
-			return &errors.Http{
-				Code:    http.StatusPreconditionFailed,
-				Message: err.(*errors.ValidationError).Message,
-			}
-		case auth.AuthenticationFailure:
-			return &errors.Http{
-				Code:    http.StatusUnauthorized,
-				Message: err.Error(),
-			}
-		default:
+		return err
+	}
+	info, err := scheme.Info()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "data": info})
+}
+
+// SchemeLogin authenticates the user with the authentication scheme used by
+// the server, returning a new token. The request body is a JSON object with
+// the credentials expected by the scheme.
+//
+// Users authenticated by an external provider are registered in tsuru in
+// their first login.
+func SchemeLogin(w http.ResponseWriter, r *http.Request) error {
+	var params map[string]string
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON"}
+	}
+	_, scheme, err := auth.ActiveScheme()
+	if err != nil {
+		return err
+	}
+	u, err := scheme.Authenticate(params)
+	if err != nil {
+		return authenticationError(err)
+	}
+	if _, err = auth.GetUserByEmail(u.Email); err == auth.ErrUserNotFound {
+		if err = registerUser(u); err != nil {
 			return err
 		}
 	}
+	return writeToken(w, u)
+}
+
+// registerUser stores a user authenticated by an external provider in tsuru
+// and in the git server.
+func registerUser(u *auth.User) error {
+	c := gandalf.Client{Endpoint: repository.GitServerUri()}
+	if _, err := c.NewUser(u.Email, keyToMap(u.Keys)); err != nil {
+		return fmt.Errorf("Failed to create user in the git server: %s", err)
+	}
+	return u.Create()
+}
+
+func writeToken(w http.ResponseWriter, u *auth.User) error {
+	t, err := auth.CreateUserToken(u)
+	if err != nil {
+		return err
+	}
 	fmt.Fprintf(w, `{"token":"%s"}`, t.Token)
 	return nil
 }
 
+// nativeSchemeRequired returns an error if the server does not authenticate
+// users with email and password.
+func nativeSchemeRequired() error {
+	name, _, err := auth.ActiveScheme()
+	if err != nil {
+		return err
+	}
+	if name != "native" {
+		msg := fmt.Sprintf("This server authenticates users with the %q scheme, email and password are not accepted.", name)
+		return &errors.Http{Code: http.StatusBadRequest, Message: msg}
+	}
+	return nil
+}
+
+// authenticationError converts errors returned by authentication schemes to
+// HTTP errors.
+func authenticationError(err error) error {
+	switch e := err.(type) {
+	case *errors.ValidationError:
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+	case auth.AuthenticationFailure, auth.OAuthFailure:
+		return &errors.Http{Code: http.StatusUnauthorized, Message: err.Error()}
+	}
+	if err == auth.ErrUserNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
 // ChangePassword changes the password from the logged in user.
 //
 // It reads the request body in JSON format. The JSON in the request body
@@ -110,6 +186,9 @@ func login(w http.ResponseWriter, r *http.Request) error {
 // This handler will return 403 if the password didn't match the user, or 412
 // if the new password is invalid.
 func ChangePassword(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	var body map[string]string
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
@@ -145,6 +224,53 @@ func ChangePassword(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	return u.Update()
 }
 
+// ResetPassword resets the password of a user who forgot it, in two steps.
+// When the request has no token, it sends a reset token to the user by email.
+// When the request has the token (in the querystring), it changes the
+// password of the user. The JSON in the request body should contain one
+// attribute:
+//
+// - password: the new password
+//
+// This handler will return 403 if the token is invalid or expired, or 412 if
+// the new password is invalid.
+//
+// Unknown users get the same responses as existing users, so this handler
+// can't be used to find out whether an account exists: no email is sent to
+// them, and their tokens are always invalid.
+func ResetPassword(w http.ResponseWriter, r *http.Request) error {
+	if err := nativeSchemeRequired(); err != nil {
+		return err
+	}
+	email := r.URL.Query().Get(":email")
+	u, err := auth.GetUserByEmail(email)
+	if err != nil && err != auth.ErrUserNotFound {
+		return authenticationError(err)
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if u == nil {
+			return nil
+		}
+		return u.StartPasswordReset()
+	}
+	if u == nil {
+		u = &auth.User{Email: email}
+	}
+	var body map[string]string
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON."}
+	}
+	if body["password"] == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the new password."}
+	}
+	err = u.ResetPassword(token, body["password"])
+	if err == auth.ErrInvalidPasswordToken {
+		return &errors.Http{Code: http.StatusForbidden, Message: err.Error()}
+	}
+	return authenticationError(err)
+}
+
 // Creates a team and store it in mongodb.
 //
 // Also communicates with git server (gandalf) in order to add the user into it
@@ -157,7 +283,11 @@ func createTeam(name string, u *auth.User) error {
 		return err
 	}
 	defer conn.Close()
-	team := &auth.Team{Name: name, Users: []string{u.Email}}
+	team := &auth.Team{
+		Name:  name,
+		Users: []string{u.Email},
+		Roles: []auth.TeamRole{{User: u.Email, Role: "owner"}},
+	}
 	if err := conn.Teams().Insert(team); err != nil &&
 		strings.Contains(err.Error(), "duplicate key error") {
 		msg := "This team already exists"
@@ -177,6 +307,9 @@ func keyToMap(keys []auth.Key) map[string]string {
 }
 
 func CreateTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	var params map[string]string
 	err := json.NewDecoder(r.Body).Decode(&params)
 	if err != nil {
@@ -196,6 +329,9 @@ func CreateTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 
 // RemoveTeam removes a team document from the database.
 func RemoveTeam(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -209,9 +345,13 @@ Please remove the apps or revoke these accesses, and try again.`
 		return &errors.Http{Code: http.StatusForbidden, Message: msg}
 	}
 	query := bson.M{"_id": name, "users": t.UserEmail}
-	if n, err := conn.Teams().Find(query).Count(); err != nil || n != 1 {
+	var team auth.Team
+	if err := conn.Teams().Find(query).One(&team); err != nil {
 		return &errors.Http{Code: http.StatusNotFound, Message: fmt.Sprintf(`Team "%s" not found.`, name)}
 	}
+	if !team.HasPermission(&auth.User{Email: t.UserEmail}, auth.PermTeamManage) {
+		return permissionDenied(auth.PermTeamManage)
+	}
 	return conn.Teams().Remove(query)
 }
 
@@ -261,6 +401,9 @@ func addUserToTeam(email, teamName string, u *auth.User) error {
 		msg := fmt.Sprintf("You are not authorized to add new users to the team %s", team.Name)
 		return &errors.Http{Code: http.StatusUnauthorized, Message: msg}
 	}
+	if !team.HasPermission(u, auth.PermTeamManage) {
+		return permissionDenied(auth.PermTeamManage)
+	}
 	if err := conn.Users().Find(bson.M{"email": email}).One(user); err != nil {
 		return &errors.Http{Code: http.StatusNotFound, Message: "User not found"}
 	}
@@ -321,6 +464,9 @@ func removeUserFromTeam(email, teamName string, u *auth.User) error {
 		msg := fmt.Sprintf("You are not authorized to remove a member from the team %s", team.Name)
 		return &errors.Http{Code: http.StatusUnauthorized, Message: msg}
 	}
+	if !team.HasPermission(u, auth.PermTeamManage) {
+		return permissionDenied(auth.PermTeamManage)
+	}
 	if len(team.Users) == 1 {
 		msg := "You can not remove this user from this team, because it is the last user within the team, and a team can not be orphaned"
 		return &errors.Http{Code: http.StatusForbidden, Message: msg}
@@ -427,6 +573,9 @@ func addKeyInGandalf(key *auth.Key, u *auth.User) error {
 // exists to be used in other places in the package without the http stuff (request and
 // response).
 func AddKeyToUser(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	key, err := getKeyFromBody(r.Body)
 	if err != nil {
 		return err
@@ -479,6 +628,9 @@ func removeKeyFromGandalf(key *auth.Key, u *auth.User) error {
 // exists to be used in other places in the package without the http stuff (request and
 // response).
 func RemoveKeyFromUser(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	key, err := getKeyFromBody(r.Body)
 	if err != nil {
 		return err
@@ -495,6 +647,9 @@ func RemoveKeyFromUser(w http.ResponseWriter, r *http.Request, t *auth.Token) er
 // In order to successfuly remove a user, it's need that he/she is not the only
 // one in a team, otherwise the function will return an error.
 func RemoveUser(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
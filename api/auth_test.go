@@ -13,6 +13,7 @@ import (
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/errors"
+	tsuruTesting "github.com/globocom/tsuru/testing"
 	"io"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
@@ -397,6 +398,195 @@ func (s *AuthSuite) TestLoginShouldReturnPreconditionFailedWhenPasswordIsInvalid
 	}
 }
 
+func (s *AuthSuite) TestLoginReturnsBadRequestIfTheServerDoesNotUseTheNativeScheme(c *gocheck.C) {
+	config.Set("auth:scheme", "oauth")
+	defer config.Unset("auth:scheme")
+	b := bytes.NewBufferString(`{"password":"123456"}`)
+	request, err := http.NewRequest("POST", "/users/whydidifall@thewho.com/tokens?:email=whydidifall@thewho.com", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = login(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `This server authenticates users with the "oauth" scheme, email and password are not accepted.`)
+}
+
+func (s *AuthSuite) TestCreateUserReturnsBadRequestIfTheServerDoesNotUseTheNativeScheme(c *gocheck.C) {
+	config.Set("auth:scheme", "oauth")
+	defer config.Unset("auth:scheme")
+	b := bytes.NewBufferString(`{"email":"nobody@globo.com","password":"123456"}`)
+	request, err := http.NewRequest("POST", "/users", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateUser(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+// fakeOAuthProvider is an OAuth2 provider that issues an access token for the
+// code "abc123", and identifies the owner of the token by the given email.
+type fakeOAuthProvider struct {
+	email string
+}
+
+func (p *fakeOAuthProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/token":
+		if r.FormValue("code") != "abc123" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"xyz789","token_type":"bearer"}`))
+	case "/user":
+		if r.Header.Get("Authorization") != "Bearer xyz789" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"email":%q}`, p.email)
+	}
+}
+
+func (s *AuthSuite) setOAuthScheme(providerUrl string) func() {
+	config.Set("auth:scheme", "oauth")
+	config.Set("auth:oauth:client-id", "tsuru")
+	config.Set("auth:oauth:client-secret", "s3cr3t")
+	config.Set("auth:oauth:auth-url", providerUrl+"/authorize")
+	config.Set("auth:oauth:token-url", providerUrl+"/token")
+	config.Set("auth:oauth:info-url", providerUrl+"/user")
+	return func() {
+		config.Unset("auth:scheme")
+		for _, name := range []string{"client-id", "client-secret", "auth-url", "token-url", "info-url"} {
+			config.Unset("auth:oauth:" + name)
+		}
+	}
+}
+
+func (s *AuthSuite) TestAuthSchemeNative(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/auth/scheme", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = AuthScheme(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]interface{}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.DeepEquals, map[string]interface{}{"name": "native", "data": nil})
+}
+
+func (s *AuthSuite) TestAuthSchemeOAuth(c *gocheck.C) {
+	defer s.setOAuthScheme("http://sso.tsuru.io")()
+	request, err := http.NewRequest("GET", "/auth/scheme", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = AuthScheme(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result struct {
+		Name string
+		Data map[string]string
+	}
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Name, gocheck.Equals, "oauth")
+	c.Assert(result.Data["authorizeUrl"], gocheck.Equals, "http://sso.tsuru.io/authorize?client_id=tsuru&response_type=code")
+	c.Assert(result.Data["port"], gocheck.Equals, "0")
+}
+
+func (s *AuthSuite) TestSchemeLoginRegistersNewUsers(c *gocheck.C) {
+	h := testHandler{}
+	gts := s.startGandalfTestServer(&h)
+	defer gts.Close()
+	ts := httptest.NewServer(&fakeOAuthProvider{email: "newcomer@globo.com"})
+	defer ts.Close()
+	defer s.setOAuthScheme(ts.URL)()
+	b := bytes.NewBufferString(`{"code":"abc123","redirectUrl":"http://127.0.0.1:4242/"}`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SchemeLogin(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	t, err := auth.GetToken(result["token"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.UserEmail, gocheck.Equals, "newcomer@globo.com")
+	_, err = auth.GetUserByEmail("newcomer@globo.com")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.url, gocheck.DeepEquals, []string{"/user"})
+	c.Assert(string(h.body[0]), gocheck.Equals, `{"name":"newcomer@globo.com","keys":{}}`)
+}
+
+func (s *AuthSuite) TestSchemeLoginDoesNotRegisterKnownUsers(c *gocheck.C) {
+	h := testHandler{}
+	gts := s.startGandalfTestServer(&h)
+	defer gts.Close()
+	ts := httptest.NewServer(&fakeOAuthProvider{email: s.user.Email})
+	defer ts.Close()
+	defer s.setOAuthScheme(ts.URL)()
+	b := bytes.NewBufferString(`{"code":"abc123"}`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SchemeLogin(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	t, err := auth.GetToken(result["token"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(h.url, gocheck.HasLen, 0)
+}
+
+func (s *AuthSuite) TestSchemeLoginReturnsUnauthorizedIfTheProviderRefusesTheCode(c *gocheck.C) {
+	ts := httptest.NewServer(&fakeOAuthProvider{email: s.user.Email})
+	defer ts.Close()
+	defer s.setOAuthScheme(ts.URL)()
+	b := bytes.NewBufferString(`{"code":"wrong"}`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SchemeLogin(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusUnauthorized)
+}
+
+func (s *AuthSuite) TestSchemeLoginWithTheNativeScheme(c *gocheck.C) {
+	u := auth.User{Email: "nobody@globo.com", Password: "123456"}
+	u.Create()
+	b := bytes.NewBufferString(`{"email":"nobody@globo.com","password":"123456"}`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SchemeLogin(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	t, err := auth.GetToken(result["token"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.UserEmail, gocheck.Equals, u.Email)
+}
+
+func (s *AuthSuite) TestSchemeLoginReturnsBadRequestIfItReceivesAnInvalidJson(c *gocheck.C) {
+	b := bytes.NewBufferString(`"invalid":"json"]`)
+	request, err := http.NewRequest("POST", "/auth/login", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SchemeLogin(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
 func (s *AuthSuite) TestCreateTeamHandlerSavesTheTeamInTheDatabaseWithTheAuthenticatedUser(c *gocheck.C) {
 	b := bytes.NewBufferString(`{"name":"timeredbull"}`)
 	request, err := http.NewRequest("POST", "/teams", b)
@@ -602,6 +792,10 @@ func (s *AuthSuite) TestAddUserToTeam(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(t, ContainsUser, s.user)
 	c.Assert(t, ContainsUser, u)
+	c.Assert(t.Role(s.user), gocheck.Equals, "owner")
+	c.Assert(t.Role(u), gocheck.Equals, "developer")
+	c.Assert(t.HasPermission(u, auth.PermTeamManage), gocheck.Equals, false)
+	c.Assert(t.HasPermission(u, auth.PermAppDelete), gocheck.Equals, false)
 }
 
 func (s *AuthSuite) TestAddUserToTeamShouldReturnNotFoundIfThereIsNoTeamWithTheGivenName(c *gocheck.C) {
@@ -710,6 +904,7 @@ func (s *AuthSuite) TestAddUserToTeamInDatabase(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	conn.Teams().FindId(team.Name).One(team)
 	c.Assert(team.Users, gocheck.DeepEquals, []string{user.Email})
+	c.Assert(team.Roles, gocheck.DeepEquals, []auth.TeamRole{{User: user.Email, Role: "developer"}})
 }
 
 func (s *AuthSuite) TestAddUserToTeamInGandalfShouldCallGandalfApi(c *gocheck.C) {
@@ -1372,6 +1567,146 @@ func (s *AuthSuite) TestChangePasswordHandler(c *gocheck.C) {
 	c.Assert(otherUser.Password, gocheck.Not(gocheck.Equals), oldPassword)
 }
 
+func (s *AuthSuite) startSMTPServer(c *gocheck.C) *tsuruTesting.SMTPServer {
+	server, err := tsuruTesting.NewSMTPServer()
+	c.Assert(err, gocheck.IsNil)
+	config.Set("smtp:server", server.Addr())
+	config.Set("smtp:from", "tsuru@globo.com")
+	return server
+}
+
+func (s *AuthSuite) stopSMTPServer(server *tsuruTesting.SMTPServer) {
+	server.Stop()
+	config.Unset("smtp:server")
+	config.Unset("smtp:from")
+}
+
+func (s *AuthSuite) TestResetPasswordSendsTheToken(c *gocheck.C) {
+	server := s.startSMTPServer(c)
+	defer s.stopSMTPServer(server)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	defer conn.PasswordTokens().RemoveAll(bson.M{"useremail": s.user.Email})
+	url := fmt.Sprintf("/users/%s/password?:email=%s", s.user.Email, s.user.Email)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	var token map[string]interface{}
+	err = conn.PasswordTokens().Find(bson.M{"useremail": s.user.Email}).One(&token)
+	c.Assert(err, gocheck.IsNil)
+	messages := server.Messages()
+	c.Assert(messages, gocheck.HasLen, 1)
+	c.Assert(messages[0].To, gocheck.DeepEquals, []string{s.user.Email})
+	c.Assert(strings.Contains(string(messages[0].Data), token["_id"].(string)), gocheck.Equals, true)
+}
+
+func (s *AuthSuite) TestResetPasswordWithToken(c *gocheck.C) {
+	server := s.startSMTPServer(c)
+	defer s.stopSMTPServer(server)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	u := &auth.User{Email: "forgetful@globo.com", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Users().Remove(bson.M{"email": u.Email})
+	login, err := u.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Tokens().Remove(bson.M{"token": login.Token})
+	defer conn.PasswordTokens().RemoveAll(bson.M{"useremail": u.Email})
+	err = u.StartPasswordReset()
+	c.Assert(err, gocheck.IsNil)
+	var token map[string]interface{}
+	err = conn.PasswordTokens().Find(bson.M{"useremail": u.Email}).One(&token)
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/users/%s/password?:email=%s&token=%s", u.Email, u.Email, token["_id"])
+	body := strings.NewReader(`{"password":"654321"}`)
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	u, err = auth.GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.CheckPassword("654321"), gocheck.IsNil)
+	_, err = auth.GetToken(login.Token)
+	c.Assert(err, gocheck.Equals, auth.ErrTokenNotFound)
+}
+
+func (s *AuthSuite) TestResetPasswordWithInvalidToken(c *gocheck.C) {
+	url := fmt.Sprintf("/users/%s/password?:email=%s&token=invalid", s.user.Email, s.user.Email)
+	body := strings.NewReader(`{"password":"654321"}`)
+	request, err := http.NewRequest("POST", url, body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "Invalid or expired password reset token.")
+}
+
+func (s *AuthSuite) TestResetPasswordWithTokenWithoutPassword(c *gocheck.C) {
+	url := fmt.Sprintf("/users/%s/password?:email=%s&token=abc", s.user.Email, s.user.Email)
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "You must provide the new password.")
+}
+
+func (s *AuthSuite) TestResetPasswordUserNotFound(c *gocheck.C) {
+	server := s.startSMTPServer(c)
+	defer s.stopSMTPServer(server)
+	request, err := http.NewRequest("POST", "/users/unknown@globo.com/password?:email=unknown@globo.com", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusOK)
+	c.Assert(server.Messages(), gocheck.HasLen, 0)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	n, err := conn.PasswordTokens().Find(bson.M{"useremail": "unknown@globo.com"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *AuthSuite) TestResetPasswordWithTokenUserNotFound(c *gocheck.C) {
+	url := "/users/unknown@globo.com/password?:email=unknown@globo.com&token=abc"
+	request, err := http.NewRequest("POST", url, strings.NewReader(`{"password":"654321"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "Invalid or expired password reset token.")
+	_, err = auth.GetUserByEmail("unknown@globo.com")
+	c.Assert(err, gocheck.Equals, auth.ErrUserNotFound)
+}
+
+func (s *AuthSuite) TestResetPasswordRequiresTheNativeScheme(c *gocheck.C) {
+	config.Set("auth:scheme", "oauth")
+	defer config.Unset("auth:scheme")
+	url := fmt.Sprintf("/users/%s/password?:email=%s", s.user.Email, s.user.Email)
+	request, err := http.NewRequest("POST", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ResetPassword(recorder, request)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
 func (s *AuthSuite) TestChangePasswordReturns412IfNewPasswordIsInvalid(c *gocheck.C) {
 	conn, _ := db.Conn()
 	defer conn.Close()
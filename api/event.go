@@ -0,0 +1,264 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/event"
+	"github.com/globocom/tsuru/log"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxEventBody is the maximum size of request bodies recorded in
+	// events. Larger bodies are recorded by their size only.
+	maxEventBody = 4096
+
+	// maxEventError is the maximum size of error messages recorded in
+	// events.
+	maxEventError = 512
+)
+
+// auditWriter keeps the status and the beginning of the body of failed
+// responses, so they can be recorded.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	err    bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && w.err.Len() < maxEventError {
+		w.err.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush flushes the underlying ResponseWriter, so streaming handlers keep
+// working when audited.
+func (w *auditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type auditedHandler struct {
+	action  string
+	target  string
+	secrets []string
+	handler http.Handler
+}
+
+// audit returns a handler that records an event for every request handled by
+// h (see event.Event).
+//
+// When target starts with a colon, the target of the event is the route
+// parameter with this name; otherwise it's the field of the JSON body with
+// this name. Besides the params that event.IsSecret considers secret, the
+// values of the body fields listed in secrets are redacted. The secret "*"
+// redacts all the values of the body, keeping only the names of its fields.
+func audit(action, target string, h http.Handler, secrets ...string) http.Handler {
+	return &auditedHandler{action: action, target: target, secrets: secrets, handler: h}
+}
+
+func (h *auditedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	e := event.Event{Action: h.action, Actor: requestActor(r)}
+	e.Params, e.Target = h.params(r, body)
+	aw := auditWriter{ResponseWriter: w}
+	h.handler.ServeHTTP(&aw, r)
+	e.Status = aw.status
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	if e.Status >= 400 {
+		msg := aw.err.String()
+		if len(msg) > maxEventError {
+			msg = msg[:maxEventError]
+		}
+		e.Error = strings.TrimSpace(msg)
+	}
+	if err := event.Record(&e); err != nil {
+		log.Printf("Failed to record the event %q: %s", e.Action, err)
+	}
+}
+
+// requestActor returns the email of the user (or the name of the app) that
+// owns the token of the request, if any.
+func requestActor(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return ""
+	}
+	t, err := auth.GetToken(header)
+	if err != nil {
+		return ""
+	}
+	if t.AppName != "" {
+		return "app:" + t.AppName
+	}
+	return t.UserEmail
+}
+
+// params returns the params and the target of the request. The params are the
+// route parameters and the querystring, sorted by name, followed by the
+// fields of the body.
+func (h *auditedHandler) params(r *http.Request, body []byte) ([]event.Param, string) {
+	var params []event.Param
+	var target string
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(query[name], ",")
+		if name == h.target {
+			target = value
+		}
+		params = append(params, event.Param{Name: strings.TrimPrefix(name, ":"), Value: value})
+	}
+	if len(body) == 0 {
+		return params, target
+	}
+	if len(body) > maxEventBody {
+		value := fmt.Sprintf("(%d bytes)", len(body))
+		return append(params, event.Param{Name: "body", Value: value}), target
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		value := string(body)
+		if h.isSecret("*") {
+			value = event.Redacted
+		}
+		return append(params, event.Param{Name: "body", Value: value}), target
+	}
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		value := event.Redacted
+		if !h.isSecret("*") {
+			value = paramValue(redactSecrets(decoded))
+		}
+		return append(params, event.Param{Name: "body", Value: value}), target
+	}
+	names = make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := paramValue(redactSecrets(fields[name]))
+		if name == h.target {
+			target = value
+		}
+		if h.isSecret(name) {
+			value = event.Redacted
+		}
+		params = append(params, event.Param{Name: name, Value: value})
+	}
+	return params, target
+}
+
+func (h *auditedHandler) isSecret(name string) bool {
+	for _, secret := range h.secrets {
+		if secret == "*" || secret == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecrets redacts the secrets nested in JSON objects.
+func redactSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if event.IsSecret(name) {
+				v[name] = event.Redacted
+			} else {
+				v[name] = redactSecrets(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactSecrets(item)
+		}
+	}
+	return value
+}
+
+func paramValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// ListEvents lists the audit events, filtered by the target and actor
+// parameters in the querystring. Admins can list every event. Other users can
+// list every event of the apps they have access to, and only their own events
+// of other targets.
+func ListEvents(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	target := r.URL.Query().Get("target")
+	actor := r.URL.Query().Get("actor")
+	if !u.IsAdmin() && !canListEventsOf(target, u) {
+		if actor != "" && actor != u.Email {
+			msg := "You can only list the events of other users on apps you have access to."
+			return &errors.Http{Code: http.StatusForbidden, Message: msg}
+		}
+		actor = u.Email
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := event.List(target, actor, limit)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+// canListEventsOf checks whether the user can list the events of the given
+// target performed by any user, which is the case when the target is an app
+// that the user can read.
+func canListEventsOf(target string, u *auth.User) bool {
+	if target == "" {
+		return false
+	}
+	_, err := getApp(target, u, auth.PermAppRead)
+	return err == nil
+}
@@ -12,8 +12,11 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	_ "github.com/globocom/tsuru/provision/docker"
 	_ "github.com/globocom/tsuru/provision/juju"
 	_ "github.com/globocom/tsuru/provision/local"
+	_ "github.com/globocom/tsuru/router/hipache"
+	"github.com/globocom/tsuru/service"
 	stdlog "log"
 	"log/syslog"
 	"net"
@@ -52,37 +55,48 @@ func main() {
 	m := pat.New()
 
 	m.Get("/services/instances", authorizationRequiredHandler(ServicesInstancesHandler))
-	m.Post("/services/instances", authorizationRequiredHandler(CreateInstanceHandler))
-	m.Put("/services/instances/:instance/:app", authorizationRequiredHandler(bindServiceInstance))
-	m.Del("/services/instances/:instance/:app", authorizationRequiredHandler(unbindServiceInstance))
-	m.Del("/services/c/instances/:name", authorizationRequiredHandler(RemoveServiceInstanceHandler))
+	m.Post("/services/instances", audit("service.instance.create", "name", authorizationRequiredHandler(CreateInstanceHandler)))
+	m.Put("/services/instances/:instance/teams/:team", audit("service.instance.grant", ":instance", authorizationRequiredHandler(GrantServiceInstanceAccessToTeamHandler)))
+	m.Del("/services/instances/:instance/teams/:team", audit("service.instance.revoke", ":instance", authorizationRequiredHandler(RevokeServiceInstanceAccessFromTeamHandler)))
+	m.Put("/services/instances/:instance/:app", audit("app.bind", ":app", authorizationRequiredHandler(bindServiceInstance)))
+	m.Del("/services/instances/:instance/:app", audit("app.unbind", ":app", authorizationRequiredHandler(unbindServiceInstance)))
+	m.Del("/services/c/instances/:name", audit("service.instance.remove", ":name", authorizationRequiredHandler(RemoveServiceInstanceHandler)))
 	m.Get("/services/instances/:instance/status", authorizationRequiredHandler(ServiceInstanceStatusHandler))
+	m.Get("/services/proxy/:instance", authorizationRequiredHandler(ServiceInstanceProxyHandler))
+	m.Post("/services/proxy/:instance", audit("service.instance.proxy", ":instance", authorizationRequiredHandler(ServiceInstanceProxyHandler), "*"))
+	m.Put("/services/proxy/:instance", audit("service.instance.proxy", ":instance", authorizationRequiredHandler(ServiceInstanceProxyHandler), "*"))
+	m.Del("/services/proxy/:instance", audit("service.instance.proxy", ":instance", authorizationRequiredHandler(ServiceInstanceProxyHandler), "*"))
 
 	m.Get("/services", authorizationRequiredHandler(ServicesHandler))
-	m.Post("/services", authorizationRequiredHandler(CreateHandler))
-	m.Put("/services", authorizationRequiredHandler(UpdateHandler))
-	m.Del("/services/:name", authorizationRequiredHandler(DeleteHandler))
+	m.Get("/services/catalog", authorizationRequiredHandler(ServiceCatalogHandler))
+	m.Post("/services", audit("service.create", "", authorizationRequiredHandler(CreateHandler), "*"))
+	m.Put("/services", audit("service.update", "", authorizationRequiredHandler(UpdateHandler), "*"))
+	m.Del("/services/:name", audit("service.remove", ":name", authorizationRequiredHandler(DeleteHandler)))
 	m.Get("/services/:name", authorizationRequiredHandler(ServiceInfoHandler))
 	m.Get("/services/c/:name/doc", authorizationRequiredHandler(Doc))
+	m.Get("/services/:name/plans", authorizationRequiredHandler(ServicePlansHandler))
 	m.Get("/services/:name/doc", authorizationRequiredHandler(GetDocHandler))
-	m.Put("/services/:name/doc", authorizationRequiredHandler(AddDocHandler))
-	m.Put("/services/:service/:team", authorizationRequiredHandler(GrantServiceAccessToTeamHandler))
-	m.Del("/services/:service/:team", authorizationRequiredHandler(RevokeServiceAccessFromTeamHandler))
+	m.Put("/services/:name/doc", audit("service.doc.update", ":name", authorizationRequiredHandler(AddDocHandler)))
+	m.Put("/services/:service/:team", audit("service.grant", ":service", authorizationRequiredHandler(GrantServiceAccessToTeamHandler)))
+	m.Del("/services/:service/:team", audit("service.revoke", ":service", authorizationRequiredHandler(RevokeServiceAccessFromTeamHandler)))
 
-	m.Del("/apps/:app", authorizationRequiredHandler(appDelete))
+	m.Del("/apps/:app", audit("app.remove", ":app", authorizationRequiredHandler(appDelete)))
 	m.Get("/apps/:app", authorizationRequiredHandler(appInfo))
-	m.Post("/apps/:app", authorizationRequiredHandler(setCName))
-	m.Post("/apps/:app/run", authorizationRequiredHandler(runCommand))
-	m.Get("/apps/:app/restart", authorizationRequiredHandler(restart))
+	m.Post("/apps/:app", audit("app.cname", ":app", authorizationRequiredHandler(setCName)))
+	m.Post("/apps/:app/run", audit("app.run", ":app", authorizationRequiredHandler(runCommand)))
+	m.Get("/apps/:app/restart", audit("app.restart", ":app", authorizationRequiredHandler(restart)))
+	m.Post("/apps/:app/deploy", audit("app.deploy", ":app", authorizationRequiredHandler(deploy)))
+	m.Get("/apps/:app/deploys", authorizationRequiredHandler(deployList))
+	m.Post("/apps/:app/rollback/:version", audit("app.rollback", ":app", authorizationRequiredHandler(rollback)))
 	m.Get("/apps/:app/env", authorizationRequiredHandler(getEnv))
-	m.Post("/apps/:app/env", authorizationRequiredHandler(setEnv))
-	m.Del("/apps/:app/env", authorizationRequiredHandler(unsetEnv))
+	m.Post("/apps/:app/env", audit("app.env.set", ":app", authorizationRequiredHandler(setEnv), "*"))
+	m.Del("/apps/:app/env", audit("app.env.unset", ":app", authorizationRequiredHandler(unsetEnv)))
 	m.Get("/apps", authorizationRequiredHandler(appList))
-	m.Post("/apps", authorizationRequiredHandler(createApp))
-	m.Put("/apps/:app/units", authorizationRequiredHandler(addUnits))
-	m.Del("/apps/:app/units", authorizationRequiredHandler(removeUnits))
-	m.Put("/apps/:app/:team", authorizationRequiredHandler(grantAccessToTeam))
-	m.Del("/apps/:app/:team", authorizationRequiredHandler(revokeAccessFromTeam))
+	m.Post("/apps", audit("app.create", "name", authorizationRequiredHandler(createApp)))
+	m.Put("/apps/:app/units", audit("app.units.add", ":app", authorizationRequiredHandler(addUnits)))
+	m.Del("/apps/:app/units", audit("app.units.remove", ":app", authorizationRequiredHandler(removeUnits)))
+	m.Put("/apps/:app/:team", audit("app.grant", ":app", authorizationRequiredHandler(grantAccessToTeam)))
+	m.Del("/apps/:app/:team", audit("app.revoke", ":app", authorizationRequiredHandler(revokeAccessFromTeam)))
 	m.Get("/apps/:app/log", authorizationRequiredHandler(appLog))
 	m.Post("/apps/:app/log", authorizationRequiredHandler(addLog))
 
@@ -92,20 +106,33 @@ func main() {
 	m.Get("/apps/:appname/avaliable", authorizationRequiredHandler(appIsAvailable))
 	m.Get("/apps/:appname/repository/clone", authorizationRequiredHandler(cloneRepository))
 
-	m.Post("/users", handler(CreateUser))
-	m.Post("/users/:email/tokens", handler(login))
-	m.Put("/users/password", authorizationRequiredHandler(ChangePassword))
-	m.Del("/users", authorizationRequiredHandler(RemoveUser))
-	m.Post("/users/keys", authorizationRequiredHandler(AddKeyToUser))
-	m.Del("/users/keys", authorizationRequiredHandler(RemoveKeyFromUser))
+	m.Post("/users", audit("user.create", "email", handler(CreateUser)))
+	m.Post("/users/:email/tokens", audit("user.login", ":email", handler(login)))
+	m.Post("/users/:email/password", audit("user.password.reset", ":email", handler(ResetPassword)))
+	m.Get("/auth/scheme", handler(AuthScheme))
+	m.Post("/auth/login", audit("user.login", "email", handler(SchemeLogin), "code"))
+	m.Put("/users/password", audit("user.password.change", "", authorizationRequiredHandler(ChangePassword), "old", "new"))
+	m.Get("/users/tokens", authorizationRequiredHandler(ListTokens))
+	m.Post("/users/tokens", audit("user.token.create", "name", authorizationRequiredHandler(CreatePersonalToken)))
+	m.Del("/users/tokens", audit("user.token.revoke", "id", authorizationRequiredHandler(RevokeToken)))
+	m.Del("/users", audit("user.remove", "", authorizationRequiredHandler(RemoveUser)))
+	m.Post("/users/keys", audit("user.key.add", "", authorizationRequiredHandler(AddKeyToUser)))
+	m.Del("/users/keys", audit("user.key.remove", "", authorizationRequiredHandler(RemoveKeyFromUser)))
 
-	m.Post("/tokens", adminRequiredHandler(generateAppToken))
+	m.Post("/tokens", audit("app.token.create", "client", adminRequiredHandler(generateAppToken)))
 
 	m.Get("/teams", authorizationRequiredHandler(ListTeams))
-	m.Post("/teams", authorizationRequiredHandler(CreateTeam))
-	m.Del("/teams/:name", authorizationRequiredHandler(RemoveTeam))
-	m.Put("/teams/:team/:user", authorizationRequiredHandler(AddUserToTeam))
-	m.Del("/teams/:team/:user", authorizationRequiredHandler(RemoveUserFromTeam))
+	m.Post("/teams", audit("team.create", "name", authorizationRequiredHandler(CreateTeam)))
+	m.Del("/teams/:name", audit("team.remove", ":name", authorizationRequiredHandler(RemoveTeam)))
+	m.Put("/teams/:team/:user", audit("team.user.add", ":team", authorizationRequiredHandler(AddUserToTeam)))
+	m.Del("/teams/:team/:user", audit("team.user.remove", ":team", authorizationRequiredHandler(RemoveUserFromTeam)))
+	m.Put("/teams/:team/:user/role/:role", audit("team.user.role", ":team", authorizationRequiredHandler(SetTeamUserRole)))
+
+	m.Get("/roles", authorizationRequiredHandler(ListRoles))
+	m.Post("/roles", audit("role.create", "name", adminRequiredHandler(CreateRole)))
+	m.Del("/roles/:name", audit("role.remove", ":name", adminRequiredHandler(RemoveRole)))
+
+	m.Get("/events", authorizationRequiredHandler(ListEvents))
 
 	m.Get("/healers", authorizationRequiredHandler(healers))
 	m.Get("/healers/:healer", authorizationRequiredHandler(healer))
@@ -121,6 +148,7 @@ func main() {
 			fatal(err)
 		}
 		fmt.Printf("Using %q provisioner.\n\n", provisioner)
+		service.StartHandler()
 
 		listen, err := config.GetString("listen")
 		if err != nil {
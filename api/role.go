@@ -0,0 +1,123 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+)
+
+func permissionDenied(perm auth.Permission) error {
+	msg := fmt.Sprintf("Permission denied: your role does not grant the permission %q.", perm)
+	return &errors.Http{Code: http.StatusForbidden, Message: msg}
+}
+
+// checkPermission checks that the user is a member of at least one of the
+// teams, with a role that grants the given permission. The noAccess message is
+// used in the error returned when the user is not a member of any of the
+// teams.
+func checkPermission(teams []string, u *auth.User, perm auth.Permission, noAccess string) error {
+	if !auth.CheckUserAccess(teams, u) {
+		return &errors.Http{Code: http.StatusForbidden, Message: noAccess}
+	}
+	if !auth.CheckUserPermission(teams, u, perm) {
+		return permissionDenied(perm)
+	}
+	return nil
+}
+
+// teamsWithPermission filters the teams in which the user has the given
+// permission.
+func teamsWithPermission(teams []auth.Team, u *auth.User, perm auth.Permission) []auth.Team {
+	var allowed []auth.Team
+	for _, team := range teams {
+		if team.HasPermission(u, perm) {
+			allowed = append(allowed, team)
+		}
+	}
+	return allowed
+}
+
+func roleError(err error) error {
+	if e, ok := err.(*errors.ValidationError); ok {
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+	}
+	if err == auth.ErrRoleNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// ListRoles returns the built-in and custom roles, along with their
+// permissions.
+func ListRoles(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	roles, err := auth.ListRoles()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(roles)
+}
+
+// CreateRole creates a custom role. The body of the request must contain the
+// name and the permissions of the role in JSON format.
+func CreateRole(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	var role auth.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	if err := auth.CreateRole(&role); err != nil {
+		return roleError(err)
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// RemoveRole removes a custom role, provided that it's not assigned to the
+// members of any team.
+func RemoveRole(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	return roleError(auth.RemoveRole(r.URL.Query().Get(":name")))
+}
+
+// SetTeamUserRole assigns a role to a member of a team. It requires the
+// team.manage permission in the team, and can't be used with personal access
+// tokens.
+func SetTeamUserRole(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var team auth.Team
+	if err = conn.Teams().FindId(r.URL.Query().Get(":team")).One(&team); err != nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: "Team not found"}
+	}
+	if !team.ContainsUser(u) {
+		msg := fmt.Sprintf("You are not authorized to manage the roles of the team %s", team.Name)
+		return &errors.Http{Code: http.StatusUnauthorized, Message: msg}
+	}
+	if !team.HasPermission(u, auth.PermTeamManage) {
+		return permissionDenied(auth.PermTeamManage)
+	}
+	member := &auth.User{Email: r.URL.Query().Get(":user")}
+	if err = team.SetRole(member, r.URL.Query().Get(":role")); err != nil {
+		if _, ok := err.(*errors.ValidationError); ok || err == auth.ErrRoleNotFound {
+			return roleError(err)
+		}
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return conn.Teams().UpdateId(team.Name, team)
+}
@@ -0,0 +1,351 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// createMemberWithRole creates the user "intern@globo.com" as member of the
+// team "interns", with the given role, returning the token of the user.
+func createMemberWithRole(c *gocheck.C, role string) (*auth.Token, *auth.Team) {
+	conn, err := db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	defer conn.Close()
+	u := &auth.User{Email: "intern@globo.com", Password: "123456"}
+	err = u.Create()
+	c.Assert(err, gocheck.IsNil)
+	token, err := u.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	team := &auth.Team{
+		Name:  "interns",
+		Users: []string{u.Email},
+		Roles: []auth.TeamRole{{User: u.Email, Role: role}},
+	}
+	err = conn.Teams().Insert(team)
+	c.Assert(err, gocheck.IsNil)
+	return token, team
+}
+
+func removeMember(token *auth.Token, team *auth.Team) {
+	conn, _ := db.Conn()
+	defer conn.Close()
+	conn.Users().Remove(bson.M{"email": token.UserEmail})
+	conn.Tokens().Remove(bson.M{"token": token.Token})
+	conn.Teams().RemoveId(team.Name)
+}
+
+func (s *S) TestAppDeleteRequiresThePermission(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "developer")
+	defer removeMember(token, team)
+	a := app.App{Name: "production-app", Teams: []string{team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"?:app="+a.Name, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appDelete(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e, gocheck.ErrorMatches, `^Permission denied: your role does not grant the permission "app.delete".$`)
+	n, err := s.conn.Apps().Find(bson.M{"name": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestSetEnvRequiresThePermission(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "viewer")
+	defer removeMember(token, team)
+	a := app.App{Name: "black-dog", Teams: []string{team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	b := strings.NewReader(`{"DATABASE_HOST":"localhost"}`)
+	request, err := http.NewRequest("POST", "/apps/black-dog/env?:app=black-dog", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = setEnv(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e, gocheck.ErrorMatches, `^Permission denied: your role does not grant the permission "app.env.set".$`)
+}
+
+func (s *S) TestAppInfoWithTheViewerRole(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "viewer")
+	defer removeMember(token, team)
+	a := app.App{Name: "black-dog", Teams: []string{team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	request, err := http.NewRequest("GET", "/apps/black-dog?:app=black-dog", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appInfo(recorder, request, token)
+	c.Assert(err, gocheck.IsNil)
+	var got app.App
+	err = json.NewDecoder(recorder.Body).Decode(&got)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.Name, gocheck.Equals, a.Name)
+}
+
+func (s *S) TestCreateAppRequiresThePermissionInAtLeastOneTeam(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "viewer")
+	defer removeMember(token, team)
+	b := strings.NewReader(`{"name":"someapp","framework":"django"}`)
+	request, err := http.NewRequest("POST", "/apps", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = createApp(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e, gocheck.ErrorMatches, `^Permission denied: your role does not grant the permission "app.create".$`)
+	n, err := s.conn.Apps().Find(bson.M{"name": "someapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *AuthSuite) TestCreateTeamMakesTheCreatorOwner(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"timeredbull"}`)
+	request, err := http.NewRequest("POST", "/teams", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateTeam(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	var team auth.Team
+	err = conn.Teams().FindId("timeredbull").One(&team)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(team.Roles, gocheck.DeepEquals, []auth.TeamRole{{User: s.user.Email, Role: "owner"}})
+}
+
+func (s *AuthSuite) TestAddUserToTeamRequiresTeamManage(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "developer")
+	defer removeMember(token, team)
+	url := "/teams/interns/whydidifall@thewho.com?:team=interns&:user=whydidifall@thewho.com"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = AddUserToTeam(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e, gocheck.ErrorMatches, `^Permission denied: your role does not grant the permission "team.manage".$`)
+}
+
+func (s *AuthSuite) TestRemoveTeamRequiresTeamManage(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "developer")
+	defer removeMember(token, team)
+	request, err := http.NewRequest("DELETE", "/teams/interns?:name=interns", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveTeam(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	n, err := conn.Teams().FindId(team.Name).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *AuthSuite) TestListRoles(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/roles", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ListRoles(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var roles []auth.Role
+	err = json.NewDecoder(recorder.Body).Decode(&roles)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(roles, gocheck.HasLen, 3)
+	c.Assert(roles[2], gocheck.DeepEquals, auth.Role{Name: "viewer", Permissions: []auth.Permission{"app.read", "service.read", "service.instance.read"}})
+}
+
+func (s *AuthSuite) TestCreateRole(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"deployer","permissions":["app.read","app.deploy"]}`)
+	request, err := http.NewRequest("POST", "/roles", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	conn, _ := db.Conn()
+	defer conn.Close()
+	defer conn.Roles().RemoveId("deployer")
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusCreated)
+	role, err := auth.GetRole("deployer")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(role.Permissions, gocheck.DeepEquals, []auth.Permission{auth.PermAppRead, auth.PermAppDeploy})
+}
+
+func (s *AuthSuite) TestCreateRoleWithUnknownPermission(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"deployer","permissions":["app.fly"]}`)
+	request, err := http.NewRequest("POST", "/roles", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusPreconditionFailed)
+	c.Assert(e, gocheck.ErrorMatches, `^Unknown permission: "app.fly".$`)
+}
+
+func (s *AuthSuite) TestCreateRoleWithInvalidJSON(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/roles", strings.NewReader("{"))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *AuthSuite) TestRemoveRole(c *gocheck.C) {
+	err := auth.CreateRole(&auth.Role{Name: "deployer", Permissions: []auth.Permission{auth.PermAppDeploy}})
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("DELETE", "/roles/deployer?:name=deployer", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = auth.GetRole("deployer")
+	c.Assert(err, gocheck.Equals, auth.ErrRoleNotFound)
+}
+
+func (s *AuthSuite) TestRemoveRoleNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/roles/deployer?:name=deployer", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RemoveRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestSetTeamUserRole(c *gocheck.C) {
+	conn, _ := db.Conn()
+	defer conn.Close()
+	team := auth.Team{Name: "rush", Users: []string{s.user.Email, "geddy@rush.com"}}
+	err := conn.Teams().Insert(team)
+	c.Assert(err, gocheck.IsNil)
+	url := "/teams/rush/geddy@rush.com/role/viewer?:team=rush&:user=geddy@rush.com&:role=viewer"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = conn.Teams().FindId(team.Name).One(&team)
+	c.Assert(err, gocheck.IsNil)
+	expected := []auth.TeamRole{
+		{User: s.user.Email, Role: "owner"},
+		{User: "geddy@rush.com", Role: "viewer"},
+	}
+	c.Assert(team.Roles, gocheck.DeepEquals, expected)
+}
+
+func (s *AuthSuite) TestSetTeamUserRoleOfTheLastManager(c *gocheck.C) {
+	conn, _ := db.Conn()
+	defer conn.Close()
+	team := auth.Team{
+		Name:  "rush",
+		Users: []string{s.user.Email, "geddy@rush.com"},
+		Roles: []auth.TeamRole{{User: s.user.Email, Role: "owner"}, {User: "geddy@rush.com", Role: "developer"}},
+	}
+	err := conn.Teams().Insert(team)
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/teams/rush/%s/role/viewer?:team=rush&:user=%s&:role=viewer", s.user.Email, s.user.Email)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusPreconditionFailed)
+	c.Assert(e.Message, gocheck.Equals, s.user.Email+" is the last member allowed to manage the team rush.")
+	err = conn.Teams().FindId(team.Name).One(&team)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(team.Role(s.user), gocheck.Equals, "owner")
+}
+
+func (s *AuthSuite) TestSetTeamUserRoleRequiresLoginToken(c *gocheck.C) {
+	token, err := auth.CreatePersonalToken(s.user, "roles", 24*time.Hour, nil, []auth.Permission{auth.PermTeamManage})
+	c.Assert(err, gocheck.IsNil)
+	defer auth.DeleteToken(token.Token)
+	url := "/teams/tsuruteam/whydidifall@thewho.com/role/viewer?:team=tsuruteam&:user=whydidifall@thewho.com&:role=viewer"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestSetTeamUserRoleWithUnknownRole(c *gocheck.C) {
+	url := "/teams/tsuruteam/whydidifall@thewho.com/role/intern?:team=tsuruteam&:user=whydidifall@thewho.com&:role=intern"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e, gocheck.ErrorMatches, "^Role not found$")
+}
+
+func (s *AuthSuite) TestSetTeamUserRoleToUserOutsideTheTeam(c *gocheck.C) {
+	url := "/teams/tsuruteam/geddy@rush.com/role/viewer?:team=tsuruteam&:user=geddy@rush.com&:role=viewer"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *AuthSuite) TestSetTeamUserRoleRequiresTeamManage(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "developer")
+	defer removeMember(token, team)
+	url := "/teams/interns/intern@globo.com/role/owner?:team=interns&:user=intern@globo.com&:role=owner"
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = SetTeamUserRole(recorder, request, token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e, gocheck.ErrorMatches, `^Permission denied: your role does not grant the permission "team.manage".$`)
+}
@@ -45,15 +45,34 @@ func CreateInstanceHandler(w http.ResponseWriter, r *http.Request, t *auth.Token
 			teamNames = append(teamNames, t.Name)
 		}
 	}
+	if plan := sJson["plan"]; plan != "" {
+		if _, err = s.FindPlan(plan); err != nil {
+			return &errors.Http{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
 	si := service.ServiceInstance{
 		Name:        sJson["name"],
 		ServiceName: sJson["service_name"],
+		PlanName:    sJson["plan"],
+		TeamOwner:   sJson["owner"],
 		Teams:       teamNames,
 	}
+	if si.TeamOwner == "" && len(teamNames) > 0 {
+		si.TeamOwner = teamNames[0]
+	} else if si.TeamOwner != "" && !si.HasTeam(si.TeamOwner) {
+		msg := fmt.Sprintf("You cannot create a service instance owned by the team %q.", si.TeamOwner)
+		return &errors.Http{Code: http.StatusForbidden, Message: msg}
+	}
+	if si.TeamOwner != "" && !auth.CheckUserPermission([]string{si.TeamOwner}, u, auth.PermServiceInstanceCreate) {
+		return permissionDenied(auth.PermServiceInstanceCreate)
+	}
 	err = service.CreateInstance(&si)
 	if err != nil {
 		return err
 	}
+	if si.State == service.StatePending {
+		w.WriteHeader(http.StatusAccepted)
+	}
 	fmt.Fprint(w, "success")
 	return nil
 }
@@ -73,7 +92,7 @@ func validateInstanceForCreation(s *service.Service, sJson map[string]string, u
 		}
 		return &errors.Http{Code: http.StatusNotFound, Message: msg}
 	}
-	_, err = getServiceOrError(sJson["service_name"], u)
+	_, err = getServiceOrError(sJson["service_name"], u, auth.PermServiceInstanceCreate)
 	if err != nil {
 		return err
 	}
@@ -86,7 +105,7 @@ func RemoveServiceInstanceHandler(w http.ResponseWriter, r *http.Request, t *aut
 		return err
 	}
 	name := r.URL.Query().Get(":name")
-	si, err := getServiceInstanceOrError(name, u)
+	si, err := getServiceInstanceOrError(name, u, auth.PermServiceInstanceDelete)
 	if err != nil {
 		return err
 	}
@@ -115,17 +134,97 @@ func ServicesInstancesHandler(w http.ResponseWriter, r *http.Request, t *auth.To
 	return err
 }
 
+// getServiceInstanceAndTeam returns the given instance and team, checking
+// that the user has the service.instance.access permission in the team that
+// owns the instance. Instances created before owner teams existed have no
+// owner, in this case the permission is required in any of their teams.
+func getServiceInstanceAndTeam(instanceName, teamName string, u *auth.User) (service.ServiceInstance, *auth.Team, error) {
+	si, err := getServiceInstanceOrError(instanceName, u, auth.PermServiceInstanceRead)
+	if err != nil {
+		return si, nil, err
+	}
+	owners := si.Teams
+	if si.TeamOwner != "" {
+		owners = []string{si.TeamOwner}
+	}
+	msg := "Only members of the team that owns this service instance can manage its teams."
+	if err = checkPermission(owners, u, auth.PermServiceInstanceAccess, msg); err != nil {
+		return si, nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return si, nil, err
+	}
+	defer conn.Close()
+	var team auth.Team
+	err = conn.Teams().Find(bson.M{"_id": teamName}).One(&team)
+	if err != nil {
+		return si, nil, &errors.Http{Code: http.StatusNotFound, Message: "Team not found"}
+	}
+	return si, &team, nil
+}
+
+// GrantServiceInstanceAccessToTeamHandler allows a team to access a service
+// instance, binding it to the apps of the team.
+func GrantServiceInstanceAccessToTeamHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	si, team, err := getServiceInstanceAndTeam(r.URL.Query().Get(":instance"), r.URL.Query().Get(":team"), u)
+	if err != nil {
+		return err
+	}
+	if err = si.GrantAccess(team.Name); err != nil {
+		return &errors.Http{Code: http.StatusConflict, Message: err.Error()}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ServiceInstances().Update(bson.M{"name": si.Name}, si)
+}
+
+// RevokeServiceInstanceAccessFromTeamHandler revokes the access of a team to
+// a service instance. The access of the team that owns the instance cannot be
+// revoked.
+func RevokeServiceInstanceAccessFromTeamHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	si, team, err := getServiceInstanceAndTeam(r.URL.Query().Get(":instance"), r.URL.Query().Get(":team"), u)
+	if err != nil {
+		return err
+	}
+	if team.Name == si.TeamOwner {
+		msg := "You cannot revoke the access of the team that owns this service instance."
+		return &errors.Http{Code: http.StatusForbidden, Message: msg}
+	}
+	if err = si.RevokeAccess(team.Name); err != nil {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.ServiceInstances().Update(bson.M{"name": si.Name}, si)
+}
+
 func ServiceInstanceStatusHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
-	// #TODO (flaviamissi) should check if user has access to service
-	// just call GetServiceInstanceOrError should be enough
 	siName := r.URL.Query().Get(":instance")
 	if siName == "" {
 		return &errors.Http{Code: http.StatusBadRequest, Message: "Service instance name not provided."}
 	}
-	si, err := service.GetInstance(siName)
+	u, err := t.User()
 	if err != nil {
-		msg := fmt.Sprintf("Service instance does not exists, error: %s", err.Error())
-		return &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+		return err
+	}
+	si, err := getServiceInstanceOrError(siName, u, auth.PermServiceInstanceRead)
+	if err != nil {
+		return err
 	}
 	var b string
 	if b, err = si.Status(); err != nil {
@@ -140,13 +239,48 @@ func ServiceInstanceStatusHandler(w http.ResponseWriter, r *http.Request, t *aut
 	return nil
 }
 
+// ServiceInstanceProxyHandler forwards the request to the api of the service of
+// the instance, on the path given in the callback parameter. It allows service
+// providers to expose custom operations to the teams that have access to the
+// instance.
+func ServiceInstanceProxyHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	si, err := getServiceInstanceOrError(r.URL.Query().Get(":instance"), u, auth.PermServiceInstanceProxy)
+	if err != nil {
+		return err
+	}
+	callback := r.URL.Query().Get("callback")
+	if callback == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the callback parameter."}
+	}
+	return si.Proxy(callback, w, r)
+}
+
+// ServiceCatalogHandler lists the services available to the user that match
+// the query given in the q parameter, along with their catalog metadata.
+func ServiceCatalogHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	entries, err := service.SearchCatalog(u, r.URL.Query().Get("q"))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(entries)
+}
+
 func ServiceInfoHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
 	serviceName := r.URL.Query().Get(":name")
-	_, err = getServiceOrError(serviceName, u)
+	_, err = getServiceOrError(serviceName, u, auth.PermServiceRead)
 	if err != nil {
 		return err
 	}
@@ -174,13 +308,33 @@ func ServiceInfoHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) e
 	return nil
 }
 
+// ServicePlansHandler returns the plans offered by a service, in JSON format.
+func ServicePlansHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	s, err := getServiceOrError(r.URL.Query().Get(":name"), u, auth.PermServiceRead)
+	if err != nil {
+		return err
+	}
+	plans, err := s.GetPlans()
+	if err != nil {
+		return err
+	}
+	if plans == nil {
+		plans = []service.Plan{}
+	}
+	return json.NewEncoder(w).Encode(plans)
+}
+
 func Doc(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
 	sName := r.URL.Query().Get(":name")
-	s, err := getServiceOrError(sName, u)
+	s, err := getServiceOrError(sName, u, auth.PermServiceRead)
 	if err != nil {
 		return err
 	}
@@ -188,7 +342,7 @@ func Doc(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	return nil
 }
 
-func getServiceOrError(name string, u *auth.User) (service.Service, error) {
+func getServiceOrError(name string, u *auth.User, perm auth.Permission) (service.Service, error) {
 	s := service.Service{Name: name}
 	err := s.Get()
 	if err != nil {
@@ -197,23 +351,15 @@ func getServiceOrError(name string, u *auth.User) (service.Service, error) {
 	if !s.IsRestricted {
 		return s, nil
 	}
-	if !auth.CheckUserAccess(s.Teams, u) {
-		msg := "This user does not have access to this service"
-		return s, &errors.Http{Code: http.StatusForbidden, Message: msg}
-	}
-	return s, err
+	return s, checkPermission(s.Teams, u, perm, "This user does not have access to this service")
 }
 
-func getServiceInstanceOrError(name string, u *auth.User) (service.ServiceInstance, error) {
+func getServiceInstanceOrError(name string, u *auth.User, perm auth.Permission) (service.ServiceInstance, error) {
 	si, err := service.GetInstance(name)
 	if err != nil {
 		return si, &errors.Http{Code: http.StatusNotFound, Message: "Service instance not found"}
 	}
-	if !auth.CheckUserAccess(si.Teams, u) {
-		msg := "This user does not have access to this service instance"
-		return si, &errors.Http{Code: http.StatusForbidden, Message: msg}
-	}
-	return si, nil
+	return si, checkPermission(si.Teams, u, perm, "This user does not have access to this service instance")
 }
 
 func serviceAndServiceInstancesByTeams(u *auth.User) []service.ServiceModel {
@@ -224,7 +370,7 @@ func serviceAndServiceInstancesByTeams(u *auth.User) []service.ServiceModel {
 		results[i].Service = s.Name
 		for _, si := range sInstances {
 			if si.ServiceName == s.Name {
-				results[i].Instances = append(results[i].Instances, si.Name)
+				results[i].AddInstance(si)
 			}
 		}
 	}
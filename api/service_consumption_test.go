@@ -33,6 +33,7 @@ func (s *ConsumptionSuite) SetUpSuite(c *gocheck.C) {
 	var err error
 	config.Set("database:url", "127.0.0.1:27017")
 	config.Set("database:name", "tsuru_api_consumption_test")
+	config.Set("queue", "fake")
 	s.conn, err = db.Conn()
 	c.Assert(err, gocheck.IsNil)
 	s.createUserAndTeam(c)
@@ -92,6 +93,80 @@ func (s *ConsumptionSuite) TestCreateInstanceHandlerSavesServiceInstanceInDb(c *
 	c.Assert(si.ServiceName, gocheck.Equals, "mysql")
 }
 
+func (s *ConsumptionSuite) TestCreateInstanceHandlerReturnsAcceptedWhenTheInstanceIsPending(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	recorder, request := makeRequestToCreateInstanceHandler(c)
+	err := CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusAccepted)
+	var si service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.State, gocheck.Equals, service.StatePending)
+}
+
+func (s *ConsumptionSuite) TestCreateInstanceHandlerWithPlan(c *gocheck.C) {
+	var plan string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plan = r.FormValue("plan")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+		Plans:    []service.Plan{{Name: "small"}, {Name: "large"}},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "plan": "large"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(plan, gocheck.Equals, "large")
+	var si service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.PlanName, gocheck.Equals, "large")
+}
+
+func (s *ConsumptionSuite) TestCreateInstanceHandlerWithUnknownPlan(c *gocheck.C) {
+	se := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": "mysql.com"},
+		Plans:    []service.Plan{{Name: "small"}},
+	}
+	se.Create()
+	defer s.conn.Services().Remove(bson.M{"_id": se.Name})
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "plan": "huge"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, `Plan "huge" does not exist in the service "mysql".`)
+	n, err := s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
 func (s *ConsumptionSuite) TestCreateInstanceHandlerSavesAllTeamsThatTheGivenUserIsMemberAndHasAccessToTheServiceInTheInstance(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"DATABASE_HOST":"localhost"}`))
@@ -113,6 +188,231 @@ func (s *ConsumptionSuite) TestCreateInstanceHandlerSavesAllTeamsThatTheGivenUse
 	c.Assert(si.Teams, gocheck.DeepEquals, []string{s.team.Name})
 }
 
+func (s *ConsumptionSuite) TestCreateInstanceHandlerSavesTheOwnerTeam(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	t := auth.Team{Name: "judaspriest", Users: []string{s.user.Email}}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().Remove(bson.M{"_id": t.Name})
+	srv := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err = srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "owner": "judaspriest"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var si service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.TeamOwner, gocheck.Equals, t.Name)
+}
+
+func (s *ConsumptionSuite) TestCreateInstanceHandlerChoosesTheOwnerTeam(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	recorder, request := makeRequestToCreateInstanceHandler(c)
+	err = CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var si service.ServiceInstance
+	err = s.conn.ServiceInstances().Find(bson.M{"name": "brainSQL"}).One(&si)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.TeamOwner, gocheck.Equals, s.team.Name)
+}
+
+func (s *ConsumptionSuite) TestCreateInstanceHandlerReturnsForbiddenWhenTheUserIsNotMemberOfTheOwnerTeam(c *gocheck.C) {
+	srv := service.Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1"}}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	b := bytes.NewBufferString(`{"name": "brainSQL", "service_name": "mysql", "owner": "someoneelse"}`)
+	request, err := http.NewRequest("POST", "/services/instances", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateInstanceHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, `You cannot create a service instance owned by the team "someoneelse".`)
+}
+
+func (s *ConsumptionSuite) TestGrantServiceInstanceAccessToTeamHandler(c *gocheck.C) {
+	t := auth.Team{Name: "judaspriest"}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().Remove(bson.M{"_id": t.Name})
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, t.Name, si.Name, t.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantServiceInstanceAccessToTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	si, err = service.GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{s.team.Name, t.Name})
+}
+
+func (s *ConsumptionSuite) TestGrantServiceInstanceAccessToTeamHandlerTeamAlreadyHasAccess(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, s.team.Name, si.Name, s.team.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantServiceInstanceAccessToTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *ConsumptionSuite) TestGrantServiceInstanceAccessToTeamHandlerRequiresTheOwnerTeam(c *gocheck.C) {
+	t := auth.Team{Name: "judaspriest"}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().Remove(bson.M{"_id": t.Name})
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: t.Name, Teams: []string{t.Name, s.team.Name}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, s.team.Name, si.Name, s.team.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantServiceInstanceAccessToTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "Only members of the team that owns this service instance can manage its teams.")
+}
+
+func (s *ConsumptionSuite) TestGrantServiceInstanceAccessToTeamHandlerWithoutOwnerTeam(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	token, team := createMemberWithRole(c, "owner")
+	defer removeMember(token, team)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, team.Name, si.Name, team.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantServiceInstanceAccessToTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	si, err = service.GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{s.team.Name, team.Name})
+}
+
+func (s *ConsumptionSuite) TestManageTeamsOfServiceInstanceWithoutOwnerTeamRequiresThePermission(c *gocheck.C) {
+	token, team := createMemberWithRole(c, "viewer")
+	defer removeMember(token, team)
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", Teams: []string{s.team.Name, team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, s.team.Name, si.Name, s.team.Name)
+	handlers := []func(http.ResponseWriter, *http.Request, *auth.Token) error{
+		GrantServiceInstanceAccessToTeamHandler,
+		RevokeServiceInstanceAccessFromTeamHandler,
+	}
+	for _, handler := range handlers {
+		request, err := http.NewRequest("PUT", url, nil)
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = handler(recorder, request, token)
+		c.Assert(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Assert(ok, gocheck.Equals, true)
+		c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+		c.Assert(e.Message, gocheck.Equals, `Permission denied: your role does not grant the permission "service.instance.access".`)
+	}
+	si, err = service.GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{s.team.Name, team.Name})
+}
+
+func (s *ConsumptionSuite) TestGrantServiceInstanceAccessToTeamHandlerUnknownTeam(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/unknown?:instance=%s&:team=unknown", si.Name, si.Name)
+	request, err := http.NewRequest("PUT", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = GrantServiceInstanceAccessToTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "Team not found")
+}
+
+func (s *ConsumptionSuite) TestRevokeServiceInstanceAccessFromTeamHandler(c *gocheck.C) {
+	t := auth.Team{Name: "judaspriest"}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().Remove(bson.M{"_id": t.Name})
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name, t.Name}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, t.Name, si.Name, t.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RevokeServiceInstanceAccessFromTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	si, err = service.GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{s.team.Name})
+}
+
+func (s *ConsumptionSuite) TestRevokeServiceInstanceAccessFromTheOwnerTeam(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, s.team.Name, si.Name, s.team.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RevokeServiceInstanceAccessFromTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "You cannot revoke the access of the team that owns this service instance.")
+}
+
+func (s *ConsumptionSuite) TestRevokeServiceInstanceAccessFromTeamWithoutAccess(c *gocheck.C) {
+	t := auth.Team{Name: "judaspriest"}
+	err := s.conn.Teams().Insert(t)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().Remove(bson.M{"_id": t.Name})
+	si := service.ServiceInstance{Name: "brainSQL", ServiceName: "mysql", TeamOwner: s.team.Name, Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	url := fmt.Sprintf("/services/instances/%s/teams/%s?:instance=%s&:team=%s", si.Name, t.Name, si.Name, t.Name)
+	request, err := http.NewRequest("DELETE", url, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RevokeServiceInstanceAccessFromTeamHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
 func (s *ConsumptionSuite) TestCreateInstanceHandlerReturnsErrorWhenUserCannotUseService(c *gocheck.C) {
 	service := service.Service{Name: "mysql", IsRestricted: true}
 	service.Create()
@@ -369,7 +669,7 @@ func (s *ConsumptionSuite) TestServiceInstanceStatusHandler(c *gocheck.C) {
 	err := srv.Create()
 	c.Assert(err, gocheck.IsNil)
 	defer srv.Delete()
-	si := service.ServiceInstance{Name: "my_nosql", ServiceName: srv.Name}
+	si := service.ServiceInstance{Name: "my_nosql", ServiceName: srv.Name, Teams: []string{s.team.Name}}
 	err = si.Create()
 	c.Assert(err, gocheck.IsNil)
 	defer service.DeleteInstance(&si)
@@ -389,7 +689,20 @@ func (s *ConsumptionSuite) TestServiceInstanceStatusHandlerShouldReturnErrorWHen
 func (s *ConsumptionSuite) TestServiceInstanceStatusHandlerShouldReturnErrorWhenServiceInstanceNotExists(c *gocheck.C) {
 	recorder, request := makeRequestToStatusHandler("inexistent-instance", c)
 	err := ServiceInstanceStatusHandler(recorder, request, s.token)
-	c.Assert(err, gocheck.ErrorMatches, "^Service instance does not exists, error: not found$")
+	c.Assert(err, gocheck.ErrorMatches, "^Service instance not found$")
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceStatusHandlerWithoutAccessToTheInstance(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "my_nosql", ServiceName: "mongodb"}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	recorder, request := makeRequestToStatusHandler("my_nosql", c)
+	err = ServiceInstanceStatusHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
 }
 
 func (s *ConsumptionSuite) TestServiceInfoHandler(c *gocheck.C) {
@@ -502,6 +815,55 @@ func (s *ConsumptionSuite) makeRequestToGetDocHandler(name string, c *gocheck.C)
 	return recorder, request
 }
 
+func (s *ConsumptionSuite) TestServicePlansHandler(c *gocheck.C) {
+	srv := service.Service{
+		Name:  "mysql",
+		Teams: []string{s.team.Name},
+		Plans: []service.Plan{{Name: "small", Description: "1 GB"}, {Name: "large", Description: "8 GB"}},
+	}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": srv.Name})
+	request, err := http.NewRequest("GET", "/services/mysql/plans?:name=mysql", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServicePlansHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var plans []service.Plan
+	err = json.NewDecoder(recorder.Body).Decode(&plans)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(plans, gocheck.DeepEquals, srv.Plans)
+}
+
+func (s *ConsumptionSuite) TestServicePlansHandlerWithoutPlans(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	srv := service.Service{
+		Name:     "mysql",
+		Teams:    []string{s.team.Name},
+		Endpoint: map[string]string{"production": ts.URL},
+	}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": srv.Name})
+	request, err := http.NewRequest("GET", "/services/mysql/plans?:name=mysql", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServicePlansHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "[]\n")
+}
+
+func (s *ConsumptionSuite) TestServicePlansHandlerReturns404WhenServiceDoesNotExist(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/services/mysql/plans?:name=mysql", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServicePlansHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.ErrorMatches, "^Service not found$")
+}
+
 func (s *ConsumptionSuite) TestDocHandler(c *gocheck.C) {
 	doc := `Doc for coolnosql
 Collnosql is a really really cool nosql`
@@ -543,7 +905,7 @@ func (s *ConsumptionSuite) TestGetServiceOrError(c *gocheck.C) {
 	srv := service.Service{Name: "foo", Teams: []string{s.team.Name}, IsRestricted: true}
 	err := srv.Create()
 	c.Assert(err, gocheck.IsNil)
-	rSrv, err := getServiceOrError("foo", s.user)
+	rSrv, err := getServiceOrError("foo", s.user, auth.PermServiceRead)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(rSrv.Name, gocheck.Equals, srv.Name)
 }
@@ -552,7 +914,7 @@ func (s *ConsumptionSuite) TestGetServiceOrErrorShouldReturnErrorWhenUserHaveNoA
 	srv := service.Service{Name: "foo", IsRestricted: true}
 	err := srv.Create()
 	c.Assert(err, gocheck.IsNil)
-	_, err = getServiceOrError("foo", s.user)
+	_, err = getServiceOrError("foo", s.user, auth.PermServiceRead)
 	c.Assert(err, gocheck.ErrorMatches, "^This user does not have access to this service$")
 }
 
@@ -560,7 +922,7 @@ func (s *ConsumptionSuite) TestGetServiceOrErrorShoudNotReturnErrorWhenServiceIs
 	srv := service.Service{Name: "foo"}
 	err := srv.Create()
 	c.Assert(err, gocheck.IsNil)
-	_, err = getServiceOrError("foo", s.user)
+	_, err = getServiceOrError("foo", s.user, auth.PermServiceRead)
 	c.Assert(err, gocheck.IsNil)
 }
 
@@ -568,7 +930,7 @@ func (s *ConsumptionSuite) TestGetServiceInstanceOrError(c *gocheck.C) {
 	si := service.ServiceInstance{Name: "foo", Teams: []string{s.team.Name}}
 	err := si.Create()
 	c.Assert(err, gocheck.IsNil)
-	rSi, err := getServiceInstanceOrError("foo", s.user)
+	rSi, err := getServiceInstanceOrError("foo", s.user, auth.PermServiceInstanceRead)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(rSi.Name, gocheck.Equals, si.Name)
 }
@@ -589,3 +951,103 @@ func (s *ConsumptionSuite) TestServiceAndServiceInstancesByTeamsShouldReturnServ
 	}
 	c.Assert(obtained, gocheck.DeepEquals, expected)
 }
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyHandler(c *gocheck.C) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte("slow queries: 0"))
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer srv.Delete()
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: srv.Name, Teams: []string{s.team.Name}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer service.DeleteInstance(&si)
+	request, err := http.NewRequest("GET", "/services/proxy/my-mysql?:instance=my-mysql&callback=/slow-queries", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServiceInstanceProxyHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "slow queries: 0")
+	c.Assert(path, gocheck.Equals, "/resources/my-mysql/slow-queries")
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyHandlerWithoutCallback(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer service.DeleteInstance(&si)
+	request, err := http.NewRequest("GET", "/services/proxy/my-mysql?:instance=my-mysql", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServiceInstanceProxyHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e, gocheck.ErrorMatches, "^You must provide the callback parameter.$")
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyHandlerWithoutAccessToTheInstance(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{}}
+	err := si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer service.DeleteInstance(&si)
+	request, err := http.NewRequest("GET", "/services/proxy/my-mysql?:instance=my-mysql&callback=/backup", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServiceInstanceProxyHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *ConsumptionSuite) TestServiceInstanceProxyHandlerInstanceNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("GET", "/services/proxy/unknown?:instance=unknown&callback=/backup", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServiceInstanceProxyHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+}
+
+func (s *ConsumptionSuite) TestServiceCatalogHandler(c *gocheck.C) {
+	srv := service.Service{
+		Name:        "mysql",
+		Description: "MySQL databases",
+		Tags:        []string{"database"},
+		DocUrl:      "http://mysql.tsuru.io",
+		Maintainer:  s.team.Name,
+	}
+	err := srv.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": srv.Name})
+	other := service.Service{Name: "redis", Description: "Key-value store"}
+	err = other.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": other.Name})
+	request, err := http.NewRequest("GET", "/services/catalog?q=database", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ServiceCatalogHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	var entries []service.CatalogEntry
+	err = json.NewDecoder(recorder.Body).Decode(&entries)
+	c.Assert(err, gocheck.IsNil)
+	expected := []service.CatalogEntry{{
+		Name:        "mysql",
+		Description: "MySQL databases",
+		Tags:        []string{"database"},
+		DocUrl:      "http://mysql.tsuru.io",
+		Maintainer:  s.team.Name,
+	}}
+	c.Assert(entries, gocheck.DeepEquals, expected)
+}
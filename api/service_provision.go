@@ -18,8 +18,31 @@ import (
 )
 
 type serviceYaml struct {
-	Id       string
-	Endpoint map[string]string
+	Id          string
+	Endpoint    map[string]string
+	Plans       []service.Plan
+	Password    string
+	Doc         string
+	Team        string
+	TestTeams   []string `yaml:"test-teams"`
+	Description string
+	Tags        []string
+	DocUrl      string `yaml:"doc-url"`
+	Maintainer  string
+}
+
+// validate checks the required fields of the manifest.
+func (sy *serviceYaml) validate() error {
+	if sy.Id == "" {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide the id of the service in the manifest file."}
+	}
+	if _, ok := sy.Endpoint["production"]; !ok {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide a production endpoint in the manifest file."}
+	}
+	if _, ok := sy.Endpoint["test"]; !ok && len(sy.TestTeams) > 0 {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide a test endpoint in the manifest file to declare test teams."}
+	}
+	return nil
 }
 
 func ServicesHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
@@ -50,8 +73,8 @@ func CreateHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return err
 	}
-	if _, ok := sy.Endpoint["production"]; !ok {
-		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide a production endpoint in the manifest file."}
+	if err = sy.validate(); err != nil {
+		return err
 	}
 	conn, err := db.Conn()
 	if err != nil {
@@ -71,6 +94,23 @@ func CreateHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 		msg := "In order to create a service, you should be member of at least one team"
 		return &errors.Http{Code: http.StatusForbidden, Message: msg}
 	}
+	teams = teamsWithPermission(teams, u, auth.PermServiceCreate)
+	if len(teams) == 0 {
+		return permissionDenied(auth.PermServiceCreate)
+	}
+	owners := auth.GetTeamsNames(teams)
+	if sy.Team != "" {
+		owners = nil
+		for _, team := range teams {
+			if team.Name == sy.Team {
+				owners = []string{sy.Team}
+			}
+		}
+		if owners == nil {
+			msg := fmt.Sprintf("You cannot create a service owned by the team %q.", sy.Team)
+			return &errors.Http{Code: http.StatusForbidden, Message: msg}
+		}
+	}
 	n, err := conn.Services().Find(bson.M{"_id": sy.Id}).Count()
 	if err != nil {
 		return &errors.Http{Code: http.StatusInternalServerError, Message: err.Error()}
@@ -80,18 +120,32 @@ func CreateHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 		return &errors.Http{Code: http.StatusInternalServerError, Message: msg}
 	}
 	s := service.Service{
-		Name:       sy.Id,
-		Endpoint:   sy.Endpoint,
-		OwnerTeams: auth.GetTeamsNames(teams),
+		Name:        sy.Id,
+		Endpoint:    sy.Endpoint,
+		OwnerTeams:  owners,
+		Plans:       sy.Plans,
+		Password:    sy.Password,
+		Doc:         sy.Doc,
+		TestTeams:   sy.TestTeams,
+		Description: sy.Description,
+		Tags:        sy.Tags,
+		DocUrl:      sy.DocUrl,
+		Maintainer:  sy.Maintainer,
 	}
 	err = s.Create()
 	if err != nil {
 		return err
 	}
 	fmt.Fprint(w, "success")
+	if sy.Password == "" {
+		fmt.Fprintf(w, "\nThe generated password of the service is %s.\n", s.Password)
+	}
 	return nil
 }
 
+// UpdateHandler updates the service with the data of the manifest. The
+// endpoints are replaced, but the other fields missing in the manifest keep
+// their current values. Lists may be cleared with an empty list.
 func UpdateHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -100,15 +154,45 @@ func UpdateHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	}
 	var yaml serviceYaml
 	goyaml.Unmarshal(body, &yaml)
+	if err = yaml.validate(); err != nil {
+		return err
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
 	}
-	s, err := getServiceByOwner(yaml.Id, u)
+	s, err := getServiceByOwner(yaml.Id, u, auth.PermServiceUpdate)
 	if err != nil {
 		return err
 	}
 	s.Endpoint = yaml.Endpoint
+	if yaml.Plans != nil {
+		s.Plans = yaml.Plans
+	}
+	if yaml.TestTeams != nil {
+		s.TestTeams = yaml.TestTeams
+	}
+	if _, ok := s.Endpoint["test"]; !ok && len(s.TestTeams) > 0 {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "You must provide a test endpoint in the manifest file, the service has test teams."}
+	}
+	if yaml.Tags != nil {
+		s.Tags = yaml.Tags
+	}
+	if yaml.Description != "" {
+		s.Description = yaml.Description
+	}
+	if yaml.DocUrl != "" {
+		s.DocUrl = yaml.DocUrl
+	}
+	if yaml.Maintainer != "" {
+		s.Maintainer = yaml.Maintainer
+	}
+	if yaml.Password != "" {
+		s.Password = yaml.Password
+	}
+	if yaml.Doc != "" {
+		s.Doc = yaml.Doc
+	}
 	if err = s.Update(); err != nil {
 		return err
 	}
@@ -121,7 +205,7 @@ func DeleteHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return err
 	}
-	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u)
+	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u, auth.PermServiceDelete)
 	if err != nil {
 		return err
 	}
@@ -151,9 +235,8 @@ func getServiceAndTeam(serviceName string, teamName string, u *auth.User) (*serv
 	if err != nil {
 		return nil, nil, &errors.Http{Code: http.StatusNotFound, Message: "Service not found"}
 	}
-	if !auth.CheckUserAccess(service.Teams, u) {
-		msg := "This user does not have access to this service"
-		return nil, nil, &errors.Http{Code: http.StatusForbidden, Message: msg}
+	if err = checkPermission(service.Teams, u, auth.PermServiceAccess, "This user does not have access to this service"); err != nil {
+		return nil, nil, err
 	}
 	t := new(auth.Team)
 	conn, err := db.Conn()
@@ -216,7 +299,7 @@ func AddDocHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return err
 	}
-	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u)
+	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u, auth.PermServiceUpdate)
 	if err != nil {
 		return err
 	}
@@ -237,7 +320,7 @@ func GetDocHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	if err != nil {
 		return err
 	}
-	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u)
+	s, err := getServiceByOwner(r.URL.Query().Get(":name"), u, auth.PermServiceRead)
 	if err != nil {
 		return err
 	}
@@ -245,17 +328,13 @@ func GetDocHandler(w http.ResponseWriter, r *http.Request, t *auth.Token) error
 	return nil
 }
 
-func getServiceByOwner(name string, u *auth.User) (service.Service, error) {
+func getServiceByOwner(name string, u *auth.User, perm auth.Permission) (service.Service, error) {
 	s := service.Service{Name: name}
 	err := s.Get()
 	if err != nil {
 		return s, &errors.Http{Code: http.StatusNotFound, Message: "Service not found"}
 	}
-	if !auth.CheckUserAccess(s.OwnerTeams, u) {
-		msg := "This user does not have access to this service"
-		return s, &errors.Http{Code: http.StatusForbidden, Message: msg}
-	}
-	return s, err
+	return s, checkPermission(s.OwnerTeams, u, perm, "This user does not have access to this service")
 }
 
 func servicesAndInstancesByOwner(u *auth.User) []service.ServiceModel {
@@ -266,7 +345,7 @@ func servicesAndInstancesByOwner(u *auth.User) []service.ServiceModel {
 		results[i].Service = s.Name
 		for _, si := range sInstances {
 			if si.ServiceName == s.Name {
-				results[i].Instances = append(results[i].Instances, si.Name)
+				results[i].AddInstance(si)
 			}
 		}
 	}
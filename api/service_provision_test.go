@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
 )
 
 type ProvisionSuite struct {
@@ -92,6 +93,7 @@ func makeRequestToCreateHandler(c *gocheck.C) (*httptest.ResponseRecorder, *http
 endpoint:
     production: someservice.com
     test: test.someservice.com
+password: s3cr3t
 `
 	b := bytes.NewBufferString(manifest)
 	request, err := http.NewRequest("POST", "/services", b)
@@ -142,6 +144,26 @@ func (s *ProvisionSuite) TestCreateHandlerWithContentOfRealYaml(c *gocheck.C) {
 	c.Assert(rService.Endpoint["test"], gocheck.Equals, "localhost:8000")
 }
 
+func (s *ProvisionSuite) TestCreateHandlerSavesPlansFromManifest(c *gocheck.C) {
+	p, err := filepath.Abs("testdata/manifest-with-plans.yml")
+	c.Assert(err, gocheck.IsNil)
+	manifest, err := ioutil.ReadFile(p)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("POST", "/services", bytes.NewBuffer(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var rService service.Service
+	err = s.conn.Services().Find(bson.M{"_id": "mysqlapi"}).One(&rService)
+	c.Assert(err, gocheck.IsNil)
+	expected := []service.Plan{
+		{Name: "small", Description: "1 GB of storage"},
+		{Name: "large", Description: "100 GB of storage"},
+	}
+	c.Assert(rService.Plans, gocheck.DeepEquals, expected)
+}
+
 func (s *ProvisionSuite) TestCreateHandlerShouldReturnErrorWhenNameExists(c *gocheck.C) {
 	recorder, request := makeRequestToCreateHandler(c)
 	err := CreateHandler(recorder, request, s.token)
@@ -166,6 +188,34 @@ func (s *ProvisionSuite) TestCreateHandlerSavesOwnerTeamsFromUserWhoCreated(c *g
 	c.Assert(rService.OwnerTeams, gocheck.DeepEquals, []string{s.team.Name})
 }
 
+func (s *ProvisionSuite) TestCreateHandlerSavesThePasswordFromTheManifest(c *gocheck.C) {
+	recorder, request := makeRequestToCreateHandler(c)
+	err := CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var rService service.Service
+	err = s.conn.Services().Find(bson.M{"_id": "some_service"}).One(&rService)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rService.Password, gocheck.Equals, "s3cr3t")
+}
+
+func (s *ProvisionSuite) TestCreateHandlerGeneratesThePasswordWhenTheManifestDoesNotHaveIt(c *gocheck.C) {
+	p, err := filepath.Abs("testdata/manifest.yml")
+	c.Assert(err, gocheck.IsNil)
+	manifest, err := ioutil.ReadFile(p)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("POST", "/services", bytes.NewBuffer(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var rService service.Service
+	err = s.conn.Services().Find(bson.M{"_id": "mysqlapi"}).One(&rService)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rService.Password, gocheck.Not(gocheck.Equals), "")
+	expected := "success\nThe generated password of the service is " + rService.Password + ".\n"
+	c.Assert(recorder.Body.String(), gocheck.Equals, expected)
+}
+
 func (s *ProvisionSuite) TestCreateHandlerReturnsForbiddenIfTheUserIsNotMemberOfAnyTeam(c *gocheck.C) {
 	u := &auth.User{Email: "enforce@queensryche.com", Password: "123456"}
 	err := u.Create()
@@ -200,6 +250,95 @@ func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestIfTheServiceDoesNotHa
 	c.Assert(e.Message, gocheck.Equals, "You must provide a production endpoint in the manifest file.")
 }
 
+func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestIfTheManifestDoesNotHaveTheId(c *gocheck.C) {
+	manifest := "endpoint:\n  production: someservice.com\n"
+	request, err := http.NewRequest("POST", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "You must provide the id of the service in the manifest file.")
+}
+
+func (s *ProvisionSuite) TestCreateHandlerReturnsBadRequestIfTheManifestHasTestTeamsWithoutTestEndpoint(c *gocheck.C) {
+	manifest := "id: some_service\nendpoint:\n  production: someservice.com\ntest-teams:\n  - qa\n"
+	request, err := http.NewRequest("POST", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(e.Message, gocheck.Equals, "You must provide a test endpoint in the manifest file to declare test teams.")
+}
+
+func (s *ProvisionSuite) TestCreateHandlerSavesTheTeamTheDocAndTheTestTeams(c *gocheck.C) {
+	manifest := `id: some_service
+endpoint:
+  production: someservice.com
+  test: test.someservice.com
+team: tsuruteam
+doc: some documentation
+test-teams:
+  - qa
+`
+	request, err := http.NewRequest("POST", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "some_service"})
+	var rService service.Service
+	err = s.conn.Services().Find(bson.M{"_id": "some_service"}).One(&rService)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rService.OwnerTeams, gocheck.DeepEquals, []string{s.team.Name})
+	c.Assert(rService.Doc, gocheck.Equals, "some documentation")
+	c.Assert(rService.TestTeams, gocheck.DeepEquals, []string{"qa"})
+}
+
+func (s *ProvisionSuite) TestCreateHandlerWithATeamThatTheUserIsNotMemberOf(c *gocheck.C) {
+	manifest := "id: some_service\nendpoint:\n  production: someservice.com\nteam: someteam\n"
+	request, err := http.NewRequest("POST", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, `You cannot create a service owned by the team "someteam".`)
+}
+
+func (s *ProvisionSuite) TestCreateHandlerSavesTheCatalogMetadata(c *gocheck.C) {
+	manifest := `id: some_service
+endpoint:
+  production: someservice.com
+description: Some service
+tags:
+  - database
+  - sql
+doc-url: http://someservice.com/docs
+maintainer: tsuruteam
+`
+	request, err := http.NewRequest("POST", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "some_service"})
+	var rService service.Service
+	err = s.conn.Services().Find(bson.M{"_id": "some_service"}).One(&rService)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rService.Description, gocheck.Equals, "Some service")
+	c.Assert(rService.Tags, gocheck.DeepEquals, []string{"database", "sql"})
+	c.Assert(rService.DocUrl, gocheck.Equals, "http://someservice.com/docs")
+	c.Assert(rService.Maintainer, gocheck.Equals, "tsuruteam")
+}
+
 func (s *ProvisionSuite) TestUpdateHandlerShouldUpdateTheServiceWithDataFromManifest(c *gocheck.C) {
 	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}}
 	err := service.Create()
@@ -219,6 +358,135 @@ func (s *ProvisionSuite) TestUpdateHandlerShouldUpdateTheServiceWithDataFromMani
 	c.Assert(service.Endpoint["production"], gocheck.Equals, "mysqlapi.com")
 }
 
+func (s *ProvisionSuite) TestUpdateHandlerUpdatesThePlans(c *gocheck.C) {
+	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	p, err := filepath.Abs("testdata/manifest-with-plans.yml")
+	c.Assert(err, gocheck.IsNil)
+	manifest, err := ioutil.ReadFile(p)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("PUT", "/services", bytes.NewBuffer(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.Plans, gocheck.HasLen, 2)
+	c.Assert(service.Plans[0].Name, gocheck.Equals, "small")
+	c.Assert(service.Plans[1].Name, gocheck.Equals, "large")
+}
+
+func (s *ProvisionSuite) TestUpdateHandlerRotatesThePassword(c *gocheck.C) {
+	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}, Password: "old"}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	manifest := "id: mysqlapi\nendpoint:\n  production: mysqlapi.com\npassword: new\n"
+	request, err := http.NewRequest("PUT", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.Password, gocheck.Equals, "new")
+}
+
+func (s *ProvisionSuite) TestUpdateHandlerUpdatesTheTestTeams(c *gocheck.C) {
+	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	manifest := "id: mysqlapi\nendpoint:\n  production: mysqlapi.com\n  test: localhost:8000\ntest-teams:\n  - qa\n"
+	request, err := http.NewRequest("PUT", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.TestTeams, gocheck.DeepEquals, []string{"qa"})
+	c.Assert(service.Endpoint["test"], gocheck.Equals, "localhost:8000")
+}
+
+func (s *ProvisionSuite) TestUpdateHandlerKeepsThePasswordWhenTheManifestDoesNotHaveIt(c *gocheck.C) {
+	service := service.Service{Name: "mysqlapi", Endpoint: map[string]string{"production": "sqlapi.com"}, OwnerTeams: []string{s.team.Name}, Password: "old"}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	p, err := filepath.Abs("testdata/manifest.yml")
+	c.Assert(err, gocheck.IsNil)
+	manifest, err := ioutil.ReadFile(p)
+	c.Assert(err, gocheck.IsNil)
+	request, err := http.NewRequest("PUT", "/services", bytes.NewBuffer(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.Password, gocheck.Equals, "old")
+}
+
+func (s *ProvisionSuite) TestUpdateHandlerKeepsTheFieldsMissingInTheManifest(c *gocheck.C) {
+	service := service.Service{
+		Name:        "mysqlapi",
+		Endpoint:    map[string]string{"production": "sqlapi.com", "test": "localhost:8000"},
+		OwnerTeams:  []string{s.team.Name},
+		Plans:       []service.Plan{{Name: "small"}},
+		TestTeams:   []string{"qa"},
+		Description: "MySQL databases",
+		Tags:        []string{"sql"},
+		DocUrl:      "http://mysqlapi.com/docs",
+		Maintainer:  "dba",
+	}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	manifest := "id: mysqlapi\nendpoint:\n  production: mysqlapi.com\n  test: localhost:8000\ndescription: MySQL 5.6 databases\ntags: []\n"
+	request, err := http.NewRequest("PUT", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.Endpoint["production"], gocheck.Equals, "mysqlapi.com")
+	c.Assert(service.Description, gocheck.Equals, "MySQL 5.6 databases")
+	c.Assert(service.Tags, gocheck.HasLen, 0)
+	c.Assert(service.Plans, gocheck.HasLen, 1)
+	c.Assert(service.TestTeams, gocheck.DeepEquals, []string{"qa"})
+	c.Assert(service.DocUrl, gocheck.Equals, "http://mysqlapi.com/docs")
+	c.Assert(service.Maintainer, gocheck.Equals, "dba")
+}
+
+func (s *ProvisionSuite) TestUpdateHandlerRequiresTheTestEndpointWhenTheServiceHasTestTeams(c *gocheck.C) {
+	service := service.Service{
+		Name:       "mysqlapi",
+		Endpoint:   map[string]string{"production": "sqlapi.com", "test": "localhost:8000"},
+		OwnerTeams: []string{s.team.Name},
+		TestTeams:  []string{"qa"},
+	}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": service.Name})
+	manifest := "id: mysqlapi\nendpoint:\n  production: mysqlapi.com\n"
+	request, err := http.NewRequest("PUT", "/services", strings.NewReader(manifest))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = UpdateHandler(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+	err = s.conn.Services().Find(bson.M{"_id": service.Name}).One(&service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(service.Endpoint["test"], gocheck.Equals, "localhost:8000")
+}
+
 func (s *ProvisionSuite) TestUpdateHandlerReturns404WhenTheServiceDoesNotExist(c *gocheck.C) {
 	p, err := filepath.Abs("testdata/manifest.yml")
 	c.Assert(err, gocheck.IsNil)
@@ -626,7 +894,7 @@ func (s *ProvisionSuite) TestgetServiceByOwner(c *gocheck.C) {
 	err := srv.Create()
 	c.Assert(err, gocheck.IsNil)
 	defer srv.Delete()
-	rSrv, err := getServiceByOwner("foo", s.user)
+	rSrv, err := getServiceByOwner("foo", s.user, auth.PermServiceRead)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(rSrv.Name, gocheck.Equals, srv.Name)
 }
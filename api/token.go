@@ -0,0 +1,120 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"net/http"
+	"time"
+)
+
+const defaultPersonalTokenExpireDays = 30
+
+// loginTokenRequired returns an error if the request was authenticated with a
+// personal access token. It protects the operations that would allow a leaked
+// token to take over the account of the user, or to escape the apps and
+// permissions it is limited to (adding SSH keys, for instance, grants access
+// to every app of the user).
+func loginTokenRequired(t *auth.Token) error {
+	if t.IsPersonal() {
+		msg := "This operation requires logging in, personal access tokens are not accepted."
+		return &errors.Http{Code: http.StatusForbidden, Message: msg}
+	}
+	return nil
+}
+
+type tokenInfo struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	ValidUntil  time.Time         `json:"valid-until"`
+	Apps        []string          `json:"apps"`
+	Permissions []auth.Permission `json:"permissions"`
+	Current     bool              `json:"current"`
+}
+
+// ListTokens lists the tokens of the user, without their values. Tokens
+// created by logging in have no name.
+func ListTokens(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	tokens, err := auth.ListUserTokens(u)
+	if err != nil {
+		return err
+	}
+	result := make([]tokenInfo, len(tokens))
+	for i, token := range tokens {
+		result[i] = tokenInfo{
+			Id:          token.Id.Hex(),
+			Name:        token.Name,
+			ValidUntil:  token.ValidUntil,
+			Apps:        token.Apps,
+			Permissions: token.Permissions,
+			Current:     token.Token == t.Token,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(result)
+}
+
+// CreatePersonalToken creates a personal access token for the user. The body
+// of the request must contain the name of the token in JSON format, and may
+// contain the number of days until the token expires (defaults to 30), and the
+// apps and permissions the token is limited to.
+func CreatePersonalToken(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
+	var params struct {
+		Name        string
+		Expires     int
+		Apps        []string
+		Permissions []auth.Permission
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return &errors.Http{Code: http.StatusBadRequest, Message: "Invalid JSON in request body."}
+	}
+	if params.Expires == 0 {
+		params.Expires = defaultPersonalTokenExpireDays
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	validity := time.Duration(params.Expires) * 24 * time.Hour
+	token, err := auth.CreatePersonalToken(u, params.Name, validity, params.Apps, params.Permissions)
+	if err != nil {
+		if e, ok := err.(*errors.ValidationError); ok {
+			return &errors.Http{Code: http.StatusPreconditionFailed, Message: e.Message}
+		}
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":       token.Token,
+		"valid-until": token.ValidUntil,
+	})
+}
+
+// RevokeToken revokes the token of the user identified by the id parameter
+// (see ListTokens).
+func RevokeToken(w http.ResponseWriter, r *http.Request, t *auth.Token) error {
+	if err := loginTokenRequired(t); err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	err = auth.DeleteUserToken(u, r.URL.Query().Get("id"))
+	if err == auth.ErrTokenNotFound {
+		return &errors.Http{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
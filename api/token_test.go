@@ -0,0 +1,272 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func (s *S) createPersonalToken(c *gocheck.C, apps []string, perms []auth.Permission) *auth.Token {
+	t, err := auth.CreatePersonalToken(s.user, "ci", 24*time.Hour, apps, perms)
+	c.Assert(err, gocheck.IsNil)
+	return t
+}
+
+func (s *S) TestListTokens(c *gocheck.C) {
+	t := s.createPersonalToken(c, []string{"myapp"}, []auth.Permission{auth.PermAppDeploy})
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("GET", "/users/tokens", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ListTokens(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Header().Get("Content-Type"), gocheck.Equals, "application/json")
+	body := recorder.Body.String()
+	c.Assert(strings.Contains(body, s.token.Token), gocheck.Equals, false)
+	c.Assert(strings.Contains(body, t.Token), gocheck.Equals, false)
+	var tokens []tokenInfo
+	err = json.Unmarshal([]byte(body), &tokens)
+	c.Assert(err, gocheck.IsNil)
+	var current, personal *tokenInfo
+	for i := range tokens {
+		if tokens[i].Current {
+			current = &tokens[i]
+		}
+		if tokens[i].Id == t.Id.Hex() {
+			personal = &tokens[i]
+		}
+	}
+	c.Assert(current, gocheck.NotNil)
+	c.Assert(current.Name, gocheck.Equals, "")
+	c.Assert(personal, gocheck.NotNil)
+	c.Assert(personal.Name, gocheck.Equals, "ci")
+	c.Assert(personal.Current, gocheck.Equals, false)
+	c.Assert(personal.Apps, gocheck.DeepEquals, []string{"myapp"})
+	c.Assert(personal.Permissions, gocheck.DeepEquals, []auth.Permission{auth.PermAppDeploy})
+}
+
+func (s *S) TestCreatePersonalTokenHandler(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"ci","expires":7,"apps":["myapp"],"permissions":["app.deploy"]}`)
+	request, err := http.NewRequest("POST", "/users/tokens", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePersonalToken(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusCreated)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": result["token"]})
+	t, err := auth.GetToken(result["token"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Name, gocheck.Equals, "ci")
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(t.Apps, gocheck.DeepEquals, []string{"myapp"})
+	c.Assert(t.Permissions, gocheck.DeepEquals, []auth.Permission{auth.PermAppDeploy})
+	c.Assert(t.ValidUntil.Sub(time.Now()) > 6*24*time.Hour, gocheck.Equals, true)
+	c.Assert(t.ValidUntil.Sub(time.Now()) <= 7*24*time.Hour, gocheck.Equals, true)
+}
+
+func (s *S) TestCreatePersonalTokenHandlerDefaultExpiration(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/users/tokens", strings.NewReader(`{"name":"ci"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePersonalToken(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	var result map[string]string
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": result["token"]})
+	t, err := auth.GetToken(result["token"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.ValidUntil.Sub(time.Now()) > 29*24*time.Hour, gocheck.Equals, true)
+	c.Assert(t.IsScoped(), gocheck.Equals, false)
+}
+
+func (s *S) TestCreatePersonalTokenHandlerInvalidToken(c *gocheck.C) {
+	b := strings.NewReader(`{"name":"ci","permissions":["app.fly"]}`)
+	request, err := http.NewRequest("POST", "/users/tokens", b)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePersonalToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusPreconditionFailed)
+	c.Assert(e.Message, gocheck.Equals, `Unknown permission: "app.fly".`)
+}
+
+func (s *S) TestCreatePersonalTokenHandlerInvalidJSON(c *gocheck.C) {
+	request, err := http.NewRequest("POST", "/users/tokens", strings.NewReader(`{"name":`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePersonalToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestCreatePersonalTokenHandlerRequiresLoginToken(c *gocheck.C) {
+	t := s.createPersonalToken(c, nil, nil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("POST", "/users/tokens", strings.NewReader(`{"name":"other"}`))
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = CreatePersonalToken(recorder, request, t)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	n, err := s.conn.Tokens().Find(bson.M{"name": "other"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestChangePasswordRequiresLoginToken(c *gocheck.C) {
+	t := s.createPersonalToken(c, nil, nil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	body := strings.NewReader(`{"old":"123456","new":"654321"}`)
+	request, err := http.NewRequest("PUT", "/users/password", body)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = ChangePassword(recorder, request, t)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAccountHandlersRequireLoginToken(c *gocheck.C) {
+	t := s.createPersonalToken(c, []string{"myapp"}, []auth.Permission{auth.PermAppDeploy})
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	var tests = []struct {
+		method  string
+		url     string
+		body    string
+		handler func(http.ResponseWriter, *http.Request, *auth.Token) error
+	}{
+		{"POST", "/users/keys", `{"key":"my-key"}`, AddKeyToUser},
+		{"DELETE", "/users/keys", `{"key":"my-key"}`, RemoveKeyFromUser},
+		{"DELETE", "/users/tokens?id=" + s.token.Id.Hex(), "", RevokeToken},
+		{"POST", "/teams", `{"name":"leakers"}`, CreateTeam},
+		{"DELETE", "/teams/" + s.team.Name + "?:name=" + s.team.Name, "", RemoveTeam},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		c.Assert(err, gocheck.IsNil)
+		recorder := httptest.NewRecorder()
+		err = test.handler(recorder, request, t)
+		c.Check(err, gocheck.NotNil)
+		e, ok := err.(*errors.Http)
+		c.Check(ok, gocheck.Equals, true)
+		if ok {
+			c.Check(e.Code, gocheck.Equals, http.StatusForbidden, gocheck.Commentf("%s %s", test.method, test.url))
+		}
+	}
+	u, err := auth.GetUserByEmail(s.user.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.HasKey(auth.Key{Content: "my-key"}), gocheck.Equals, false)
+	_, err = auth.GetToken(s.token.Token)
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Teams().Find(bson.M{"_id": "leakers"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	n, err = s.conn.Teams().FindId(s.team.Name).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestRevokeToken(c *gocheck.C) {
+	t := s.createPersonalToken(c, nil, nil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("DELETE", "/users/tokens?id="+t.Id.Hex(), nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RevokeToken(recorder, request, s.token)
+	c.Assert(err, gocheck.IsNil)
+	_, err = auth.GetToken(t.Token)
+	c.Assert(err, gocheck.Equals, auth.ErrTokenNotFound)
+}
+
+func (s *S) TestRevokeTokenNotFound(c *gocheck.C) {
+	request, err := http.NewRequest("DELETE", "/users/tokens?id="+bson.NewObjectId().Hex(), nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = RevokeToken(recorder, request, s.token)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusNotFound)
+	c.Assert(e.Message, gocheck.Equals, "Token not found")
+}
+
+func (s *S) TestAppInfoWithTokenLimitedToOtherApps(c *gocheck.C) {
+	a := app.App{Name: "myapp", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	t := s.createPersonalToken(c, []string{"otherapp"}, nil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"?:app="+a.Name, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appInfo(recorder, request, t)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, "This token does not have access to this app")
+}
+
+func (s *S) TestAppDeleteWithTokenLimitedToOtherPermissions(c *gocheck.C) {
+	a := app.App{Name: "myapp", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	t := s.createPersonalToken(c, []string{a.Name}, []auth.Permission{auth.PermAppDeploy})
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"?:app="+a.Name, nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appDelete(recorder, request, t)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusForbidden)
+	c.Assert(e.Message, gocheck.Equals, `Permission denied: your role does not grant the permission "app.delete".`)
+}
+
+func (s *S) TestAppListWithTokenLimitedToSomeApps(c *gocheck.C) {
+	app1 := app.App{Name: "app1", Teams: []string{s.team.Name}}
+	err := s.conn.Apps().Insert(app1)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app1.Name})
+	app2 := app.App{Name: "app2", Teams: []string{s.team.Name}}
+	err = s.conn.Apps().Insert(app2)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app2.Name})
+	t := s.createPersonalToken(c, []string{app2.Name}, nil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appList(recorder, request, t)
+	c.Assert(err, gocheck.IsNil)
+	var apps []app.App
+	err = json.NewDecoder(recorder.Body).Decode(&apps)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(apps, gocheck.HasLen, 1)
+	c.Assert(apps[0].Name, gocheck.Equals, app2.Name)
+}
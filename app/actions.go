@@ -5,6 +5,7 @@
 package app
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/globocom/config"
@@ -15,6 +16,7 @@ import (
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/repository"
+	"io"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/goamz/aws"
 	"launchpad.net/goamz/iam"
@@ -289,10 +291,125 @@ var provisionAddUnits = action.Action{
 			units = 1
 		}
 		if units > 1 {
-			_, err := Provisioner.AddUnits(app, units-1)
+			_, err := Provisioner.AddUnits(app, units-1, "")
 			return nil, err
 		}
 		return nil, nil
 	},
 	MinParams: 2,
 }
+
+// updateRepository updates the code of the app in its units to the ref of the
+// deploy, storing the deployed commit in the deploy. It takes three arguments:
+// the app, the writer and the deploy (a pointer to a Deploy instance).
+//
+// Each unit records the commit it had before the update. If the update fails
+// in some unit, all units are put back in their previous commits. The
+// Backward does the same, and then reinstalls the dependencies and restarts
+// the app, so it is left in the last good version.
+var updateRepository = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Params[0].(*App)
+		w := ctx.Params[1].(io.Writer)
+		d := ctx.Params[2].(*Deploy)
+		previous, err := repository.SaveHead(app)
+		if err != nil {
+			return nil, err
+		}
+		out, err := repository.CloneOrPull(app, d.Ref)
+		if werr := write(w, out); werr != nil {
+			err = werr
+		} else if err != nil {
+			err = fmt.Errorf("Failed to update the repository: %s", err)
+		} else {
+			d.Commit, err = repository.Head(app)
+		}
+		if err != nil {
+			if previous != "" {
+				repository.RestoreHead(app)
+			}
+			return nil, err
+		}
+		return previous, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		previous := ctx.FWResult.(string)
+		if previous == "" {
+			return
+		}
+		app := ctx.Params[0].(*App)
+		w := ctx.Params[1].(io.Writer)
+		fmt.Fprintf(w, "\n ---> Deploy failed, rolling back to the previous version (%s)\n", previous)
+		if out, err := repository.RestoreHead(app); err != nil {
+			log.Printf("Failed to restore the previous version of the app %q (%s): %s", app.Name, err, out)
+			return
+		}
+		if err := app.InstallDeps(w); err != nil {
+			log.Printf("Failed to install the dependencies of the app %q: %s", app.Name, err)
+			return
+		}
+		if err := app.Restart(w); err != nil {
+			log.Printf("Failed to restart the app %q: %s", app.Name, err)
+		}
+	},
+	MinParams: 3,
+}
+
+// updateApprc writes the environment variables of the app to the apprc file
+// in its units, keeping a copy of the previous file. The Backward restores the
+// previous file. It takes the app as the first argument.
+var updateApprc = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Params[0].(*App)
+		var buf bytes.Buffer
+		cmd := "cp /home/application/apprc /home/application/apprc.previous 2>/dev/null"
+		cmd += " || rm -f /home/application/apprc.previous"
+		if err := app.run(cmd, &buf); err != nil {
+			return nil, fmt.Errorf("Failed to backup env vars (%s): %s", err, buf.Bytes())
+		}
+		return nil, app.serializeEnvVars()
+	},
+	Backward: func(ctx action.BWContext) {
+		app := ctx.Params[0].(*App)
+		var buf bytes.Buffer
+		cmd := "if [ -f /home/application/apprc.previous ]; then"
+		cmd += " mv /home/application/apprc.previous /home/application/apprc;"
+		cmd += " else rm -f /home/application/apprc; fi"
+		if err := app.run(cmd, &buf); err != nil {
+			log.Printf("Failed to restore the env vars of the app %q (%s): %s", app.Name, err, buf.Bytes())
+		}
+	},
+	MinParams: 1,
+}
+
+// installDependencies runs the dependencies hook in the units of the app. It
+// takes two arguments: the app and the writer.
+var installDependencies = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Params[0].(*App)
+		w := ctx.Params[1].(io.Writer)
+		err := write(w, []byte("\n ---> Installing dependencies\n"))
+		if err != nil {
+			return nil, err
+		}
+		return nil, app.InstallDeps(w)
+	},
+	MinParams: 2,
+}
+
+// restartApp restarts the app, running its pre-restart and post-restart
+// hooks. It takes two arguments: the app and the writer.
+//
+// When the app.conf of the app defines a rolling-restart section, the units
+// are restarted in batches (see App.RollingRestart).
+var restartApp = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		app := ctx.Params[0].(*App)
+		w := ctx.Params[1].(io.Writer)
+		if err := app.loadHooks(); err != nil {
+			return nil, err
+		}
+		return nil, app.RollingRestart(w, app.hooks.RollingRestart.BatchSize)
+	},
+	MinParams: 2,
+}
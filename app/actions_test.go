@@ -5,11 +5,13 @@
 package app
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/action"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/provision"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/goamz/aws"
 	"launchpad.net/goamz/iam"
@@ -527,3 +529,174 @@ func (s *S) TestProvisionAddUnitsBackward(c *gocheck.C) {
 func (s *S) TestProvisionAddUnitsMinParams(c *gocheck.C) {
 	c.Assert(provisionAddUnits.MinParams, gocheck.Equals, 2)
 }
+
+func (s *S) TestUpdateRepositoryForward(c *gocheck.C) {
+	previous := "e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28"
+	s.provisioner.PrepareOutput([]byte(previous + "\n")) // save head
+	s.provisioner.PrepareOutput([]byte("cloned"))        // clone
+	s.provisioner.PrepareOutput(nil)                     // checkout
+	s.provisioner.PrepareOutput([]byte(commit + "\n"))   // rev-parse
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	d := Deploy{App: app.Name, Ref: "master"}
+	var buf bytes.Buffer
+	ctx := action.FWContext{Params: []interface{}{&app, &buf, &d}}
+	result, err := updateRepository.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.Equals, previous)
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(buf.String(), gocheck.Equals, "cloned")
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 4)
+	c.Assert(cmds[0].Cmd, gocheck.Matches, "^if .*git rev-parse HEAD \\| tee .git/tsuru-previous-head; fi$")
+	c.Assert(cmds[1].Cmd, gocheck.Matches, "^git clone .*")
+}
+
+func (s *S) TestUpdateRepositoryForwardFailureRestoresTheUnits(c *gocheck.C) {
+	previous := "e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28"
+	s.provisioner.PrepareOutput([]byte(previous + "\n"))          // save head
+	s.provisioner.PrepareOutput(nil)                              // clone
+	s.provisioner.PrepareOutput(nil)                              // checkout
+	s.provisioner.PrepareOutput([]byte("fatal: bad object HEAD")) // rev-parse
+	s.provisioner.PrepareOutput(nil)                              // restore head
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	d := Deploy{App: app.Name, Ref: "master"}
+	var buf bytes.Buffer
+	ctx := action.FWContext{Params: []interface{}{&app, &buf, &d}}
+	_, err := updateRepository.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to get the current commit: fatal: bad object HEAD")
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 5)
+	c.Assert(cmds[4].Cmd, gocheck.Matches, "^cd .* && if .*git checkout -q \\$\\(cat .git/tsuru-previous-head\\); fi$")
+}
+
+func (s *S) TestUpdateRepositoryBackward(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                 // restore head
+	s.provisioner.PrepareOutput([]byte("installed")) // install
+	s.provisioner.PrepareOutput(nil)                 // loadHooks
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	defer s.conn.Logs().Remove(bson.M{"appname": app.Name})
+	d := Deploy{App: app.Name, Ref: "master", Commit: commit}
+	var buf bytes.Buffer
+	ctx := action.BWContext{
+		Params:   []interface{}{&app, &buf, &d},
+		FWResult: "e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28",
+	}
+	updateRepository.Backward(ctx)
+	result := strings.Replace(buf.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, "^# ---> Deploy failed, rolling back to the previous version \\(e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28\\)#installed.*")
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 3)
+	c.Assert(cmds[0].Cmd, gocheck.Matches, "^cd .* && if .*git checkout -q \\$\\(cat .git/tsuru-previous-head\\); fi$")
+	c.Assert(cmds[1].Cmd, gocheck.Equals, "/var/lib/tsuru/hooks/dependencies")
+	c.Assert(s.provisioner.Restarts(&app), gocheck.Equals, 1)
+}
+
+func (s *S) TestUpdateRepositoryBackwardWithoutPreviousVersion(c *gocheck.C) {
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	d := Deploy{App: app.Name, Ref: "master", Commit: commit}
+	var buf bytes.Buffer
+	ctx := action.BWContext{Params: []interface{}{&app, &buf, &d}, FWResult: ""}
+	updateRepository.Backward(ctx)
+	c.Assert(buf.String(), gocheck.Equals, "")
+	c.Assert(s.provisioner.GetCmds("", &app), gocheck.HasLen, 0)
+	c.Assert(s.provisioner.Restarts(&app), gocheck.Equals, 0)
+}
+
+func (s *S) TestUpdateRepositoryMinParams(c *gocheck.C) {
+	c.Assert(updateRepository.MinParams, gocheck.Equals, 3)
+}
+
+func (s *S) TestUpdateApprcForward(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // backup apprc
+	s.provisioner.PrepareOutput(nil) // apprc
+	app := App{
+		Name: "cribs",
+		Env: map[string]bind.EnvVar{
+			"DATABASE_HOST": {Name: "DATABASE_HOST", Value: "localhost", Public: true},
+		},
+		Units: []Unit{{Name: "i-0800", State: "started"}},
+	}
+	ctx := action.FWContext{Params: []interface{}{&app}}
+	_, err := updateApprc.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 2)
+	expected := "cp /home/application/apprc /home/application/apprc.previous 2>/dev/null"
+	expected += " || rm -f /home/application/apprc.previous"
+	c.Assert(cmds[0].Cmd, gocheck.Equals, expected)
+	c.Assert(cmds[1].Cmd, gocheck.Matches, `(?s)^cat > /home/application/apprc <<END.*export DATABASE_HOST="localhost".*`)
+}
+
+func (s *S) TestUpdateApprcBackward(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // restore apprc
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	ctx := action.BWContext{Params: []interface{}{&app}}
+	updateApprc.Backward(ctx)
+	cmds := s.provisioner.GetCmds("", &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	expected := "if [ -f /home/application/apprc.previous ]; then"
+	expected += " mv /home/application/apprc.previous /home/application/apprc;"
+	expected += " else rm -f /home/application/apprc; fi"
+	c.Assert(cmds[0].Cmd, gocheck.Equals, expected)
+}
+
+func (s *S) TestUpdateApprcMinParams(c *gocheck.C) {
+	c.Assert(updateApprc.MinParams, gocheck.Equals, 1)
+}
+
+func (s *S) TestInstallDependenciesForward(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("installed"))
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	var buf bytes.Buffer
+	ctx := action.FWContext{Params: []interface{}{&app, &buf}}
+	_, err := installDependencies.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "\n ---> Installing dependencies\ninstalled")
+	cmds := s.provisioner.GetCmds("/var/lib/tsuru/hooks/dependencies", &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+}
+
+func (s *S) TestInstallDependenciesBackward(c *gocheck.C) {
+	c.Assert(installDependencies.Backward, gocheck.IsNil)
+}
+
+func (s *S) TestInstallDependenciesMinParams(c *gocheck.C) {
+	c.Assert(installDependencies.MinParams, gocheck.Equals, 2)
+}
+
+func (s *S) TestRestartAppForward(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil) // loadHooks
+	app := App{Name: "cribs", Units: []Unit{{Name: "i-0800", State: "started"}}}
+	defer s.conn.Logs().Remove(bson.M{"appname": app.Name})
+	var buf bytes.Buffer
+	ctx := action.FWContext{Params: []interface{}{&app, &buf}}
+	_, err := restartApp.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.Restarts(&app), gocheck.Equals, 1)
+}
+
+func (s *S) TestRestartAppForwardWithRollingRestart(c *gocheck.C) {
+	s.provisioner.PrepareOutput([]byte("rolling-restart:\n  batch-size: 1\n")) // loadHooks
+	app := App{
+		Name:  "cribs",
+		Units: []Unit{{Name: "cribs/0", State: "started"}, {Name: "cribs/1", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": app.Name})
+	s.provisioner.SetUnitStatus(&app, "cribs/0", provision.StatusStarted)
+	s.provisioner.SetUnitStatus(&app, "cribs/1", provision.StatusStarted)
+	var buf bytes.Buffer
+	ctx := action.FWContext{Params: []interface{}{&app, &buf}}
+	_, err := restartApp.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.Restarts(&app), gocheck.Equals, 0)
+	c.Assert(s.provisioner.RestartedUnits(&app), gocheck.DeepEquals, []string{"cribs/0", "cribs/1"})
+}
+
+func (s *S) TestRestartAppBackward(c *gocheck.C) {
+	c.Assert(restartApp.Backward, gocheck.IsNil)
+}
+
+func (s *S) TestRestartAppMinParams(c *gocheck.C) {
+	c.Assert(restartApp.MinParams, gocheck.Equals, 2)
+}
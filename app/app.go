@@ -39,6 +39,14 @@ var (
 	cnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][\w-.]+$`)
 )
 
+// rollingTimeout is the default time to wait for the units of a batch to
+// start in rolling restarts, and rollingInterval is the interval between
+// checks of their status.
+var (
+	rollingTimeout  = 5 * time.Minute
+	rollingInterval = time.Second
+)
+
 // App is the main type in tsuru. An app represents a real world application.
 // This struct holds information about the app: its name, address, list of
 // teams that have access to it, used platform, etc.
@@ -76,8 +84,19 @@ type Applog struct {
 }
 
 type conf struct {
-	PreRestart []string `yaml:"pre-restart"`
-	PosRestart []string `yaml:"post-restart"`
+	PreRestart     []string        `yaml:"pre-restart"`
+	PosRestart     []string        `yaml:"post-restart"`
+	RollingRestart rollingConf     `yaml:"rolling-restart"`
+	Healthcheck    healthcheckConf `yaml:"healthcheck"`
+}
+
+// rollingConf holds the rolling-restart section of app.conf, used in deploys.
+//
+// BatchSize is the number of units restarted at a time, and Timeout is the
+// number of seconds to wait for the units of a batch to start.
+type rollingConf struct {
+	BatchSize int `yaml:"batch-size"`
+	Timeout   int `yaml:"timeout"`
 }
 
 // Get queries the database and fills the App object with data retrieved from
@@ -207,6 +226,9 @@ func ForceDestroy(app *App) error {
 func (app *App) AddUnit(u *Unit) {
 	for i, unt := range app.Units {
 		if unt.Name == u.Name {
+			if u.ProcessName == "" {
+				u.ProcessName = unt.ProcessName
+			}
 			app.Units[i] = *u
 			return
 		}
@@ -216,11 +238,17 @@ func (app *App) AddUnit(u *Unit) {
 
 // AddUnits creates n new units within the provisioner, saves new units in the
 // database and enqueues the apprc serialization.
-func (app *App) AddUnits(n uint) error {
+//
+// The new units run the given process type, that must be declared in the
+// Procfile of the app. An empty process name means all processes.
+func (app *App) AddUnits(n uint, process string) error {
 	if n == 0 {
 		return stderr.New("Cannot add zero units.")
 	}
-	units, err := Provisioner.AddUnits(app, n)
+	if err := app.checkProcess(process); err != nil {
+		return err
+	}
+	units, err := Provisioner.AddUnits(app, n, process)
 	if err != nil {
 		return err
 	}
@@ -236,12 +264,13 @@ func (app *App) AddUnits(n uint) error {
 	mCount := 0
 	for i, unit := range units {
 		app.Units[i+length] = Unit{
-			Name:       unit.Name,
-			Type:       unit.Type,
-			Ip:         unit.Ip,
-			Machine:    unit.Machine,
-			State:      provision.StatusPending.String(),
-			InstanceId: unit.InstanceId,
+			Name:        unit.Name,
+			Type:        unit.Type,
+			Ip:          unit.Ip,
+			Machine:     unit.Machine,
+			State:       provision.StatusPending.String(),
+			InstanceId:  unit.InstanceId,
+			ProcessName: unit.ProcessName,
 		}
 		messages[mCount] = queue.Message{Action: RegenerateApprcAndStart, Args: []string{app.Name, unit.Name}}
 		messages[mCount+1] = queue.Message{Action: bindService, Args: []string{app.Name, unit.Name}}
@@ -333,7 +362,10 @@ func (app *App) removeUnits(indices []int) {
 //     2. Unbind units from service instances bound to the app
 //     3. Remove units from the app list
 //     4. Update the app in the database
-func (app *App) RemoveUnits(n uint) error {
+//
+// When process is not empty, only units running the given process type are
+// removed.
+func (app *App) RemoveUnits(n uint, process string) error {
 	if n == 0 {
 		return stderr.New("Cannot remove zero units.")
 	} else if l := uint(len(app.Units)); l == n {
@@ -341,13 +373,25 @@ func (app *App) RemoveUnits(n uint) error {
 	} else if n > l {
 		return fmt.Errorf("Cannot remove %d units from this app, it has only %d units.", n, l)
 	}
+	units := UnitSlice(app.Units)
+	sort.Sort(units)
+	var selected []int
+	for i, u := range units {
+		if uint(len(selected)) == n {
+			break
+		}
+		if process == "" || u.ProcessName == process {
+			selected = append(selected, i)
+		}
+	}
+	if l := uint(len(selected)); l < n {
+		return fmt.Errorf("Cannot remove %d units of the process %q from this app, it has only %d units of this process.", n, process, l)
+	}
 	var (
 		removed []int
 		err     error
 	)
-	units := UnitSlice(app.Units)
-	sort.Sort(units)
-	for i := 0; i < int(n); i++ {
+	for _, i := range selected {
 		err = Provisioner.RemoveUnit(app, units[i].GetName())
 		if err == nil {
 			removed = append(removed, i)
@@ -388,7 +432,7 @@ func (app *App) unbindUnit(unit provision.AppUnit) error {
 		return err
 	}
 	for _, instance := range instances {
-		err = instance.UnbindUnit(unit)
+		err = instance.UnbindUnit(app, unit)
 		if err != nil {
 			log.Printf("Error unbinding the unit %s with the service instance %s.", unit.GetIp(), instance.Name)
 		}
@@ -616,6 +660,18 @@ func (app *App) Command(stdout, stderr io.Writer, cmdArgs ...string) error {
 
 // Restart runs the restart hook for the app, writing its output to w.
 func (app *App) Restart(w io.Writer) error {
+	return app.RollingRestart(w, 0)
+}
+
+// RollingRestart runs the restart hook for the app in batches of batchSize
+// units, writing its output to w. Before restarting a batch, it waits for the
+// units of the previous batch to be started and to pass the health check, so
+// the app keeps serving requests during the restart.
+//
+// If batchSize is lower than 1, or the provisioner is not able to restart
+// units individually, all units are restarted at once, and then checked as
+// soon as the units of web processes are started.
+func (app *App) RollingRestart(w io.Writer, batchSize int) error {
 	app.Log("executing hook to restart", "tsuru")
 	err := app.preRestart(w)
 	if err != nil {
@@ -625,13 +681,96 @@ func (app *App) Restart(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = Provisioner.Restart(app)
+	if r, ok := Provisioner.(provision.UnitRestarter); ok && batchSize > 0 {
+		err = app.restartUnits(w, r, batchSize)
+	} else if err = Provisioner.Restart(app); err == nil && app.hasHealthcheck() {
+		units := app.ProvisionUnits()
+		if err = waitUnits(app, webUnitNames(units), app.rollingTimeout()); err != nil {
+			app.Log(err.Error(), "tsuru")
+		} else {
+			err = app.healthcheck(w, units)
+		}
+	}
 	if err != nil {
 		return err
 	}
 	return app.postRestart(w)
 }
 
+// restartUnits restarts the units of the app in batches, waiting for the
+// units of each batch to be started before moving on to the next one.
+func (app *App) restartUnits(w io.Writer, r provision.UnitRestarter, batchSize int) error {
+	timeout := app.rollingTimeout()
+	units := app.ProvisionUnits()
+	for start := 0; start < len(units); start += batchSize {
+		end := start + batchSize
+		if end > len(units) {
+			end = len(units)
+		}
+		names := make([]string, end-start)
+		for i, unit := range units[start:end] {
+			names[i] = unit.GetName()
+		}
+		msg := fmt.Sprintf(" ---> Restarting units %s\n", strings.Join(names, ", "))
+		if err := write(w, []byte(msg)); err != nil {
+			return err
+		}
+		for _, unit := range units[start:end] {
+			if err := r.RestartUnit(app, unit); err != nil {
+				return err
+			}
+		}
+		if err := waitUnits(app, names, timeout); err != nil {
+			app.Log(err.Error(), "tsuru")
+			return err
+		}
+		if err := app.healthcheck(w, units[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollingTimeout returns the time to wait for restarted units to start, defined
+// in app.conf or rollingTimeout.
+func (app *App) rollingTimeout() time.Duration {
+	if app.hooks != nil && app.hooks.RollingRestart.Timeout > 0 {
+		return time.Duration(app.hooks.RollingRestart.Timeout) * time.Second
+	}
+	return rollingTimeout
+}
+
+// waitUnits waits for the given units of the app to be reported as started by
+// the provisioner, giving up after the timeout.
+func waitUnits(app *App, names []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		units, err := Provisioner.CollectStatus()
+		if err != nil {
+			return err
+		}
+		started := make(map[string]bool)
+		for _, unit := range units {
+			if unit.AppName == app.Name && unit.Status == provision.StatusStarted {
+				started[unit.Name] = true
+			}
+		}
+		var pending []string
+		for _, name := range names {
+			if !started[name] {
+				pending = append(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for the units %s to start.", strings.Join(pending, ", "))
+		}
+		time.Sleep(rollingInterval)
+	}
+}
+
 // InstallDeps runs the dependencies hook for the app, writing its output to w.
 func (app *App) InstallDeps(w io.Writer) error {
 	return app.run("/var/lib/tsuru/hooks/dependencies", w)
@@ -781,10 +920,18 @@ func (app *App) UnsetEnvs(variableNames []string, publicOnly bool) error {
 // SetCName defines the CName of the app. It updates the attribute and saves
 // the app in the database, returning an error when it cannot save the change
 // in the database.
+//
+// If the provisioner is a provision.CNameManager, the cname is also set in the
+// provisioner, so the app starts responding to requests sent to it.
 func (app *App) SetCName(cname string) error {
 	if cname != "" && !cnameRegexp.MatchString(cname) {
 		return stderr.New("Invalid cname")
 	}
+	if manager, ok := Provisioner.(provision.CNameManager); ok {
+		if err := manager.SetCName(app, cname); err != nil {
+			return err
+		}
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -392,6 +392,18 @@ func (s *S) TestAppendOrUpdate(c *gocheck.C) {
 	c.Assert(a.Units[0], gocheck.DeepEquals, u)
 }
 
+func (s *S) TestAppendOrUpdateKeepsTheProcessName(c *gocheck.C) {
+	a := App{
+		Name:  "appName",
+		Units: []Unit{{Name: "i-00000zz8", ProcessName: "worker"}},
+	}
+	u := Unit{Name: "i-00000zz8", Ip: "192.168.0.12"}
+	a.AddUnit(&u)
+	c.Assert(a.Units, gocheck.HasLen, 1)
+	c.Assert(a.Units[0].Ip, gocheck.Equals, "192.168.0.12")
+	c.Assert(a.Units[0].ProcessName, gocheck.Equals, "worker")
+}
+
 func (s *S) TestAddUnits(c *gocheck.C) {
 	app := App{Name: "warpaint", Framework: "python"}
 	err := s.conn.Apps().Insert(app)
@@ -400,11 +412,11 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
 	otherApp := App{Name: "warpaint"}
-	err = otherApp.AddUnits(5)
+	err = otherApp.AddUnits(5, "")
 	c.Assert(err, gocheck.IsNil)
 	units := s.provisioner.GetUnits(&app)
 	c.Assert(units, gocheck.HasLen, 6)
-	err = otherApp.AddUnits(2)
+	err = otherApp.AddUnits(2, "")
 	c.Assert(err, gocheck.IsNil)
 	units = s.provisioner.GetUnits(&app)
 	c.Assert(units, gocheck.HasLen, 8)
@@ -440,16 +452,64 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(gotMessages, gocheck.DeepEquals, expectedMessages)
 }
 
+func (s *S) TestAddUnitsWithProcess(c *gocheck.C) {
+	app := App{
+		Name:      "warpaint",
+		Framework: "python",
+		Units:     []Unit{{Name: "warpaint/0", State: provision.StatusStarted.String()}},
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.PrepareOutput([]byte("web: python app.py\nworker: python worker.py\n"))
+	err = app.AddUnits(2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("cat /home/application/current/Procfile", &app)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, gocheck.HasLen, 3)
+	c.Assert(units[1].ProcessName, gocheck.Equals, "worker")
+	c.Assert(units[2].ProcessName, gocheck.Equals, "worker")
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.Units, gocheck.HasLen, 3)
+	c.Assert(app.Units[0].ProcessName, gocheck.Equals, "")
+	c.Assert(app.Units[1].ProcessName, gocheck.Equals, "worker")
+	c.Assert(app.Units[2].ProcessName, gocheck.Equals, "worker")
+	for i := 0; i < 4; i++ {
+		message, err := aqueue().Get(1e6)
+		c.Assert(err, gocheck.IsNil)
+		message.Delete()
+	}
+}
+
+func (s *S) TestAddUnitsWithUndefinedProcess(c *gocheck.C) {
+	app := App{
+		Name:      "warpaint",
+		Framework: "python",
+		Units:     []Unit{{Name: "warpaint/0", State: provision.StatusStarted.String()}},
+	}
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.PrepareOutput([]byte("web: python app.py\n"))
+	err := app.AddUnits(2, "worker")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Process "worker" is not defined in the Procfile.`)
+	c.Assert(s.provisioner.GetUnits(&app), gocheck.HasLen, 1)
+}
+
 func (s *S) TestAddZeroUnits(c *gocheck.C) {
 	app := App{Name: "warpaint", Framework: "ruby"}
-	err := app.AddUnits(0)
+	err := app.AddUnits(0, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add zero units.")
 }
 
 func (s *S) TestAddUnitsFailureInProvisioner(c *gocheck.C) {
 	app := App{Name: "scars", Framework: "golang"}
-	err := app.AddUnits(2)
+	err := app.AddUnits(2, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "App is not provisioned.")
 }
@@ -493,7 +553,7 @@ func (s *S) TestRemoveUnitsPriority(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	s.provisioner.Provision(&a)
-	s.provisioner.AddUnits(&a, 6)
+	s.provisioner.AddUnits(&a, 6, "")
 	un := a.ProvisionUnits()
 	c.Assert(&a, HasUnit, un[0])
 	c.Assert(&a, HasUnit, un[1])
@@ -501,19 +561,19 @@ func (s *S) TestRemoveUnitsPriority(c *gocheck.C) {
 	c.Assert(&a, HasUnit, un[3])
 	c.Assert(&a, HasUnit, un[4])
 	c.Assert(&a, HasUnit, un[5])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[4])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[1])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[3])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[2])
-	err = a.RemoveUnits(1)
+	err = a.RemoveUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(&a, gocheck.Not(HasUnit), un[5])
 	c.Assert(&a, HasUnit, un[0])
@@ -549,9 +609,9 @@ func (s *S) TestRemoveUnits(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	app.AddUnits(4)
+	app.AddUnits(4, "")
 	otherApp := App{Name: app.Name, Units: app.Units}
-	err = otherApp.RemoveUnits(2)
+	err = otherApp.RemoveUnits(2, "")
 	c.Assert(err, gocheck.IsNil)
 	ts.Close()
 	units := s.provisioner.GetUnits(&app)
@@ -605,14 +665,56 @@ func (s *S) TestRemoveUnitsInvalidValues(c *gocheck.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	s.provisioner.AddUnits(&app, 4)
+	s.provisioner.AddUnits(&app, 4, "")
 	for _, test := range tests {
-		err := app.RemoveUnits(test.n)
+		err := app.RemoveUnits(test.n, "")
 		c.Check(err, gocheck.NotNil)
 		c.Check(err.Error(), gocheck.Equals, test.expected)
 	}
 }
 
+func (s *S) TestRemoveUnitsOfProcess(c *gocheck.C) {
+	app := App{
+		Name:      "chemistry",
+		Framework: "python",
+		Units: []Unit{
+			{Name: "chemistry/0", ProcessName: "web"},
+			{Name: "chemistry/1", ProcessName: "worker"},
+			{Name: "chemistry/2", ProcessName: "web"},
+			{Name: "chemistry/3", ProcessName: "worker"},
+		},
+	}
+	err := s.conn.Apps().Insert(app)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
+	s.provisioner.Provision(&app)
+	defer s.provisioner.Destroy(&app)
+	s.provisioner.AddUnits(&app, 4, "")
+	err = app.RemoveUnits(2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	err = app.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(app.Units, gocheck.HasLen, 2)
+	c.Assert(app.Units[0].Name, gocheck.Equals, "chemistry/0")
+	c.Assert(app.Units[1].Name, gocheck.Equals, "chemistry/2")
+}
+
+func (s *S) TestRemoveUnitsOfProcessWithoutEnoughUnits(c *gocheck.C) {
+	app := App{
+		Name:      "chemistry",
+		Framework: "python",
+		Units: []Unit{
+			{Name: "chemistry/0", ProcessName: "web"},
+			{Name: "chemistry/1", ProcessName: "worker"},
+			{Name: "chemistry/2", ProcessName: "web"},
+		},
+	}
+	err := app.RemoveUnits(2, "worker")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Cannot remove 2 units of the process "worker" from this app, it has only 1 units of this process.`)
+	c.Assert(app.Units, gocheck.HasLen, 3)
+}
+
 func (s *S) TestRemoveUnitsFailureInProvisioner(c *gocheck.C) {
 	s.provisioner.PrepareFailure("RemoveUnit", stderr.New("Cannot remove this unit."))
 	app := App{
@@ -625,7 +727,7 @@ func (s *S) TestRemoveUnitsFailureInProvisioner(c *gocheck.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": app.Name})
 	s.provisioner.Provision(&app)
 	defer s.provisioner.Destroy(&app)
-	err = app.RemoveUnits(1)
+	err = app.RemoveUnits(1, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot remove this unit.")
 }
@@ -690,7 +792,7 @@ func (s *S) TestRemoveUnitByNameOrInstanceId(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	err = s.provisioner.Provision(&app)
 	c.Assert(err, gocheck.IsNil)
-	err = app.AddUnits(4)
+	err = app.AddUnits(4, "")
 	c.Assert(err, gocheck.IsNil)
 	defer func() {
 		s.provisioner.Destroy(&app)
@@ -742,7 +844,7 @@ func (s *S) TestRemoveAbsentUnit(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	err = s.provisioner.Provision(&app)
 	c.Assert(err, gocheck.IsNil)
-	err = app.AddUnits(1)
+	err = app.AddUnits(1, "")
 	c.Assert(err, gocheck.IsNil)
 	defer func() {
 		s.provisioner.Destroy(&app)
@@ -1045,6 +1147,21 @@ func (s *S) TestSetCName(c *gocheck.C) {
 	err = a.Get()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(a.CName, gocheck.Equals, "ktulu.mycompany.com")
+	c.Assert(s.provisioner.CName(&a), gocheck.Equals, "ktulu.mycompany.com")
+}
+
+func (s *S) TestSetCNameProvisionerFailure(c *gocheck.C) {
+	a := App{Name: "ktulu"}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	s.provisioner.PrepareFailure("SetCName", stderr.New("Failed to set cname."))
+	err = a.SetCName("ktulu.mycompany.com")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to set cname.")
+	err = a.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.CName, gocheck.Equals, "")
 }
 
 func (s *S) TestSetCNamePartialUpdate(c *gocheck.C) {
@@ -1186,6 +1303,41 @@ post-restart:
 	c.Assert(a.hooks.PosRestart, gocheck.DeepEquals, []string{"testdata/pos.sh"})
 }
 
+func (s *S) TestLoadHooksWithRollingRestart(c *gocheck.C) {
+	output := `rolling-restart:
+  batch-size: 2
+  timeout: 30
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := a.loadHooks()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(a.hooks.RollingRestart, gocheck.Equals, rollingConf{BatchSize: 2, Timeout: 30})
+}
+
+func (s *S) TestLoadHooksWithHealthcheck(c *gocheck.C) {
+	output := `healthcheck:
+  path: /status
+  status: 204
+  timeout: 3
+  retries: 5
+`
+	s.provisioner.PrepareOutput([]byte(output))
+	a := App{
+		Name:      "something",
+		Framework: "django",
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	err := a.loadHooks()
+	c.Assert(err, gocheck.IsNil)
+	expected := healthcheckConf{Path: "/status", Status: 204, Timeout: 3, Retries: 5}
+	c.Assert(a.hooks.Healthcheck, gocheck.Equals, expected)
+}
+
 func (s *S) TestLoadHooksWithError(c *gocheck.C) {
 	a := App{Name: "something", Framework: "django"}
 	err := a.loadHooks()
@@ -1356,6 +1508,118 @@ func (s *S) TestRestartRunsPosRestartHook(c *gocheck.C) {
 	c.Assert(content, gocheck.Matches, "^.*### ---> Running post-restart###.*$")
 }
 
+func (s *S) TestRollingRestart(c *gocheck.C) {
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		hooks:     &conf{},
+		Units: []Unit{
+			{Name: "someApp/0", State: "started"},
+			{Name: "someApp/1", State: "started"},
+			{Name: "someApp/2", State: "started"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	for _, u := range a.Units {
+		s.provisioner.SetUnitStatus(&a, u.Name, provision.StatusStarted)
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 2)
+	c.Assert(err, gocheck.IsNil)
+	result := strings.Replace(buf.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, ".*# ---> Restarting your app# ---> Restarting units someApp/0, someApp/1# ---> Restarting units someApp/2#.*")
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"someApp/0", "someApp/1", "someApp/2"})
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 0)
+}
+
+func (s *S) TestRollingRestartWaitsForTheUnitsToStart(c *gocheck.C) {
+	old := rollingInterval
+	rollingInterval = 10 * time.Millisecond
+	defer func() { rollingInterval = old }()
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		hooks:     &conf{},
+		Units: []Unit{
+			{Name: "someApp/0", State: "started"},
+			{Name: "someApp/1", State: "started"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusPending)
+	s.provisioner.SetUnitStatus(&a, "someApp/1", provision.StatusStarted)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusStarted)
+	}()
+	var buf bytes.Buffer
+	start := time.Now()
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(time.Since(start) >= 100*time.Millisecond, gocheck.Equals, true)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"someApp/0", "someApp/1"})
+}
+
+func (s *S) TestRollingRestartTimeout(c *gocheck.C) {
+	oldInterval, oldTimeout := rollingInterval, rollingTimeout
+	rollingInterval, rollingTimeout = 10*time.Millisecond, 50*time.Millisecond
+	defer func() { rollingInterval, rollingTimeout = oldInterval, oldTimeout }()
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		hooks:     &conf{},
+		Units: []Unit{
+			{Name: "someApp/0", State: "started"},
+			{Name: "someApp/1", State: "started"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusDown)
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 2)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Timed out waiting for the units someApp/0, someApp/1 to start.")
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name, "source": "tsuru"}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs[len(logs)-1].Message, gocheck.Equals, "Timed out waiting for the units someApp/0, someApp/1 to start.")
+}
+
+func (s *S) TestRollingRestartUsesTheTimeoutFromAppConf(c *gocheck.C) {
+	old := rollingInterval
+	rollingInterval = 10 * time.Millisecond
+	defer func() { rollingInterval = old }()
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		hooks:     &conf{RollingRestart: rollingConf{Timeout: 1}},
+		Units:     []Unit{{Name: "someApp/0", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusDown)
+	var buf bytes.Buffer
+	start := time.Now()
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.NotNil)
+	elapsed := time.Since(start)
+	c.Assert(elapsed >= time.Second && elapsed < 2*time.Second, gocheck.Equals, true)
+}
+
+func (s *S) TestRollingRestartWithoutBatchSizeRestartsAllUnits(c *gocheck.C) {
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		hooks:     &conf{},
+		Units:     []Unit{{Name: "someApp/0", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 0)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 1)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.HasLen, 0)
+}
+
 func (s *S) TestLog(c *gocheck.C) {
 	a := App{Name: "newApp"}
 	err := s.conn.Apps().Insert(a)
@@ -56,12 +56,14 @@ type Binder interface {
 	// BindApp makes the bind between the binder and an app.
 	BindApp(App) error
 
-	// BindUnit makes the bind between the binder and an unit.
-	BindUnit(App, Unit) (map[string]string, error)
+	// BindUnit authorizes an unit of the app to use the binder, without
+	// generating new credentials for the app.
+	BindUnit(App, Unit) error
 
 	// UnbindApp makes the unbind between the binder and an app.
 	UnbindApp(App) error
 
-	// UnbindUnit makes the unbind between the binder and an unit.
-	UnbindUnit(Unit) error
+	// UnbindUnit revokes the authorization of an unit of the app, without
+	// revoking the credentials of the app.
+	UnbindUnit(App, Unit) error
 }
@@ -0,0 +1,229 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/repository"
+	"io"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrDeployNotFound is the error returned when one tries to rollback an app
+// to a version that it does not have.
+var ErrDeployNotFound = stderr.New("Deploy not found.")
+
+// Deploy represents a deploy of an app.
+//
+// Deploys are stored in the deploys collection. Each deploy of an app gets a
+// version, starting at 1 and incremented on every new deploy, including
+// rollbacks and failed deploys. Rollbacks keep the ref and the commit of the
+// deploy they restore, and its version in RollbackTo.
+type Deploy struct {
+	App        string
+	Version    int
+	RollbackTo int
+	Ref        string
+	Commit     string
+	User       string
+	Timestamp  time.Time
+	Duration   time.Duration
+	Log        string
+	Success    bool
+	Error      string
+}
+
+const (
+	// maxDeployLogSize is the maximum size of the log stored with a deploy,
+	// keeping deploys well below the document size limit of MongoDB.
+	maxDeployLogSize = 1 << 20
+
+	// maxRecordAttempts is the maximum number of times a deploy is
+	// inserted, when concurrent deploys of the app take its version.
+	maxRecordAttempts = 10
+)
+
+// truncateLog keeps the last maxDeployLogSize bytes of the log, where the
+// errors of failed deploys are, dropping the beginning.
+func truncateLog(output string) string {
+	if len(output) <= maxDeployLogSize {
+		return output
+	}
+	start := len(output) - maxDeployLogSize
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return "[... truncated ...]\n" + output[start:]
+}
+
+// isDuplicateKey checks whether the error was caused by the violation of an
+// unique index.
+func isDuplicateKey(err error) bool {
+	if e, ok := err.(*mgo.LastError); ok {
+		return e.Code == 11000 || e.Code == 11001
+	}
+	return false
+}
+
+// record stores the deploy in the database, filling its version, duration,
+// log and outcome. The log is truncated to maxDeployLogSize.
+//
+// The version is the next after the last deploy of the app. Versions are
+// unique per app (see db.Storage.Deploys), so when a concurrent deploy takes
+// the version first, the insertion is retried with the next one.
+func (d *Deploy) record(output string, deployErr error) error {
+	d.Duration = time.Since(d.Timestamp)
+	d.Log = truncateLog(output)
+	d.Success = deployErr == nil
+	if deployErr != nil {
+		d.Error = deployErr.Error()
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for i := 0; i < maxRecordAttempts; i++ {
+		var last Deploy
+		err = conn.Deploys().Find(bson.M{"app": d.App}).Sort("-version").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		d.Version = last.Version + 1
+		if err = conn.Deploys().Insert(d); !isDuplicateKey(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Deploy updates the code of the app in its units to the given ref, installs
+// its dependencies and restarts it, writing the output to w. The ref may be a
+// branch, a tag or a commit, and defaults to repository.DefaultRef when empty.
+//
+// The deploy runs as a pipeline: if any step fails, the units are put back in
+// the previous commit, with the previous apprc file.
+//
+// The deploy is recorded with the commit that was deployed and the given user,
+// no matter whether it succeeds or fails.
+func (app *App) Deploy(w io.Writer, user, ref string) error {
+	if !repository.ValidRef(ref) {
+		return repository.ErrInvalidRef
+	}
+	if ref == "" {
+		ref = repository.DefaultRef
+	}
+	d := Deploy{App: app.Name, Ref: ref, User: user, Timestamp: time.Now()}
+	var buf bytes.Buffer
+	err := app.deploy(io.MultiWriter(w, &buf), &d)
+	if rerr := d.record(buf.String(), err); rerr != nil {
+		log.Printf("Failed to record the deploy of the app %q: %s", app.Name, rerr)
+	}
+	return err
+}
+
+func (app *App) deploy(w io.Writer, d *Deploy) error {
+	err := write(w, []byte("\n ---> Tsuru receiving push\n"))
+	if err != nil {
+		return err
+	}
+	err = write(w, []byte("\n ---> Replicating the application repository across units\n"))
+	if err != nil {
+		return err
+	}
+	pipeline := action.NewPipeline(&updateRepository, &updateApprc, &installDependencies, &restartApp)
+	err = pipeline.Execute(app, w, d)
+	if err != nil {
+		return err
+	}
+	return write(w, []byte("\n ---> Deploy done!\n\n"))
+}
+
+// Rollback puts the code of the app back in the commit of the given deploy
+// version, installs its dependencies and restarts it, writing the output to w.
+//
+// The rollback is recorded as a new deploy of the app.
+func (app *App) Rollback(w io.Writer, version int, user string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var target Deploy
+	err = conn.Deploys().Find(bson.M{"app": app.Name, "version": version}).One(&target)
+	if err == mgo.ErrNotFound {
+		return ErrDeployNotFound
+	} else if err != nil {
+		return err
+	}
+	if target.Commit == "" {
+		return fmt.Errorf("Deploy %d did not reach any commit, cannot rollback to it.", version)
+	}
+	d := Deploy{
+		App:        app.Name,
+		RollbackTo: target.Version,
+		Ref:        target.Ref,
+		Commit:     target.Commit,
+		User:       user,
+		Timestamp:  time.Now(),
+	}
+	var buf bytes.Buffer
+	err = app.rollback(io.MultiWriter(w, &buf), &target)
+	if rerr := d.record(buf.String(), err); rerr != nil {
+		log.Printf("Failed to record the rollback of the app %q: %s", app.Name, rerr)
+	}
+	return err
+}
+
+func (app *App) rollback(w io.Writer, target *Deploy) error {
+	msg := fmt.Sprintf("\n ---> Rolling back to version %d (%s)\n", target.Version, target.Commit)
+	err := write(w, []byte(msg))
+	if err != nil {
+		return err
+	}
+	out, err := repository.Checkout(app, target.Commit)
+	if werr := write(w, out); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to checkout the commit %s: %s", target.Commit, err)
+	}
+	err = write(w, []byte("\n ---> Installing dependencies\n"))
+	if err != nil {
+		return err
+	}
+	err = app.InstallDeps(w)
+	if err != nil {
+		return err
+	}
+	err = app.Restart(w)
+	if err != nil {
+		return err
+	}
+	return write(w, []byte("\n ---> Rollback done!\n\n"))
+}
+
+// Deploys returns the deploys of the app, from the newest to the oldest.
+func (app *App) Deploys() ([]Deploy, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deploys []Deploy
+	err = conn.Deploys().Find(bson.M{"app": app.Name}).Sort("-version").All(&deploys)
+	if err != nil {
+		return nil, err
+	}
+	return deploys, nil
+}
@@ -0,0 +1,264 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/repository"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const commit = "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9"
+
+func (s *S) TestDeploy(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                   // save head
+	s.provisioner.PrepareOutput([]byte("cloned"))      // clone
+	s.provisioner.PrepareOutput(nil)                   // checkout
+	s.provisioner.PrepareOutput([]byte(commit + "\n")) // rev-parse
+	s.provisioner.PrepareOutput(nil)                   // backup apprc
+	s.provisioner.PrepareOutput(nil)                   // apprc
+	s.provisioner.PrepareOutput([]byte("installed"))   // install
+	s.provisioner.PrepareOutput(nil)                   // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy(&buf, "someone@tsuru.io", "")
+	c.Assert(err, gocheck.IsNil)
+	result := strings.Replace(buf.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, ".*cloned.*# ---> Installing dependencies#installed.*# ---> Deploy done!##$")
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 1)
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, 1)
+	c.Assert(d.Ref, gocheck.Equals, "master")
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(d.User, gocheck.Equals, "someone@tsuru.io")
+	c.Assert(d.Success, gocheck.Equals, true)
+	c.Assert(d.Error, gocheck.Equals, "")
+	c.Assert(d.Log, gocheck.Equals, buf.String())
+	c.Assert(time.Since(d.Timestamp) < time.Minute, gocheck.Equals, true)
+	c.Assert(d.Duration > 0, gocheck.Equals, true)
+}
+
+func (s *S) TestDeployIncrementsTheVersion(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                   // save head
+	s.provisioner.PrepareOutput(nil)                   // clone
+	s.provisioner.PrepareOutput(nil)                   // checkout
+	s.provisioner.PrepareOutput([]byte(commit + "\n")) // rev-parse
+	s.provisioner.PrepareOutput(nil)                   // backup apprc
+	s.provisioner.PrepareOutput(nil)                   // apprc
+	s.provisioner.PrepareOutput(nil)                   // install
+	s.provisioner.PrepareOutput(nil)                   // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	err := s.conn.Deploys().Insert(Deploy{App: a.Name, Version: 3}, Deploy{App: "otherApp", Version: 7})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": "otherApp"})
+	var buf bytes.Buffer
+	err = a.Deploy(&buf, "someone@tsuru.io", "")
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name, "version": 4, "commit": commit}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestRecordConcurrentDeploys(c *gocheck.C) {
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": "someApp"})
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := Deploy{App: "someApp", Timestamp: time.Now()}
+			errs <- d.record("", nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Check(err, gocheck.IsNil)
+	}
+	var versions []int
+	err := s.conn.Deploys().Find(bson.M{"app": "someApp"}).Distinct("version", &versions)
+	c.Assert(err, gocheck.IsNil)
+	sort.Ints(versions)
+	c.Assert(versions, gocheck.DeepEquals, []int{1, 2, 3, 4, 5})
+}
+
+func (s *S) TestRecordTruncatesTheLog(c *gocheck.C) {
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": "someApp"})
+	output := strings.Repeat("x", maxDeployLogSize) + "failed to install"
+	d := Deploy{App: "someApp", Timestamp: time.Now()}
+	err := d.record(output, nil)
+	c.Assert(err, gocheck.IsNil)
+	var stored Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": "someApp"}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(strings.HasPrefix(stored.Log, "[... truncated ...]\n"), gocheck.Equals, true)
+	c.Assert(strings.HasSuffix(stored.Log, "failed to install"), gocheck.Equals, true)
+	c.Assert(len(stored.Log) <= maxDeployLogSize+len("[... truncated ...]\n"), gocheck.Equals, true)
+}
+
+func (s *S) TestDeployRef(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                   // save head
+	s.provisioner.PrepareOutput(nil)                   // clone
+	s.provisioner.PrepareOutput(nil)                   // checkout
+	s.provisioner.PrepareOutput([]byte(commit + "\n")) // rev-parse
+	s.provisioner.PrepareOutput(nil)                   // backup apprc
+	s.provisioner.PrepareOutput(nil)                   // apprc
+	s.provisioner.PrepareOutput(nil)                   // install
+	s.provisioner.PrepareOutput(nil)                   // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy(&buf, "someone@tsuru.io", "refs/heads/release-1.2")
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("cd /home/application/current && git checkout -q origin/release-1.2", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Ref, gocheck.Equals, "refs/heads/release-1.2")
+	c.Assert(d.Commit, gocheck.Equals, commit)
+}
+
+func (s *S) TestDeployInvalidRef(c *gocheck.C) {
+	a := App{Name: "someApp"}
+	var buf bytes.Buffer
+	err := a.Deploy(&buf, "someone@tsuru.io", "master && reboot")
+	c.Assert(err, gocheck.Equals, repository.ErrInvalidRef)
+	c.Assert(s.provisioner.GetCmds("", &a), gocheck.HasLen, 0)
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestDeployRecordsFailures(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                                   // save head
+	s.provisioner.PrepareOutput(nil)                                   // clone
+	s.provisioner.PrepareOutput(nil)                                   // checkout
+	s.provisioner.PrepareOutput([]byte("fatal: Not a git repository")) // rev-parse
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err := a.Deploy(&buf, "someone@tsuru.io", "")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to get the current commit: fatal: Not a git repository")
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 0)
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.Version, gocheck.Equals, 1)
+	c.Assert(d.Commit, gocheck.Equals, "")
+	c.Assert(d.Success, gocheck.Equals, false)
+	c.Assert(d.Error, gocheck.Equals, "Failed to get the current commit: fatal: Not a git repository")
+	c.Assert(d.Log, gocheck.Equals, buf.String())
+}
+
+func (s *S) TestRollback(c *gocheck.C) {
+	s.provisioner.PrepareOutput(nil)                 // checkout
+	s.provisioner.PrepareOutput([]byte("installed")) // install
+	s.provisioner.PrepareOutput(nil)                 // loadHooks
+	a := App{
+		Name:      "someApp",
+		Framework: "django",
+		Teams:     []string{s.team.Name},
+		Units:     []Unit{{Name: "i-0800", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	err := s.conn.Deploys().Insert(
+		Deploy{App: a.Name, Version: 1, Ref: "release-1.0", Commit: commit, Success: true},
+		Deploy{App: a.Name, Version: 2, Ref: "master", Commit: "e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28", Success: true},
+	)
+	c.Assert(err, gocheck.IsNil)
+	var buf bytes.Buffer
+	err = a.Rollback(&buf, 1, "someone@tsuru.io")
+	c.Assert(err, gocheck.IsNil)
+	result := strings.Replace(buf.String(), "\n", "#", -1)
+	c.Assert(result, gocheck.Matches, "^# ---> Rolling back to version 1 \\("+commit+"\\)#.*# ---> Rollback done!##$")
+	cmds := s.provisioner.GetCmds("cd /home/application/current && git checkout -q "+commit, &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 1)
+	var d Deploy
+	err = s.conn.Deploys().Find(bson.M{"app": a.Name, "version": 3}).One(&d)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(d.RollbackTo, gocheck.Equals, 1)
+	c.Assert(d.Ref, gocheck.Equals, "release-1.0")
+	c.Assert(d.Commit, gocheck.Equals, commit)
+	c.Assert(d.User, gocheck.Equals, "someone@tsuru.io")
+	c.Assert(d.Success, gocheck.Equals, true)
+	c.Assert(d.Log, gocheck.Equals, buf.String())
+}
+
+func (s *S) TestRollbackVersionNotFound(c *gocheck.C) {
+	a := App{Name: "someApp"}
+	var buf bytes.Buffer
+	err := a.Rollback(&buf, 10, "someone@tsuru.io")
+	c.Assert(err, gocheck.Equals, ErrDeployNotFound)
+	n, err := s.conn.Deploys().Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestRollbackToDeployWithoutCommit(c *gocheck.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Deploys().Insert(Deploy{App: a.Name, Version: 1, Error: "Failed to update the repository"})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": a.Name})
+	var buf bytes.Buffer
+	err = a.Rollback(&buf, 1, "someone@tsuru.io")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Deploy 1 did not reach any commit, cannot rollback to it.")
+	c.Assert(s.provisioner.GetCmds("", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestDeploys(c *gocheck.C) {
+	a := App{Name: "someApp"}
+	err := s.conn.Deploys().Insert(
+		Deploy{App: a.Name, Version: 1, Commit: commit},
+		Deploy{App: a.Name, Version: 3, Commit: commit},
+		Deploy{App: a.Name, Version: 2, Commit: "e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28"},
+		Deploy{App: "otherApp", Version: 1, Commit: commit},
+	)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Deploys().RemoveAll(bson.M{"app": bson.M{"$in": []string{a.Name, "otherApp"}}})
+	deploys, err := a.Deploys()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(deploys, gocheck.HasLen, 3)
+	c.Assert(deploys[0].Version, gocheck.Equals, 3)
+	c.Assert(deploys[1].Version, gocheck.Equals, 2)
+	c.Assert(deploys[2].Version, gocheck.Equals, 1)
+}
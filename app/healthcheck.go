@@ -0,0 +1,130 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// healthcheckInterval is the interval between retries of a failed health
+// check.
+var healthcheckInterval = time.Second
+
+// healthcheckConf holds the healthcheck section of app.conf.
+//
+// Path is the path requested in each unit of the app. Status is the expected
+// status of the response (defaults to 200), Timeout is the number of seconds
+// to wait for the response (defaults to 10) and Retries is the number of
+// times the request is retried before the health check is considered failed.
+type healthcheckConf struct {
+	Path    string `yaml:"path"`
+	Status  int    `yaml:"status"`
+	Timeout int    `yaml:"timeout"`
+	Retries int    `yaml:"retries"`
+}
+
+// unitAddr returns the address where the given unit serves requests: its IP,
+// in the port of web processes of the provisioner (see provision.WebPorter).
+// Units whose address already includes the port are probed in it.
+func unitAddr(unit provision.AppUnit) string {
+	ip := unit.GetIp()
+	if _, _, err := net.SplitHostPort(ip); err == nil {
+		return ip
+	}
+	if p, ok := Provisioner.(provision.WebPorter); ok {
+		return net.JoinHostPort(ip, strconv.Itoa(p.WebPort()))
+	}
+	return ip
+}
+
+// probe sends a GET request to the path of the health check in the given
+// address, retrying it in case of failure.
+func (hc *healthcheckConf) probe(addr string) error {
+	status := hc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	timeout := 10 * time.Second
+	if hc.Timeout > 0 {
+		timeout = time.Duration(hc.Timeout) * time.Second
+	}
+	client := http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.DialTimeout(network, addr, timeout)
+			},
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+	url := "http://" + addr + "/" + strings.TrimLeft(hc.Path, "/")
+	var err error
+	for i := 0; ; i++ {
+		var resp *http.Response
+		resp, err = client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == status {
+				return nil
+			}
+			err = fmt.Errorf("GET %s returned status %d, expected %d", url, resp.StatusCode, status)
+		}
+		if i >= hc.Retries {
+			return err
+		}
+		time.Sleep(healthcheckInterval)
+	}
+}
+
+// healthcheck checks that the given units of the app are serving requests,
+// probing each of them as defined in the healthcheck section of app.conf. It
+// does nothing if app.conf does not define a health check. Units running
+// process types other than web (like workers) don't serve requests, and are
+// not probed.
+//
+// The outcome of each probe is logged with source tsuru.
+func (app *App) healthcheck(w io.Writer, units []provision.AppUnit) error {
+	if !app.hasHealthcheck() {
+		return nil
+	}
+	for _, unit := range units {
+		if !provision.IsWebProcess(unit.GetProcessName()) {
+			continue
+		}
+		if err := app.hooks.Healthcheck.probe(unitAddr(unit)); err != nil {
+			msg := fmt.Sprintf("Health check of the unit %s failed: %s.", unit.GetName(), err)
+			app.Log(msg, "tsuru")
+			return stderr.New(msg)
+		}
+		msg := fmt.Sprintf("Health check of the unit %s passed.", unit.GetName())
+		app.Log(msg, "tsuru")
+		if err := write(w, []byte(" ---> "+msg+"\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *App) hasHealthcheck() bool {
+	return app.hooks != nil && app.hooks.Healthcheck.Path != ""
+}
+
+// webUnitNames returns the names of the given units that run web processes.
+func webUnitNames(units []provision.AppUnit) []string {
+	var names []string
+	for _, unit := range units {
+		if provision.IsWebProcess(unit.GetProcessName()) {
+			names = append(names, unit.GetName())
+		}
+	}
+	return names
+}
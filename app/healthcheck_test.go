@@ -0,0 +1,339 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/provision"
+	ttesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func (s *S) TestHealthcheckProbe(c *gocheck.C) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer ts.Close()
+	hc := healthcheckConf{Path: "healthcheck"}
+	err := hc.probe(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(path, gocheck.Equals, "/healthcheck")
+}
+
+func (s *S) TestHealthcheckProbeExpectedStatus(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	hc := healthcheckConf{Path: "/status", Status: http.StatusNoContent}
+	err := hc.probe(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestHealthcheckProbeUnexpectedStatus(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+	hc := healthcheckConf{Path: "/status"}
+	err := hc.probe(addr)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "GET http://"+addr+"/status returned status 500, expected 200")
+}
+
+func (s *S) TestHealthcheckProbeRetries(c *gocheck.C) {
+	old := healthcheckInterval
+	healthcheckInterval = 10 * time.Millisecond
+	defer func() { healthcheckInterval = old }()
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	hc := healthcheckConf{Path: "/status", Retries: 2}
+	err := hc.probe(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(3))
+}
+
+func (s *S) TestHealthcheckProbeGivesUpAfterTheRetries(c *gocheck.C) {
+	old := healthcheckInterval
+	healthcheckInterval = 10 * time.Millisecond
+	defer func() { healthcheckInterval = old }()
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	hc := healthcheckConf{Path: "/status", Retries: 2}
+	err := hc.probe(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(3))
+}
+
+func (s *S) TestHealthcheckProbeTimeout(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer ts.Close()
+	hc := healthcheckConf{Path: "/status", Timeout: 1}
+	start := time.Now()
+	err := hc.probe(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(time.Since(start) < 2*time.Second, gocheck.Equals, true)
+}
+
+func (s *S) TestHealthcheck(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{
+			{Name: "someApp/0", Ip: ts.Listener.Addr().String()},
+			{Name: "someApp/1", Ip: ts.Listener.Addr().String()},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	var buf bytes.Buffer
+	err := a.healthcheck(&buf, a.ProvisionUnits())
+	c.Assert(err, gocheck.IsNil)
+	expected := " ---> Health check of the unit someApp/0 passed.\n ---> Health check of the unit someApp/1 passed.\n"
+	c.Assert(buf.String(), gocheck.Equals, expected)
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name, "source": "tsuru"}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].Message, gocheck.Equals, "Health check of the unit someApp/0 passed.")
+	c.Assert(logs[1].Message, gocheck.Equals, "Health check of the unit someApp/1 passed.")
+}
+
+func (s *S) TestHealthcheckSkipsUnitsThatDoNotServeRequests(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{
+			{Name: "someApp/0", Ip: ts.Listener.Addr().String(), ProcessName: "web"},
+			{Name: "someApp/1", Ip: "127.0.0.1:1", ProcessName: "worker"},
+			{Name: "someApp/2", Ip: "127.0.0.1:1", ProcessName: "clock"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	var buf bytes.Buffer
+	err := a.healthcheck(&buf, a.ProvisionUnits())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, " ---> Health check of the unit someApp/0 passed.\n")
+}
+
+type webPortProvisioner struct {
+	*ttesting.FakeProvisioner
+	port int
+}
+
+func (p *webPortProvisioner) WebPort() int {
+	return p.port
+}
+
+func (s *S) TestHealthcheckUsesTheWebPortOfTheProvisioner(c *gocheck.C) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	c.Assert(err, gocheck.IsNil)
+	n, err := strconv.Atoi(port)
+	c.Assert(err, gocheck.IsNil)
+	Provisioner = &webPortProvisioner{FakeProvisioner: s.provisioner, port: n}
+	defer func() { Provisioner = s.provisioner }()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{{Name: "someApp/0", Ip: host}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	var buf bytes.Buffer
+	err = a.healthcheck(&buf, a.ProvisionUnits())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(1))
+}
+
+func (s *S) TestHealthcheckFailure(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{{Name: "someApp/0", Ip: addr}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	var buf bytes.Buffer
+	err := a.healthcheck(&buf, a.ProvisionUnits())
+	c.Assert(err, gocheck.NotNil)
+	expected := "Health check of the unit someApp/0 failed: GET http://" + addr + "/status returned status 404, expected 200."
+	c.Assert(err.Error(), gocheck.Equals, expected)
+	var logs []Applog
+	err = s.conn.Logs().Find(bson.M{"appname": a.Name, "source": "tsuru"}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, expected)
+}
+
+func (s *S) TestHealthcheckWithoutPath(c *gocheck.C) {
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{},
+		Units: []Unit{{Name: "someApp/0", Ip: "127.0.0.1:1"}},
+	}
+	var buf bytes.Buffer
+	err := a.healthcheck(&buf, a.ProvisionUnits())
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "")
+}
+
+func (s *S) TestRestartRunsTheHealthcheck(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{PosRestart: []string{"pos.sh"}, Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{{Name: "someApp/0", Ip: ts.Listener.Addr().String(), State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusStarted)
+	var buf bytes.Buffer
+	err := a.Restart(&buf)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Matches, "^Health check of the unit someApp/0 failed: .*")
+	c.Assert(s.provisioner.Restarts(&a), gocheck.Equals, 1)
+	c.Assert(strings.Contains(buf.String(), "post-restart"), gocheck.Equals, false)
+}
+
+func (s *S) TestRestartWaitsForTheUnitsBeforeTheHealthcheck(c *gocheck.C) {
+	old := rollingInterval
+	rollingInterval = 10 * time.Millisecond
+	defer func() { rollingInterval = old }()
+	var started, early int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&started) == 0 {
+			atomic.AddInt32(&early, 1)
+		}
+	}))
+	defer ts.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{
+			{Name: "someApp/0", Ip: ts.Listener.Addr().String(), State: "started", ProcessName: "web"},
+			{Name: "someApp/1", Ip: "127.0.0.1:1", State: "started", ProcessName: "worker"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusPending)
+	s.provisioner.SetUnitStatus(&a, "someApp/1", provision.StatusDown)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&started, 1)
+		s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusStarted)
+	}()
+	var buf bytes.Buffer
+	err := a.Restart(&buf)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&early), gocheck.Equals, int32(0))
+	c.Assert(buf.String(), gocheck.Matches, "(?s).* ---> Health check of the unit someApp/0 passed.*")
+}
+
+func (s *S) TestRestartTimesOutWaitingForTheUnitsBeforeTheHealthcheck(c *gocheck.C) {
+	oldInterval, oldTimeout := rollingInterval, rollingTimeout
+	rollingInterval, rollingTimeout = 10*time.Millisecond, 50*time.Millisecond
+	defer func() { rollingInterval, rollingTimeout = oldInterval, oldTimeout }()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{{Name: "someApp/0", Ip: "127.0.0.1:1", State: "started"}},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.SetUnitStatus(&a, "someApp/0", provision.StatusPending)
+	var buf bytes.Buffer
+	err := a.Restart(&buf)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Timed out waiting for the units someApp/0 to start.")
+}
+
+func (s *S) TestRollingRestartChecksEachBatch(c *gocheck.C) {
+	var calls int32
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{
+			{Name: "someApp/0", Ip: healthy.Listener.Addr().String(), State: "started"},
+			{Name: "someApp/1", Ip: broken.Listener.Addr().String(), State: "started"},
+			{Name: "someApp/2", Ip: healthy.Listener.Addr().String(), State: "started"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	for _, u := range a.Units {
+		s.provisioner.SetUnitStatus(&a, u.Name, provision.StatusStarted)
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Matches, "^Health check of the unit someApp/1 failed: .*")
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"someApp/0", "someApp/1"})
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(1))
+}
+
+func (s *S) TestRollingRestartWithWorkersRunsTheHealthcheckOnWebUnits(c *gocheck.C) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+	a := App{
+		Name:  "someApp",
+		hooks: &conf{Healthcheck: healthcheckConf{Path: "/status"}},
+		Units: []Unit{
+			{Name: "someApp/0", Ip: ts.Listener.Addr().String(), State: "started", ProcessName: "web"},
+			{Name: "someApp/1", Ip: "127.0.0.1:1", State: "started", ProcessName: "worker"},
+		},
+	}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	for _, u := range a.Units {
+		s.provisioner.SetUnitStatus(&a, u.Name, provision.StatusStarted)
+	}
+	var buf bytes.Buffer
+	err := a.RollingRestart(&buf, 1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.RestartedUnits(&a), gocheck.DeepEquals, []string{"someApp/0", "someApp/1"})
+	c.Assert(atomic.LoadInt32(&calls), gocheck.Equals, int32(1))
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/repository"
+	"path"
+	"strings"
+)
+
+// parseProcfile parses the content of a Procfile, returning a map from the
+// name of each process type to its command.
+//
+// Each line of a Procfile declares one process type, in the format
+// "<name>: <command>". Blank lines and lines starting with # are ignored.
+func parseProcfile(content []byte) map[string]string {
+	procs := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+		procs[name] = strings.TrimSpace(parts[1])
+	}
+	return procs
+}
+
+// unitApp restricts the app to one of its units, so provisioners run
+// commands only in this unit.
+type unitApp struct {
+	*App
+	unit provision.AppUnit
+}
+
+func (a unitApp) ProvisionUnits() []provision.AppUnit {
+	return []provision.AppUnit{a.unit}
+}
+
+// loadProcfile loads the process types declared in the Procfile of the app,
+// reading it from one of the started units of the app.
+//
+// It returns a validation error if the app has no started units or no
+// Procfile.
+func (app *App) loadProcfile() (map[string]string, error) {
+	var unit provision.AppUnit
+	for _, u := range app.ProvisionUnits() {
+		if u.GetStatus() == provision.StatusStarted {
+			unit = u
+			break
+		}
+	}
+	if unit == nil {
+		msg := "The app must have a started unit for reading its Procfile."
+		return nil, &errors.ValidationError{Message: msg}
+	}
+	uRepo, err := repository.GetPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := "cat " + path.Join(uRepo, "Procfile")
+	var buf bytes.Buffer
+	if err = Provisioner.ExecuteCommand(&buf, &buf, unitApp{app, unit}, cmd); err != nil {
+		app.Log(fmt.Sprintf("Failed to read the Procfile: %s: %s", err, buf.String()), "tsuru")
+		msg := "The app has no Procfile. Units of a single process type require a Procfile in the root of the app."
+		return nil, &errors.ValidationError{Message: msg}
+	}
+	return parseProcfile(buf.Bytes()), nil
+}
+
+// checkProcess returns an error if the given process type is not declared in
+// the Procfile of the app. An empty name means all processes and is always
+// valid.
+func (app *App) checkProcess(process string) error {
+	if process == "" {
+		return nil
+	}
+	procs, err := app.loadProcfile()
+	if err != nil {
+		return err
+	}
+	if _, ok := procs[process]; !ok {
+		msg := fmt.Sprintf("Process %q is not defined in the Procfile.", process)
+		return &errors.ValidationError{Message: msg}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/provision"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestParseProcfile(c *gocheck.C) {
+	content := []byte(`# processes of the app
+web: gunicorn -b 0.0.0.0:$PORT app:app
+
+worker:python worker.py --queue=default
+invalid line
+: no name
+`)
+	expected := map[string]string{
+		"web":    "gunicorn -b 0.0.0.0:$PORT app:app",
+		"worker": "python worker.py --queue=default",
+	}
+	c.Assert(parseProcfile(content), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCheckProcessWithoutProcess(c *gocheck.C) {
+	a := App{Name: "someApp"}
+	err := a.checkProcess("")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.provisioner.GetCmds("", &a), gocheck.HasLen, 0)
+}
+
+func (s *S) TestCheckProcess(c *gocheck.C) {
+	a := App{
+		Name: "someApp",
+		Units: []Unit{
+			{Name: "someApp/0", State: provision.StatusPending.String()},
+			{Name: "someApp/1", State: provision.StatusStarted.String()},
+			{Name: "someApp/2", State: provision.StatusStarted.String()},
+		},
+	}
+	s.provisioner.PrepareOutput([]byte("web: python app.py\nworker: python worker.py\n"))
+	err := a.checkProcess("worker")
+	c.Assert(err, gocheck.IsNil)
+	cmds := s.provisioner.GetCmds("cat /home/application/current/Procfile", &a)
+	c.Assert(cmds, gocheck.HasLen, 1)
+	units := cmds[0].App.ProvisionUnits()
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].GetName(), gocheck.Equals, "someApp/1")
+}
+
+func (s *S) TestCheckProcessNotDefined(c *gocheck.C) {
+	a := App{Name: "someApp", Units: []Unit{{Name: "someApp/0", State: provision.StatusStarted.String()}}}
+	s.provisioner.PrepareOutput([]byte("web: python app.py\n"))
+	err := a.checkProcess("worker")
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `Process "worker" is not defined in the Procfile.`)
+}
+
+func (s *S) TestCheckProcessWithoutProcfile(c *gocheck.C) {
+	a := App{Name: "someApp", Units: []Unit{{Name: "someApp/0", State: provision.StatusStarted.String()}}}
+	defer s.conn.Logs().Remove(bson.M{"appname": a.Name})
+	s.provisioner.PrepareFailure("ExecuteCommand", stderr.New("exit status 1"))
+	err := a.checkProcess("worker")
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "The app has no Procfile. Units of a single process type require a Procfile in the root of the app.")
+}
+
+func (s *S) TestCheckProcessWithoutStartedUnits(c *gocheck.C) {
+	a := App{Name: "someApp", Units: []Unit{{Name: "someApp/0", State: provision.StatusPending.String()}}}
+	err := a.checkProcess("worker")
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "The app must have a started unit for reading its Procfile.")
+	c.Assert(s.provisioner.GetCmds("", &a), gocheck.HasLen, 0)
+}
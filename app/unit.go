@@ -13,14 +13,18 @@ import (
 // The unit is equivalent to a machine. How the machine is actually represented
 // (baremetal, virtual machine, jails, containers, etc.) is up to the
 // provisioner.
+//
+// Each unit may run a single process type from the Procfile of the app,
+// identified by ProcessName. Units without a process name run all processes.
 type Unit struct {
-	Name       string
-	Type       string
-	Machine    int
-	InstanceId string
-	Ip         string
-	State      string
-	app        *App
+	Name        string
+	Type        string
+	Machine     int
+	InstanceId  string
+	Ip          string
+	State       string
+	ProcessName string
+	app         *App
 }
 
 func (u *Unit) GetName() string {
@@ -43,6 +47,10 @@ func (u *Unit) GetInstanceId() string {
 	return u.InstanceId
 }
 
+func (u *Unit) GetProcessName() string {
+	return u.ProcessName
+}
+
 // UnitSlice attaches the methods of sort.Interface to []Unit, sorting in increasing order.
 type UnitSlice []Unit
 
@@ -43,6 +43,11 @@ func (s *S) TestUnitGetStatus(c *gocheck.C) {
 	}
 }
 
+func (s *S) TestUnitGetProcessName(c *gocheck.C) {
+	u := Unit{ProcessName: "worker"}
+	c.Assert(u.GetProcessName(), gocheck.Equals, "worker")
+}
+
 func (s *S) TestUnitShouldBeABinderUnit(c *gocheck.C) {
 	var _ bind.Unit = &Unit{}
 }
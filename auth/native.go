@@ -0,0 +1,32 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+func init() {
+	RegisterScheme("native", NativeScheme{})
+}
+
+// NativeScheme authenticates users with the email and the password stored in
+// tsuru's database.
+type NativeScheme struct{}
+
+// Authenticate checks the password of the user. The params must contain the
+// email and the password of the user.
+func (NativeScheme) Authenticate(params map[string]string) (*User, error) {
+	u, err := GetUserByEmail(params["email"])
+	if err != nil {
+		return nil, err
+	}
+	if err = u.CheckPassword(params["password"]); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Info returns nothing, clients of the native scheme just ask the user for
+// the password.
+func (NativeScheme) Info() (map[string]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/validation"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	RegisterScheme("oauth", OAuthScheme{})
+}
+
+// OAuthFailure is returned when the OAuth2 provider refuses to authenticate
+// the user.
+type OAuthFailure struct {
+	Reason string
+}
+
+func (e OAuthFailure) Error() string {
+	return "Authentication failed: " + e.Reason
+}
+
+type oauthConfig struct {
+	clientId     string
+	clientSecret string
+	scope        string
+	authUrl      string
+	tokenUrl     string
+	infoUrl      string
+	callbackPort string
+}
+
+func loadOAuthConfig() (*oauthConfig, error) {
+	var c oauthConfig
+	settings := []struct {
+		name     string
+		value    *string
+		required bool
+	}{
+		{"client-id", &c.clientId, true},
+		{"client-secret", &c.clientSecret, true},
+		{"scope", &c.scope, false},
+		{"auth-url", &c.authUrl, true},
+		{"token-url", &c.tokenUrl, true},
+		{"info-url", &c.infoUrl, true},
+	}
+	for _, s := range settings {
+		value, err := config.GetString("auth:oauth:" + s.name)
+		if err != nil && s.required {
+			return nil, fmt.Errorf(`Setting "auth:oauth:%s" is undefined.`, s.name)
+		}
+		*s.value = value
+	}
+	c.callbackPort = "0"
+	if port, err := config.Get("auth:oauth:callback-port"); err == nil {
+		c.callbackPort = fmt.Sprint(port)
+	}
+	return &c, nil
+}
+
+// OAuthScheme authenticates users with an OAuth2 provider, using the
+// authorization code flow. Clients send the user to the authorization url of
+// the provider, which redirects them back to the client with a code. The
+// scheme exchanges the code for an access token, and uses the token to get
+// the email of the user in the provider.
+//
+// The scheme is configured with the settings under "auth:oauth": client-id,
+// client-secret, scope (optional), auth-url, token-url, info-url (the url
+// that returns the user as a JSON object with the email attribute) and
+// callback-port (the port in which clients listen for the redirect, defaults
+// to any free port).
+type OAuthScheme struct{}
+
+// Info returns the url that clients must open to authorize tsuru in the
+// provider (authorizeUrl, without the redirect_uri parameter) and the port in
+// which the clients should listen for the redirect (port).
+func (OAuthScheme) Info() (map[string]string, error) {
+	c, err := loadOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(c.authUrl)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("client_id", c.clientId)
+	q.Set("response_type", "code")
+	if c.scope != "" {
+		q.Set("scope", c.scope)
+	}
+	u.RawQuery = q.Encode()
+	return map[string]string{"authorizeUrl": u.String(), "port": c.callbackPort}, nil
+}
+
+// Authenticate exchanges the authorization code for an access token, and
+// returns the user with the email provided by the provider. The params must
+// contain the code and the redirect url used to get the code (redirectUrl).
+func (OAuthScheme) Authenticate(params map[string]string) (*User, error) {
+	code := params["code"]
+	if code == "" {
+		return nil, &errors.ValidationError{Message: "You must provide the authorization code."}
+	}
+	c, err := loadOAuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := c.exchange(code, params["redirectUrl"])
+	if err != nil {
+		return nil, err
+	}
+	email, err := c.email(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := GetUserByEmail(email); err == nil {
+		return u, nil
+	}
+	return &User{Email: email}, nil
+}
+
+// exchange exchanges the authorization code for an access token.
+func (c *oauthConfig) exchange(code, redirectUrl string) (string, error) {
+	body := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectUrl},
+		"client_id":     {c.clientId},
+		"client_secret": {c.clientSecret},
+	}
+	req, err := http.NewRequest("POST", c.tokenUrl, strings.NewReader(body.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = doJSON(req, &result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", OAuthFailure{Reason: "the provider did not return an access token"}
+	}
+	return result.AccessToken, nil
+}
+
+// email returns the email of the owner of the access token.
+func (c *oauthConfig) email(accessToken string) (string, error) {
+	req, err := http.NewRequest("GET", c.infoUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var info struct {
+		Email string `json:"email"`
+	}
+	if err = doJSON(req, &info); err != nil {
+		return "", err
+	}
+	if !validation.ValidateEmail(info.Email) {
+		return "", OAuthFailure{Reason: "the provider did not return a valid email"}
+	}
+	return info.Email, nil
+}
+
+// doJSON sends the request to the provider, decoding the JSON response in v.
+func doJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to the OAuth2 provider: %s", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return OAuthFailure{Reason: "the provider refused the credentials (" + e.Error + ")"}
+	default:
+		return fmt.Errorf("Unexpected response from the OAuth2 provider: %s", resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Invalid response from the OAuth2 provider: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"encoding/json"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+// fakeOAuthProvider is an OAuth2 provider that accepts only the code "abc123",
+// issuing the access token "xyz789" for the user with the given email.
+type fakeOAuthProvider struct {
+	email string
+	form  url.Values
+}
+
+func (p *fakeOAuthProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/token":
+		r.ParseForm()
+		p.form = r.PostForm
+		if r.PostForm.Get("code") != "abc123" || r.PostForm.Get("client_secret") != "s3cr3t" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "xyz789", "token_type": "bearer"})
+	case "/user":
+		if r.Header.Get("Authorization") != "Bearer xyz789" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"email": p.email, "name": "Someone"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *S) setOAuthConfig(serverUrl string) func() {
+	settings := map[string]interface{}{
+		"client-id":     "tsuru",
+		"client-secret": "s3cr3t",
+		"scope":         "email",
+		"auth-url":      serverUrl + "/authorize",
+		"token-url":     serverUrl + "/token",
+		"info-url":      serverUrl + "/user",
+		"callback-port": 33123,
+	}
+	for name, value := range settings {
+		config.Set("auth:oauth:"+name, value)
+	}
+	return func() {
+		for name := range settings {
+			config.Unset("auth:oauth:" + name)
+		}
+	}
+}
+
+func (s *S) TestOAuthSchemeInfo(c *gocheck.C) {
+	defer s.setOAuthConfig("http://sso.tsuru.io")()
+	info, err := OAuthScheme{}.Info()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(info["port"], gocheck.Equals, "33123")
+	u, err := url.Parse(info["authorizeUrl"])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.Host, gocheck.Equals, "sso.tsuru.io")
+	c.Assert(u.Path, gocheck.Equals, "/authorize")
+	expected := url.Values{"client_id": {"tsuru"}, "response_type": {"code"}, "scope": {"email"}}
+	c.Assert(u.Query(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestOAuthSchemeInfoWithoutSettings(c *gocheck.C) {
+	info, err := OAuthScheme{}.Info()
+	c.Assert(info, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `^Setting "auth:oauth:client-id" is undefined.$`)
+}
+
+func (s *S) TestOAuthSchemeAuthenticateRegisteredUser(c *gocheck.C) {
+	provider := fakeOAuthProvider{email: s.user.Email}
+	ts := httptest.NewServer(&provider)
+	defer ts.Close()
+	defer s.setOAuthConfig(ts.URL)()
+	params := map[string]string{"code": "abc123", "redirectUrl": "http://127.0.0.1:33123/"}
+	u, err := OAuthScheme{}.Authenticate(params)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.Email, gocheck.Equals, s.user.Email)
+	c.Assert(u.Password, gocheck.Not(gocheck.Equals), "")
+	c.Assert(provider.form.Get("grant_type"), gocheck.Equals, "authorization_code")
+	c.Assert(provider.form.Get("client_id"), gocheck.Equals, "tsuru")
+	c.Assert(provider.form.Get("redirect_uri"), gocheck.Equals, "http://127.0.0.1:33123/")
+}
+
+func (s *S) TestOAuthSchemeAuthenticateUnregisteredUser(c *gocheck.C) {
+	provider := fakeOAuthProvider{email: "newcomer@tsuru.io"}
+	ts := httptest.NewServer(&provider)
+	defer ts.Close()
+	defer s.setOAuthConfig(ts.URL)()
+	u, err := OAuthScheme{}.Authenticate(map[string]string{"code": "abc123"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u, gocheck.DeepEquals, &User{Email: "newcomer@tsuru.io"})
+	_, err = GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestOAuthSchemeAuthenticateWithInvalidCode(c *gocheck.C) {
+	ts := httptest.NewServer(&fakeOAuthProvider{email: s.user.Email})
+	defer ts.Close()
+	defer s.setOAuthConfig(ts.URL)()
+	u, err := OAuthScheme{}.Authenticate(map[string]string{"code": "wrong"})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.FitsTypeOf, OAuthFailure{})
+	c.Assert(err, gocheck.ErrorMatches, `^Authentication failed: the provider refused the credentials \(invalid_grant\)$`)
+}
+
+func (s *S) TestOAuthSchemeAuthenticateWithoutEmail(c *gocheck.C) {
+	ts := httptest.NewServer(&fakeOAuthProvider{})
+	defer ts.Close()
+	defer s.setOAuthConfig(ts.URL)()
+	u, err := OAuthScheme{}.Authenticate(map[string]string{"code": "abc123"})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "^Authentication failed: the provider did not return a valid email$")
+}
+
+func (s *S) TestOAuthSchemeAuthenticateWithoutCode(c *gocheck.C) {
+	u, err := OAuthScheme{}.Authenticate(map[string]string{})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+}
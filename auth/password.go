@@ -0,0 +1,136 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/mail"
+	"github.com/globocom/tsuru/validation"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// passwordTokenExpire is the validity of password reset tokens.
+const passwordTokenExpire = 24 * time.Hour
+
+const passwordResetBody = `Someone, hopefully you, asked to reset the password of %s in tsuru.
+
+To choose a new password, run the following command:
+
+	tsuru reset-password %s --token %s
+
+The token expires in %d hours and can be used only once. If you didn't ask to
+reset your password, just ignore this message.
+`
+
+// ErrInvalidPasswordToken is returned by ResetPassword when the given token
+// does not exist, has expired or has already been used.
+var ErrInvalidPasswordToken = stderrors.New("Invalid or expired password reset token.")
+
+// passwordToken allows a user to reset the password without knowing the
+// current one.
+type passwordToken struct {
+	Token     string `bson:"_id"`
+	UserEmail string
+	Creation  time.Time
+	Used      bool
+}
+
+func createPasswordToken(u *User) (*passwordToken, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	t := passwordToken{
+		Token:     fmt.Sprintf("%x", b),
+		UserEmail: u.Email,
+		Creation:  time.Now(),
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.PasswordTokens().Insert(t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// usePasswordToken marks the token of the user as used. It fails if the token
+// does not exist, has expired or has already been used. The token is checked
+// and marked in a single update, so concurrent requests can't use the same
+// token twice.
+func usePasswordToken(u *User, token string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	q := bson.M{
+		"_id":       token,
+		"useremail": u.Email,
+		"used":      false,
+		"creation":  bson.M{"$gt": time.Now().Add(-passwordTokenExpire)},
+	}
+	err = conn.PasswordTokens().Update(q, bson.M{"$set": bson.M{"used": true}})
+	if err == mgo.ErrNotFound {
+		return ErrInvalidPasswordToken
+	}
+	return err
+}
+
+// releasePasswordToken marks the token as not used, so it can be used again.
+func releasePasswordToken(token string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.PasswordTokens().UpdateId(token, bson.M{"$set": bson.M{"used": false}})
+}
+
+// StartPasswordReset starts the password reset process, sending a reset token
+// to the user by email (see ResetPassword).
+func (u *User) StartPasswordReset() error {
+	t, err := createPasswordToken(u)
+	if err != nil {
+		return err
+	}
+	hours := int(passwordTokenExpire / time.Hour)
+	body := fmt.Sprintf(passwordResetBody, u.Email, u.Email, t.Token, hours)
+	return mail.Send([]string{u.Email}, "[tsuru] Password reset", []byte(body))
+}
+
+// ResetPassword changes the password of the user, given a valid reset token
+// sent by StartPasswordReset. Reset tokens can be used only once: the token is
+// marked as used before the password changes, so concurrent requests can't
+// both use it, and released if the password can't be changed.
+//
+// All the tokens of the user, including personal access tokens, are revoked,
+// so whoever had access to the account before the reset loses it.
+func (u *User) ResetPassword(token, password string) error {
+	if !validation.ValidateLength(password, passwordMinLen, passwordMaxLen) {
+		return &errors.ValidationError{Message: passwordError}
+	}
+	if err := usePasswordToken(u, token); err != nil {
+		return err
+	}
+	u.Password = password
+	u.HashPassword()
+	if err := u.Update(); err != nil {
+		if rerr := releasePasswordToken(token); rerr != nil {
+			log.Printf("Failed to release the password token of %s: %s", u.Email, rerr)
+		}
+		return err
+	}
+	return deleteTokens(u)
+}
@@ -0,0 +1,190 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	ttesting "github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"strings"
+	"sync"
+	"time"
+)
+
+func (s *S) TestCreatePasswordToken(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	c.Assert(t.Token, gocheck.HasLen, 40)
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(t.Used, gocheck.Equals, false)
+	var result passwordToken
+	err = s.conn.PasswordTokens().FindId(t.Token).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.UserEmail, gocheck.Equals, s.user.Email)
+	t2, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t2.Token)
+	c.Assert(t2.Token, gocheck.Not(gocheck.Equals), t.Token)
+}
+
+func (s *S) TestUsePasswordToken(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = usePasswordToken(s.user, t.Token)
+	c.Assert(err, gocheck.IsNil)
+	var result passwordToken
+	err = s.conn.PasswordTokens().FindId(t.Token).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Used, gocheck.Equals, true)
+	err = usePasswordToken(s.user, t.Token)
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+}
+
+func (s *S) TestUsePasswordTokenInvalid(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = usePasswordToken(s.user, "invalid")
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+	err = usePasswordToken(&User{Email: "other@globo.com"}, t.Token)
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+}
+
+func (s *S) TestUsePasswordTokenExpired(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	creation := time.Now().Add(-passwordTokenExpire - time.Minute)
+	err = s.conn.PasswordTokens().UpdateId(t.Token, bson.M{"$set": bson.M{"creation": creation}})
+	c.Assert(err, gocheck.IsNil)
+	err = usePasswordToken(s.user, t.Token)
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+}
+
+func (s *S) TestUsePasswordTokenConcurrently(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- usePasswordToken(s.user, t.Token)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var used int
+	for err := range errs {
+		if err == nil {
+			used++
+		} else {
+			c.Check(err, gocheck.Equals, ErrInvalidPasswordToken)
+		}
+	}
+	c.Assert(used, gocheck.Equals, 1)
+}
+
+func (s *S) TestStartPasswordReset(c *gocheck.C) {
+	server, err := ttesting.NewSMTPServer()
+	c.Assert(err, gocheck.IsNil)
+	defer server.Stop()
+	config.Set("smtp:server", server.Addr())
+	defer config.Unset("smtp:server")
+	config.Set("smtp:from", "tsuru@globo.com")
+	defer config.Unset("smtp:from")
+	err = s.user.StartPasswordReset()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveAll(bson.M{"useremail": s.user.Email})
+	var t passwordToken
+	err = s.conn.PasswordTokens().Find(bson.M{"useremail": s.user.Email}).One(&t)
+	c.Assert(err, gocheck.IsNil)
+	messages := server.Messages()
+	c.Assert(messages, gocheck.HasLen, 1)
+	c.Assert(messages[0].To, gocheck.DeepEquals, []string{s.user.Email})
+	data := string(messages[0].Data)
+	c.Assert(strings.Contains(data, "Subject: [tsuru] Password reset\n"), gocheck.Equals, true)
+	c.Assert(strings.Contains(data, "tsuru reset-password "+s.user.Email+" --token "+t.Token), gocheck.Equals, true)
+}
+
+func (s *S) TestResetPassword(c *gocheck.C) {
+	u := User{Email: "reset@globo.com", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	t, err := createPasswordToken(&u)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = u.ResetPassword(t.Token, "654321")
+	c.Assert(err, gocheck.IsNil)
+	u2, err := GetUserByEmail(u.Email)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u2.CheckPassword("654321"), gocheck.IsNil)
+	err = s.conn.PasswordTokens().FindId(t.Token).One(t)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Used, gocheck.Equals, true)
+	err = u.ResetPassword(t.Token, "abcdef")
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+}
+
+func (s *S) TestResetPasswordRevokesAllTokens(c *gocheck.C) {
+	u := User{Email: "reset@globo.com", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": u.Email})
+	defer s.conn.Tokens().RemoveAll(bson.M{"useremail": u.Email})
+	login, err := u.CreateToken("123456")
+	c.Assert(err, gocheck.IsNil)
+	personal, err := CreatePersonalToken(&u, "ci", time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	t, err := createPasswordToken(&u)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = u.ResetPassword(t.Token, "654321")
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetToken(login.Token)
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+	_, err = GetToken(personal.Token)
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+}
+
+func (s *S) TestResetPasswordKeepsTheTokenWhenTheUpdateFails(c *gocheck.C) {
+	u := User{Email: "ghost@globo.com"}
+	t, err := createPasswordToken(&u)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = u.ResetPassword(t.Token, "654321")
+	c.Assert(err, gocheck.NotNil)
+	var result passwordToken
+	err = s.conn.PasswordTokens().FindId(t.Token).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Used, gocheck.Equals, false)
+}
+
+func (s *S) TestResetPasswordInvalidToken(c *gocheck.C) {
+	err := s.user.ResetPassword("invalid", "654321")
+	c.Assert(err, gocheck.Equals, ErrInvalidPasswordToken)
+}
+
+func (s *S) TestResetPasswordInvalidPassword(c *gocheck.C) {
+	t, err := createPasswordToken(s.user)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.PasswordTokens().RemoveId(t.Token)
+	err = s.user.ResetPassword(t.Token, "123")
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, passwordError)
+	var result passwordToken
+	err = s.conn.PasswordTokens().FindId(t.Token).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Used, gocheck.Equals, false)
+}
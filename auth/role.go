@@ -0,0 +1,219 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"strings"
+)
+
+// Permission is the name of an operation that members of a team may perform
+// on the resources of the team, like deploying an app or removing a service.
+type Permission string
+
+const (
+	PermAppCreate             Permission = "app.create"
+	PermAppRead               Permission = "app.read"
+	PermAppDelete             Permission = "app.delete"
+	PermAppDeploy             Permission = "app.deploy"
+	PermAppEnvSet             Permission = "app.env.set"
+	PermAppRestart            Permission = "app.restart"
+	PermAppRun                Permission = "app.run"
+	PermAppUnits              Permission = "app.units"
+	PermAppCName              Permission = "app.cname"
+	PermAppAccess             Permission = "app.access"
+	PermAppBind               Permission = "app.bind"
+	PermServiceCreate         Permission = "service.create"
+	PermServiceRead           Permission = "service.read"
+	PermServiceUpdate         Permission = "service.update"
+	PermServiceDelete         Permission = "service.delete"
+	PermServiceAccess         Permission = "service.access"
+	PermServiceInstanceCreate Permission = "service.instance.create"
+	PermServiceInstanceRead   Permission = "service.instance.read"
+	PermServiceInstanceDelete Permission = "service.instance.delete"
+	PermServiceInstanceAccess Permission = "service.instance.access"
+	PermServiceInstanceBind   Permission = "service.instance.bind"
+	PermServiceInstanceProxy  Permission = "service.instance.proxy"
+	PermTeamManage            Permission = "team.manage"
+)
+
+// Permissions is the list of all known permissions.
+var Permissions = []Permission{
+	PermAppCreate, PermAppRead, PermAppDelete, PermAppDeploy, PermAppEnvSet,
+	PermAppRestart, PermAppRun, PermAppUnits, PermAppCName, PermAppAccess,
+	PermAppBind, PermServiceCreate, PermServiceRead, PermServiceUpdate,
+	PermServiceDelete, PermServiceAccess, PermServiceInstanceCreate,
+	PermServiceInstanceRead, PermServiceInstanceDelete,
+	PermServiceInstanceAccess, PermServiceInstanceBind,
+	PermServiceInstanceProxy, PermTeamManage,
+}
+
+// ErrRoleNotFound is returned when there is no role with the given name.
+var ErrRoleNotFound = stderrors.New("Role not found")
+
+// Role is a named set of permissions. Roles are assigned to the members of a
+// team, and grant these permissions on the resources of the team.
+type Role struct {
+	Name        string `bson:"_id"`
+	Permissions []Permission
+}
+
+// HasPermission checks whether the role grants the given permission.
+func (r *Role) HasPermission(perm Permission) bool {
+	for _, p := range r.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinRoles are the roles that come with tsuru. They can't be changed nor
+// removed.
+var builtinRoles = map[string]Role{
+	"owner": {Name: "owner", Permissions: Permissions},
+	"developer": {Name: "developer", Permissions: []Permission{
+		PermAppCreate, PermAppRead, PermAppDeploy, PermAppEnvSet,
+		PermAppRestart, PermAppRun, PermAppUnits, PermAppCName, PermAppBind,
+		PermServiceCreate, PermServiceRead, PermServiceUpdate,
+		PermServiceInstanceCreate, PermServiceInstanceRead,
+		PermServiceInstanceBind, PermServiceInstanceProxy,
+	}},
+	"viewer": {Name: "viewer", Permissions: []Permission{
+		PermAppRead, PermServiceRead, PermServiceInstanceRead,
+	}},
+}
+
+// DefaultRole returns the name of the role of the members of legacy teams,
+// created before roles existed and without any role assigned, defined in the
+// "auth:default-role" setting.
+//
+// It defaults to "owner", granting every permission to the members of these
+// teams. That's what they could do before roles existed, and tsuru doesn't
+// know who created these teams, so any other default would leave them without
+// a member allowed to manage them.
+func DefaultRole() string {
+	if role, err := config.GetString("auth:default-role"); err == nil && role != "" {
+		return role
+	}
+	return "owner"
+}
+
+// NewMemberRole returns the name of the role assigned to users when they are
+// added to a team, defined in the "auth:new-member-role" setting. It defaults
+// to "developer", that can't remove apps nor manage the team.
+func NewMemberRole() string {
+	if role, err := config.GetString("auth:new-member-role"); err == nil && role != "" {
+		return role
+	}
+	return "developer"
+}
+
+// GetRole returns the role with the given name, looking for it in the
+// built-in roles and in the database.
+func GetRole(name string) (*Role, error) {
+	if role, ok := builtinRoles[name]; ok {
+		return &role, nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var role Role
+	if err = conn.Roles().FindId(name).One(&role); err != nil {
+		return nil, ErrRoleNotFound
+	}
+	return &role, nil
+}
+
+// ListRoles returns all roles, built-in roles first, sorted by name.
+func ListRoles() ([]Role, error) {
+	var names []string
+	for name := range builtinRoles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	roles := make([]Role, 0, len(names))
+	for _, name := range names {
+		roles = append(roles, builtinRoles[name])
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var custom []Role
+	if err = conn.Roles().Find(nil).Sort("_id").All(&custom); err != nil {
+		return nil, err
+	}
+	return append(roles, custom...), nil
+}
+
+// CreateRole stores a new role in the database, validating its name and
+// permissions.
+func CreateRole(r *Role) error {
+	if r.Name == "" {
+		return &errors.ValidationError{Message: "You must provide the name of the role."}
+	}
+	if _, ok := builtinRoles[r.Name]; ok {
+		return &errors.ValidationError{Message: fmt.Sprintf("The role %q is a built-in role.", r.Name)}
+	}
+	if len(r.Permissions) == 0 {
+		return &errors.ValidationError{Message: "You must provide at least one permission."}
+	}
+	for _, p := range r.Permissions {
+		if !isKnownPermission(p) {
+			return &errors.ValidationError{Message: fmt.Sprintf("Unknown permission: %q.", p)}
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Roles().Insert(r)
+	if err != nil && strings.Contains(err.Error(), "duplicate key error") {
+		return &errors.ValidationError{Message: fmt.Sprintf("The role %q already exists.", r.Name)}
+	}
+	return err
+}
+
+// RemoveRole removes a role from the database. Built-in roles, and roles
+// assigned to members of any team, can't be removed.
+func RemoveRole(name string) error {
+	if _, ok := builtinRoles[name]; ok {
+		return &errors.ValidationError{Message: fmt.Sprintf("The role %q is a built-in role.", name)}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var team Team
+	if err = conn.Teams().Find(bson.M{"roles.role": name}).One(&team); err == nil {
+		msg := fmt.Sprintf("The role %q is assigned to members of the team %q.", name, team.Name)
+		return &errors.ValidationError{Message: msg}
+	}
+	if err = conn.Roles().RemoveId(name); err != nil {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func isKnownPermission(perm Permission) bool {
+	for _, p := range Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
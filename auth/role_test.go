@@ -0,0 +1,139 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestRoleHasPermission(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppRead, PermAppDeploy}}
+	c.Assert(r.HasPermission(PermAppDeploy), gocheck.Equals, true)
+	c.Assert(r.HasPermission(PermAppDelete), gocheck.Equals, false)
+}
+
+func (s *S) TestOwnerRoleHasAllPermissions(c *gocheck.C) {
+	r, err := GetRole("owner")
+	c.Assert(err, gocheck.IsNil)
+	for _, p := range Permissions {
+		c.Check(r.HasPermission(p), gocheck.Equals, true)
+	}
+}
+
+func (s *S) TestDeveloperRoleCannotDeleteAppsNorManageTeams(c *gocheck.C) {
+	r, err := GetRole("developer")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r.HasPermission(PermAppDeploy), gocheck.Equals, true)
+	c.Assert(r.HasPermission(PermAppDelete), gocheck.Equals, false)
+	c.Assert(r.HasPermission(PermTeamManage), gocheck.Equals, false)
+}
+
+func (s *S) TestDefaultRole(c *gocheck.C) {
+	c.Assert(DefaultRole(), gocheck.Equals, "owner")
+	config.Set("auth:default-role", "viewer")
+	defer config.Unset("auth:default-role")
+	c.Assert(DefaultRole(), gocheck.Equals, "viewer")
+}
+
+func (s *S) TestNewMemberRole(c *gocheck.C) {
+	c.Assert(NewMemberRole(), gocheck.Equals, "developer")
+	config.Set("auth:new-member-role", "viewer")
+	defer config.Unset("auth:new-member-role")
+	c.Assert(NewMemberRole(), gocheck.Equals, "viewer")
+}
+
+func (s *S) TestCreateRole(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppRead, PermAppDeploy}}
+	err := CreateRole(&r)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Roles().RemoveId(r.Name)
+	role, err := GetRole("deployer")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(*role, gocheck.DeepEquals, r)
+}
+
+func (s *S) TestCreateRoleValidatesTheRole(c *gocheck.C) {
+	var tests = []struct {
+		role Role
+		msg  string
+	}{
+		{Role{Permissions: []Permission{PermAppRead}}, "^You must provide the name of the role.$"},
+		{Role{Name: "owner", Permissions: []Permission{PermAppRead}}, `^The role "owner" is a built-in role.$`},
+		{Role{Name: "deployer"}, "^You must provide at least one permission.$"},
+		{Role{Name: "deployer", Permissions: []Permission{"app.fly"}}, `^Unknown permission: "app.fly".$`},
+	}
+	for _, t := range tests {
+		err := CreateRole(&t.role)
+		c.Check(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+		c.Check(err, gocheck.ErrorMatches, t.msg)
+	}
+}
+
+func (s *S) TestCreateRoleDuplicated(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppDeploy}}
+	err := CreateRole(&r)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Roles().RemoveId(r.Name)
+	err = CreateRole(&r)
+	c.Assert(err, gocheck.ErrorMatches, `^The role "deployer" already exists.$`)
+}
+
+func (s *S) TestGetRoleNotFound(c *gocheck.C) {
+	_, err := GetRole("unknown")
+	c.Assert(err, gocheck.Equals, ErrRoleNotFound)
+}
+
+func (s *S) TestListRoles(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppDeploy}}
+	err := CreateRole(&r)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Roles().RemoveId(r.Name)
+	roles, err := ListRoles()
+	c.Assert(err, gocheck.IsNil)
+	var names []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	c.Assert(names, gocheck.DeepEquals, []string{"developer", "owner", "viewer", "deployer"})
+}
+
+func (s *S) TestRemoveRole(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppDeploy}}
+	err := CreateRole(&r)
+	c.Assert(err, gocheck.IsNil)
+	err = RemoveRole(r.Name)
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetRole(r.Name)
+	c.Assert(err, gocheck.Equals, ErrRoleNotFound)
+}
+
+func (s *S) TestRemoveRoleNotFound(c *gocheck.C) {
+	err := RemoveRole("unknown")
+	c.Assert(err, gocheck.Equals, ErrRoleNotFound)
+}
+
+func (s *S) TestRemoveBuiltinRole(c *gocheck.C) {
+	err := RemoveRole("developer")
+	c.Assert(err, gocheck.ErrorMatches, `^The role "developer" is a built-in role.$`)
+}
+
+func (s *S) TestRemoveRoleAssignedToTeamMembers(c *gocheck.C) {
+	r := Role{Name: "deployer", Permissions: []Permission{PermAppDeploy}}
+	err := CreateRole(&r)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Roles().RemoveId(r.Name)
+	team := Team{Name: "deployers", Users: []string{s.user.Email}, Roles: []TeamRole{{User: s.user.Email, Role: r.Name}}}
+	err = s.conn.Teams().Insert(team)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	err = RemoveRole(r.Name)
+	c.Assert(err, gocheck.ErrorMatches, `^The role "deployer" is assigned to members of the team "deployers".$`)
+	n, err := s.conn.Roles().Find(bson.M{"_id": r.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
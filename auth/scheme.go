@@ -0,0 +1,57 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+)
+
+// Scheme is the interface for authentication schemes. A scheme checks the
+// credentials of users, and tells clients how to get these credentials.
+//
+// Tsuru comes with two schemes: native (email and password) and oauth (OAuth2
+// authorization code flow). One can add other schemes by satisfying this
+// interface and registering it using the function RegisterScheme. The scheme
+// used by the server is defined in the "auth:scheme" setting.
+type Scheme interface {
+	// Authenticate checks the given credentials, returning the user that
+	// owns them. Users authenticated by external providers may not be
+	// registered in tsuru yet, in this case the returned user is not
+	// stored in the database.
+	Authenticate(params map[string]string) (*User, error)
+
+	// Info returns the information that clients need to get the
+	// credentials of the user, like the address of the provider.
+	Info() (map[string]string, error)
+}
+
+var schemes = make(map[string]Scheme)
+
+// RegisterScheme registers a new authentication scheme in the Scheme
+// registry.
+func RegisterScheme(name string, scheme Scheme) {
+	schemes[name] = scheme
+}
+
+// GetScheme gets the named authentication scheme from the registry.
+func GetScheme(name string) (Scheme, error) {
+	scheme, ok := schemes[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown authentication scheme: %q.", name)
+	}
+	return scheme, nil
+}
+
+// ActiveScheme returns the name of the scheme defined in the "auth:scheme"
+// setting, and the scheme. It defaults to the native scheme.
+func ActiveScheme() (string, Scheme, error) {
+	name, err := config.GetString("auth:scheme")
+	if err != nil {
+		name = "native"
+	}
+	scheme, err := GetScheme(name)
+	return name, scheme, err
+}
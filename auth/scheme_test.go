@@ -0,0 +1,95 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+type fakeScheme struct{}
+
+func (fakeScheme) Authenticate(params map[string]string) (*User, error) {
+	return &User{Email: params["email"]}, nil
+}
+
+func (fakeScheme) Info() (map[string]string, error) {
+	return map[string]string{"fake": "true"}, nil
+}
+
+func (s *S) TestRegisterAndGetScheme(c *gocheck.C) {
+	RegisterScheme("fake", fakeScheme{})
+	defer delete(schemes, "fake")
+	scheme, err := GetScheme("fake")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.Equals, fakeScheme{})
+}
+
+func (s *S) TestGetUnknownScheme(c *gocheck.C) {
+	scheme, err := GetScheme("unknown")
+	c.Assert(scheme, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, `^Unknown authentication scheme: "unknown".$`)
+}
+
+func (s *S) TestBuiltinSchemesAreRegistered(c *gocheck.C) {
+	scheme, err := GetScheme("native")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.FitsTypeOf, NativeScheme{})
+	scheme, err = GetScheme("oauth")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(scheme, gocheck.FitsTypeOf, OAuthScheme{})
+}
+
+func (s *S) TestActiveSchemeDefaultsToNative(c *gocheck.C) {
+	name, scheme, err := ActiveScheme()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(name, gocheck.Equals, "native")
+	c.Assert(scheme, gocheck.FitsTypeOf, NativeScheme{})
+}
+
+func (s *S) TestActiveSchemeUsesTheConfiguredScheme(c *gocheck.C) {
+	RegisterScheme("fake", fakeScheme{})
+	defer delete(schemes, "fake")
+	config.Set("auth:scheme", "fake")
+	defer config.Unset("auth:scheme")
+	name, scheme, err := ActiveScheme()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(name, gocheck.Equals, "fake")
+	c.Assert(scheme, gocheck.Equals, fakeScheme{})
+}
+
+func (s *S) TestNativeSchemeAuthenticate(c *gocheck.C) {
+	user := User{Email: "wolverine@xmen.com", Password: "123456"}
+	err := user.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	u, err := NativeScheme{}.Authenticate(map[string]string{"email": user.Email, "password": "123456"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.Email, gocheck.Equals, user.Email)
+}
+
+func (s *S) TestNativeSchemeAuthenticateWithWrongPassword(c *gocheck.C) {
+	user := User{Email: "wolverine@xmen.com", Password: "123456"}
+	err := user.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Users().Remove(bson.M{"email": user.Email})
+	u, err := NativeScheme{}.Authenticate(map[string]string{"email": user.Email, "password": "1234567"})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.FitsTypeOf, AuthenticationFailure{})
+}
+
+func (s *S) TestNativeSchemeAuthenticateWithInvalidEmail(c *gocheck.C) {
+	u, err := NativeScheme{}.Authenticate(map[string]string{"email": "invalid", "password": "123456"})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.FitsTypeOf, &errors.ValidationError{})
+}
+
+func (s *S) TestNativeSchemeAuthenticateWithUnknownUser(c *gocheck.C) {
+	u, err := NativeScheme{}.Authenticate(map[string]string{"email": "unknown@tsuru.io", "password": "123456"})
+	c.Assert(u, gocheck.IsNil)
+	c.Assert(err, gocheck.ErrorMatches, "^User not found$")
+}
@@ -7,6 +7,7 @@ package auth
 import (
 	"fmt"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
 	"github.com/globocom/tsuru/log"
 	"labix.org/v2/mgo/bson"
 	"sync"
@@ -15,6 +16,13 @@ import (
 type Team struct {
 	Name  string `bson:"_id"`
 	Users []string
+	Roles []TeamRole `bson:",omitempty" json:",omitempty"`
+}
+
+// TeamRole is the role assigned to a member of a team.
+type TeamRole struct {
+	User string
+	Role string
 }
 
 func (t *Team) ContainsUser(u *User) bool {
@@ -26,11 +34,17 @@ func (t *Team) ContainsUser(u *User) bool {
 	return false
 }
 
+// AddUser adds the user to the team, with the role of new members (see
+// NewMemberRole). In legacy teams, without any role assigned, the current
+// members are first assigned to the default role (see DefaultRole), so they
+// keep their permissions.
 func (t *Team) AddUser(u *User) error {
 	if t.ContainsUser(u) {
 		return fmt.Errorf("User %s is already in the team %s.", u.Email, t.Name)
 	}
+	t.assignDefaultRoles()
 	t.Users = append(t.Users, u.Email)
+	t.Roles = append(t.Roles, TeamRole{User: u.Email, Role: NewMemberRole()})
 	return nil
 }
 
@@ -47,9 +61,97 @@ func (t *Team) RemoveUser(u *User) error {
 	}
 	copy(t.Users[index:], t.Users[index+1:])
 	t.Users = t.Users[:len(t.Users)-1]
+	for i, r := range t.Roles {
+		if r.User == u.Email {
+			t.Roles = append(t.Roles[:i], t.Roles[i+1:]...)
+			break
+		}
+	}
 	return nil
 }
 
+// Role returns the name of the role of the user in the team. Members of
+// legacy teams, without any role assigned, have the default role (see
+// DefaultRole). In other teams, members that were not assigned to any role
+// have the role of new members (see NewMemberRole).
+func (t *Team) Role(u *User) string {
+	for _, r := range t.Roles {
+		if r.User == u.Email {
+			return r.Role
+		}
+	}
+	if len(t.Roles) == 0 {
+		return DefaultRole()
+	}
+	return NewMemberRole()
+}
+
+// SetRole assigns the given role to a member of the team. The team must keep
+// at least one member with the team.manage permission, so it's not possible
+// to assign a role without this permission to the last manager of the team.
+func (t *Team) SetRole(u *User, role string) error {
+	if !t.ContainsUser(u) {
+		return fmt.Errorf("User %s is not in the team %s.", u.Email, t.Name)
+	}
+	newRole, err := GetRole(role)
+	if err != nil {
+		return err
+	}
+	if !newRole.HasPermission(PermTeamManage) && t.isLastManager(u) {
+		msg := fmt.Sprintf("%s is the last member allowed to manage the team %s.", u.Email, t.Name)
+		return &errors.ValidationError{Message: msg}
+	}
+	t.assignDefaultRoles()
+	for i, r := range t.Roles {
+		if r.User == u.Email {
+			t.Roles[i].Role = role
+			return nil
+		}
+	}
+	t.Roles = append(t.Roles, TeamRole{User: u.Email, Role: role})
+	return nil
+}
+
+// assignDefaultRoles assigns the default role (see DefaultRole) to the
+// members of legacy teams, so they keep their permissions once other members
+// get a role.
+func (t *Team) assignDefaultRoles() {
+	if len(t.Roles) == 0 {
+		for _, email := range t.Users {
+			t.Roles = append(t.Roles, TeamRole{User: email, Role: DefaultRole()})
+		}
+	}
+}
+
+// isLastManager checks whether the user is the only member of the team with
+// the team.manage permission.
+func (t *Team) isLastManager(u *User) bool {
+	if !t.HasPermission(&User{Email: u.Email}, PermTeamManage) {
+		return false
+	}
+	for _, email := range t.Users {
+		if email != u.Email && t.HasPermission(&User{Email: email}, PermTeamManage) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPermission checks whether the user is a member of the team, with a role
+// that grants the given permission. Users authenticated by tokens limited to
+// some permissions only have the permissions of the token.
+func (t *Team) HasPermission(u *User, perm Permission) bool {
+	if !t.ContainsUser(u) || !u.scopeAllows(perm) {
+		return false
+	}
+	role, err := GetRole(t.Role(u))
+	if err != nil {
+		log.Printf("Failed to get the role of %s in the team %s: %s", u.Email, t.Name, err)
+		return false
+	}
+	return role.HasPermission(perm)
+}
+
 func GetTeamsNames(teams []Team) []string {
 	tn := make([]string, len(teams))
 	for i, t := range teams {
@@ -85,3 +187,26 @@ func CheckUserAccess(teamNames []string, u *User) bool {
 	}()
 	return <-found
 }
+
+// CheckUserPermission checks whether the user has the given permission in at
+// least one of the given teams.
+func CheckUserPermission(teamNames []string, u *User, perm Permission) bool {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Printf("Failed to connect to the database: %s", err)
+		return false
+	}
+	defer conn.Close()
+	var teams []Team
+	q := bson.M{"_id": bson.M{"$in": teamNames}, "users": u.Email}
+	if err = conn.Teams().Find(q).All(&teams); err != nil {
+		log.Printf("Failed to get the teams of %s: %s", u.Email, err)
+		return false
+	}
+	for _, team := range teams {
+		if team.HasPermission(u, perm) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,8 @@
 package auth
 
 import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 )
@@ -114,3 +116,162 @@ func (s *S) TestCheckUserAccessWithMultipleUsersOnMultipleTeams(c *gocheck.C) {
 	c.Assert(CheckUserAccess(teams, &punk), gocheck.Equals, true)
 	c.Assert(CheckUserAccess(teams, &one), gocheck.Equals, true)
 }
+
+func (s *S) TestRemoveUserFromTeamRemovesItsRole(c *gocheck.C) {
+	t := &Team{
+		Name:  "timeredbull",
+		Users: []string{"somebody@globo.com", "nobody@globo.com"},
+		Roles: []TeamRole{{User: "somebody@globo.com", Role: "viewer"}, {User: "nobody@globo.com", Role: "developer"}},
+	}
+	err := t.RemoveUser(&User{Email: "somebody@globo.com"})
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Roles, gocheck.DeepEquals, []TeamRole{{User: "nobody@globo.com", Role: "developer"}})
+}
+
+func (s *S) TestTeamRole(c *gocheck.C) {
+	t := &Team{
+		Name:  "timeredbull",
+		Users: []string{"somebody@globo.com", "nobody@globo.com"},
+		Roles: []TeamRole{{User: "somebody@globo.com", Role: "viewer"}},
+	}
+	c.Assert(t.Role(&User{Email: "somebody@globo.com"}), gocheck.Equals, "viewer")
+	c.Assert(t.Role(&User{Email: "nobody@globo.com"}), gocheck.Equals, "developer")
+}
+
+func (s *S) TestTeamRoleInLegacyTeam(c *gocheck.C) {
+	t := &Team{Name: "timeredbull", Users: []string{"somebody@globo.com"}}
+	c.Assert(t.Role(&User{Email: "somebody@globo.com"}), gocheck.Equals, "owner")
+}
+
+func (s *S) TestAddUserAssignsTheRoleOfNewMembers(c *gocheck.C) {
+	owner := &User{Email: "owner@globo.com"}
+	u := &User{Email: "nobody@globo.com"}
+	t := &Team{Name: "timeredbull", Users: []string{owner.Email}, Roles: []TeamRole{{User: owner.Email, Role: "owner"}}}
+	err := t.AddUser(u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Roles, gocheck.DeepEquals, []TeamRole{{User: owner.Email, Role: "owner"}, {User: u.Email, Role: "developer"}})
+	c.Assert(t.HasPermission(u, PermAppDeploy), gocheck.Equals, true)
+	c.Assert(t.HasPermission(u, PermAppDelete), gocheck.Equals, false)
+	c.Assert(t.HasPermission(u, PermTeamManage), gocheck.Equals, false)
+}
+
+func (s *S) TestAddUserAssignsTheConfiguredRoleOfNewMembers(c *gocheck.C) {
+	config.Set("auth:new-member-role", "viewer")
+	defer config.Unset("auth:new-member-role")
+	u := &User{Email: "nobody@globo.com"}
+	t := &Team{Name: "timeredbull"}
+	err := t.AddUser(u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Role(u), gocheck.Equals, "viewer")
+}
+
+func (s *S) TestAddUserToLegacyTeamKeepsThePermissionsOfCurrentMembers(c *gocheck.C) {
+	t := &Team{Name: "timeredbull", Users: []string{"somebody@globo.com", "anybody@globo.com"}}
+	err := t.AddUser(&User{Email: "nobody@globo.com"})
+	c.Assert(err, gocheck.IsNil)
+	expected := []TeamRole{
+		{User: "somebody@globo.com", Role: "owner"},
+		{User: "anybody@globo.com", Role: "owner"},
+		{User: "nobody@globo.com", Role: "developer"},
+	}
+	c.Assert(t.Roles, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestTeamSetRole(c *gocheck.C) {
+	u := &User{Email: "nobody@globo.com"}
+	t := &Team{
+		Name:  "timeredbull",
+		Users: []string{"somebody@globo.com", u.Email},
+		Roles: []TeamRole{{User: "somebody@globo.com", Role: "owner"}},
+	}
+	err := t.SetRole(u, "developer")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Role(u), gocheck.Equals, "developer")
+	err = t.SetRole(u, "viewer")
+	c.Assert(err, gocheck.IsNil)
+	expected := []TeamRole{
+		{User: "somebody@globo.com", Role: "owner"},
+		{User: u.Email, Role: "viewer"},
+	}
+	c.Assert(t.Roles, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestTeamSetRoleInLegacyTeam(c *gocheck.C) {
+	u := &User{Email: "nobody@globo.com"}
+	t := &Team{Name: "timeredbull", Users: []string{"somebody@globo.com", u.Email}}
+	err := t.SetRole(u, "viewer")
+	c.Assert(err, gocheck.IsNil)
+	expected := []TeamRole{
+		{User: "somebody@globo.com", Role: "owner"},
+		{User: u.Email, Role: "viewer"},
+	}
+	c.Assert(t.Roles, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestTeamSetRoleOfTheLastManager(c *gocheck.C) {
+	u := &User{Email: "nobody@globo.com"}
+	roles := []TeamRole{
+		{User: u.Email, Role: "owner"},
+		{User: "somebody@globo.com", Role: "developer"},
+	}
+	t := &Team{
+		Name:  "timeredbull",
+		Users: []string{u.Email, "somebody@globo.com"},
+		Roles: append([]TeamRole(nil), roles...),
+	}
+	err := t.SetRole(u, "developer")
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "nobody@globo.com is the last member allowed to manage the team timeredbull.")
+	c.Assert(t.Roles, gocheck.DeepEquals, roles)
+	err = t.SetRole(&User{Email: "somebody@globo.com"}, "owner")
+	c.Assert(err, gocheck.IsNil)
+	err = t.SetRole(u, "developer")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(t.Role(u), gocheck.Equals, "developer")
+}
+
+func (s *S) TestTeamSetRoleToUserOutsideTheTeam(c *gocheck.C) {
+	t := &Team{Name: "timeredbull"}
+	err := t.SetRole(&User{Email: "nobody@globo.com"}, "developer")
+	c.Assert(err, gocheck.ErrorMatches, "^User nobody@globo.com is not in the team timeredbull.$")
+}
+
+func (s *S) TestTeamSetUnknownRole(c *gocheck.C) {
+	u := &User{Email: "nobody@globo.com"}
+	t := &Team{Name: "timeredbull", Users: []string{u.Email}}
+	err := t.SetRole(u, "intern")
+	c.Assert(err, gocheck.Equals, ErrRoleNotFound)
+	c.Assert(t.Roles, gocheck.HasLen, 0)
+}
+
+func (s *S) TestTeamHasPermission(c *gocheck.C) {
+	dev := &User{Email: "dev@globo.com"}
+	t := &Team{
+		Name:  "timeredbull",
+		Users: []string{dev.Email, "owner@globo.com", "nobody@globo.com"},
+		Roles: []TeamRole{{User: dev.Email, Role: "developer"}, {User: "owner@globo.com", Role: "owner"}},
+	}
+	c.Assert(t.HasPermission(dev, PermAppDeploy), gocheck.Equals, true)
+	c.Assert(t.HasPermission(dev, PermAppDelete), gocheck.Equals, false)
+	c.Assert(t.HasPermission(&User{Email: "owner@globo.com"}, PermAppDelete), gocheck.Equals, true)
+	c.Assert(t.HasPermission(&User{Email: "nobody@globo.com"}, PermAppDelete), gocheck.Equals, false)
+	c.Assert(t.HasPermission(&User{Email: "outsider@globo.com"}, PermAppRead), gocheck.Equals, false)
+}
+
+func (s *S) TestCheckUserPermission(c *gocheck.C) {
+	u := User{Email: "intern@globo.com"}
+	viewers := Team{Name: "viewers", Users: []string{u.Email}, Roles: []TeamRole{{User: u.Email, Role: "viewer"}}}
+	err := s.conn.Teams().Insert(viewers)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(viewers.Name)
+	devs := Team{Name: "devs", Users: []string{u.Email}, Roles: []TeamRole{{User: u.Email, Role: "developer"}}}
+	err = s.conn.Teams().Insert(devs)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(devs.Name)
+	c.Assert(CheckUserPermission([]string{viewers.Name}, &u, PermAppDeploy), gocheck.Equals, false)
+	c.Assert(CheckUserPermission([]string{viewers.Name, devs.Name}, &u, PermAppDeploy), gocheck.Equals, true)
+	c.Assert(CheckUserPermission([]string{viewers.Name, devs.Name}, &u, PermAppDelete), gocheck.Equals, false)
+	c.Assert(CheckUserPermission([]string{s.team.Name}, &u, PermAppRead), gocheck.Equals, false)
+}
@@ -6,22 +6,61 @@ package auth
 
 import (
 	"crypto/sha1"
-	"errors"
+	stderrors "errors"
 	"fmt"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
 	"labix.org/v2/mgo/bson"
+	"strings"
 	"time"
 )
 
+// maxPersonalTokenExpire is the maximum validity of personal access tokens.
+const maxPersonalTokenExpire = 365 * 24 * time.Hour
+
+// ErrTokenNotFound is returned when a token can't be found.
+var ErrTokenNotFound = stderrors.New("Token not found")
+
+// Token authenticates requests to the tsuru API. Tokens are created when users
+// log in, when admins generate tokens for apps, or when users create personal
+// access tokens.
+//
+// Personal access tokens have a name, and may have a scope: when Apps is not
+// empty, the token can only be used on the listed apps, and when Permissions
+// is not empty, the token only grants the listed permissions (see
+// CheckUserPermission).
 type Token struct {
-	Token      string    `json:"token"`
-	ValidUntil time.Time `json:"valid-until"`
-	UserEmail  string    `json:"email"`
-	AppName    string    `json:"app"`
+	Id          bson.ObjectId `bson:"_id,omitempty" json:"-"`
+	Token       string        `json:"token"`
+	ValidUntil  time.Time     `json:"valid-until"`
+	UserEmail   string        `json:"email"`
+	AppName     string        `json:"app"`
+	Name        string        `json:"name,omitempty"`
+	Apps        []string      `json:"apps,omitempty"`
+	Permissions []Permission  `json:"permissions,omitempty"`
 }
 
+// User returns the user that owns the token. The user is limited to the
+// scope of the token.
 func (t *Token) User() (*User, error) {
-	return GetUserByEmail(t.UserEmail)
+	u, err := GetUserByEmail(t.UserEmail)
+	if err != nil {
+		return nil, err
+	}
+	if t.IsScoped() {
+		u.scope = t
+	}
+	return u, nil
+}
+
+// IsPersonal checks whether the token is a personal access token.
+func (t *Token) IsPersonal() bool {
+	return t.Name != ""
+}
+
+// IsScoped checks whether the token is limited to some apps or permissions.
+func (t *Token) IsScoped() bool {
+	return len(t.Apps) > 0 || len(t.Permissions) > 0
 }
 
 func token(data string) string {
@@ -34,10 +73,10 @@ func token(data string) string {
 
 func newUserToken(u *User) (*Token, error) {
 	if u == nil {
-		return nil, errors.New("User is nil")
+		return nil, stderrors.New("User is nil")
 	}
 	if u.Email == "" {
-		return nil, errors.New("Impossible to generate tokens for users without email")
+		return nil, stderrors.New("Impossible to generate tokens for users without email")
 	}
 	if err := loadConfig(); err != nil {
 		return nil, err
@@ -58,10 +97,10 @@ func GetToken(token string) (*Token, error) {
 	var t Token
 	err = conn.Tokens().Find(bson.M{"token": token}).One(&t)
 	if err != nil {
-		return nil, errors.New("Token not found")
+		return nil, ErrTokenNotFound
 	}
 	if t.ValidUntil.Sub(time.Now()) < 1 {
-		return nil, errors.New("Token has expired")
+		return nil, stderrors.New("Token has expired")
 	}
 	return &t, nil
 }
@@ -75,6 +114,23 @@ func DeleteToken(token string) error {
 	return conn.Tokens().Remove(bson.M{"token": token})
 }
 
+// CreateUserToken creates a new token for the user, without checking their
+// credentials. The credentials must have been checked by an authentication
+// scheme.
+func CreateUserToken(u *User) (*Token, error) {
+	t, err := newUserToken(u)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.Tokens().Insert(t)
+	return t, err
+}
+
 func CreateApplicationToken(appName string) (*Token, error) {
 	conn, err := db.Conn()
 	if err != nil {
@@ -92,3 +148,85 @@ func CreateApplicationToken(appName string) (*Token, error) {
 	}
 	return &t, nil
 }
+
+// CreatePersonalToken creates a personal access token for the user, valid for
+// the given duration. The token is limited to the given apps and permissions;
+// empty lists mean no limit.
+func CreatePersonalToken(u *User, name string, validity time.Duration, apps []string, perms []Permission) (*Token, error) {
+	if name == "" {
+		return nil, &errors.ValidationError{Message: "You must provide the name of the token."}
+	}
+	if validity <= 0 || validity > maxPersonalTokenExpire {
+		return nil, &errors.ValidationError{Message: "The token must expire in 1 to 365 days."}
+	}
+	for _, p := range perms {
+		if !isKnownPermission(p) {
+			return nil, &errors.ValidationError{Message: fmt.Sprintf("Unknown permission: %q.", p)}
+		}
+	}
+	t, err := newUserToken(u)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	n, err := conn.Tokens().Find(bson.M{"useremail": u.Email, "name": name}).Count()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, &errors.ValidationError{Message: fmt.Sprintf("You already have a token named %q.", name)}
+	}
+	t.Token = token(u.Email + name)
+	t.ValidUntil = time.Now().Add(validity)
+	t.Name = name
+	t.Apps = apps
+	t.Permissions = perms
+	err = conn.Tokens().Insert(t)
+	return t, err
+}
+
+// ListUserTokens returns the tokens of the user that did not expire yet.
+func ListUserTokens(u *User) ([]Token, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tokens []Token
+	q := bson.M{"useremail": u.Email, "validuntil": bson.M{"$gt": time.Now()}}
+	err = conn.Tokens().Find(q).Sort("validuntil").All(&tokens)
+	return tokens, err
+}
+
+// DeleteUserToken revokes the token of the user with the given id.
+func DeleteUserToken(u *User, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrTokenNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Tokens().Remove(bson.M{"_id": bson.ObjectIdHex(id), "useremail": u.Email})
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// deleteTokens revokes all the tokens of the user: the ones created by
+// logging in and the personal access tokens.
+func deleteTokens(u *User) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Tokens().RemoveAll(bson.M{"useremail": u.Email})
+	return err
+}
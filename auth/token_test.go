@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 	"time"
@@ -40,6 +41,18 @@ func (s *S) TestNewTokenWithoutTokenKey(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, `Setting "auth:token-key" is undefined.`)
 }
 
+func (s *S) TestCreateUserToken(c *gocheck.C) {
+	u := User{Email: "wolverine@xmen.com"}
+	t, err := CreateUserToken(&u)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	c.Assert(t.UserEmail, gocheck.Equals, u.Email)
+	var result Token
+	err = s.conn.Tokens().Find(bson.M{"token": t.Token}).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.UserEmail, gocheck.Equals, u.Email)
+}
+
 func (s *S) TestGetToken(c *gocheck.C) {
 	t, err := GetToken(s.token.Token)
 	c.Assert(err, gocheck.IsNil)
@@ -120,3 +133,136 @@ func (s *S) TestDeleteToken(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Token not found")
 }
+
+func (s *S) TestCreatePersonalToken(c *gocheck.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, []string{"myapp"}, []Permission{PermAppDeploy})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	c.Assert(t.Token, gocheck.Not(gocheck.Equals), "")
+	c.Assert(t.Id.Valid(), gocheck.Equals, true)
+	c.Assert(t.Name, gocheck.Equals, "ci")
+	c.Assert(t.UserEmail, gocheck.Equals, s.user.Email)
+	c.Assert(t.ValidUntil.Sub(time.Now()) <= 24*time.Hour, gocheck.Equals, true)
+	var result Token
+	err = s.conn.Tokens().Find(bson.M{"token": t.Token}).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Name, gocheck.Equals, "ci")
+	c.Assert(result.Apps, gocheck.DeepEquals, []string{"myapp"})
+	c.Assert(result.Permissions, gocheck.DeepEquals, []Permission{PermAppDeploy})
+	got, err := GetToken(t.Token)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got.IsPersonal(), gocheck.Equals, true)
+	c.Assert(got.IsScoped(), gocheck.Equals, true)
+}
+
+func (s *S) TestCreatePersonalTokenValidation(c *gocheck.C) {
+	var tests = []struct {
+		name     string
+		validity time.Duration
+		perms    []Permission
+		message  string
+	}{
+		{"", 24 * time.Hour, nil, "You must provide the name of the token."},
+		{"ci", 0, nil, "The token must expire in 1 to 365 days."},
+		{"ci", 366 * 24 * time.Hour, nil, "The token must expire in 1 to 365 days."},
+		{"ci", 24 * time.Hour, []Permission{"app.fly"}, `Unknown permission: "app.fly".`},
+	}
+	for _, t := range tests {
+		token, err := CreatePersonalToken(s.user, t.name, t.validity, nil, t.perms)
+		c.Check(token, gocheck.IsNil)
+		e, ok := err.(*errors.ValidationError)
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(e.Message, gocheck.Equals, t.message)
+	}
+}
+
+func (s *S) TestCreatePersonalTokenDuplicateName(c *gocheck.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	t2, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, nil, nil)
+	c.Assert(t2, gocheck.IsNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, `You already have a token named "ci".`)
+}
+
+func (s *S) TestListUserTokens(c *gocheck.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	expired, err := CreatePersonalToken(s.user, "old", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": expired.Token})
+	err = s.conn.Tokens().UpdateId(expired.Id, bson.M{"$set": bson.M{"validuntil": time.Now().Add(-time.Hour)}})
+	c.Assert(err, gocheck.IsNil)
+	other, err := CreatePersonalToken(&User{Email: "other@globo.com"}, "ci", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": other.Token})
+	tokens, err := ListUserTokens(s.user)
+	c.Assert(err, gocheck.IsNil)
+	names := make(map[string]bool)
+	for _, token := range tokens {
+		c.Check(token.UserEmail, gocheck.Equals, s.user.Email)
+		names[token.Name] = true
+	}
+	c.Assert(names["ci"], gocheck.Equals, true)
+	c.Assert(names["old"], gocheck.Equals, false)
+}
+
+func (s *S) TestDeleteUserToken(c *gocheck.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	err = DeleteUserToken(s.user, t.Id.Hex())
+	c.Assert(err, gocheck.IsNil)
+	_, err = GetToken(t.Token)
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+}
+
+func (s *S) TestDeleteUserTokenOfAnotherUser(c *gocheck.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 24*time.Hour, nil, nil)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Tokens().Remove(bson.M{"token": t.Token})
+	err = DeleteUserToken(&User{Email: "other@globo.com"}, t.Id.Hex())
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+	_, err = GetToken(t.Token)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestDeleteUserTokenInvalidId(c *gocheck.C) {
+	err := DeleteUserToken(s.user, "invalid")
+	c.Assert(err, gocheck.Equals, ErrTokenNotFound)
+}
+
+func (s *S) TestScopedTokenUser(c *gocheck.C) {
+	t := Token{UserEmail: s.user.Email, Name: "ci", Apps: []string{"myapp"}, Permissions: []Permission{PermAppDeploy}}
+	u, err := t.User()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.CanAccessApp("myapp"), gocheck.Equals, true)
+	c.Assert(u.CanAccessApp("otherapp"), gocheck.Equals, false)
+	c.Assert(s.team.HasPermission(u, PermAppDeploy), gocheck.Equals, true)
+	c.Assert(s.team.HasPermission(u, PermAppDelete), gocheck.Equals, false)
+}
+
+func (s *S) TestScopedTokenUserIsNotAdmin(c *gocheck.C) {
+	team := Team{Name: "admin", Users: []string{s.user.Email}}
+	err := s.conn.Teams().Insert(&team)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Teams().RemoveId(team.Name)
+	u, err := s.token.User()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.IsAdmin(), gocheck.Equals, true)
+	t := Token{UserEmail: s.user.Email, Name: "ci", Permissions: []Permission{PermAppRead}}
+	u, err = t.User()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.IsAdmin(), gocheck.Equals, false)
+}
+
+func (s *S) TestUnscopedPersonalTokenUser(c *gocheck.C) {
+	t := Token{UserEmail: s.user.Email, Name: "ci"}
+	u, err := t.User()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(u.CanAccessApp("otherapp"), gocheck.Equals, true)
+	c.Assert(s.team.HasPermission(u, PermAppDelete), gocheck.Equals, true)
+}
@@ -77,8 +77,16 @@ type User struct {
 	Email    string
 	Password string
 	Keys     []Key
+
+	// scope is the token that authenticated the user, when it's limited
+	// to some apps or permissions.
+	scope *Token
 }
 
+// ErrUserNotFound is returned by GetUserByEmail when there is no user with
+// the given email.
+var ErrUserNotFound = stderrors.New("User not found")
+
 func GetUserByEmail(email string) (*User, error) {
 	if !validation.ValidateEmail(email) {
 		return nil, &errors.ValidationError{Message: emailError}
@@ -91,7 +99,7 @@ func GetUserByEmail(email string) (*User, error) {
 	defer conn.Close()
 	err = conn.Users().Find(bson.M{"email": email}).One(&u)
 	if err != nil {
-		return nil, stderrors.New("User not found")
+		return nil, ErrUserNotFound
 	}
 	return &u, nil
 }
@@ -150,17 +158,7 @@ func (u *User) CreateToken(password string) (*Token, error) {
 	if err := u.CheckPassword(password); err != nil {
 		return nil, err
 	}
-	conn, err := db.Conn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	t, err := newUserToken(u)
-	if err != nil {
-		return nil, err
-	}
-	err = conn.Tokens().Insert(t)
-	return t, err
+	return CreateUserToken(u)
 }
 
 // Teams returns a slice containing all teams that the user is member of.
@@ -203,7 +201,13 @@ func (u *User) RemoveKey(key Key) error {
 	return nil
 }
 
+// IsAdmin checks whether the user is a member of the admin team. Users
+// authenticated by tokens limited to some apps or permissions are never
+// admins.
 func (u *User) IsAdmin() bool {
+	if u.scope != nil {
+		return false
+	}
 	adminTeamName, err := config.GetString("admin-team")
 	if err != nil {
 		return false
@@ -220,6 +224,34 @@ func (u *User) IsAdmin() bool {
 	return false
 }
 
+// CanAccessApp checks whether the token that authenticated the user allows
+// access to the given app.
+func (u *User) CanAccessApp(name string) bool {
+	if u.scope == nil || len(u.scope.Apps) == 0 {
+		return true
+	}
+	for _, app := range u.scope.Apps {
+		if app == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllows checks whether the token that authenticated the user grants the
+// given permission.
+func (u *User) scopeAllows(perm Permission) bool {
+	if u.scope == nil || len(u.scope.Permissions) == 0 {
+		return true
+	}
+	for _, p := range u.scope.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *User) AllowedApps() ([]string, error) {
 	conn, err := db.Conn()
 	if err != nil {
@@ -12,6 +12,7 @@ import (
 	"github.com/globocom/tsuru/cmd/term"
 	"io"
 	"io/ioutil"
+	"launchpad.net/gnuflag"
 	"net/http"
 	"os"
 )
@@ -99,7 +100,23 @@ func (c *userRemove) Info() *Info {
 type login struct{}
 
 func (c *login) Run(context *Context, client Doer) error {
-	email := context.Args[0]
+	var email string
+	if len(context.Args) > 0 {
+		email = context.Args[0]
+	} else {
+		scheme, err := getAuthScheme(client)
+		if err != nil {
+			return err
+		}
+		if scheme.Name == "oauth" {
+			return oauthLogin(context, client, scheme.Data)
+		}
+		fmt.Fprint(context.Stdout, "Email: ")
+		fmt.Fscanf(context.Stdin, "%s\n", &email)
+		if email == "" {
+			return errors.New("You must provide the email!")
+		}
+	}
 	url, err := GetUrl("/users/" + email + "/tokens")
 	if err != nil {
 		return err
@@ -136,9 +153,9 @@ func (c *login) Run(context *Context, client Doer) error {
 func (c *login) Info() *Info {
 	return &Info{
 		Name:    "login",
-		Usage:   "login <email>",
+		Usage:   "login [email]",
 		Desc:    "log in with your credentials.",
-		MinArgs: 1,
+		MinArgs: 0,
 	}
 }
 
@@ -383,6 +400,79 @@ func (c *changePassword) Info() *Info {
 	}
 }
 
+type resetPassword struct {
+	token string
+}
+
+func (c *resetPassword) Info() *Info {
+	return &Info{
+		Name:  "reset-password",
+		Usage: "reset-password <email> [--token|-t <token>]",
+		Desc: `resets your password, in case you forgot it.
+
+Without the token, tsuru sends a reset token to your email. Run the command
+again with the token to choose a new password.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *resetPassword) Run(context *Context, client Doer) error {
+	email := context.Args[0]
+	if c.token == "" {
+		url, err := GetUrl("/users/" + email + "/password")
+		if err != nil {
+			return err
+		}
+		request, err := http.NewRequest("POST", url, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = client.Do(request); err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "If %s is registered in tsuru, an email with the instructions to reset the password was sent to it.\n", email)
+		return nil
+	}
+	url, err := GetUrl("/users/" + email + "/password?token=" + c.token)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(context.Stdout, "New password: ")
+	password, err := passwordFromReader(context.Stdin)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(context.Stdout, "\nConfirm: ")
+	confirm, err := passwordFromReader(context.Stdin)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout)
+	if password != confirm {
+		return errors.New("New password and password confirmation didn't match.")
+	}
+	var body bytes.Buffer
+	if err = json.NewEncoder(&body).Encode(map[string]string{"password": password}); err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Password successfully updated!")
+	return nil
+}
+
+func (c *resetPassword) Flags() *gnuflag.FlagSet {
+	fs := gnuflag.NewFlagSet("reset-password", gnuflag.ExitOnError)
+	fs.StringVar(&c.token, "token", "", "The token sent to your email")
+	fs.StringVar(&c.token, "t", "", "The token sent to your email")
+	return fs
+}
+
 func passwordFromReader(reader io.Reader) (string, error) {
 	var (
 		password string
@@ -12,6 +12,8 @@ import (
 	"io"
 	"launchpad.net/gocheck"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -63,6 +65,135 @@ func (s *S) TestLoginShouldReturnErrorIfThePasswordIsNotGiven(c *gocheck.C) {
 	c.Assert(err, gocheck.ErrorMatches, "^You must provide the password!$")
 }
 
+func (s *S) TestLoginAsksForTheEmailIfTheServerUsesTheNativeScheme(c *gocheck.C) {
+	fsystem = &testing.RecordingFs{}
+	defer func() {
+		fsystem = nil
+	}()
+	reader := strings.NewReader("foo@foo.com\nchico\n")
+	context := Context{[]string{}, manager.stdout, manager.stderr, reader}
+	trans := &ttesting.MultiConditionalTransport{
+		ConditionalTransports: []ttesting.ConditionalTransport{
+			{
+				Transport: ttesting.Transport{Message: `{"name":"native","data":null}`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && req.URL.Path == "/auth/scheme"
+				},
+			},
+			{
+				Transport: ttesting.Transport{Message: `{"token":"sometoken"}`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "POST" && req.URL.Path == "/users/foo@foo.com/tokens"
+				},
+			},
+		},
+	}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(manager.stdout.(*bytes.Buffer).String(), gocheck.Equals, "Email: Password: \nSuccessfully logged in!\n")
+	token, err := readToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(token, gocheck.Equals, "sometoken")
+}
+
+func (s *S) TestLoginWithOAuth(c *gocheck.C) {
+	fsystem = &testing.RecordingFs{}
+	defer func() {
+		fsystem = nil
+	}()
+	var callback *http.Response
+	oldOpenBrowser := openBrowser
+	openBrowser = func(authorizeUrl string) error {
+		u, err := url.Parse(authorizeUrl)
+		c.Assert(err, gocheck.IsNil)
+		c.Assert(u.Host, gocheck.Equals, "sso.tsuru.io")
+		q := u.Query()
+		c.Assert(q.Get("client_id"), gocheck.Equals, "tsuru")
+		c.Assert(q.Get("redirect_uri"), gocheck.Matches, `^http://127\.0\.0\.1:\d+/$`)
+		// The provider redirects the user back to the client.
+		callback, err = http.Get(q.Get("redirect_uri") + "?code=abc123&state=" + q.Get("state"))
+		c.Assert(err, gocheck.IsNil)
+		return nil
+	}
+	defer func() {
+		openBrowser = oldOpenBrowser
+	}()
+	var params map[string]string
+	trans := &ttesting.MultiConditionalTransport{
+		ConditionalTransports: []ttesting.ConditionalTransport{
+			{
+				Transport: ttesting.Transport{
+					Message: `{"name":"oauth","data":{"authorizeUrl":"http://sso.tsuru.io/authorize?client_id=tsuru&response_type=code","port":"0"}}`,
+					Status:  http.StatusOK,
+				},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && req.URL.Path == "/auth/scheme"
+				},
+			},
+			{
+				Transport: ttesting.Transport{Message: `{"token":"oauthtoken"}`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					json.NewDecoder(req.Body).Decode(&params)
+					return req.Method == "POST" && req.URL.Path == "/auth/login"
+				},
+			},
+		},
+	}
+	context := Context{[]string{}, manager.stdout, manager.stderr, manager.stdin}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(callback.StatusCode, gocheck.Equals, http.StatusOK)
+	c.Assert(params["code"], gocheck.Equals, "abc123")
+	c.Assert(params["redirectUrl"], gocheck.Matches, `^http://127\.0\.0\.1:\d+/$`)
+	c.Assert(manager.stdout.(*bytes.Buffer).String(), gocheck.Matches, `(?s)^Opening http://sso\.tsuru\.io/authorize\?.* in your browser\..*\nSuccessfully logged in!\n$`)
+	token, err := readToken()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(token, gocheck.Equals, "oauthtoken")
+}
+
+func (s *S) TestLoginWithOAuthWhenTheUserDeniesTheAuthorization(c *gocheck.C) {
+	oldOpenBrowser := openBrowser
+	openBrowser = func(authorizeUrl string) error {
+		u, _ := url.Parse(authorizeUrl)
+		q := u.Query()
+		_, err := http.Get(q.Get("redirect_uri") + "?error=access_denied&state=" + q.Get("state"))
+		c.Assert(err, gocheck.IsNil)
+		return nil
+	}
+	defer func() {
+		openBrowser = oldOpenBrowser
+	}()
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{
+			Message: `{"name":"oauth","data":{"authorizeUrl":"http://sso.tsuru.io/authorize"}}`,
+			Status:  http.StatusOK,
+		},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/auth/scheme"
+		},
+	}
+	context := Context{[]string{}, manager.stdout, manager.stderr, manager.stdin}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.ErrorMatches, "^Authorization failed: access_denied.$")
+}
+
+func (s *S) TestOAuthCallbackHandlerRefusesWrongState(c *gocheck.C) {
+	results := make(chan callbackResult, 1)
+	handler := callbackHandler("right", results)
+	request, err := http.NewRequest("GET", "/?code=abc123&state=wrong", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusBadRequest)
+	c.Assert(results, gocheck.HasLen, 0)
+}
+
 func (s *S) TestLogout(c *gocheck.C) {
 	rfs := &testing.RecordingFs{}
 	fsystem = rfs
@@ -441,6 +572,81 @@ func (s *S) TestChangePasswordIsACommand(c *gocheck.C) {
 	var _ Command = &changePassword{}
 }
 
+func (s *S) TestResetPasswordSendsTheToken(c *gocheck.C) {
+	var (
+		buf    bytes.Buffer
+		called bool
+	)
+	context := Context{Args: []string{"gopher@golang.org"}, Stdout: &buf}
+	trans := ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.Method == "POST" && req.URL.Path == "/users/gopher@golang.org/password" &&
+				req.URL.Query().Get("token") == ""
+		},
+	}
+	client := NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := resetPassword{}
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	expected := "If gopher@golang.org is registered in tsuru, an email with the instructions to reset the password was sent to it.\n"
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestResetPasswordWithToken(c *gocheck.C) {
+	var (
+		buf    bytes.Buffer
+		called bool
+	)
+	context := Context{
+		Args:   []string{"gopher@golang.org"},
+		Stdout: &buf,
+		Stdin:  strings.NewReader("bbrothers\nbbrothers\n"),
+	}
+	trans := ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			var got map[string]string
+			called = true
+			if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+				return false
+			}
+			return got["password"] == "bbrothers" && req.Method == "POST" &&
+				req.URL.Path == "/users/gopher@golang.org/password" &&
+				req.URL.Query().Get("token") == "abc123"
+		},
+	}
+	client := NewClient(&http.Client{Transport: &trans}, nil, manager)
+	command := resetPassword{}
+	command.Flags().Parse(true, []string{"-t", "abc123"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	expected := "New password: \nConfirm: \nPassword successfully updated!\n"
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestResetPasswordWrongConfirmation(c *gocheck.C) {
+	var buf bytes.Buffer
+	context := Context{
+		Args:   []string{"gopher@golang.org"},
+		Stdin:  strings.NewReader("blood\nsugar\n"),
+		Stdout: &buf,
+	}
+	command := resetPassword{token: "abc123"}
+	err := command.Run(&context, nil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "New password and password confirmation didn't match.")
+}
+
+func (s *S) TestResetPasswordFlags(c *gocheck.C) {
+	command := resetPassword{}
+	command.Flags().Parse(true, []string{"--token", "abc123"})
+	c.Assert(command.token, gocheck.Equals, "abc123")
+}
+
 func (s *S) TestPasswordFromReaderUsingFile(c *gocheck.C) {
 	tmpdir, err := filepath.EvalSymlinks(os.TempDir())
 	filename := path.Join(tmpdir, "password-reader.txt")
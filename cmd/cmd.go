@@ -57,7 +57,16 @@ func BuildBaseManager(name, version, versionHeader string) *Manager {
 	m.Register(&teamList{})
 	m.Register(&teamUserAdd{})
 	m.Register(&teamUserRemove{})
+	m.Register(&teamUserRole{})
+	m.Register(&roleList{})
+	m.Register(&roleCreate{})
+	m.Register(&roleRemove{})
 	m.Register(&changePassword{})
+	m.Register(&resetPassword{})
+	m.Register(&tokenCreate{})
+	m.Register(&tokenList{})
+	m.Register(&tokenRevoke{})
+	m.Register(&eventList{})
 	m.Register(&targetList{})
 	m.Register(&targetAdd{})
 	m.Register(&targetRemove{})
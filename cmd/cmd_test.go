@@ -346,6 +346,48 @@ func (s *S) TestTeamRemoveUserIsRegistered(c *gocheck.C) {
 	c.Assert(removeuser, gocheck.FitsTypeOf, &teamUserRemove{})
 }
 
+func (s *S) TestRoleCommandsAreRegistered(c *gocheck.C) {
+	manager := BuildBaseManager("tsuru", "1.0", "")
+	var tests = []struct {
+		name    string
+		command Command
+	}{
+		{"team-user-role", &teamUserRole{}},
+		{"role-list", &roleList{}},
+		{"role-create", &roleCreate{}},
+		{"role-remove", &roleRemove{}},
+	}
+	for _, t := range tests {
+		command, ok := manager.Commands[t.name]
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(command, gocheck.FitsTypeOf, t.command)
+	}
+}
+
+func (s *S) TestTokenCommandsAreRegistered(c *gocheck.C) {
+	manager := BuildBaseManager("tsuru", "1.0", "")
+	var tests = []struct {
+		name    string
+		command Command
+	}{
+		{"token-create", &tokenCreate{}},
+		{"token-list", &tokenList{}},
+		{"token-revoke", &tokenRevoke{}},
+	}
+	for _, t := range tests {
+		command, ok := manager.Commands[t.name]
+		c.Check(ok, gocheck.Equals, true)
+		c.Check(command, gocheck.FitsTypeOf, t.command)
+	}
+}
+
+func (s *S) TestEventListIsRegistered(c *gocheck.C) {
+	manager := BuildBaseManager("tsuru", "1.0", "")
+	list, ok := manager.Commands["event-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, &eventList{})
+}
+
 func (s *S) TestTargetIsRegistered(c *gocheck.C) {
 	manager := BuildBaseManager("tsuru", "1.0", "")
 	tgt, ok := manager.Commands["target-list"]
@@ -374,6 +416,13 @@ func (s *S) TestChangePasswordIsRegistered(c *gocheck.C) {
 	c.Assert(chpass, gocheck.FitsTypeOf, &changePassword{})
 }
 
+func (s *S) TestResetPasswordIsRegistered(c *gocheck.C) {
+	manager := BuildBaseManager("tsuru", "1.0", "")
+	reset, ok := manager.Commands["reset-password"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(reset, gocheck.FitsTypeOf, &resetPassword{})
+}
+
 func (s *S) TestVersionIsRegisteredByNewManager(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	manager := NewManager("tsuru", "1.0", "", &stdout, &stderr, os.Stdin)
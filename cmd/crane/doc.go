@@ -26,6 +26,10 @@ The currently available commands are (grouped by subject):
 	login             authenticates the user with tsuru server
 	logout            finishes the session with tsuru server
 	change-password   changes your password
+	reset-password    resets your password, in case you forgot it
+	token-create      creates a personal access token
+	token-list        lists your tokens
+	token-revoke      revokes one of your tokens
 	key-add           adds a public key to tsuru deploy server
 	key-remove        removes a public key from tsuru deploy server
 
@@ -34,6 +38,11 @@ The currently available commands are (grouped by subject):
 	team-list         list teams that the user is member
 	team-user-add     adds a user to a team
 	team-user-remove  removes a user from a team
+	team-user-role    sets the role of a user in a team
+	role-list         lists the available roles and their permissions
+	role-create       creates a new role (admins only)
+	role-remove       removes a role (admins only)
+	event-list        lists the operations performed in tsuru
 
 	template          generates a new manifest file, so you can just fill information for your service
 	create            creates a new service from a manifest file
@@ -97,12 +106,17 @@ Authenticate within remote crane server
 
 Usage:
 
-	% crane login <email>
+	% crane login [email]
 
 Login will ask for the password and check if the user is successfully
 authenticated. If so, the token generated by the crane server will be stored in
 ${HOME}/.crane_token.
 
+Servers that authenticate users with an OAuth2 provider don't use passwords:
+omit the email, and login will open the authorization page of the provider in
+the browser. After the authorization, the provider redirects the browser back to
+login, which listens for it locally.
+
 All crane actions require the user to be authenticated (except login and
 user-create, obviously).
 
@@ -127,6 +141,57 @@ change-password will change the password of the logged in user. It will ask for
 the current password, the new and the confirmation.
 
 
+Reset user's password
+
+Usage:
+
+	% crane reset-password <email> [--token|-t <token>]
+
+reset-password resets the password of a user who forgot it, in two steps. When
+called without the token, tsuru sends an email with a reset token to the user.
+Then, call reset-password again, with the token, to choose the new password.
+The token expires in 24 hours and can be used only once. Resetting the password
+logs out all your sessions and revokes your personal access tokens, so you need
+to log in again.
+
+
+Create a personal access token
+
+Usage:
+
+	% crane token-create <name> [--expires days] [--apps app1,app2] [--permissions perm1,perm2]
+
+token-create creates a personal access token, to be used by scripts and CI
+pipelines instead of the token created when you log in. The token expires in
+30 days by default, and may last up to 365 days. Use the --apps flag to limit
+the token to some apps, and the --permissions flag to limit it to some
+permissions (see role-list). Personal access tokens can't be used to create
+other tokens, nor to change your password or remove your user.
+
+The token is displayed only once, so save it somewhere safe.
+
+
+List your tokens
+
+Usage:
+
+	% crane token-list
+
+token-list lists your valid tokens, including the ones created by logging in.
+The token you're currently using is marked with an asterisk. The value of the
+tokens is never displayed.
+
+
+Revoke a token
+
+Usage:
+
+	% crane token-revoke <id>
+
+token-revoke revokes one of your tokens, using the id displayed by token-list.
+Requests authenticated by the token fail right away.
+
+
 Create a new team for the user
 
 Usage:
@@ -166,8 +231,8 @@ Usage:
 
 	% crane team-user-add <teamname> <useremail>
 
-team-user-add adds a user to a team. You need to be a member of the team to be
-able to add another user to it.
+team-user-add adds a user to a team. You need the team.manage permission in
+the team to be able to add another user to it.
 
 
 Remove a user from a team
@@ -183,6 +248,75 @@ A team can never have 0 users. If you are the last member of a team, you can't
 remove yourself from it.
 
 
+Set the role of a user in a team
+
+Usage:
+
+	% crane team-user-role <teamname> <useremail> <role>
+
+team-user-role assigns a role to a member of a team. The role defines what the
+user can do with the apps, services and service instances of the team. You
+need the team.manage permission in the team to be able to assign roles. A
+team must always have a member with the team.manage permission, so its last
+manager can't be assigned to a role without it.
+
+The creator of a team is always its owner. Users added to a team are assigned
+to the role of new members of the server, usually "developer".
+
+
+List roles
+
+Usage:
+
+	% crane role-list
+
+role-list lists the available roles, along with their permissions. Tsuru comes
+with three roles: "owner", that has all permissions; "developer", that can do
+anything but removing apps and services, managing the access of other teams
+and managing the team; and "viewer", that can only read information.
+
+
+Create a role
+
+Usage:
+
+	% crane role-create <name> <permission> [permission...]
+
+role-create creates a new role with the given permissions, like app.deploy,
+app.env.set, app.delete, service.create or team.manage. Only admins can create
+roles.
+
+
+Remove a role
+
+Usage:
+
+	% crane role-remove <name>
+
+role-remove removes a role. Only admins can remove roles, and roles assigned to
+members of any team can't be removed.
+
+
+List the operations performed in tsuru
+
+Usage:
+
+	% crane event-list [--target name] [--actor email] [--limit n]
+
+event-list lists the operations performed through the tsuru API (creating
+apps, setting environment variables, adding users to teams and so on), from
+the newest to the oldest. Each operation is displayed with its date, the user
+that performed it, its target, its parameters and its result. Secret
+parameters, like passwords, are never displayed.
+
+The --target flag filters the operations by their target, like an app or a
+team, and the --actor flag filters them by the user that performed them. Users
+can list the operations performed by anyone on the apps they have access to,
+and only their own operations on other targets; admins can list every
+operation. At most 100 operations are listed, unless another limit, up to
+1000, is given with the --limit flag.
+
+
 Create an empty manifest file
 
 Usage:
@@ -222,8 +356,30 @@ Here is an example of usage:
 You can use "crane template" to generate a template. Both id and production
 endpoint are required fields.
 
+Before sending the manifest to tsuru, crane validates it, and reports all the
+problems found in it, like unknown fields (often typos), a missing production
+endpoint or plans without names. The fields accepted in the manifest are:
+
+	id           the id of the service, required
+	endpoint     the production (required) and the test endpoints
+	password     the password used by tsuru to authenticate in the service api
+	plans        the plans offered by the service, each one with a name and a
+	             description
+	doc          the documentation of the service
+	team         the team that administrates the service
+	test-teams   the teams that use the test endpoint
+	description  the description of the service, displayed in the catalog
+	tags         a list of tags, used to search the catalog
+	doc-url      the address of the documentation of the service
+	maintainer   the team that maintains the service
+
 When creating a new service, crane will add all user's teams as administrator
-teams of the service.
+teams of the service, unless the manifest declares the team field.
+
+Instances created by members of the teams listed in test-teams use the test
+endpoint of the service, so service providers can test new versions of their
+api before deploying them to production. Instances of all other teams use the
+production endpoint.
 
 
 Update a service
@@ -233,8 +389,13 @@ Usage:
 	% crane update <manifest-file.yaml>
 
 Update will update a service using a manifest file. Currently, it's only
-possible to edit an endpoint, or add new endpoints. You need to be an
-administrator of the team to perform an update.
+possible to edit endpoints, plans, test teams, documentation, catalog metadata
+and the password of the service. When the
+manifest has a password, it replaces the password that tsuru uses to
+authenticate in the service api. The endpoints are always replaced, but the
+other fields missing in the manifest keep their current values; an empty list
+clears the plans, test teams or tags. You need to be an administrator of the
+team to perform an update.
 
 
 Remove a service
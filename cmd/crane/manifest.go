@@ -0,0 +1,193 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// manifestFields are the fields accepted in the manifest of a service.
+var manifestFields = map[string]bool{
+	"id":          true,
+	"endpoint":    true,
+	"password":    true,
+	"plans":       true,
+	"doc":         true,
+	"team":        true,
+	"test-teams":  true,
+	"description": true,
+	"tags":        true,
+	"doc-url":     true,
+	"maintainer":  true,
+}
+
+var serviceIdRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// readManifest reads the manifest in the given path, validating it before it
+// is sent to the tsuru server.
+func readManifest(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateManifest(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// validateManifest checks the schema of a manifest, returning an error that
+// describes all the problems found in it.
+func validateManifest(content []byte) error {
+	var manifest map[string]interface{}
+	if err := goyaml.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("Invalid manifest: %s", err)
+	}
+	var problems []string
+	var unknown []string
+	for field := range manifest {
+		if !manifestFields[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown field %q", field))
+	}
+	problems = append(problems, validateId(manifest["id"])...)
+	endpoints, p := validateEndpoints(manifest["endpoint"])
+	problems = append(problems, p...)
+	problems = append(problems, validatePlans(manifest["plans"])...)
+	for _, field := range []string{"password", "doc", "team", "description", "doc-url", "maintainer"} {
+		if value, ok := manifest[field]; ok {
+			if _, ok := value.(string); !ok {
+				problems = append(problems, fmt.Sprintf("the field %q must be a string", field))
+			}
+		}
+	}
+	if tags, ok := manifest["tags"]; ok && !isStringList(tags) {
+		problems = append(problems, `the field "tags" must be a list of tags`)
+	}
+	if teams, ok := manifest["test-teams"]; ok {
+		if !isStringList(teams) {
+			problems = append(problems, `the field "test-teams" must be a list of team names`)
+		} else if !endpoints["test"] {
+			problems = append(problems, `the field "test-teams" requires a test endpoint`)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("Invalid manifest:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func validateId(value interface{}) []string {
+	if value == nil {
+		return []string{`the field "id" is required`}
+	}
+	id, ok := value.(string)
+	if !ok {
+		return []string{`the field "id" must be a string`}
+	}
+	if !serviceIdRegexp.MatchString(id) {
+		msg := fmt.Sprintf("the id %q is invalid, it must start with a letter and contain only lowercase letters, numbers, dashes and underscores", id)
+		return []string{msg}
+	}
+	return nil
+}
+
+// validateEndpoints validates the endpoint field of the manifest, returning
+// the names of the declared endpoints and the problems found in the field.
+func validateEndpoints(value interface{}) (map[string]bool, []string) {
+	names := make(map[string]bool)
+	if value == nil {
+		return names, []string{`the field "endpoint" is required`}
+	}
+	endpoints, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return names, []string{`the field "endpoint" must map the names of the endpoints to their addresses`}
+	}
+	var problems []string
+	for k, v := range endpoints {
+		name := fmt.Sprint(k)
+		if name != "production" && name != "test" {
+			problems = append(problems, fmt.Sprintf(`unknown endpoint %q, the endpoints must be "production" or "test"`, name))
+			continue
+		}
+		if addr, ok := v.(string); !ok || addr == "" {
+			problems = append(problems, fmt.Sprintf("the address of the %s endpoint must be a non-empty string", name))
+			continue
+		}
+		names[name] = true
+	}
+	if _, ok := endpoints["production"]; !ok {
+		problems = append(problems, "the production endpoint is required")
+	}
+	sort.Strings(problems)
+	return names, problems
+}
+
+func validatePlans(value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	plans, ok := value.([]interface{})
+	if !ok {
+		return []string{`the field "plans" must be a list of plans`}
+	}
+	var problems []string
+	seen := make(map[string]bool)
+	for i, p := range plans {
+		plan, ok := p.(map[interface{}]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("the plan #%d must have a name and a description", i+1))
+			continue
+		}
+		var unknown []string
+		for k := range plan {
+			if field := fmt.Sprint(k); field != "name" && field != "description" {
+				unknown = append(unknown, field)
+			}
+		}
+		sort.Strings(unknown)
+		for _, field := range unknown {
+			problems = append(problems, fmt.Sprintf("unknown field %q in the plan #%d", field, i+1))
+		}
+		name, ok := plan["name"].(string)
+		if !ok || name == "" {
+			problems = append(problems, fmt.Sprintf("the plan #%d must have a name", i+1))
+			continue
+		}
+		if seen[name] {
+			problems = append(problems, fmt.Sprintf("the plan %q is declared more than once", name))
+		}
+		seen[name] = true
+		if desc, ok := plan["description"]; ok {
+			if _, ok := desc.(string); !ok {
+				problems = append(problems, fmt.Sprintf("the description of the plan %q must be a string", name))
+			}
+		}
+	}
+	return problems
+}
+
+func isStringList(value interface{}) bool {
+	list, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
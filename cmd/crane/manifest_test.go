@@ -0,0 +1,144 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/globocom/tsuru/cmd"
+	"github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestValidateManifest(c *gocheck.C) {
+	manifest := `id: mysqlapi
+endpoint:
+  production: mysqlapi.com
+  test: localhost:8000
+password: s3cr3t
+doc: MySQL databases
+team: dba
+test-teams:
+  - qa
+plans:
+  - name: small
+    description: 1 GB of storage
+  - name: large
+description: MySQL databases
+tags:
+  - database
+  - sql
+doc-url: http://mysqlapi.com/docs
+maintainer: dba
+`
+	err := validateManifest([]byte(manifest))
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestValidateManifestReportsAllProblems(c *gocheck.C) {
+	manifest := `endpoint:
+  production: mysqlapi.com
+  staging: localhost:8000
+pasword: s3cr3t
+test-teams:
+  - qa
+plans:
+  - name: small
+    descripton: 1 GB of storage
+  - name: small
+  - description: no name
+`
+	err := validateManifest([]byte(manifest))
+	c.Assert(err, gocheck.NotNil)
+	expected := `Invalid manifest:
+  - unknown field "pasword"
+  - the field "id" is required
+  - unknown endpoint "staging", the endpoints must be "production" or "test"
+  - unknown field "descripton" in the plan #1
+  - the plan "small" is declared more than once
+  - the plan #3 must have a name
+  - the field "test-teams" requires a test endpoint`
+	c.Assert(err.Error(), gocheck.Equals, expected)
+}
+
+func (s *S) TestValidateManifestWithoutEndpoint(c *gocheck.C) {
+	err := validateManifest([]byte("id: mysqlapi\n"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Invalid manifest:\n  - the field \"endpoint\" is required")
+}
+
+func (s *S) TestValidateManifestWithoutProductionEndpoint(c *gocheck.C) {
+	err := validateManifest([]byte("id: mysqlapi\nendpoint:\n  test: localhost:8000\n"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Invalid manifest:\n  - the production endpoint is required")
+}
+
+func (s *S) TestValidateManifestWithInvalidId(c *gocheck.C) {
+	err := validateManifest([]byte("id: My API\nendpoint:\n  production: mysqlapi.com\n"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, `(?s)Invalid manifest:\n  - the id "My API" is invalid.*`)
+}
+
+func (s *S) TestValidateManifestWithFieldsOfTheWrongType(c *gocheck.C) {
+	manifest := "id: mysqlapi\nendpoint: mysqlapi.com\npassword: 1234\nplans: small\ntags: database\ntest-teams: qa\n"
+	err := validateManifest([]byte(manifest))
+	c.Assert(err, gocheck.NotNil)
+	expected := `Invalid manifest:
+  - the field "endpoint" must map the names of the endpoints to their addresses
+  - the field "plans" must be a list of plans
+  - the field "password" must be a string
+  - the field "tags" must be a list of tags
+  - the field "test-teams" must be a list of team names`
+	c.Assert(err.Error(), gocheck.Equals, expected)
+}
+
+func (s *S) TestValidateManifestWithInvalidYaml(c *gocheck.C) {
+	err := validateManifest([]byte("id: [mysqlapi\n"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, "^Invalid manifest: .*")
+}
+
+func (s *S) TestServiceCreateDoesNotSendInvalidManifests(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "success", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return true
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	context := cmd.Context{
+		Args:   []string{"testdata/invalid-manifest.yml"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	err := (&ServiceCreate{}).Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Invalid manifest:\n  - unknown field \"endpiont\"\n  - the field \"endpoint\" is required")
+	c.Assert(called, gocheck.Equals, false)
+}
+
+func (s *S) TestServiceUpdateDoesNotSendInvalidManifests(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	trans := testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return true
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	context := cmd.Context{
+		Args:   []string{"testdata/invalid-manifest.yml"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	err := (&ServiceUpdate{}).Run(&context, client)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(called, gocheck.Equals, false)
+}
@@ -32,7 +32,7 @@ func (c *ServiceCreate) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	b, err := ioutil.ReadFile(manifest)
+	b, err := readManifest(manifest)
 	if err != nil {
 		return err
 	}
@@ -130,7 +130,7 @@ func (c *ServiceUpdate) Info() *cmd.Info {
 
 func (c *ServiceUpdate) Run(ctx *cmd.Context, client cmd.Doer) error {
 	manifest := ctx.Args[0]
-	b, err := ioutil.ReadFile(manifest)
+	b, err := readManifest(manifest)
 	if err != nil {
 		return err
 	}
@@ -234,7 +234,11 @@ func (c *ServiceTemplate) Run(ctx *cmd.Context, client cmd.Doer) error {
 	template := `id: servicename
 endpoint:
   production: production-endpoint.com
-  test: test-endpoint.com:8080`
+  test: test-endpoint.com:8080
+password: your-password
+plans:
+  - name: small
+    description: plan description`
 	f, err := os.Create("manifest.yaml")
 	defer f.Close()
 	if err != nil {
@@ -283,6 +283,10 @@ func (s *S) TestServiceTemplateRun(c *gocheck.C) {
 	manifest := `id: servicename
 endpoint:
   production: production-endpoint.com
-  test: test-endpoint.com:8080`
+  test: test-endpoint.com:8080
+password: your-password
+plans:
+  - name: small
+    description: plan description`
 	c.Assert(string(fc), gocheck.Equals, manifest)
 }
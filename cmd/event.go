@@ -0,0 +1,110 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type eventList struct {
+	target string
+	actor  string
+	limit  int
+}
+
+func (c *eventList) Info() *Info {
+	return &Info{
+		Name:  "event-list",
+		Usage: "event-list [--target name] [--actor email] [--limit n]",
+		Desc: `lists the operations performed in tsuru, from the newest to the oldest. Admins
+can list every operation, other users can list the operations on the apps they
+have access to and their own operations.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *eventList) Run(context *Context, client Doer) error {
+	query := url.Values{}
+	if c.target != "" {
+		query.Set("target", c.target)
+	}
+	if c.actor != "" {
+		query.Set("actor", c.actor)
+	}
+	if c.limit > 0 {
+		query.Set("limit", strconv.Itoa(c.limit))
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	u, err := GetUrl(path)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No events found.")
+		return nil
+	}
+	var events []struct {
+		Actor     string
+		Action    string
+		Target    string
+		Params    []struct{ Name, Value string }
+		Status    int
+		Error     string
+		Timestamp time.Time
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return err
+	}
+	table := NewTable()
+	table.Headers = Row([]string{"Date", "Actor", "Action", "Target", "Params", "Result"})
+	for _, e := range events {
+		params := make([]string, len(e.Params))
+		for i, p := range e.Params {
+			params[i] = p.Name + "=" + p.Value
+		}
+		result := "ok"
+		if e.Status >= 400 {
+			result = strings.Replace(fmt.Sprintf("%d %s", e.Status, e.Error), "\n", " ", -1)
+		}
+		actor := e.Actor
+		if actor == "" {
+			actor = "-"
+		}
+		date := e.Timestamp.Format("2006-01-02 15:04:05")
+		table.AddRow(Row([]string{date, actor, e.Action, e.Target, strings.Join(params, ", "), result}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+func (c *eventList) Flags() *gnuflag.FlagSet {
+	fs := gnuflag.NewFlagSet("event-list", gnuflag.ExitOnError)
+	fs.StringVar(&c.target, "target", "", "Only list the operations on the given target, like an app or a team")
+	fs.StringVar(&c.target, "t", "", "Only list the operations on the given target, like an app or a team")
+	fs.StringVar(&c.actor, "actor", "", "Only list the operations performed by the given user")
+	fs.StringVar(&c.actor, "a", "", "Only list the operations performed by the given user")
+	fs.IntVar(&c.limit, "limit", 0, "The maximum number of operations to list (defaults to 100, at most 1000)")
+	fs.IntVar(&c.limit, "l", 0, "The maximum number of operations to list (defaults to 100, at most 1000)")
+	return fs
+}
@@ -0,0 +1,78 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestEventListInfo(c *gocheck.C) {
+	info := (&eventList{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "event-list")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestEventListRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	result := `[{"Actor":"gopher@golang.org","Action":"app.env.unset","Target":"payments","Params":[{"Name":"app","Value":"payments"},{"Name":"body","Value":"[\"DATABASE_URL\"]"}],"Status":200,"Error":"","Timestamp":"2013-08-20T10:00:00Z"},
+{"Actor":"","Action":"user.login","Target":"rob@golang.org","Params":[{"Name":"email","Value":"rob@golang.org"},{"Name":"password","Value":"*****"}],"Status":401,"Error":"Authentication failed, wrong password.","Timestamp":"2013-08-20T09:00:00Z"}]`
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/events" && req.URL.RawQuery == ""
+		},
+	}
+	expected := `+---------------------+-------------------+---------------+----------------+--------------------------------------+--------------------------------------------+
+| Date                | Actor             | Action        | Target         | Params                               | Result                                     |
++---------------------+-------------------+---------------+----------------+--------------------------------------+--------------------------------------------+
+| 2013-08-20 10:00:00 | gopher@golang.org | app.env.unset | payments       | app=payments, body=["DATABASE_URL"]  | ok                                         |
+| 2013-08-20 09:00:00 | -                 | user.login    | rob@golang.org | email=rob@golang.org, password=***** | 401 Authentication failed, wrong password. |
++---------------------+-------------------+---------------+----------------+--------------------------------------+--------------------------------------------+
+`
+	context := Context{Args: []string{}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&eventList{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestEventListRunWithFilters(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "[]", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			query := req.URL.Query()
+			return req.URL.Path == "/events" && query.Get("target") == "payments" &&
+				query.Get("actor") == "gopher@golang.org" && query.Get("limit") == "10"
+		},
+	}
+	command := eventList{}
+	command.Flags().Parse(true, []string{"-t", "payments", "--actor", "gopher@golang.org", "-l", "10"})
+	context := Context{Args: []string{}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestEventListRunWithoutEvents(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.Transport{Message: "", Status: http.StatusNoContent}
+	context := Context{Args: []string{}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&eventList{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "No events found.\n")
+}
+
+func (s *S) TestEventListFlagsDefaults(c *gocheck.C) {
+	command := eventList{}
+	command.Flags().Parse(true, []string{})
+	c.Assert(command.target, gocheck.Equals, "")
+	c.Assert(command.actor, gocheck.Equals, "")
+	c.Assert(command.limit, gocheck.Equals, 0)
+}
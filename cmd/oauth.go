@@ -0,0 +1,179 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// oauthTimeout is how long the login waits for the user to authorize tsuru in
+// the OAuth2 provider.
+var oauthTimeout = 5 * time.Minute
+
+// openBrowser opens the given url in the browser of the user.
+var openBrowser = func(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "start", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+type authScheme struct {
+	Name string
+	Data map[string]string
+}
+
+// getAuthScheme asks the server for the authentication scheme it uses.
+func getAuthScheme(client Doer) (*authScheme, error) {
+	url, err := GetUrl("/auth/scheme")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var scheme authScheme
+	if err = json.NewDecoder(response.Body).Decode(&scheme); err != nil {
+		return nil, err
+	}
+	return &scheme, nil
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// oauthLogin logs the user in using the OAuth2 authorization code flow. It
+// opens the authorization url of the provider in the browser, and listens
+// locally for the redirect of the provider, that carries the code. The code
+// is then sent to the tsuru server, which exchanges it for a token.
+func oauthLogin(context *Context, client Doer, info map[string]string) error {
+	port := info["port"]
+	if port == "" {
+		port = "0"
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		return fmt.Errorf("Failed to listen for the authorization callback: %s", err)
+	}
+	defer listener.Close()
+	redirectUrl := fmt.Sprintf("http://%s/", listener.Addr())
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+	authorizeUrl, err := url.Parse(info["authorizeUrl"])
+	if err != nil {
+		return err
+	}
+	q := authorizeUrl.Query()
+	q.Set("redirect_uri", redirectUrl)
+	q.Set("state", state)
+	authorizeUrl.RawQuery = q.Encode()
+	results := make(chan callbackResult, 1)
+	go http.Serve(listener, callbackHandler(state, results))
+	fmt.Fprintf(context.Stdout, "Opening %s in your browser. If it does not open, copy the url to the browser.\n", authorizeUrl)
+	openBrowser(authorizeUrl.String())
+	var result callbackResult
+	select {
+	case result = <-results:
+	case <-time.After(oauthTimeout):
+		return errors.New("Timed out waiting for the authorization.")
+	}
+	if result.err != nil {
+		return result.err
+	}
+	params := map[string]string{"code": result.code, "redirectUrl": redirectUrl}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	loginUrl, err := GetUrl("/auth/login")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", loginUrl, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	out := make(map[string]string)
+	if err = json.Unmarshal(body, &out); err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Successfully logged in!")
+	return writeToken(out["token"])
+}
+
+// callbackHandler handles the redirect of the provider, sending the code (or
+// the error) to results. Requests with a wrong state are refused.
+func callbackHandler(state string, results chan<- callbackResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "Invalid state.", http.StatusBadRequest)
+			return
+		}
+		var result callbackResult
+		if result.code = q.Get("code"); result.code == "" {
+			reason := q.Get("error")
+			if reason == "" {
+				reason = "the provider did not send the authorization code"
+			}
+			result.err = fmt.Errorf("Authorization failed: %s.", reason)
+			fmt.Fprintln(w, result.err)
+		} else {
+			fmt.Fprintln(w, "Authorization granted, you can close this window and go back to the terminal.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type roleList struct{}
+
+func (c *roleList) Info() *Info {
+	return &Info{
+		Name:    "role-list",
+		Usage:   "role-list",
+		Desc:    "lists the available roles, along with their permissions.",
+		MinArgs: 0,
+	}
+}
+
+func (c *roleList) Run(context *Context, client Doer) error {
+	url, err := GetUrl("/roles")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var roles []struct {
+		Name        string
+		Permissions []string
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&roles); err != nil {
+		return err
+	}
+	table := NewTable()
+	table.Headers = Row([]string{"Role", "Permissions"})
+	for _, role := range roles {
+		table.AddRow(Row([]string{role.Name, strings.Join(role.Permissions, ", ")}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type roleCreate struct{}
+
+func (c *roleCreate) Info() *Info {
+	return &Info{
+		Name:    "role-create",
+		Usage:   "role-create <name> <permission> [permission...]",
+		Desc:    "creates a new role with the given permissions. Only admins can create roles.",
+		MinArgs: 2,
+	}
+}
+
+func (c *roleCreate) Run(context *Context, client Doer) error {
+	name := context.Args[0]
+	url, err := GetUrl("/roles")
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	params := map[string]interface{}{"name": name, "permissions": context.Args[1:]}
+	if err = json.NewEncoder(&b).Encode(params); err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, &b)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Role %q successfully created!\n", name)
+	return nil
+}
+
+type roleRemove struct{}
+
+func (c *roleRemove) Info() *Info {
+	return &Info{
+		Name:    "role-remove",
+		Usage:   "role-remove <name>",
+		Desc:    "removes a role. Only admins can remove roles.",
+		MinArgs: 1,
+	}
+}
+
+func (c *roleRemove) Run(context *Context, client Doer) error {
+	name := context.Args[0]
+	url, err := GetUrl("/roles/" + name)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Role %q successfully removed!\n", name)
+	return nil
+}
+
+type teamUserRole struct{}
+
+func (c *teamUserRole) Info() *Info {
+	return &Info{
+		Name:    "team-user-role",
+		Usage:   "team-user-role <teamname> <useremail> <role>",
+		Desc:    "sets the role of a user in a team.",
+		MinArgs: 3,
+	}
+}
+
+func (c *teamUserRole) Run(context *Context, client Doer) error {
+	teamName, userName, role := context.Args[0], context.Args[1], context.Args[2]
+	url, err := GetUrl(fmt.Sprintf("/teams/%s/%s/role/%s", teamName, userName, role))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, `User "%s" is now %s in the "%s" team`+"\n", userName, role, teamName)
+	return nil
+}
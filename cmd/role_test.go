@@ -0,0 +1,98 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestRoleListRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{
+			Message: `[{"Name":"viewer","Permissions":["app.read","service.read"]},{"Name":"deployer","Permissions":["app.deploy"]}]`,
+			Status:  http.StatusOK,
+		},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/roles"
+		},
+	}
+	expected := `+----------+------------------------+
+| Role     | Permissions            |
++----------+------------------------+
+| viewer   | app.read, service.read |
+| deployer | app.deploy             |
++----------+------------------------+
+`
+	context := Context{Args: []string{}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&roleList{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestRoleCreateRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusCreated},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&params)
+			perms, _ := params["permissions"].([]interface{})
+			return req.Method == "POST" && req.URL.Path == "/roles" &&
+				params["name"] == "deployer" && len(perms) == 2 &&
+				perms[0] == "app.read" && perms[1] == "app.deploy"
+		},
+	}
+	context := Context{Args: []string{"deployer", "app.read", "app.deploy"}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&roleCreate{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, `Role "deployer" successfully created!`+"\n")
+}
+
+func (s *S) TestRoleRemoveRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/roles/deployer"
+		},
+	}
+	context := Context{Args: []string{"deployer"}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&roleRemove{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, `Role "deployer" successfully removed!`+"\n")
+}
+
+func (s *S) TestTeamUserRoleRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "PUT" && req.URL.Path == "/teams/cobrateam/intern@globo.com/role/developer"
+		},
+	}
+	context := Context{Args: []string{"cobrateam", "intern@globo.com", "developer"}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&teamUserRole{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, `User "intern@globo.com" is now developer in the "cobrateam" team`+"\n")
+}
+
+func (s *S) TestTeamUserRoleInfo(c *gocheck.C) {
+	expected := &Info{
+		Name:    "team-user-role",
+		Usage:   "team-user-role <teamname> <useremail> <role>",
+		Desc:    "sets the role of a user in a team.",
+		MinArgs: 3,
+	}
+	c.Assert((&teamUserRole{}).Info(), gocheck.DeepEquals, expected)
+}
@@ -0,0 +1,174 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"launchpad.net/gnuflag"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type tokenCreate struct {
+	expires     int
+	apps        string
+	permissions string
+}
+
+func (c *tokenCreate) Info() *Info {
+	return &Info{
+		Name:  "token-create",
+		Usage: "token-create <name> [--expires days] [--apps app1,app2] [--permissions perm1,perm2]",
+		Desc: `creates a personal access token, to be used by scripts and CI pipelines instead of
+your login token. The token may be limited to some apps and permissions, and
+expires in 30 days by default. It's displayed only once, so save it somewhere
+safe.`,
+		MinArgs: 1,
+	}
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *tokenCreate) Run(context *Context, client Doer) error {
+	url, err := GetUrl("/users/tokens")
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	params := map[string]interface{}{
+		"name":        context.Args[0],
+		"expires":     c.expires,
+		"apps":        splitList(c.apps),
+		"permissions": splitList(c.permissions),
+	}
+	if err = json.NewEncoder(&b).Encode(params); err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, &b)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var token map[string]string
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Personal access token: %q.\n", token["token"])
+	return nil
+}
+
+func (c *tokenCreate) Flags() *gnuflag.FlagSet {
+	fs := gnuflag.NewFlagSet("token-create", gnuflag.ExitOnError)
+	fs.IntVar(&c.expires, "expires", 30, "The number of days until the token expires")
+	fs.IntVar(&c.expires, "e", 30, "The number of days until the token expires")
+	fs.StringVar(&c.apps, "apps", "", "Comma-separated list of apps the token is limited to")
+	fs.StringVar(&c.apps, "a", "", "Comma-separated list of apps the token is limited to")
+	fs.StringVar(&c.permissions, "permissions", "", "Comma-separated list of permissions the token is limited to")
+	fs.StringVar(&c.permissions, "p", "", "Comma-separated list of permissions the token is limited to")
+	return fs
+}
+
+type tokenList struct{}
+
+func (c *tokenList) Info() *Info {
+	return &Info{
+		Name:    "token-list",
+		Usage:   "token-list",
+		Desc:    "lists your valid tokens, including the ones created by logging in.",
+		MinArgs: 0,
+	}
+}
+
+func (c *tokenList) Run(context *Context, client Doer) error {
+	url, err := GetUrl("/users/tokens")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var tokens []struct {
+		Id          string
+		Name        string
+		ValidUntil  time.Time `json:"valid-until"`
+		Apps        []string
+		Permissions []string
+		Current     bool
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return err
+	}
+	table := NewTable()
+	table.Headers = Row([]string{"Id", "Name", "Expires", "Apps", "Permissions"})
+	for _, token := range tokens {
+		name := token.Name
+		if name == "" {
+			name = "(login)"
+		}
+		if token.Current {
+			name += " *"
+		}
+		apps, perms := strings.Join(token.Apps, ", "), strings.Join(token.Permissions, ", ")
+		if apps == "" {
+			apps = "all"
+		}
+		if perms == "" {
+			perms = "all"
+		}
+		expires := token.ValidUntil.Format("2006-01-02 15:04")
+		table.AddRow(Row([]string{token.Id, name, expires, apps, perms}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type tokenRevoke struct{}
+
+func (c *tokenRevoke) Info() *Info {
+	return &Info{
+		Name:    "token-revoke",
+		Usage:   "token-revoke <id>",
+		Desc:    "revokes one of your tokens. Use token-list to find the id of the token.",
+		MinArgs: 1,
+	}
+}
+
+func (c *tokenRevoke) Run(context *Context, client Doer) error {
+	id := context.Args[0]
+	url, err := GetUrl("/users/tokens?id=" + id)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = client.Do(request); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Token %q successfully revoked!\n", id)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+	"net/http"
+)
+
+func (s *S) TestTokenCreateRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{
+			Message: `{"token":"secret123","valid-until":"2013-09-19T10:00:00Z"}`,
+			Status:  http.StatusCreated,
+		},
+		CondFunc: func(req *http.Request) bool {
+			var params map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&params)
+			apps, _ := params["apps"].([]interface{})
+			perms, _ := params["permissions"].([]interface{})
+			return req.Method == "POST" && req.URL.Path == "/users/tokens" &&
+				params["name"] == "ci" && params["expires"] == float64(7) &&
+				len(apps) == 2 && apps[0] == "myapp" && apps[1] == "otherapp" &&
+				len(perms) == 1 && perms[0] == "app.deploy"
+		},
+	}
+	command := tokenCreate{}
+	command.Flags().Parse(true, []string{"-e", "7", "--apps", "myapp, otherapp", "-p", "app.deploy"})
+	context := Context{Args: []string{"ci"}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, `Personal access token: "secret123".`+"\n")
+}
+
+func (s *S) TestTokenCreateFlagsDefaults(c *gocheck.C) {
+	command := tokenCreate{}
+	command.Flags().Parse(true, []string{})
+	c.Assert(command.expires, gocheck.Equals, 30)
+	c.Assert(command.apps, gocheck.Equals, "")
+	c.Assert(command.permissions, gocheck.Equals, "")
+}
+
+func (s *S) TestSplitList(c *gocheck.C) {
+	c.Assert(splitList(""), gocheck.IsNil)
+	c.Assert(splitList("a, b,,c "), gocheck.DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *S) TestTokenListRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	result := `[{"id":"5212f6c5a3a7b34ac4000001","name":"","valid-until":"2013-08-20T10:00:00Z","apps":null,"permissions":null,"current":true},
+{"id":"5212f6c5a3a7b34ac4000002","name":"ci","valid-until":"2013-09-19T10:00:00Z","apps":["myapp","otherapp"],"permissions":["app.deploy"],"current":false}]`
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/users/tokens"
+		},
+	}
+	expected := `+--------------------------+-----------+------------------+-----------------+-------------+
+| Id                       | Name      | Expires          | Apps            | Permissions |
++--------------------------+-----------+------------------+-----------------+-------------+
+| 5212f6c5a3a7b34ac4000001 | (login) * | 2013-08-20 10:00 | all             | all         |
+| 5212f6c5a3a7b34ac4000002 | ci        | 2013-09-19 10:00 | myapp, otherapp | app.deploy  |
++--------------------------+-----------+------------------+-----------------+-------------+
+`
+	context := Context{Args: []string{}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&tokenList{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestTokenRevokeRun(c *gocheck.C) {
+	var buf bytes.Buffer
+	trans := &ttesting.ConditionalTransport{
+		Transport: ttesting.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "DELETE" && req.URL.Path == "/users/tokens" &&
+				req.URL.Query().Get("id") == "5212f6c5a3a7b34ac4000002"
+		},
+	}
+	context := Context{Args: []string{"5212f6c5a3a7b34ac4000002"}, Stdout: &buf}
+	client := NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&tokenRevoke{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, `Token "5212f6c5a3a7b34ac4000002" successfully revoked!`+"\n")
+}
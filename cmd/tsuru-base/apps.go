@@ -10,8 +10,10 @@ import (
 	"github.com/globocom/tsuru/cmd"
 	"io"
 	"io/ioutil"
+	"launchpad.net/gnuflag"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type AppInfo struct {
@@ -58,9 +60,10 @@ func (c *AppInfo) Run(context *cmd.Context, client cmd.Doer) error {
 }
 
 type unit struct {
-	Name  string
-	Ip    string
-	State string
+	Name        string
+	Ip          string
+	State       string
+	ProcessName string
 }
 
 type app struct {
@@ -88,10 +91,24 @@ Teams: %s
 Address: %s
 `
 	teams := strings.Join(a.Teams, ", ")
+	var withProcess bool
+	for _, unit := range a.Units {
+		if unit.ProcessName != "" {
+			withProcess = true
+			break
+		}
+	}
 	units := cmd.NewTable()
 	units.Headers = cmd.Row([]string{"Unit", "State"})
+	if withProcess {
+		units.Headers = append(units.Headers, "Process")
+	}
 	for _, unit := range a.Units {
-		units.AddRow(cmd.Row([]string{unit.Name, unit.State}))
+		row := cmd.Row([]string{unit.Name, unit.State})
+		if withProcess {
+			row = append(row, unit.ProcessName)
+		}
+		units.AddRow(row)
 	}
 	args := []interface{}{a.Name, a.Repository, a.Framework, teams, a.Addr()}
 	if len(a.Units) > 0 {
@@ -244,6 +261,8 @@ func (c AppList) Info() *cmd.Info {
 
 type AppRestart struct {
 	GuessingCommand
+	fs        *gnuflag.FlagSet
+	batchSize int
 }
 
 func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
@@ -251,7 +270,11 @@ func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/restart", appName))
+	path := fmt.Sprintf("/apps/%s/restart", appName)
+	if c.batchSize > 0 {
+		path += fmt.Sprintf("?batch=%d", c.batchSize)
+	}
+	url, err := cmd.GetUrl(path)
 	if err != nil {
 		return err
 	}
@@ -274,14 +297,148 @@ func (c *AppRestart) Run(context *cmd.Context, client cmd.Doer) error {
 func (c *AppRestart) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "restart",
-		Usage: "restart [--app appname]",
+		Usage: "restart [--app appname] [--batch-size/-b size]",
 		Desc: `restarts an app.
 
+With --batch-size, the units of the app are restarted in batches of the given
+size, waiting for the units of a batch to start before restarting the next one.
+
 If you don't provide the app name, tsuru will try to guess it.`,
 		MinArgs: 0,
 	}
 }
 
+func (c *AppRestart) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.IntVar(&c.batchSize, "batch-size", 0, "Number of units restarted at a time")
+		c.fs.IntVar(&c.batchSize, "b", 0, "Number of units restarted at a time")
+	}
+	return c.fs
+}
+
+type deploy struct {
+	Version    int
+	RollbackTo int
+	Ref        string
+	Commit     string
+	User       string
+	Timestamp  time.Time
+	Duration   time.Duration
+	Success    bool
+	Error      string
+}
+
+type AppDeployList struct {
+	GuessingCommand
+}
+
+func (c *AppDeployList) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploy-list",
+		Usage: "app-deploy-list [--app appname]",
+		Desc: `lists the deploys of an app, from the newest to the oldest.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppDeployList) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/deploys", appName))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	defer response.Body.Close()
+	var deploys []deploy
+	err = json.NewDecoder(response.Body).Decode(&deploys)
+	if err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Version", "Ref", "Date", "Commit", "User", "Duration", "Status"})
+	for _, d := range deploys {
+		commit := d.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		status := "success"
+		if !d.Success {
+			status = "failed"
+		}
+		ref := d.Ref
+		if d.RollbackTo > 0 {
+			ref = fmt.Sprintf("%s (rollback to %d)", ref, d.RollbackTo)
+		}
+		table.AddRow(cmd.Row([]string{
+			fmt.Sprintf("%d", d.Version),
+			ref,
+			d.Timestamp.Format("2006-01-02 15:04:05"),
+			commit,
+			d.User,
+			d.Duration.String(),
+			status,
+		}))
+	}
+	context.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type AppRollback struct {
+	GuessingCommand
+}
+
+func (c *AppRollback) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <version> [--app appname]",
+		Desc: `puts an app back in the commit of a previous deploy.
+
+The version is the one displayed by app-deploy-list. The rollback is recorded
+as a new deploy of the app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *AppRollback) Run(context *cmd.Context, client cmd.Doer) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/rollback/%s", appName, context.Args[0]))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, err = io.Copy(context.Stdout, response.Body)
+	return err
+}
+
 type SetCName struct {
 	GuessingCommand
 }
@@ -58,6 +58,35 @@ Units:
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestAppInfoWithProcesses(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"Name":"app1","CName":"","Ip":"myapp.tsuru.io","Framework":"php","Repository":"git@git.com:php.git","State":"dead", "Units":[{"Ip":"10.10.10.10","Name":"app1/0","State":"started","ProcessName":"web"}, {"Ip":"9.9.9.9","Name":"app1/1","State":"started","ProcessName":"worker"}],"Teams":["tsuruteam","crane"]}`
+	expected := `Application: app1
+Repository: git@git.com:php.git
+Platform: php
+Teams: tsuruteam, crane
+Address: myapp.tsuru.io
+Units:
++--------+---------+---------+
+| Unit   | State   | Process |
++--------+---------+---------+
+| app1/0 | started | web     |
+| app1/1 | started | worker  |
++--------+---------+---------+
+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
 func (s *S) TestAppInfoNoUnits(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	result := `{"Name":"app1","Ip":"app1.tsuru.io","Framework":"php","Repository":"git@git.com:php.git","State":"dead", "Units":[],"Teams":["tsuruteam","crane"]}`
@@ -407,12 +436,57 @@ func (s *S) TestAppRestartWithoutTheFlag(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, "Restarted")
 }
 
+func (s *S) TestAppRestartInBatches(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "Restarted", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/handful_of_nothing/restart" &&
+				req.URL.Query().Get("batch") == "2" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--app", "handful_of_nothing", "-b", "2"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Restarted")
+}
+
+func (s *S) TestAppRestartFlags(c *gocheck.C) {
+	command := AppRestart{}
+	flagset := command.Flags()
+	c.Assert(flagset, gocheck.NotNil)
+	flagset.Parse(true, []string{"--batch-size", "3"})
+	batch := flagset.Lookup("batch-size")
+	c.Assert(batch.Name, gocheck.Equals, "batch-size")
+	c.Assert(batch.Usage, gocheck.Equals, "Number of units restarted at a time")
+	c.Assert(batch.Value.String(), gocheck.Equals, "3")
+	c.Assert(batch.DefValue, gocheck.Equals, "0")
+	sbatch := flagset.Lookup("b")
+	c.Assert(sbatch.Name, gocheck.Equals, "b")
+	c.Assert(sbatch.Value.String(), gocheck.Equals, "3")
+	c.Assert(command.batchSize, gocheck.Equals, 3)
+}
+
 func (s *S) TestAppRestartInfo(c *gocheck.C) {
 	expected := &cmd.Info{
 		Name:  "restart",
-		Usage: "restart [--app appname]",
+		Usage: "restart [--app appname] [--batch-size/-b size]",
 		Desc: `restarts an app.
 
+With --batch-size, the units of the app are restarted in batches of the given
+size, waiting for the units of a batch to start before restarting the next one.
+
 If you don't provide the app name, tsuru will try to guess it.`,
 		MinArgs: 0,
 	}
@@ -423,6 +497,119 @@ func (s *S) TestAppRestartIsAFlaggedCommand(c *gocheck.C) {
 	var _ cmd.FlaggedCommand = &AppRestart{}
 }
 
+func (s *S) TestAppDeployList(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	result := `[{"Version":3,"RollbackTo":1,"Ref":"master","Commit":"f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9","User":"someone@tsuru.io","Timestamp":"2013-08-20T18:00:00Z","Duration":40000000000,"Success":true},
+{"Version":2,"Ref":"release-1.2","Commit":"e83f2fa4e3f8b7c55ebee4e1b3ab3ac1fa5b6c28","User":"someone@tsuru.io","Timestamp":"2013-08-20T17:34:12Z","Duration":67300000000,"Success":false,"Error":"exit status 1"},
+{"Version":1,"Ref":"master","Commit":"f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9","User":"someone@tsuru.io","Timestamp":"2013-08-20T16:10:00Z","Duration":45000000000,"Success":true}]`
+	expected := `+---------+------------------------+---------------------+---------+------------------+----------+---------+
+| Version | Ref                    | Date                | Commit  | User             | Duration | Status  |
++---------+------------------------+---------------------+---------+------------------+----------+---------+
+| 3       | master (rollback to 1) | 2013-08-20 18:00:00 | f2a5d5f | someone@tsuru.io | 40s      | success |
+| 2       | release-1.2            | 2013-08-20 17:34:12 | e83f2fa | someone@tsuru.io | 1m7.3s   | failed  |
+| 1       | master                 | 2013-08-20 16:10:00 | f2a5d5f | someone@tsuru.io | 45s      | success |
++---------+------------------------+---------------------+---------+------------------+----------+---------+
+`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/handful_of_nothing/deploys" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployList{}
+	command.Flags().Parse(true, []string{"--app", "handful_of_nothing"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestAppDeployListWithoutDeploys(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: "", Status: http.StatusNoContent}}, nil, manager)
+	fake := &FakeGuesser{name: "motorbreath"}
+	command := AppDeployList{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "")
+}
+
+func (s *S) TestAppDeployListInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-deploy-list",
+		Usage: "app-deploy-list [--app appname]",
+		Desc: `lists the deploys of an app, from the newest to the oldest.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 0,
+	}
+	c.Assert((&AppDeployList{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppDeployListIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppDeployList{}
+}
+
+func (s *S) TestAppRollback(c *gocheck.C) {
+	var (
+		called         bool
+		stdout, stderr bytes.Buffer
+	)
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"3"},
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "Rollback done!", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/motorbreath/rollback/3" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	fake := &FakeGuesser{name: "motorbreath"}
+	command := AppRollback{GuessingCommand: GuessingCommand{G: fake}}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Rollback done!")
+}
+
+func (s *S) TestAppRollbackInfo(c *gocheck.C) {
+	expected := &cmd.Info{
+		Name:  "app-rollback",
+		Usage: "app-rollback <version> [--app appname]",
+		Desc: `puts an app back in the commit of a previous deploy.
+
+The version is the one displayed by app-deploy-list. The rollback is recorded
+as a new deploy of the app.
+
+If you don't provide the app name, tsuru will try to guess it.`,
+		MinArgs: 1,
+	}
+	c.Assert((&AppRollback{}).Info(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAppRollbackIsAFlaggedCommand(c *gocheck.C) {
+	var _ cmd.FlaggedCommand = &AppRollback{}
+}
+
 func (s *S) TestSetCName(c *gocheck.C) {
 	var (
 		called         bool
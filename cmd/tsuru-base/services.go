@@ -12,7 +12,9 @@ import (
 	"github.com/globocom/tsuru/cmd"
 	"io"
 	"io/ioutil"
+	"launchpad.net/gnuflag"
 	"net/http"
+	"net/url"
 	"sort"
 	"strings"
 )
@@ -56,15 +58,80 @@ func (s ServiceList) Run(ctx *cmd.Context, client cmd.Doer) error {
 	return nil
 }
 
-type ServiceAdd struct{}
+type ServiceCatalog struct{}
 
-func (sa ServiceAdd) Info() *cmd.Info {
-	usage := `service-add <servicename> <serviceinstancename>
+func (c ServiceCatalog) Info() *cmd.Info {
+	usage := `service-catalog [query]
 e.g.:
 
-    $ tsuru service-add mongodb tsuru_mongodb
+    $ tsuru service-catalog mysql database
 
-Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
+Will list the services that match all the words of the query in their names,
+descriptions, tags or maintainers. Without a query, lists all the services
+available to you.`
+	return &cmd.Info{
+		Name:  "service-catalog",
+		Usage: usage,
+		Desc:  "browses the catalog of available services.",
+	}
+}
+
+type catalogEntry struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	DocUrl      string   `json:"doc_url"`
+	Maintainer  string   `json:"maintainer"`
+}
+
+func (c ServiceCatalog) Run(ctx *cmd.Context, client cmd.Doer) error {
+	u, err := cmd.GetUrl("/services/catalog?q=" + url.QueryEscape(strings.Join(ctx.Args, " ")))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var entries []catalogEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No services found.")
+		return nil
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Service", "Description", "Tags", "Maintainer", "Documentation"})
+	for _, e := range entries {
+		table.AddRow(cmd.Row([]string{e.Name, e.Description, strings.Join(e.Tags, ", "), e.Maintainer, e.DocUrl}))
+	}
+	ctx.Stdout.Write(table.Bytes())
+	return nil
+}
+
+type ServiceAdd struct {
+	fs   *gnuflag.FlagSet
+	team string
+}
+
+func (sa *ServiceAdd) Info() *cmd.Info {
+	usage := `service-add <servicename> <serviceinstancename> [plan] [--team teamname]
+e.g.:
+
+    $ tsuru service-add mongodb tsuru_mongodb small
+
+Will add a new instance of the "mongodb" service, named "tsuru_mongodb", using
+the plan "small". The plans of a service are listed by service-info.
+
+The --team flag sets the team that owns the instance. Its members are able to
+grant and revoke the access of other teams to the instance. If you don't
+provide it, tsuru chooses one of your teams.`
 	return &cmd.Info{
 		Name:    "service-add",
 		Usage:   usage,
@@ -73,10 +140,28 @@ Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
 	}
 }
 
-func (sa ServiceAdd) Run(ctx *cmd.Context, client cmd.Doer) error {
-	srvName, instName := ctx.Args[0], ctx.Args[1]
-	fmtBody := fmt.Sprintf(`{"name": "%s", "service_name": "%s"}`, instName, srvName)
-	b := bytes.NewBufferString(fmtBody)
+func (sa *ServiceAdd) Flags() *gnuflag.FlagSet {
+	if sa.fs == nil {
+		sa.fs = gnuflag.NewFlagSet("service-add", gnuflag.ExitOnError)
+		sa.fs.StringVar(&sa.team, "team", "", "Team that owns the service instance")
+		sa.fs.StringVar(&sa.team, "t", "", "Team that owns the service instance")
+	}
+	return sa.fs
+}
+
+func (sa *ServiceAdd) Run(ctx *cmd.Context, client cmd.Doer) error {
+	params := map[string]string{"name": ctx.Args[1], "service_name": ctx.Args[0]}
+	if len(ctx.Args) > 2 {
+		params["plan"] = ctx.Args[2]
+	}
+	if sa.team != "" {
+		params["owner"] = sa.team
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	b := bytes.NewBuffer(body)
 	url, err := cmd.GetUrl("/services/instances")
 	if err != nil {
 		return err
@@ -86,14 +171,146 @@ func (sa ServiceAdd) Run(ctx *cmd.Context, client cmd.Doer) error {
 		return err
 	}
 	request.Header.Set("Content-Type", "application/json")
-	_, err = client.Do(request)
+	resp, err := client.Do(request)
 	if err != nil {
 		return err
 	}
+	if resp.StatusCode == http.StatusAccepted {
+		fmt.Fprint(ctx.Stdout, "Service is being added. Use service-list to check whether it is ready.\n")
+		return nil
+	}
 	fmt.Fprint(ctx.Stdout, "Service successfully added.\n")
 	return nil
 }
 
+type ServiceInstanceGrant struct{}
+
+func (c ServiceInstanceGrant) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "service-instance-grant",
+		Usage: "service-instance-grant <serviceinstancename> <teamname>",
+		Desc: `grants access to a service instance to a team.
+
+Members of the team will be able to bind the instance to the apps of the team.
+Only members of the team that owns the instance can grant access to it.`,
+		MinArgs: 2,
+	}
+}
+
+func (c ServiceInstanceGrant) Run(ctx *cmd.Context, client cmd.Doer) error {
+	instanceName, teamName := ctx.Args[0], ctx.Args[1]
+	url, err := cmd.GetUrl("/services/instances/" + instanceName + "/teams/" + teamName)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Granted access to the service instance %q to the team %q.\n", instanceName, teamName)
+	return nil
+}
+
+type ServiceInstanceRevoke struct{}
+
+func (c ServiceInstanceRevoke) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "service-instance-revoke",
+		Usage: "service-instance-revoke <serviceinstancename> <teamname>",
+		Desc: `revokes access to a service instance from a team.
+
+Only members of the team that owns the instance can revoke access to it, and
+the access of the owner team cannot be revoked.`,
+		MinArgs: 2,
+	}
+}
+
+func (c ServiceInstanceRevoke) Run(ctx *cmd.Context, client cmd.Doer) error {
+	instanceName, teamName := ctx.Args[0], ctx.Args[1]
+	url, err := cmd.GetUrl("/services/instances/" + instanceName + "/teams/" + teamName)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "Revoked access to the service instance %q from the team %q.\n", instanceName, teamName)
+	return nil
+}
+
+type ServiceInstanceProxy struct {
+	fs     *gnuflag.FlagSet
+	method string
+	body   string
+}
+
+func (c *ServiceInstanceProxy) Info() *cmd.Info {
+	usage := `service-instance-proxy <serviceinstancename> <path> [--method method] [--body body]
+e.g.:
+
+    $ tsuru service-instance-proxy tsuru_mysql /backup --method POST
+
+Will send a POST request to the path "/backup" of the api of the service of the
+instance "tsuru_mysql". The default method is GET. The --body flag sets the
+body of the request.`
+	return &cmd.Info{
+		Name:    "service-instance-proxy",
+		Usage:   usage,
+		Desc:    "sends a request to the api of the service of a service instance.",
+		MinArgs: 2,
+	}
+}
+
+func (c *ServiceInstanceProxy) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("service-instance-proxy", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.method, "method", "GET", "HTTP method of the request")
+		c.fs.StringVar(&c.method, "m", "GET", "HTTP method of the request")
+		c.fs.StringVar(&c.body, "body", "", "Body of the request")
+		c.fs.StringVar(&c.body, "b", "", "Body of the request")
+	}
+	return c.fs
+}
+
+func (c *ServiceInstanceProxy) Run(ctx *cmd.Context, client cmd.Doer) error {
+	instanceName, path := ctx.Args[0], ctx.Args[1]
+	u, err := cmd.GetUrl("/services/proxy/" + instanceName + "?callback=" + url.QueryEscape(path))
+	if err != nil {
+		return err
+	}
+	method := strings.ToUpper(c.method)
+	if method == "" {
+		method = "GET"
+	}
+	var body io.Reader
+	if c.body != "" {
+		body = strings.NewReader(c.body)
+	}
+	request, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ctx.Stdout, resp.Body)
+	return err
+}
+
 type ServiceBind struct {
 	GuessingCommand
 }
@@ -310,6 +527,10 @@ func (c ServiceInfo) Run(ctx *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
+	plans, err := c.plans(serviceName, client)
+	if err != nil {
+		return err
+	}
 	ctx.Stdout.Write([]byte(fmt.Sprintf("Info for \"%s\"\n", serviceName)))
 	if len(instances) > 0 {
 		table := cmd.NewTable()
@@ -327,9 +548,46 @@ func (c ServiceInfo) Run(ctx *cmd.Context, client cmd.Doer) error {
 		table.Headers = cmd.Row(headers)
 		ctx.Stdout.Write(table.Bytes())
 	}
+	if len(plans) > 0 {
+		table := cmd.NewTable()
+		table.Headers = cmd.Row([]string{"Plan", "Description"})
+		for _, p := range plans {
+			table.AddRow(cmd.Row([]string{p.Name, p.Description}))
+		}
+		ctx.Stdout.Write([]byte("\nPlans\n"))
+		ctx.Stdout.Write(table.Bytes())
+	}
 	return nil
 }
 
+type plan struct {
+	Name        string
+	Description string
+}
+
+// plans returns the plans offered by the given service.
+func (ServiceInfo) plans(serviceName string, client cmd.Doer) ([]plan, error) {
+	url, err := cmd.GetUrl("/services/" + serviceName + "/plans")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var plans []plan
+	err = json.NewDecoder(resp.Body).Decode(&plans)
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
 type ServiceDoc struct{}
 
 func (c ServiceDoc) Info() *cmd.Info {
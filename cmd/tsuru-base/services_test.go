@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"github.com/globocom/tsuru/cmd"
 	"github.com/globocom/tsuru/testing"
+	"io/ioutil"
 	"launchpad.net/gocheck"
 	"net/http"
 	"strings"
@@ -265,12 +266,17 @@ func (s *S) TestServiceUnbindIsAFlaggedComand(c *gocheck.C) {
 }
 
 func (s *S) TestServiceAddInfo(c *gocheck.C) {
-	usage := `service-add <servicename> <serviceinstancename>
+	usage := `service-add <servicename> <serviceinstancename> [plan] [--team teamname]
 e.g.:
 
-    $ tsuru service-add mongodb tsuru_mongodb
+    $ tsuru service-add mongodb tsuru_mongodb small
 
-Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
+Will add a new instance of the "mongodb" service, named "tsuru_mongodb", using
+the plan "small". The plans of a service are listed by service-info.
+
+The --team flag sets the team that owns the instance. Its members are able to
+grant and revoke the access of other teams to the instance. If you don't
+provide it, tsuru chooses one of your teams.`
 	expected := &cmd.Info{
 		Name:    "service-add",
 		Usage:   usage,
@@ -281,6 +287,232 @@ Will add a new instance of the "mongodb" service, named "tsuru_mongodb".`
 	c.Assert(command.Info(), gocheck.DeepEquals, expected)
 }
 
+func (s *S) TestServiceAddRunWithPlan(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var params map[string]string
+	context := cmd.Context{
+		Args:   []string{"mysql", "my_app_db", "small"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, gocheck.IsNil)
+			return req.URL.Path == "/services/instances" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&ServiceAdd{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"name": "my_app_db", "service_name": "mysql", "plan": "small"}
+	c.Assert(params, gocheck.DeepEquals, expected)
+	c.Assert(stdout.String(), gocheck.Equals, "Service successfully added.\n")
+}
+
+func (s *S) TestServiceAddRunWithTeam(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var params map[string]string
+	context := cmd.Context{
+		Args:   []string{"mysql", "my_app_db"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			err := json.NewDecoder(req.Body).Decode(&params)
+			c.Assert(err, gocheck.IsNil)
+			return req.URL.Path == "/services/instances" && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := ServiceAdd{}
+	command.Flags().Parse(true, []string{"--team", "admin"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]string{"name": "my_app_db", "service_name": "mysql", "owner": "admin"}
+	c.Assert(params, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestServiceAddFlags(c *gocheck.C) {
+	command := ServiceAdd{}
+	flagset := command.Flags()
+	flagset.Parse(true, []string{"-t", "admin"})
+	c.Assert(command.team, gocheck.Equals, "admin")
+	team := flagset.Lookup("team")
+	c.Assert(team, gocheck.NotNil)
+	c.Assert(team.Usage, gocheck.Equals, "Team that owns the service instance")
+}
+
+func (s *S) TestServiceInstanceGrantInfo(c *gocheck.C) {
+	info := ServiceInstanceGrant{}.Info()
+	c.Assert(info.Name, gocheck.Equals, "service-instance-grant")
+	c.Assert(info.MinArgs, gocheck.Equals, 2)
+}
+
+func (s *S) TestServiceInstanceGrantRun(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"my_mongodb", "admin"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/services/instances/my_mongodb/teams/admin" && req.Method == "PUT"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := ServiceInstanceGrant{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, `Granted access to the service instance "my_mongodb" to the team "admin".`+"\n")
+}
+
+func (s *S) TestServiceInstanceRevokeInfo(c *gocheck.C) {
+	info := ServiceInstanceRevoke{}.Info()
+	c.Assert(info.Name, gocheck.Equals, "service-instance-revoke")
+	c.Assert(info.MinArgs, gocheck.Equals, 2)
+}
+
+func (s *S) TestServiceInstanceRevokeRun(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"my_mongodb", "admin"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/services/instances/my_mongodb/teams/admin" && req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := ServiceInstanceRevoke{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, `Revoked access to the service instance "my_mongodb" from the team "admin".`+"\n")
+}
+
+func (s *S) TestServiceInstanceProxyInfo(c *gocheck.C) {
+	info := (&ServiceInstanceProxy{}).Info()
+	c.Assert(info.Name, gocheck.Equals, "service-instance-proxy")
+	c.Assert(info.MinArgs, gocheck.Equals, 2)
+}
+
+func (s *S) TestServiceInstanceProxyRun(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var body string
+	context := cmd.Context{
+		Args:   []string{"my_mysql", "/backup"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "backup scheduled", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			b, _ := ioutil.ReadAll(req.Body)
+			body = string(b)
+			return req.URL.Path == "/services/proxy/my_mysql" && req.Method == "POST" &&
+				req.URL.Query().Get("callback") == "/backup"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := ServiceInstanceProxy{}
+	command.Flags().Parse(true, []string{"--method", "post", "--body", "when=now"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "backup scheduled")
+	c.Assert(body, gocheck.Equals, "when=now")
+}
+
+func (s *S) TestServiceInstanceProxyRunDefaultsToGET(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"my_mysql", "/slow-queries"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "slow queries: 0", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/services/proxy/my_mysql" && req.Method == "GET"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&ServiceInstanceProxy{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "slow queries: 0")
+}
+
+func (s *S) TestServiceInstanceProxyFlags(c *gocheck.C) {
+	command := ServiceInstanceProxy{}
+	flagset := command.Flags()
+	flagset.Parse(true, []string{"-m", "DELETE", "-b", "name=x"})
+	c.Assert(command.method, gocheck.Equals, "DELETE")
+	c.Assert(command.body, gocheck.Equals, "name=x")
+}
+
+func (s *S) TestServiceCatalogInfo(c *gocheck.C) {
+	info := ServiceCatalog{}.Info()
+	c.Assert(info.Name, gocheck.Equals, "service-catalog")
+	c.Assert(info.MinArgs, gocheck.Equals, 0)
+}
+
+func (s *S) TestServiceCatalogRun(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"name":"mysql","description":"MySQL databases","tags":["database","sql"],"doc_url":"http://mysql.tsuru.io","maintainer":"dba"}]`
+	context := cmd.Context{
+		Args:   []string{"sql", "database"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/services/catalog" && req.URL.Query().Get("q") == "sql database"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := ServiceCatalog{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	expected := `+---------+-----------------+---------------+------------+-----------------------+
+| Service | Description     | Tags          | Maintainer | Documentation         |
++---------+-----------------+---------------+------------+-----------------------+
+| mysql   | MySQL databases | database, sql | dba        | http://mysql.tsuru.io |
++---------+-----------------+---------------+------------+-----------------------+
+`
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestServiceCatalogRunWithoutServices(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: "[]", Status: http.StatusOK}}, nil, manager)
+	err := ServiceCatalog{}.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "No services found.\n")
+}
+
+func (s *S) TestServiceAddRunAccepted(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"mysql", "my_app_db"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: "success", Status: http.StatusAccepted}}, nil, manager)
+	err := (&ServiceAdd{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "Service is being added. Use service-list to check whether it is ready.\n")
+}
+
 func (s *S) TestServiceAddRun(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	result := "Service successfully added.\n"
@@ -374,13 +606,75 @@ func (s *S) TestServiceInfoRun(c *gocheck.C) {
 		Stdout: &stdout,
 		Stderr: &stderr,
 	}
-	client := cmd.NewClient(&http.Client{Transport: &testing.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	trans := &testing.MultiConditionalTransport{
+		ConditionalTransports: []testing.ConditionalTransport{
+			{
+				Transport: testing.Transport{Message: result, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/services/mongodb"
+				},
+			},
+			{
+				Transport: testing.Transport{Message: "[]", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/services/mongodb/plans"
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	err := (&ServiceInfo{}).Run(&context, client)
 	c.Assert(err, gocheck.IsNil)
 	obtained := stdout.String()
 	c.Assert(obtained, gocheck.Equals, expected)
 }
 
+func (s *S) TestServiceInfoRunWithPlans(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"Name":"mymongo", "Apps":["myapp"]}]`
+	plans := `[{"name":"small","description":"1 GB"},{"name":"large","description":"8 GB"}]`
+	expected := `Info for "mongodb"
++-----------+-------+
+| Instances | Apps  |
++-----------+-------+
+| mymongo   | myapp |
++-----------+-------+
+
+Plans
++-------+-------------+
+| Plan  | Description |
++-------+-------------+
+| small | 1 GB        |
+| large | 8 GB        |
++-------+-------------+
+`
+	context := cmd.Context{
+		Args:   []string{"mongodb"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.MultiConditionalTransport{
+		ConditionalTransports: []testing.ConditionalTransport{
+			{
+				Transport: testing.Transport{Message: result, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/services/mongodb"
+				},
+			},
+			{
+				Transport: testing.Transport{Message: plans, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/services/mongodb/plans"
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	err := (&ServiceInfo{}).Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, expected)
+}
+
 func (s *S) TestServiceDocInfo(c *gocheck.C) {
 	i := (&ServiceDoc{}).Info()
 	expected := &cmd.Info{
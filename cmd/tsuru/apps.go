@@ -141,9 +141,12 @@ type UnitAdd struct {
 
 func (c *UnitAdd) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
-		Desc:    "add new units to an app.",
+		Name:  "unit-add",
+		Usage: "unit-add <# of units> [process] [--app appname]",
+		Desc: `add new units to an app.
+
+If you provide a process, the new units will run only the given process type,
+as declared in the Procfile of the app.`,
 		MinArgs: 1,
 	}
 }
@@ -153,7 +156,7 @@ func (c *UnitAdd) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/units", appName))
+	url, err := cmd.GetUrl(unitsPath(appName, context.Args))
 	if err != nil {
 		return err
 	}
@@ -175,9 +178,12 @@ type UnitRemove struct {
 
 func (c *UnitRemove) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "unit-remove",
-		Usage:   "unit-remove <# of units> [--app appname]",
-		Desc:    "remove units from an app.",
+		Name:  "unit-remove",
+		Usage: "unit-remove <# of units> [process] [--app appname]",
+		Desc: `remove units from an app.
+
+If you provide a process, only units running the given process type will be
+removed.`,
 		MinArgs: 1,
 	}
 }
@@ -187,7 +193,7 @@ func (c *UnitRemove) Run(context *cmd.Context, client cmd.Doer) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetUrl(fmt.Sprintf("/apps/%s/units", appName))
+	url, err := cmd.GetUrl(unitsPath(appName, context.Args))
 	if err != nil {
 		return err
 	}
@@ -203,3 +209,13 @@ func (c *UnitRemove) Run(context *cmd.Context, client cmd.Doer) error {
 	fmt.Fprintln(context.Stdout, "Units successfully removed!")
 	return nil
 }
+
+// unitsPath returns the path of the units of the app, filtered by the process
+// type given in the second argument, if any.
+func unitsPath(appName string, args []string) string {
+	path := fmt.Sprintf("/apps/%s/units", appName)
+	if len(args) > 1 {
+		path += "?process=" + args[1]
+	}
+	return path
+}
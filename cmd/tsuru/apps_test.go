@@ -289,6 +289,34 @@ func (s *S) TestUnitAdd(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestUnitAddWithProcess(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"2", "worker"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			b, err := ioutil.ReadAll(req.Body)
+			c.Assert(err, gocheck.IsNil)
+			c.Assert(string(b), gocheck.Equals, "2")
+			return req.URL.Path == "/apps/radio/units" && req.URL.Query().Get("process") == "worker" &&
+				req.Method == "PUT"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitAdd{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Units successfully added!\n")
+}
+
 func (s *S) TestUnitAddFailure(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -306,9 +334,12 @@ func (s *S) TestUnitAddFailure(c *gocheck.C) {
 
 func (s *S) TestUnitAddInfo(c *gocheck.C) {
 	expected := &cmd.Info{
-		Name:    "unit-add",
-		Usage:   "unit-add <# of units> [--app appname]",
-		Desc:    "add new units to an app.",
+		Name:  "unit-add",
+		Usage: "unit-add <# of units> [process] [--app appname]",
+		Desc: `add new units to an app.
+
+If you provide a process, the new units will run only the given process type,
+as declared in the Procfile of the app.`,
 		MinArgs: 1,
 	}
 	c.Assert((&UnitAdd{}).Info(), gocheck.DeepEquals, expected)
@@ -346,6 +377,31 @@ func (s *S) TestUnitRemove(c *gocheck.C) {
 	c.Assert(stdout.String(), gocheck.Equals, expected)
 }
 
+func (s *S) TestUnitRemoveWithProcess(c *gocheck.C) {
+	var stdout, stderr bytes.Buffer
+	var called bool
+	context := cmd.Context{
+		Args:   []string{"1", "worker"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &testing.ConditionalTransport{
+		Transport: testing.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.URL.Path == "/apps/vapor/units" && req.URL.Query().Get("process") == "worker" &&
+				req.Method == "DELETE"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitRemove{}
+	command.Flags().Parse(true, []string{"-a", "vapor"})
+	err := command.Run(&context, client)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(called, gocheck.Equals, true)
+	c.Assert(stdout.String(), gocheck.Equals, "Units successfully removed!\n")
+}
+
 func (s *S) TestUnitRemoveFailure(c *gocheck.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -365,9 +421,12 @@ func (s *S) TestUnitRemoveFailure(c *gocheck.C) {
 
 func (s *S) TestUnitRemoveInfo(c *gocheck.C) {
 	expected := cmd.Info{
-		Name:    "unit-remove",
-		Usage:   "unit-remove <# of units> [--app appname]",
-		Desc:    "remove units from an app.",
+		Name:  "unit-remove",
+		Usage: "unit-remove <# of units> [process] [--app appname]",
+		Desc: `remove units from an app.
+
+If you provide a process, only units running the given process type will be
+removed.`,
 		MinArgs: 1,
 	}
 	c.Assert((&UnitRemove{}).Info(), gocheck.DeepEquals, &expected)
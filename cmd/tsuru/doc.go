@@ -25,6 +25,10 @@ The currently available commands are (grouped by subject):
 	login             authenticates the user with tsuru server
 	logout            finishes the session with tsuru server
 	change-password   changes your password
+	reset-password    resets your password, in case you forgot it
+	token-create      creates a personal access token
+	token-list        lists your tokens
+	token-revoke      revokes one of your tokens
 	key-add           adds a public key to tsuru deploy server
 	key-remove        removes a public key from tsuru deploy server
 
@@ -33,6 +37,11 @@ The currently available commands are (grouped by subject):
 	team-list         list teams that the user is member
 	team-user-add     adds a user to a team
 	team-user-remove  removes a user from a team
+	team-user-role    sets the role of a user in a team
+	role-list         lists the available roles and their permissions
+	role-create       creates a new role (admins only)
+	role-remove       removes a role (admins only)
+	event-list        lists the operations performed in tsuru
 
 	app-create        creates an app
 	app-remove        removes an app
@@ -45,6 +54,8 @@ The currently available commands are (grouped by subject):
 	log               shows log for an app
 	run               runs a command in all units of an app
 	restart           restarts the app's application server
+	app-deploy-list   lists the deploys of an app
+	app-rollback      puts an app back in the code of a previous deploy
 	set-cname         defines a cname for an app
 	unset-cname       unsets the cname from an app
 
@@ -56,11 +67,15 @@ The currently available commands are (grouped by subject):
 	unbind            unbinds an app from a service instance
 
 	service-list      list all services, and instances of each service
+	service-catalog   browses the catalog of available services
 	service-add       creates a new instance of a service
 	service-remove    removes a instance of a service
 	service-status    checks the status of a service instance
 	service-info      list instances of a service, and apps bound to each instance
 	service-doc       displays documentation for a service
+	service-instance-grant   allows a team to use a service instance
+	service-instance-revoke  revokes the access of a team to a service instance
+	service-instance-proxy   sends a request to the api of the service of an instance
 
 Use "tsuru help <command>" for more information about a command.
 
@@ -136,12 +151,17 @@ Authenticate within remote tsuru server
 
 Usage:
 
-	% tsuru login <email>
+	% tsuru login [email]
 
 Login will ask for the password and check if the user is successfully
 authenticated. If so, the token generated by the tsuru server will be stored in
 ${HOME}/.tsuru_token.
 
+Servers that authenticate users with an OAuth2 provider don't use passwords:
+omit the email, and login will open the authorization page of the provider in
+the browser. After the authorization, the provider redirects the browser back to
+login, which listens for it locally.
+
 All tsuru actions require the user to be authenticated (except login and
 user-create, obviously).
 
@@ -166,6 +186,57 @@ change-password will change the password of the logged in user. It will ask for
 the current password, the new and the confirmation.
 
 
+Reset user's password
+
+Usage:
+
+	% tsuru reset-password <email> [--token|-t <token>]
+
+reset-password resets the password of a user who forgot it, in two steps. When
+called without the token, tsuru sends an email with a reset token to the user.
+Then, call reset-password again, with the token, to choose the new password.
+The token expires in 24 hours and can be used only once. Resetting the password
+logs out all your sessions and revokes your personal access tokens, so you need
+to log in again.
+
+
+Create a personal access token
+
+Usage:
+
+	% tsuru token-create <name> [--expires days] [--apps app1,app2] [--permissions perm1,perm2]
+
+token-create creates a personal access token, to be used by scripts and CI
+pipelines instead of the token created when you log in. The token expires in
+30 days by default, and may last up to 365 days. Use the --apps flag to limit
+the token to some apps, and the --permissions flag to limit it to some
+permissions (see role-list). Personal access tokens can't be used to create
+other tokens, nor to change your password or remove your user.
+
+The token is displayed only once, so save it somewhere safe.
+
+
+List your tokens
+
+Usage:
+
+	% tsuru token-list
+
+token-list lists your valid tokens, including the ones created by logging in.
+The token you're currently using is marked with an asterisk. The value of the
+tokens is never displayed.
+
+
+Revoke a token
+
+Usage:
+
+	% tsuru token-revoke <id>
+
+token-revoke revokes one of your tokens, using the id displayed by token-list.
+Requests authenticated by the token fail right away.
+
+
 Add SSH public key to tsuru's git server
 
 Usage:
@@ -236,8 +307,8 @@ Usage:
 
 	% tsuru team-user-add <team-name> <user@email>
 
-team-user-add adds a user to a team. You need to be a member of the team to be
-able to add another user to it.
+team-user-add adds a user to a team. You need the team.manage permission in
+the team to be able to add another user to it.
 
 
 Remove a user from a team
@@ -253,6 +324,75 @@ A team can never have 0 users. If you are the last member of a team, you can't
 remove yourself from it.
 
 
+Set the role of a user in a team
+
+Usage:
+
+	% tsuru team-user-role <team-name> <user@email> <role>
+
+team-user-role assigns a role to a member of a team. The role defines what the
+user can do with the apps, services and service instances of the team. You
+need the team.manage permission in the team to be able to assign roles. A
+team must always have a member with the team.manage permission, so its last
+manager can't be assigned to a role without it.
+
+The creator of a team is always its owner. Users added to a team are assigned
+to the role of new members of the server, usually "developer".
+
+
+List roles
+
+Usage:
+
+	% tsuru role-list
+
+role-list lists the available roles, along with their permissions. Tsuru comes
+with three roles: "owner", that has all permissions; "developer", that can do
+anything but removing apps and services, managing the access of other teams
+and managing the team; and "viewer", that can only read information.
+
+
+Create a role
+
+Usage:
+
+	% tsuru role-create <name> <permission> [permission...]
+
+role-create creates a new role with the given permissions, like app.deploy,
+app.env.set, app.delete, service.create or team.manage. Only admins can create
+roles.
+
+
+Remove a role
+
+Usage:
+
+	% tsuru role-remove <name>
+
+role-remove removes a role. Only admins can remove roles, and roles assigned to
+members of any team can't be removed.
+
+
+List the operations performed in tsuru
+
+Usage:
+
+	% tsuru event-list [--target name] [--actor email] [--limit n]
+
+event-list lists the operations performed through the tsuru API (creating
+apps, setting environment variables, adding users to teams and so on), from
+the newest to the oldest. Each operation is displayed with its date, the user
+that performed it, its target, its parameters and its result. Secret
+parameters, like passwords, are never displayed.
+
+The --target flag filters the operations by their target, like an app or a
+team, and the --actor flag filters them by the user that performed them. Users
+can list the operations performed by anyone on the apps they have access to,
+and only their own operations on other targets; admins can list every
+operation. At most 100 operations are listed, unless another limit, up to
+1000, is given with the --limit flag.
+
+
 Create an app
 
 Usage:
@@ -338,11 +478,15 @@ Add new units to the app
 
 Usage:
 
-	% tsuru unit-add <# of units> [--app appname]
+	% tsuru unit-add <# of units> [process] [--app appname]
 
 unit-add will add new units (instances) to an app. You need to have access to
 the app to be able to add new units to it.
 
+If the process argument is provided, the new units will run only the given
+process type, that must be declared in the Procfile of the app. Otherwise, the
+new units run all processes.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -350,11 +494,14 @@ Remove units from the app
 
 Usage:
 
-	% tsuru unit-remove <# of units> [--app appname]
+	% tsuru unit-remove <# of units> [process] [--app appname]
 
 unit-remove will remove units (instances) from an app. You need to have access
 to the app to be able to remove units from it.
 
+If the process argument is provided, only units running the given process type
+will be removed.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -431,11 +578,45 @@ Restart the app's application server
 
 Usage:
 
-	% tsuru restart [--app appname]
+	% tsuru restart [--app appname] [--batch-size/-b size]
 
 Restart will restart the application server (as defined in Procfile) of the
 application.
 
+The --batch-size flag enables rolling restarts: the units of the app are
+restarted in batches of the given size, and tsuru waits for the units of a
+batch to start before restarting the next batch, so the app does not go down
+during the restart.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+List the deploys of an app
+
+Usage:
+
+	% tsuru app-deploy-list [--app appname]
+
+app-deploy-list lists all deploys of the app, from the newest to the oldest.
+Each deploy is identified by a version, and the list includes the git ref and
+the commit that were deployed, the user that pushed it, when the deploy happened, how long it
+took and whether it succeeded.
+
+The --app flag is optional, see "Guessing app names" section for more details.
+
+
+Rollback an app to a previous deploy
+
+Usage:
+
+	% tsuru app-rollback <version> [--app appname]
+
+app-rollback puts the code of the app back in the commit of the given deploy
+version (see app-deploy-list), installs its dependencies and restarts it. The
+rollback itself is recorded as a new deploy of the app, with the ref and the
+commit of the restored deploy, and app-deploy-list marks it as a rollback to
+the restored version.
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -524,6 +705,9 @@ When binding an application to a service instance, tsuru will add new
 environment variables to the app. All environment variables exported by bind
 will be private (not accessible via env-get).
 
+The app must belong to a team that has access to the service instance (see
+"service-instance-grant").
+
 The --app flag is optional, see "Guessing app names" section for more details.
 
 
@@ -548,18 +732,47 @@ Usage:
 
 service-list will retrieve and display a list of services that the user has
 access to. If the user has any instance of services, it will be displayed by
-this command too.
+this command too. Instances that are not ready yet are followed by their state:
+"pending" while the service creates them, or "failed" if the service failed to
+create them.
+
+
+Browse the catalog of services
+
+Usage:
+
+	% tsuru service-catalog [query]
+
+service-catalog will display the services available to the user, with their
+descriptions, tags, maintainer teams and links to their documentation. When a
+query is given, only the services that match all its words (in their names,
+descriptions, tags or maintainers) are displayed.
+
+Example of use:
+
+	% tsuru service-catalog database
+	+---------+-----------------+----------+------------+-----------------------+
+	| Service | Description     | Tags     | Maintainer | Documentation         |
+	+---------+-----------------+----------+------------+-----------------------+
+	| mysql   | MySQL databases | database | dba        | http://mysql.tsuru.io |
+	+---------+-----------------+----------+------------+-----------------------+
 
 
 Create a new service instance
 
 Usage:
 
-	% tsuru service-add <service-name> <instance-name>
+	% tsuru service-add <service-name> <instance-name> [plan] [--team teamname]
 
 service-add will create a new service instance. After listing services with
 "service-list", you may want to create a new service instance.
 
+Services may offer plans (like "small" or "large"), listed by "service-info".
+The plan argument chooses the plan of the new instance.
+
+The --team flag chooses the team that owns the instance. If you don't provide
+it, tsuru chooses one of your teams.
+
 Example of use:
 
 	% tsuru service-list
@@ -577,6 +790,19 @@ Example of use:
 	| mysql    | newmysql  |
 	+----------+-----------+
 
+Some services create instances asynchronously. In this case, the instance is
+pending until the service finishes creating it, and apps can be bound to it
+only after it's ready:
+
+	% tsuru service-add mysql bigmysql
+	Service is being added. Use service-list to check whether it is ready.
+	% tsuru service-list
+	+----------+------------------------------+
+	| Services | Instances                    |
+	+----------+------------------------------+
+	| mysql    | newmysql, bigmysql (pending) |
+	+----------+------------------------------+
+
 
 Remove a service instance
 
@@ -589,6 +815,42 @@ instance that is bound to an app, so before remove a service instance, make
 sure there is no apps bound to it (see "service-info" command).
 
 
+Grant access to a service instance
+
+Usage:
+
+	% tsuru service-instance-grant <instance-name> <team-name>
+
+service-instance-grant will allow a team to use a service instance, binding it
+to the apps of the team. This allows different teams to share the same
+instance. Only members of the team that owns the instance can grant access to
+it.
+
+
+Revoke access to a service instance
+
+Usage:
+
+	% tsuru service-instance-revoke <instance-name> <team-name>
+
+service-instance-revoke will revoke the access of a team to a service
+instance. Only members of the team that owns the instance can revoke access to
+it, and the access of the owner team cannot be revoked.
+
+
+Send a request to the api of a service
+
+Usage:
+
+	% tsuru service-instance-proxy <instance-name> <path> [--method method] [--body body]
+
+service-instance-proxy will send a request to the api of the service of the
+instance, in the given path. Services use it to expose custom operations, like
+backups or password resets, to the teams that have access to the instance. The
+request is authenticated by tsuru, and the response of the service is
+displayed as is. The default method of the request is GET.
+
+
 Display information about a service
 
 Usage:
@@ -596,7 +858,8 @@ Usage:
 	% tsuru service-info <service-name>
 
 service-info will display a list of all instances of a given service (that the
-user has access to), and apps bound to these instances.
+user has access to), apps bound to these instances and the plans offered by the
+service.
 
 Example of use:
 
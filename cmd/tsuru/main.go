@@ -28,6 +28,8 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&tsuru.AppGrant{})
 	m.Register(&tsuru.AppRevoke{})
 	m.Register(&tsuru.AppRestart{})
+	m.Register(&tsuru.AppDeployList{})
+	m.Register(&tsuru.AppRollback{})
 	m.Register(&tsuru.SetCName{})
 	m.Register(&tsuru.UnsetCName{})
 	m.Register(&tsuru.EnvGet{})
@@ -36,11 +38,15 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&KeyAdd{})
 	m.Register(&KeyRemove{})
 	m.Register(tsuru.ServiceList{})
-	m.Register(tsuru.ServiceAdd{})
+	m.Register(tsuru.ServiceCatalog{})
+	m.Register(&tsuru.ServiceAdd{})
 	m.Register(tsuru.ServiceRemove{})
 	m.Register(tsuru.ServiceDoc{})
 	m.Register(tsuru.ServiceInfo{})
 	m.Register(tsuru.ServiceInstanceStatus{})
+	m.Register(tsuru.ServiceInstanceGrant{})
+	m.Register(tsuru.ServiceInstanceRevoke{})
+	m.Register(&tsuru.ServiceInstanceProxy{})
 	m.Register(&tsuru.ServiceBind{})
 	m.Register(&tsuru.ServiceUnbind{})
 	return m
@@ -76,6 +76,20 @@ func (s *S) TestAppRestartIsRegistered(c *gocheck.C) {
 	c.Assert(restart, gocheck.FitsTypeOf, &tsuru.AppRestart{})
 }
 
+func (s *S) TestAppDeployListIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	list, ok := manager.Commands["app-deploy-list"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(list, gocheck.FitsTypeOf, &tsuru.AppDeployList{})
+}
+
+func (s *S) TestAppRollbackIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	rollback, ok := manager.Commands["app-rollback"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(rollback, gocheck.FitsTypeOf, &tsuru.AppRollback{})
+}
+
 func (s *S) TestEnvGetIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	get, ok := manager.Commands["env-get"]
@@ -122,7 +136,35 @@ func (s *S) TestServiceAddIsRegistered(c *gocheck.C) {
 	manager := buildManager("tsuru")
 	add, ok := manager.Commands["service-add"]
 	c.Assert(ok, gocheck.Equals, true)
-	c.Assert(add, gocheck.FitsTypeOf, tsuru.ServiceAdd{})
+	c.Assert(add, gocheck.FitsTypeOf, &tsuru.ServiceAdd{})
+}
+
+func (s *S) TestServiceInstanceGrantIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	grant, ok := manager.Commands["service-instance-grant"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(grant, gocheck.FitsTypeOf, tsuru.ServiceInstanceGrant{})
+}
+
+func (s *S) TestServiceInstanceRevokeIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	revoke, ok := manager.Commands["service-instance-revoke"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(revoke, gocheck.FitsTypeOf, tsuru.ServiceInstanceRevoke{})
+}
+
+func (s *S) TestServiceInstanceProxyIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	proxy, ok := manager.Commands["service-instance-proxy"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(proxy, gocheck.FitsTypeOf, &tsuru.ServiceInstanceProxy{})
+}
+
+func (s *S) TestServiceCatalogIsRegistered(c *gocheck.C) {
+	manager := buildManager("tsuru")
+	catalog, ok := manager.Commands["service-catalog"]
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(catalog, gocheck.FitsTypeOf, tsuru.ServiceCatalog{})
 }
 
 func (s *S) TestServiceRemoveIsRegistered(c *gocheck.C) {
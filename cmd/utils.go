@@ -52,6 +52,7 @@ func readToken() (string, error) {
 type ServiceModel struct {
 	Service   string
 	Instances []string
+	States    map[string]string
 }
 
 func ShowServicesInstancesList(b []byte) ([]byte, error) {
@@ -66,7 +67,14 @@ func ShowServicesInstancesList(b []byte) ([]byte, error) {
 	table := NewTable()
 	table.Headers = Row([]string{"Services", "Instances"})
 	for _, s := range services {
-		insts := strings.Join(s.Instances, ", ")
+		instances := make([]string, len(s.Instances))
+		for i, name := range s.Instances {
+			instances[i] = name
+			if state := s.States[name]; state != "" {
+				instances[i] += " (" + state + ")"
+			}
+		}
+		insts := strings.Join(instances, ", ")
 		r := Row([]string{s.Service, insts})
 		table.AddRow(r)
 	}
@@ -52,3 +52,16 @@ func (s *S) TestShowServicesInstancesList(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(string(result), gocheck.Equals, expected)
 }
+
+func (s *S) TestShowServicesInstancesListWithStates(c *gocheck.C) {
+	expected := `+----------+--------------------------------------------------+
+| Services | Instances                                        |
++----------+--------------------------------------------------+
+| mongodb  | my_nosql, other_nosql (pending), broken (failed) |
++----------+--------------------------------------------------+
+`
+	b := `[{"service": "mongodb", "instances": ["my_nosql", "other_nosql", "broken"], "states": {"other_nosql": "pending", "broken": "failed"}}]`
+	result, err := ShowServicesInstancesList([]byte(b))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(string(result), gocheck.Equals, expected)
+}
@@ -58,6 +58,7 @@ func update(units []provision.Unit) {
 		u.InstanceId = unit.InstanceId
 		u.Ip = unit.Ip
 		u.State = string(unit.Status)
+		u.ProcessName = unit.ProcessName
 		a.AddUnit(&u)
 		if index > -1 {
 			l.Add(a, index)
@@ -11,8 +11,10 @@ import (
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	_ "github.com/globocom/tsuru/provision/docker"
 	_ "github.com/globocom/tsuru/provision/juju"
 	_ "github.com/globocom/tsuru/provision/local"
+	_ "github.com/globocom/tsuru/router/hipache"
 	stdlog "log"
 	"log/syslog"
 	"os"
@@ -75,6 +77,7 @@ func main() {
 
 		ticker := time.Tick(time.Minute)
 		fmt.Println("tsuru collector agent started...")
+		go checkServices(time.Tick(time.Minute))
 		collect(ticker)
 	}
 }
@@ -0,0 +1,33 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/service"
+	"time"
+)
+
+// checkServices checks the status of all service instances on each tick,
+// alerting the apps bound to the instances that go down or come back up.
+func checkServices(ticker <-chan time.Time) {
+	for _ = range ticker {
+		if err := service.CheckInstancesStatus(logInBoundApps); err != nil {
+			log.Printf("Failed to check the status of the service instances: %s.", err)
+		}
+	}
+}
+
+// logInBoundApps logs the message in all apps bound to the service instance,
+// with source tsuru-service.
+func logInBoundApps(si *service.ServiceInstance, message string) {
+	for _, name := range si.Apps {
+		a := app.App{Name: name}
+		if err := a.Log(message, "tsuru-service"); err != nil {
+			log.Printf("Failed to log in the app %q: %s.", name, err)
+		}
+	}
+}
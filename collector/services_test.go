@@ -0,0 +1,58 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/globocom/tsuru/app"
+	"github.com/globocom/tsuru/service"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func (s *S) TestLogInBoundApps(c *gocheck.C) {
+	si := service.ServiceInstance{Name: "mysql", Apps: []string{"caravan", "bu2b"}}
+	defer s.conn.Logs().Remove(bson.M{"appname": bson.M{"$in": si.Apps}})
+	logInBoundApps(&si, `The service instance "mysql" is down.`)
+	var logs []app.Applog
+	err := s.conn.Logs().Find(bson.M{"source": "tsuru-service"}).Sort("appname").All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 2)
+	c.Assert(logs[0].AppName, gocheck.Equals, "bu2b")
+	c.Assert(logs[0].Message, gocheck.Equals, `The service instance "mysql" is down.`)
+	c.Assert(logs[1].AppName, gocheck.Equals, "caravan")
+}
+
+func (s *S) TestCheckServices(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	srv := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := service.ServiceInstance{Name: "my-mysql", ServiceName: srv.Name, Apps: []string{"carnies"}}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	defer s.conn.Logs().Remove(bson.M{"appname": "carnies"})
+	ch := make(chan time.Time)
+	done := make(chan bool)
+	go func() {
+		checkServices(ch)
+		done <- true
+	}()
+	ch <- time.Now()
+	close(ch)
+	<-done
+	var logs []app.Applog
+	err = s.conn.Logs().Find(bson.M{"appname": "carnies", "source": "tsuru-service"}).All(&logs)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(logs, gocheck.HasLen, 1)
+	c.Assert(logs[0].Message, gocheck.Equals, `The service instance "my-mysql" is down.`)
+}
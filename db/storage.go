@@ -153,11 +153,35 @@ func (s *Storage) Tokens() *mgo.Collection {
 	return s.Collection("tokens")
 }
 
+// PasswordTokens returns the collection of password reset tokens from
+// MongoDB.
+func (s *Storage) PasswordTokens() *mgo.Collection {
+	return s.Collection("password_tokens")
+}
+
 // Teams returns the teams collection from MongoDB.
 func (s *Storage) Teams() *mgo.Collection {
 	return s.Collection("teams")
 }
 
+// Roles returns the roles collection from MongoDB.
+func (s *Storage) Roles() *mgo.Collection {
+	return s.Collection("roles")
+}
+
+// Events returns the collection of audit events from MongoDB.
+func (s *Storage) Events() *mgo.Collection {
+	return s.Collection("events")
+}
+
+// Deploys returns the deploys collection from MongoDB.
+func (s *Storage) Deploys() *mgo.Collection {
+	versionIndex := mgo.Index{Key: []string{"app", "version"}, Unique: true}
+	c := s.Collection("deploys")
+	c.EnsureIndex(versionIndex)
+	return c
+}
+
 func init() {
 	ticker = time.NewTicker(time.Hour)
 	go retire(ticker)
@@ -227,6 +227,39 @@ func (s *S) TestMethodTeamsShouldReturnTeamsCollection(c *gocheck.C) {
 	c.Assert(teams, gocheck.DeepEquals, teamsc)
 }
 
+func (s *S) TestPasswordTokens(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	tokens := storage.PasswordTokens()
+	tokensc := storage.Collection("password_tokens")
+	c.Assert(tokens, gocheck.DeepEquals, tokensc)
+}
+
+func (s *S) TestRoles(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	roles := storage.Roles()
+	rolesc := storage.Collection("roles")
+	c.Assert(roles, gocheck.DeepEquals, rolesc)
+}
+
+func (s *S) TestEvents(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	events := storage.Events()
+	eventsc := storage.Collection("events")
+	c.Assert(events, gocheck.DeepEquals, eventsc)
+}
+
+func (s *S) TestDeploys(c *gocheck.C) {
+	storage, _ := Open("127.0.0.1:27017", "tsuru_storage_test")
+	defer storage.session.Close()
+	deploys := storage.Deploys()
+	deploysc := storage.Collection("deploys")
+	c.Assert(deploys, gocheck.DeepEquals, deploysc)
+	c.Assert(deploys, HasUniqueIndex, []string{"app", "version"})
+}
+
 func (s *S) TestRetire(c *gocheck.C) {
 	defer func() {
 		if r := recover(); !c.Failed() && r == nil {
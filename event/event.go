@@ -0,0 +1,115 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package event provides the audit log of tsuru: a record of the operations
+// performed through the API, telling who did what, when, and how it ended.
+package event
+
+import (
+	"github.com/globocom/tsuru/db"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"time"
+)
+
+// Redacted is the value stored in place of secret params.
+const Redacted = "*****"
+
+const (
+	// DefaultLimit is the maximum number of events returned by List when no
+	// limit is given.
+	DefaultLimit = 100
+
+	// MaxLimit is the maximum number of events returned by List, whatever
+	// the given limit.
+	MaxLimit = 1000
+)
+
+// secretWords identify the params that hold secrets: the value of any param
+// whose name contains one of these words is redacted.
+var secretWords = []string{"password", "secret", "token"}
+
+// Param is a parameter of the operation, taken from the url or from the body
+// of the request.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Event represents an operation performed through the API.
+//
+// Events are stored in the events collection. The actor is the email of the
+// user that performed the operation (or the name of the app, for app tokens),
+// and is empty for operations that do not require authentication, like
+// logging in. The target is the name of the object of the operation, like an
+// app or a team.
+type Event struct {
+	Actor     string
+	Action    string
+	Target    string
+	Params    []Param
+	Status    int
+	Error     string
+	Timestamp time.Time
+}
+
+// IsSecret checks whether the param with the given name holds a secret.
+func IsSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record stores the event, redacting its secret params (see IsSecret). The
+// timestamp defaults to the current time.
+func Record(e *Event) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	for i, p := range e.Params {
+		if IsSecret(p.Name) {
+			e.Params[i].Value = Redacted
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Events().Insert(e)
+}
+
+// List returns the events of the given target and actor, from the newest to
+// the oldest. Empty target or actor match any event. The number of events is
+// limited to limit, or to DefaultLimit when limit is not positive, and never
+// exceeds MaxLimit.
+func List(target, actor string, limit int) ([]Event, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{}
+	if target != "" {
+		query["target"] = target
+	}
+	if actor != "" {
+		query["actor"] = actor
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	var events []Event
+	err = conn.Events().Find(query).Sort("-timestamp").Limit(limit).All(&events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"time"
+)
+
+func (s *S) TestIsSecret(c *gocheck.C) {
+	var tests = []struct {
+		name   string
+		secret bool
+	}{
+		{"password", true},
+		{"Password", true},
+		{"client-secret", true},
+		{"token", true},
+		{"DATABASE_PASSWORD", true},
+		{"app", false},
+		{"name", false},
+		{"DATABASE_URL", false},
+	}
+	for _, t := range tests {
+		c.Check(IsSecret(t.name), gocheck.Equals, t.secret)
+	}
+}
+
+func (s *S) TestRecord(c *gocheck.C) {
+	e := Event{
+		Actor:  "gopher@golang.org",
+		Action: "app.env.unset",
+		Target: "payments",
+		Params: []Param{{Name: "app", Value: "payments"}, {Name: "body", Value: `["DATABASE_URL"]`}},
+		Status: 200,
+	}
+	err := Record(&e)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(e.Timestamp.IsZero(), gocheck.Equals, false)
+	var result Event
+	err = s.conn.Events().Find(bson.M{"target": "payments"}).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result.Actor, gocheck.Equals, e.Actor)
+	c.Assert(result.Action, gocheck.Equals, e.Action)
+	c.Assert(result.Params, gocheck.DeepEquals, e.Params)
+	c.Assert(result.Status, gocheck.Equals, 200)
+}
+
+func (s *S) TestRecordRedactsSecrets(c *gocheck.C) {
+	e := Event{
+		Action: "user.login",
+		Target: "gopher@golang.org",
+		Params: []Param{{Name: "email", Value: "gopher@golang.org"}, {Name: "password", Value: "123456"}},
+	}
+	err := Record(&e)
+	c.Assert(err, gocheck.IsNil)
+	var result Event
+	err = s.conn.Events().Find(bson.M{"target": "gopher@golang.org"}).One(&result)
+	c.Assert(err, gocheck.IsNil)
+	expected := []Param{{Name: "email", Value: "gopher@golang.org"}, {Name: "password", Value: Redacted}}
+	c.Assert(result.Params, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRecordKeepsTheTimestamp(c *gocheck.C) {
+	timestamp := time.Date(2013, 8, 20, 10, 0, 0, 0, time.UTC)
+	e := Event{Action: "app.create", Target: "payments", Timestamp: timestamp}
+	err := Record(&e)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(e.Timestamp, gocheck.Equals, timestamp)
+}
+
+func (s *S) TestList(c *gocheck.C) {
+	now := time.Now()
+	events := []Event{
+		{Actor: "gopher@golang.org", Action: "app.create", Target: "payments", Timestamp: now.Add(-3 * time.Hour)},
+		{Actor: "rob@golang.org", Action: "app.env.set", Target: "payments", Timestamp: now.Add(-2 * time.Hour)},
+		{Actor: "gopher@golang.org", Action: "app.env.unset", Target: "payments", Timestamp: now.Add(-time.Hour)},
+		{Actor: "gopher@golang.org", Action: "app.create", Target: "checkout", Timestamp: now},
+	}
+	for i := range events {
+		err := Record(&events[i])
+		c.Assert(err, gocheck.IsNil)
+	}
+	var tests = []struct {
+		target, actor string
+		limit         int
+		expected      []string
+	}{
+		{"", "", 0, []string{"app.create", "app.env.unset", "app.env.set", "app.create"}},
+		{"payments", "", 0, []string{"app.env.unset", "app.env.set", "app.create"}},
+		{"payments", "gopher@golang.org", 0, []string{"app.env.unset", "app.create"}},
+		{"", "rob@golang.org", 0, []string{"app.env.set"}},
+		{"", "", 2, []string{"app.create", "app.env.unset"}},
+		{"unknown", "", 0, nil},
+	}
+	for _, t := range tests {
+		result, err := List(t.target, t.actor, t.limit)
+		c.Assert(err, gocheck.IsNil)
+		var actions []string
+		for _, e := range result {
+			actions = append(actions, e.Action)
+		}
+		c.Check(actions, gocheck.DeepEquals, t.expected)
+	}
+}
+
+func (s *S) TestListNeverExceedsMaxLimit(c *gocheck.C) {
+	events := make([]interface{}, MaxLimit+1)
+	for i := range events {
+		events[i] = Event{Action: "app.restart", Target: "payments", Timestamp: time.Now()}
+	}
+	err := s.conn.Events().Insert(events...)
+	c.Assert(err, gocheck.IsNil)
+	result, err := List("payments", "", MaxLimit+1)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(result, gocheck.HasLen, MaxLimit)
+}
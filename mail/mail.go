@@ -0,0 +1,52 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mail provides the interface used by tsuru to send emails to users,
+// along with an SMTP implementation.
+package mail
+
+import (
+	"fmt"
+	"github.com/globocom/config"
+)
+
+// Mailer is the interface for sending emails. Tsuru comes with an SMTP
+// mailer, one can add other mailers by satisfying this interface and
+// registering it using the function Register.
+type Mailer interface {
+	// Send sends a message with the given subject and body to the given
+	// recipients.
+	Send(to []string, subject string, body []byte) error
+}
+
+var mailers = map[string]Mailer{
+	"smtp": smtpMailer{},
+}
+
+// Register registers a new mailer.
+func Register(name string, mailer Mailer) {
+	mailers[name] = mailer
+}
+
+// Get returns the mailer defined in the "mail:mailer" setting, if it's
+// registered. It defaults to the SMTP mailer.
+func Get() (Mailer, error) {
+	name, err := config.GetString("mail:mailer")
+	if err != nil {
+		name = "smtp"
+	}
+	if m, ok := mailers[name]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("Mailer %q is not known.", name)
+}
+
+// Send sends a message using the configured mailer.
+func Send(to []string, subject string, body []byte) error {
+	m, err := Get()
+	if err != nil {
+		return err
+	}
+	return m.Send(to, subject, body)
+}
@@ -0,0 +1,73 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mail
+
+import (
+	"github.com/globocom/config"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) {
+	gocheck.TestingT(t)
+}
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+type fakeMailer struct {
+	to      []string
+	subject string
+	body    []byte
+}
+
+func (m *fakeMailer) Send(to []string, subject string, body []byte) error {
+	m.to, m.subject, m.body = to, subject, body
+	return nil
+}
+
+func (s *S) TestGet(c *gocheck.C) {
+	config.Set("mail:mailer", "smtp")
+	defer config.Unset("mail:mailer")
+	m, err := Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(m, gocheck.FitsTypeOf, smtpMailer{})
+}
+
+func (s *S) TestGetConfigUndefined(c *gocheck.C) {
+	m, err := Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(m, gocheck.FitsTypeOf, smtpMailer{})
+}
+
+func (s *S) TestGetConfigUnknown(c *gocheck.C) {
+	config.Set("mail:mailer", "unknown")
+	defer config.Unset("mail:mailer")
+	m, err := Get()
+	c.Assert(m, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Mailer "unknown" is not known.`)
+}
+
+func (s *S) TestRegisterAndSend(c *gocheck.C) {
+	var fake fakeMailer
+	Register("fake", &fake)
+	defer delete(mailers, "fake")
+	config.Set("mail:mailer", "fake")
+	defer config.Unset("mail:mailer")
+	err := Send([]string{"gopher@golang.org"}, "Hello", []byte("Hello world!"))
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(fake.to, gocheck.DeepEquals, []string{"gopher@golang.org"})
+	c.Assert(fake.subject, gocheck.Equals, "Hello")
+	c.Assert(string(fake.body), gocheck.Equals, "Hello world!")
+}
+
+func (s *S) TestSendUnknownMailer(c *gocheck.C) {
+	config.Set("mail:mailer", "unknown")
+	defer config.Unset("mail:mailer")
+	err := Send([]string{"gopher@golang.org"}, "Hello", []byte("Hello world!"))
+	c.Assert(err, gocheck.NotNil)
+}
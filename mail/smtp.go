@@ -0,0 +1,52 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/config"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// smtpMailer sends emails through the SMTP server defined in the
+// "smtp:server" setting (in the format host:port), on behalf of the address
+// defined in the "smtp:from" setting. When the "smtp:user" setting is
+// defined, the mailer authenticates with the server, using the password
+// defined in the "smtp:password" setting.
+type smtpMailer struct{}
+
+func (smtpMailer) Send(to []string, subject string, body []byte) error {
+	server, err := config.GetString("smtp:server")
+	if err != nil {
+		return err
+	}
+	from, err := config.GetString("smtp:from")
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if user, err := config.GetString("smtp:user"); err == nil {
+		password, _ := config.GetString("smtp:password")
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", user, password, host)
+	}
+	return smtp.SendMail(server, auth, from, to, message(from, to, subject, body))
+}
+
+func message(from string, to []string, subject string, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
@@ -0,0 +1,58 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mail
+
+import (
+	"github.com/globocom/config"
+	ttesting "github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestSMTPMailerSend(c *gocheck.C) {
+	server, err := ttesting.NewSMTPServer()
+	c.Assert(err, gocheck.IsNil)
+	defer server.Stop()
+	config.Set("smtp:server", server.Addr())
+	defer config.Unset("smtp:server")
+	config.Set("smtp:from", "tsuru@globo.com")
+	defer config.Unset("smtp:from")
+	err = smtpMailer{}.Send([]string{"gopher@golang.org", "rob@golang.org"}, "Hello", []byte("Hello world!"))
+	c.Assert(err, gocheck.IsNil)
+	messages := server.Messages()
+	c.Assert(messages, gocheck.HasLen, 1)
+	c.Assert(messages[0].From, gocheck.Equals, "tsuru@globo.com")
+	c.Assert(messages[0].To, gocheck.DeepEquals, []string{"gopher@golang.org", "rob@golang.org"})
+	expected := `From: tsuru@globo.com
+To: gopher@golang.org, rob@golang.org
+Subject: Hello
+Content-Type: text/plain; charset=utf-8
+
+Hello world!
+`
+	c.Assert(string(messages[0].Data), gocheck.Equals, expected)
+}
+
+func (s *S) TestSMTPMailerSendWithoutServer(c *gocheck.C) {
+	config.Set("smtp:from", "tsuru@globo.com")
+	defer config.Unset("smtp:from")
+	err := smtpMailer{}.Send([]string{"gopher@golang.org"}, "Hello", []byte("Hello world!"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `key "smtp:server" not found`)
+}
+
+func (s *S) TestSMTPMailerSendWithoutFrom(c *gocheck.C) {
+	config.Set("smtp:server", "127.0.0.1:25")
+	defer config.Unset("smtp:server")
+	err := smtpMailer{}.Send([]string{"gopher@golang.org"}, "Hello", []byte("Hello world!"))
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `key "smtp:from" not found`)
+}
+
+func (s *S) TestMessage(c *gocheck.C) {
+	msg := message("tsuru@globo.com", []string{"gopher@golang.org"}, "Hello", []byte("Hello world!"))
+	expected := "From: tsuru@globo.com\r\nTo: gopher@golang.org\r\nSubject: Hello\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\nHello world!"
+	c.Assert(string(msg), gocheck.Equals, expected)
+}
@@ -0,0 +1,20 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package docker provides a provisioner implementation that runs units of
+// apps as Docker containers, talking to the Docker remote API.
+//
+// In order to use the provisioner, import this package and call
+// provision.Get("docker"):
+//
+//     import (
+//         "github.com/globocom/tsuru/provision"
+//         _ "github.com/globocom/tsuru/provision/docker"
+//     )
+//     // ...
+//     func main() {
+//         provisioner, err := provision.Get("docker")
+//         // Use provisioner.
+//     }
+package docker
@@ -0,0 +1,278 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// container represents a docker container, running a unit of an app.
+//
+// Containers are stored in the database, in the collection defined by the
+// docker:collection setting.
+type container struct {
+	Id          string `bson:"_id"`
+	AppName     string
+	Type        string
+	Ip          string
+	Status      string
+	ProcessName string
+}
+
+// asUnit converts the container to a provision.Unit.
+func (c *container) asUnit() provision.Unit {
+	return provision.Unit{
+		Name:        c.Id,
+		AppName:     c.AppName,
+		Type:        c.Type,
+		InstanceId:  c.Id,
+		Ip:          c.Ip,
+		Status:      provision.Status(c.Status),
+		ProcessName: c.ProcessName,
+	}
+}
+
+// webPort returns the port where containers of web processes serve requests,
+// defined in the setting docker:web-port. The default port is 80.
+func webPort() int {
+	port, err := config.GetInt("docker:web-port")
+	if err != nil {
+		return 80
+	}
+	return port
+}
+
+// webAddr returns the address where a container with the given IP serves
+// requests: the IP alone when the web port is 80, or ip:port otherwise.
+func webAddr(ip string) string {
+	if port := webPort(); port != 80 {
+		return net.JoinHostPort(ip, strconv.Itoa(port))
+	}
+	return ip
+}
+
+// image returns the name of the image used by containers of the given
+// framework.
+func image(framework string) (string, error) {
+	namespace, err := config.GetString("docker:repository-namespace")
+	if err != nil {
+		return "", err
+	}
+	return namespace + "/" + framework, nil
+}
+
+// dockerRequest issues a request to the Docker remote API, identified by the
+// setting docker:server.
+//
+// The given body is encoded in JSON. If out is not nil, the response body is
+// decoded in it.
+func dockerRequest(method, path string, body, out interface{}) error {
+	server, err := config.GetString("docker:server")
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	url := strings.TrimRight(server, "/") + path
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		log.Printf("[docker] Failed to %s %s (%d): %s", method, path, resp.StatusCode, data)
+		return &provision.Error{
+			Reason: string(data),
+			Err:    fmt.Errorf("%s %s returned status %d", method, path, resp.StatusCode),
+		}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// create creates a container for the given app in the docker server, running
+// the given process type. It fills the Id, AppName, Type and ProcessName
+// fields of the container.
+//
+// The process type is available to the container in the environment variable
+// TSURU_PROCESS.
+func (c *container) create(app provision.App, process string) error {
+	img, err := image(app.GetFramework())
+	if err != nil {
+		return err
+	}
+	opts := map[string]interface{}{
+		"Image":        img,
+		"AttachStdout": false,
+		"AttachStderr": false,
+	}
+	if process != "" {
+		opts["Env"] = []string{"TSURU_PROCESS=" + process}
+	}
+	var result struct{ Id string }
+	if err = dockerRequest("POST", "/containers/create", opts, &result); err != nil {
+		return err
+	}
+	c.Id = result.Id
+	c.AppName = app.GetName()
+	c.Type = app.GetFramework()
+	c.ProcessName = process
+	c.Status = provision.StatusCreating.String()
+	return nil
+}
+
+// start starts the container.
+func (c *container) start() error {
+	return dockerRequest("POST", "/containers/"+c.Id+"/start", nil, nil)
+}
+
+// stop stops the container.
+func (c *container) stop() error {
+	return dockerRequest("POST", "/containers/"+c.Id+"/stop?t=10", nil, nil)
+}
+
+// remove removes the container from the docker server.
+func (c *container) remove() error {
+	return dockerRequest("DELETE", "/containers/"+c.Id, nil, nil)
+}
+
+// inspect loads the state of the container from the docker server, updating
+// its Ip and Status.
+func (c *container) inspect() error {
+	var result struct {
+		State struct {
+			Running  bool
+			ExitCode int
+		}
+		NetworkSettings struct {
+			IPAddress string
+		}
+	}
+	if err := dockerRequest("GET", "/containers/"+c.Id+"/json", nil, &result); err != nil {
+		return err
+	}
+	c.Ip = result.NetworkSettings.IPAddress
+	switch {
+	case result.State.Running:
+		c.Status = provision.StatusStarted.String()
+	case result.State.ExitCode != 0:
+		c.Status = provision.StatusError.String()
+	default:
+		c.Status = provision.StatusDown.String()
+	}
+	return nil
+}
+
+// restartArgs returns the arguments of the restart hook for the container: the
+// name of the process type run by the container, if any.
+func (c *container) restartArgs() []string {
+	if c.ProcessName != "" {
+		return []string{c.ProcessName}
+	}
+	return nil
+}
+
+// exec runs the given command inside the container, using bash. The output of
+// the command is written to stdout and stderr.
+func (c *container) exec(stdout, stderr io.Writer, cmd string, args ...string) error {
+	cmdline := strings.Join(append([]string{cmd}, args...), " ")
+	opts := map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          false,
+		"Cmd":          []string{"/bin/bash", "-c", cmdline},
+	}
+	var created struct{ Id string }
+	err := dockerRequest("POST", "/containers/"+c.Id+"/exec", opts, &created)
+	if err != nil {
+		return err
+	}
+	server, err := config.GetString("docker:server")
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(server, "/") + "/exec/" + created.Id + "/start"
+	body := strings.NewReader(`{"Detach":false,"Tty":false}`)
+	resp, err := http.Post(url, "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return &provision.Error{
+			Reason: string(data),
+			Err:    fmt.Errorf("POST /exec/%s/start returned status %d", created.Id, resp.StatusCode),
+		}
+	}
+	if err = demux(stdout, stderr, resp.Body); err != nil {
+		return err
+	}
+	var result struct{ ExitCode int }
+	err = dockerRequest("GET", "/exec/"+created.Id+"/json", nil, &result)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return nil
+}
+
+// demux reads the multiplexed stream returned by the docker server when
+// attaching to a command, writing each frame to stdout or stderr.
+//
+// Each frame starts with a header of 8 bytes: the first byte identifies the
+// stream (1 for stdout, 2 for stderr) and the last four bytes contain the
+// size of the frame, in big endian.
+func demux(stdout, stderr io.Writer, r io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/testing"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestContainerAsUnit(c *gocheck.C) {
+	cont := container{
+		Id:          "abc123",
+		AppName:     "myapp",
+		Type:        "python",
+		Ip:          "172.17.0.1",
+		Status:      "started",
+		ProcessName: "worker",
+	}
+	expected := provision.Unit{
+		Name:        "abc123",
+		AppName:     "myapp",
+		Type:        "python",
+		InstanceId:  "abc123",
+		Ip:          "172.17.0.1",
+		Status:      provision.StatusStarted,
+		ProcessName: "worker",
+	}
+	c.Assert(cont.asUnit(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestContainerCreate(c *gocheck.C) {
+	var cont container
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := cont.create(app, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.Id, gocheck.Not(gocheck.Equals), "")
+	c.Assert(cont.AppName, gocheck.Equals, "myapp")
+	c.Assert(cont.Type, gocheck.Equals, "python")
+	c.Assert(cont.ProcessName, gocheck.Equals, "")
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusCreating.String())
+	c.Assert(s.docker.container(cont.Id).Image, gocheck.Equals, "tsuru/python")
+	c.Assert(s.docker.container(cont.Id).Env, gocheck.IsNil)
+}
+
+func (s *S) TestContainerCreateWithProcess(c *gocheck.C) {
+	var cont container
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := cont.create(app, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.ProcessName, gocheck.Equals, "worker")
+	c.Assert(s.docker.container(cont.Id).Env, gocheck.DeepEquals, []string{"TSURU_PROCESS=worker"})
+}
+
+func (s *S) TestContainerStartAndInspect(c *gocheck.C) {
+	var cont container
+	err := cont.create(testing.NewFakeApp("myapp", "python", 0), "")
+	c.Assert(err, gocheck.IsNil)
+	err = cont.start()
+	c.Assert(err, gocheck.IsNil)
+	err = cont.inspect()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(cont.Ip, gocheck.Equals, s.docker.container(cont.Id).Ip)
+}
+
+func (s *S) TestContainerStop(c *gocheck.C) {
+	var cont container
+	err := cont.create(testing.NewFakeApp("myapp", "python", 0), "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.start(), gocheck.IsNil)
+	c.Assert(cont.stop(), gocheck.IsNil)
+	c.Assert(cont.inspect(), gocheck.IsNil)
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusDown.String())
+}
+
+func (s *S) TestContainerRemove(c *gocheck.C) {
+	var cont container
+	err := cont.create(testing.NewFakeApp("myapp", "python", 0), "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.remove(), gocheck.IsNil)
+	c.Assert(s.docker.container(cont.Id), gocheck.IsNil)
+}
+
+func (s *S) TestContainerInspectNotFound(c *gocheck.C) {
+	cont := container{Id: "unknown"}
+	err := cont.inspect()
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Reason, gocheck.Equals, "No such container: unknown\n")
+}
+
+func (s *S) TestContainerExec(c *gocheck.C) {
+	var cont container
+	err := cont.create(testing.NewFakeApp("myapp", "python", 0), "")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.prepareExec("total 0", 0)
+	var buf bytes.Buffer
+	err = cont.exec(&buf, &buf, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "total 0")
+	c.Assert(s.docker.cmds, gocheck.DeepEquals, [][]string{{"/bin/bash", "-c", "ls -lh"}})
+}
+
+func (s *S) TestContainerExecFailure(c *gocheck.C) {
+	var cont container
+	err := cont.create(testing.NewFakeApp("myapp", "python", 0), "")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.prepareExec("command not found", 127)
+	var buf bytes.Buffer
+	err = cont.exec(&buf, &buf, "wat")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "exit status 127")
+	c.Assert(buf.String(), gocheck.Equals, "command not found")
+}
+
+func (s *S) TestDemux(c *gocheck.C) {
+	var input, stdout, stderr bytes.Buffer
+	frames := []struct {
+		stream byte
+		data   string
+	}{
+		{1, "out1"},
+		{2, "err"},
+		{1, "out2"},
+	}
+	for _, f := range frames {
+		header := make([]byte, 8)
+		header[0] = f.stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(f.data)))
+		input.Write(header)
+		input.WriteString(f.data)
+	}
+	err := demux(&stdout, &stderr, &input)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stdout.String(), gocheck.Equals, "out1out2")
+	c.Assert(stderr.String(), gocheck.Equals, "err")
+}
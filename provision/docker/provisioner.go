@@ -0,0 +1,299 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	"io"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+func init() {
+	provision.Register("docker", &DockerProvisioner{})
+}
+
+// DockerProvisioner is an implementation for the Provisioner interface that
+// runs units of apps as containers, using the Docker remote API.
+type DockerProvisioner struct{}
+
+func (p *DockerProvisioner) collection() (*db.Storage, *mgo.Collection) {
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		log.Fatalf("FATAL: %s.", err)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %s", err)
+	}
+	return conn, conn.Collection(name)
+}
+
+// router returns the router defined in the setting docker:router. It returns
+// nil if the setting is not defined, meaning that apps are reached directly
+// through the IP of their first unit.
+func (p *DockerProvisioner) router() (router.Router, error) {
+	name, err := config.GetString("docker:router")
+	if err != nil {
+		return nil, nil
+	}
+	return router.Get(name)
+}
+
+// containers returns all containers of the given app.
+func (p *DockerProvisioner) containers(app provision.App) ([]container, error) {
+	var containers []container
+	conn, coll := p.collection()
+	defer conn.Close()
+	err := coll.Find(bson.M{"appname": app.GetName()}).All(&containers)
+	return containers, err
+}
+
+// deploy creates and starts a new container for the app, running the given
+// process type, and stores it in the database.
+func (p *DockerProvisioner) deploy(app provision.App, process string) (*container, error) {
+	var c container
+	if err := c.create(app, process); err != nil {
+		app.Log("Failed to create container: "+err.Error(), "tsuru")
+		return nil, err
+	}
+	conn, coll := p.collection()
+	defer conn.Close()
+	if err := coll.Insert(c); err != nil {
+		return nil, err
+	}
+	if err := c.start(); err != nil {
+		app.Log("Failed to start container: "+err.Error(), "tsuru")
+		c.Status = provision.StatusError.String()
+		coll.UpdateId(c.Id, c)
+		return nil, err
+	}
+	if err := c.inspect(); err != nil {
+		return nil, err
+	}
+	if err := coll.UpdateId(c.Id, c); err != nil {
+		return nil, err
+	}
+	r, err := p.router()
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && provision.IsWebProcess(process) {
+		if err = r.AddRoute(app.GetName(), webAddr(c.Ip)); err != nil {
+			app.Log("Failed to add route: "+err.Error(), "tsuru")
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// destroy removes the container from the router, stops and removes it, and
+// deletes it from the database.
+func (p *DockerProvisioner) destroy(c *container) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if r != nil && provision.IsWebProcess(c.ProcessName) {
+		if err = r.RemoveRoute(c.AppName, webAddr(c.Ip)); err != nil {
+			log.Printf("[docker] Failed to remove route to container %s: %s", c.Id, err)
+		}
+	}
+	if err := c.stop(); err != nil {
+		log.Printf("[docker] Failed to stop container %s: %s", c.Id, err)
+	}
+	if err := c.remove(); err != nil {
+		return err
+	}
+	conn, coll := p.collection()
+	defer conn.Close()
+	return coll.RemoveId(c.Id)
+}
+
+func (p *DockerProvisioner) Provision(app provision.App) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		if err = r.AddBackend(app.GetName()); err != nil {
+			return err
+		}
+	}
+	_, err = p.deploy(app, "")
+	return err
+}
+
+// Restart runs the restart hook in all started containers of the app.
+// Containers that are not started are skipped, unless the app has only one
+// container.
+func (p *DockerProvisioner) Restart(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if len(containers) > 1 && provision.Status(c.Status) != provision.StatusStarted {
+			continue
+		}
+		var buf bytes.Buffer
+		if err = c.exec(&buf, &buf, "/var/lib/tsuru/hooks/restart", c.restartArgs()...); err != nil {
+			msg := fmt.Sprintf("Failed to restart the app (%s): %s", err, buf.String())
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: buf.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// RestartUnit runs the restart hook in the container of the given unit.
+func (p *DockerProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	var c container
+	conn, coll := p.collection()
+	defer conn.Close()
+	err := coll.Find(bson.M{"_id": unit.GetName(), "appname": app.GetName()}).One(&c)
+	if err != nil {
+		return fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), unit.GetName())
+	}
+	var buf bytes.Buffer
+	if err = c.exec(&buf, &buf, "/var/lib/tsuru/hooks/restart", c.restartArgs()...); err != nil {
+		msg := fmt.Sprintf("Failed to restart the unit %s (%s): %s", c.Id, err, buf.String())
+		app.Log(msg, "tsuru-provisioner")
+		return &provision.Error{Reason: buf.String(), Err: err}
+	}
+	return nil
+}
+
+func (p *DockerProvisioner) Destroy(app provision.App) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	for i := range containers {
+		if err = p.destroy(&containers[i]); err != nil {
+			msg := fmt.Sprintf("Failed to destroy unit %s: %s", containers[i].Id, err)
+			app.Log(msg, "tsuru")
+			return err
+		}
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		return r.RemoveBackend(app.GetName())
+	}
+	return nil
+}
+
+func (p *DockerProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if n < 1 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	units := make([]provision.Unit, n)
+	for i := uint(0); i < n; i++ {
+		c, err := p.deploy(app, process)
+		if err != nil {
+			return nil, err
+		}
+		units[i] = c.asUnit()
+	}
+	return units, nil
+}
+
+func (p *DockerProvisioner) RemoveUnit(app provision.App, name string) error {
+	var c container
+	conn, coll := p.collection()
+	defer conn.Close()
+	err := coll.Find(bson.M{"_id": name, "appname": app.GetName()}).One(&c)
+	if err != nil {
+		return fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), name)
+	}
+	return p.destroy(&c)
+}
+
+func (p *DockerProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	containers, err := p.containers(app)
+	if err != nil {
+		return err
+	}
+	length := len(containers)
+	for i, c := range containers {
+		if length > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "Output from unit %q:\n\n", c.Id)
+			if status := provision.Status(c.Status); status != provision.StatusStarted {
+				fmt.Fprintf(stdout, "Unit state is %q, it must be %q for running commands.\n",
+					status, provision.StatusStarted)
+				continue
+			}
+		}
+		if err = c.exec(stdout, stderr, cmd, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectStatus inspects all containers in the docker server, updating their
+// state in the database.
+func (p *DockerProvisioner) CollectStatus() ([]provision.Unit, error) {
+	var containers []container
+	conn, coll := p.collection()
+	defer conn.Close()
+	if err := coll.Find(nil).All(&containers); err != nil {
+		return nil, err
+	}
+	units := make([]provision.Unit, len(containers))
+	for i, c := range containers {
+		if err := c.inspect(); err != nil {
+			log.Printf("[docker] Failed to inspect container %s: %s", c.Id, err)
+			c.Status = provision.StatusError.String()
+		}
+		coll.UpdateId(c.Id, c)
+		units[i] = c.asUnit()
+	}
+	return units, nil
+}
+
+func (p *DockerProvisioner) Addr(app provision.App) (string, error) {
+	r, err := p.router()
+	if err != nil {
+		return "", err
+	}
+	if r != nil {
+		return r.Addr(app.GetName())
+	}
+	units := app.ProvisionUnits()
+	if len(units) < 1 {
+		return "", fmt.Errorf("App %q has no units.", app.GetName())
+	}
+	return webAddr(units[0].GetIp()), nil
+}
+
+// WebPort returns the port where containers of web processes serve requests
+// (see webPort).
+func (p *DockerProvisioner) WebPort() int {
+	return webPort()
+}
+
+// SetCName sets the cname of the app in the router. Without a router there is
+// nothing to do, as the cname points directly to the unit.
+func (p *DockerProvisioner) SetCName(app provision.App, cname string) error {
+	r, err := p.router()
+	if err != nil || r == nil {
+		return err
+	}
+	return r.SetCName(cname, app.GetName())
+}
@@ -0,0 +1,347 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/provision"
+	rtesting "github.com/globocom/tsuru/router/testing"
+	"github.com/globocom/tsuru/testing"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	p, err := provision.Get("docker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p, gocheck.FitsTypeOf, &DockerProvisioner{})
+}
+
+func (s *S) TestProvisionerProvision(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.IsNil)
+	var containers []container
+	err = s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).All(&containers)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(containers, gocheck.HasLen, 1)
+	c.Assert(containers[0].Type, gocheck.Equals, "python")
+	c.Assert(containers[0].Status, gocheck.Equals, provision.StatusStarted.String())
+	c.Assert(containers[0].Ip, gocheck.Equals, s.docker.container(containers[0].Id).Ip)
+	c.Assert(s.docker.container(containers[0].Id).Running, gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerProvisionWithRouter(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.IsNil)
+	var cont container
+	err = s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).One(&cont)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, true)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", cont.Ip), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerProvisionWithRouterAndWebPort(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	config.Set("docker:web-port", 8888)
+	defer config.Unset("docker:web-port")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.IsNil)
+	var cont container
+	err = s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).One(&cont)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", cont.Ip+":8888"), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerWebPort(c *gocheck.C) {
+	var p DockerProvisioner
+	c.Assert(p.WebPort(), gocheck.Equals, 80)
+	config.Set("docker:web-port", 8888)
+	defer config.Unset("docker:web-port")
+	c.Assert(p.WebPort(), gocheck.Equals, 8888)
+}
+
+func (s *S) TestProvisionerProvisionFailure(c *gocheck.C) {
+	s.server.Close()
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.NotNil)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestProvisionerDestroy(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	_, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	err = p.Destroy(app)
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+	c.Assert(s.docker.containers, gocheck.HasLen, 0)
+}
+
+func (s *S) TestProvisionerDestroyWithRouter(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	err := p.Destroy(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
+}
+
+func (s *S) TestProvisionerAddUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	for _, u := range units {
+		c.Assert(u.AppName, gocheck.Equals, "myapp")
+		c.Assert(u.Type, gocheck.Equals, "python")
+		c.Assert(u.Status, gocheck.Equals, provision.StatusStarted)
+		c.Assert(u.Ip, gocheck.Equals, s.docker.container(u.Name).Ip)
+	}
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 3)
+}
+
+func (s *S) TestProvisionerAddUnitsWithProcess(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	defer p.Destroy(app)
+	units, err := p.AddUnits(app, 1, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 1)
+	c.Assert(units[0].ProcessName, gocheck.Equals, "worker")
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", units[0].Ip), gocheck.Equals, false)
+	err = p.RemoveUnit(app, units[0].Name)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestProvisionerAddZeroUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	units, err := p.AddUnits(testing.NewFakeApp("myapp", "python", 0), 0, "")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Cannot add zero units.")
+}
+
+func (s *S) TestProvisionerRemoveUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemoveUnit(app, units[0].Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.docker.container(units[0].Name), gocheck.IsNil)
+	n, err := s.conn.Collection(s.collName).Find(bson.M{"appname": "myapp"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestProvisionerRemoveUnitWithRouter(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	units, err := p.AddUnits(app, 1, "")
+	c.Assert(err, gocheck.IsNil)
+	err = p.RemoveUnit(app, units[0].Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", units[0].Ip), gocheck.Equals, false)
+}
+
+func (s *S) TestProvisionerRemoveUnknownUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RemoveUnit(app, "unknown")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `App "myapp" does not have a unit named "unknown".`)
+}
+
+func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	s.docker.prepareExec("ok", 0)
+	var buf bytes.Buffer
+	err := p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(buf.String(), gocheck.Equals, "ok")
+	c.Assert(s.docker.cmds, gocheck.DeepEquals, [][]string{{"/bin/bash", "-c", "ls -lh"}})
+}
+
+func (s *S) TestProvisionerExecuteCommandMultipleUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.prepareExec("ok", 0)
+	var buf bytes.Buffer
+	err = p.ExecuteCommand(&buf, &buf, app, "ls")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.docker.cmds, gocheck.HasLen, 2)
+	expected := `Output from unit "` + units[0].Name + `":` + "\n\nok\n"
+	expected += `Output from unit "` + units[1].Name + `":` + "\n\nok"
+	c.Assert(buf.String(), gocheck.Equals, expected)
+}
+
+func (s *S) TestProvisionerRestart(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	s.docker.prepareExec("", 0)
+	err := p.Restart(app)
+	c.Assert(err, gocheck.IsNil)
+	expected := [][]string{{"/bin/bash", "-c", "/var/lib/tsuru/hooks/restart"}}
+	c.Assert(s.docker.cmds, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerRestartFailure(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	c.Assert(p.Provision(app), gocheck.IsNil)
+	s.docker.prepareExec("fatal unexpected failure", 25)
+	err := p.Restart(app)
+	c.Assert(err, gocheck.NotNil)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(pErr.Reason, gocheck.Equals, "fatal unexpected failure")
+	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
+}
+
+func (s *S) TestProvisionerRestartUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.prepareExec("", 0)
+	err = p.RestartUnit(app, &testing.FakeUnit{Name: units[1].Name})
+	c.Assert(err, gocheck.IsNil)
+	expected := [][]string{{"/bin/bash", "-c", "/var/lib/tsuru/hooks/restart"}}
+	c.Assert(s.docker.cmds, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerRestartUnitWithProcess(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 1, "worker")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.prepareExec("", 0)
+	err = p.RestartUnit(app, &testing.FakeUnit{Name: units[0].Name})
+	c.Assert(err, gocheck.IsNil)
+	expected := [][]string{{"/bin/bash", "-c", "/var/lib/tsuru/hooks/restart worker"}}
+	c.Assert(s.docker.cmds, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerRestartUnknownUnit(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RestartUnit(app, &testing.FakeUnit{Name: "unknown"})
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `App "myapp" does not have a unit named "unknown".`)
+}
+
+func (s *S) TestProvisionerCollectStatus(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	s.docker.container(units[1].Name).Running = false
+	collected, err := p.CollectStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(collected, gocheck.HasLen, 2)
+	statuses := map[string]provision.Status{}
+	for _, u := range collected {
+		statuses[u.Name] = u.Status
+	}
+	c.Assert(statuses[units[0].Name], gocheck.Equals, provision.StatusStarted)
+	c.Assert(statuses[units[1].Name], gocheck.Equals, provision.StatusDown)
+	var cont container
+	err = s.conn.Collection(s.collName).FindId(units[1].Name).One(&cont)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.Status, gocheck.Equals, provision.StatusDown.String())
+}
+
+func (s *S) TestProvisionerAddr(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	addr, err := p.Addr(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, app.ProvisionUnits()[0].GetIp())
+}
+
+func (s *S) TestProvisionerAddrWithoutUnits(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	addr, err := p.Addr(app)
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `App "myapp" has no units.`)
+}
+
+func (s *S) TestProvisionerAddrWithRouter(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err := rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	addr, err := p.Addr(app)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestProvisionerSetCName(c *gocheck.C) {
+	config.Set("docker:router", "fake")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err := rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	err = p.SetCName(app, "myapp.mycompany.com")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.CName("myapp"), gocheck.Equals, "myapp.mycompany.com")
+}
+
+func (s *S) TestProvisionerSetCNameWithoutRouter(c *gocheck.C) {
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err := p.SetCName(app, "myapp.mycompany.com")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestProvisionerUnknownRouter(c *gocheck.C) {
+	config.Set("docker:router", "unknown")
+	defer config.Unset("docker:router")
+	var p DockerProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.Provision(app)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Unknown router: "unknown".`)
+}
@@ -0,0 +1,123 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type fakeContainer struct {
+	Image   string
+	Env     []string
+	Ip      string
+	Running bool
+}
+
+// fakeDockerServer is an http.Handler that behaves like the Docker remote
+// API, storing containers in memory.
+type fakeDockerServer struct {
+	mut        sync.Mutex
+	containers map[string]*fakeContainer
+	execs      map[string]string
+	cmds       [][]string
+	output     string
+	exitCode   int
+	counter    int
+}
+
+func newFakeDockerServer() *fakeDockerServer {
+	return &fakeDockerServer{
+		containers: make(map[string]*fakeContainer),
+		execs:      make(map[string]string),
+	}
+}
+
+func (s *fakeDockerServer) prepareExec(output string, exitCode int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.output = output
+	s.exitCode = exitCode
+}
+
+func (s *fakeDockerServer) container(id string) *fakeContainer {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.containers[id]
+}
+
+func (s *fakeDockerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 2 && parts[1] == "create" && r.Method == "POST" {
+		var opts struct {
+			Image string
+			Env   []string
+		}
+		json.NewDecoder(r.Body).Decode(&opts)
+		s.counter++
+		id := fmt.Sprintf("9930c24f1c%02d", s.counter)
+		s.containers[id] = &fakeContainer{
+			Image: opts.Image,
+			Env:   opts.Env,
+			Ip:    fmt.Sprintf("172.17.0.%d", s.counter),
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"Id":%q}`, id)
+		return
+	}
+	if parts[0] == "exec" && len(parts) == 3 {
+		if _, ok := s.execs[parts[1]]; !ok {
+			http.Error(w, "No such exec instance", http.StatusNotFound)
+			return
+		}
+		switch parts[2] {
+		case "start":
+			header := make([]byte, 8)
+			header[0] = 1
+			binary.BigEndian.PutUint32(header[4:], uint32(len(s.output)))
+			w.Write(header)
+			w.Write([]byte(s.output))
+		case "json":
+			fmt.Fprintf(w, `{"ExitCode":%d}`, s.exitCode)
+		}
+		return
+	}
+	c, ok := s.containers[parts[1]]
+	if !ok {
+		http.Error(w, "No such container: "+parts[1], http.StatusNotFound)
+		return
+	}
+	if len(parts) == 2 && r.Method == "DELETE" {
+		delete(s.containers, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	switch parts[2] {
+	case "start":
+		c.Running = true
+		w.WriteHeader(http.StatusNoContent)
+	case "stop":
+		c.Running = false
+		w.WriteHeader(http.StatusNoContent)
+	case "json":
+		fmt.Fprintf(w, `{"State":{"Running":%t},"NetworkSettings":{"IPAddress":%q}}`, c.Running, c.Ip)
+	case "exec":
+		var opts struct{ Cmd []string }
+		json.NewDecoder(r.Body).Decode(&opts)
+		s.cmds = append(s.cmds, opts.Cmd)
+		id := fmt.Sprintf("exec-%d", len(s.cmds))
+		s.execs[id] = parts[1]
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"Id":%q}`, id)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
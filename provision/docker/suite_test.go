@@ -0,0 +1,52 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	rtesting "github.com/globocom/tsuru/router/testing"
+	"launchpad.net/gocheck"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	collName string
+	conn     *db.Storage
+	docker   *fakeDockerServer
+	server   *httptest.Server
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	var err error
+	s.collName = "docker_units_test"
+	config.Set("docker:collection", s.collName)
+	config.Set("docker:repository-namespace", "tsuru")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "docker_provision_tests_s")
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) SetUpTest(c *gocheck.C) {
+	s.docker = newFakeDockerServer()
+	s.server = httptest.NewServer(s.docker)
+	config.Set("docker:server", s.server.URL)
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	s.server.Close()
+	s.conn.Collection(s.collName).RemoveAll(nil)
+	rtesting.FakeRouter.Reset()
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Collection(s.collName).Database.DropDatabase()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/globocom/tsuru/heal"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router/elb"
 	"launchpad.net/goamz/aws"
 	"launchpad.net/goamz/ec2"
 	"launchpad.net/goamz/s3"
@@ -357,6 +358,16 @@ func (h bootstrapMachineHealer) Heal() error {
 	return nil
 }
 
+// elbInstance represents the health of an instance registered in a load
+// balancer.
+type elbInstance struct {
+	id          string
+	description string
+	reasonCode  string
+	state       string
+	lb          string
+}
+
 type elbInstanceHealer struct{}
 
 func (h elbInstanceHealer) Heal() error {
@@ -374,10 +385,17 @@ func (h elbInstanceHealer) Heal() error {
 	if instances, err := h.checkInstances(names); err == nil && len(instances) > 0 {
 		for _, instance := range instances {
 			a := apps[instance.lb]
+			var process string
+			for _, u := range a.Units {
+				if u.InstanceId == instance.id {
+					process = u.ProcessName
+					break
+				}
+			}
 			if err := a.RemoveUnit(instance.id); err != nil {
 				return err
 			}
-			if err := a.AddUnits(1); err != nil {
+			if err := a.AddUnits(1, process); err != nil {
 				return err
 			}
 		}
@@ -440,7 +458,7 @@ func (h elbInstanceHealer) getUnhealthyApps() map[string]app.App {
 }
 
 func (h elbInstanceHealer) describeLoadBalancers(names []string) ([]string, error) {
-	resp, err := getELBEndpoint().DescribeLoadBalancers(names...)
+	resp, err := elb.Client().DescribeLoadBalancers(names...)
 	if err != nil {
 		return nil, err
 	}
@@ -452,7 +470,7 @@ func (h elbInstanceHealer) describeLoadBalancers(names []string) ([]string, erro
 }
 
 func (h elbInstanceHealer) describeInstancesHealth(lb string) ([]elbInstance, error) {
-	resp, err := getELBEndpoint().DescribeInstanceHealth(lb)
+	resp, err := elb.Client().DescribeInstanceHealth(lb)
 	if err != nil {
 		return nil, err
 	}
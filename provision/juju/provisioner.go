@@ -7,15 +7,18 @@ package juju
 import (
 	"bufio"
 	"bytes"
-	"errors"
+	stderrors "errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/app"
 	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
 	"github.com/globocom/tsuru/repository"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/elb"
 	"github.com/globocom/tsuru/safe"
 	"io"
 	"labix.org/v2/mgo"
@@ -81,7 +84,7 @@ func (p *JujuProvisioner) Provision(app provision.App) error {
 	var buf bytes.Buffer
 	charms, err := config.GetString("juju:charms-path")
 	if err != nil {
-		return errors.New(`Setting "juju:charms-path" is not defined.`)
+		return stderrors.New(`Setting "juju:charms-path" is not defined.`)
 	}
 	args := []string{
 		"deploy", "--repository", charms,
@@ -98,7 +101,7 @@ func (p *JujuProvisioner) Provision(app provision.App) error {
 	}
 	runCmd(true, &buf, &buf, setOption...)
 	if p.elbSupport() {
-		if err = p.LoadBalancer().Create(app); err != nil {
+		if err = p.LoadBalancer().AddBackend(app.GetName()); err != nil {
 			return err
 		}
 		p.enqueueUnits(app.GetName())
@@ -106,11 +109,32 @@ func (p *JujuProvisioner) Provision(app provision.App) error {
 	return nil
 }
 
+// Restart runs the restart hook in the machines of all started units of the
+// app. Units that are not started are skipped, unless the app has only one
+// unit.
 func (p *JujuProvisioner) Restart(app provision.App) error {
+	units := app.ProvisionUnits()
+	for _, unit := range units {
+		if len(units) > 1 && unit.GetStatus() != provision.StatusStarted {
+			continue
+		}
+		var buf bytes.Buffer
+		err := p.executeCommandOnUnit(&buf, &buf, unit, "/var/lib/tsuru/hooks/restart", restartArgs(unit)...)
+		if err != nil {
+			msg := fmt.Sprintf("Failed to restart the app (%s): %s", err, buf.String())
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: buf.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// RestartUnit runs the restart hook in the machine of the given unit.
+func (p *JujuProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
 	var buf bytes.Buffer
-	err := p.ExecuteCommand(&buf, &buf, app, "/var/lib/tsuru/hooks/restart")
+	err := p.executeCommandOnUnit(&buf, &buf, unit, "/var/lib/tsuru/hooks/restart", restartArgs(unit)...)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to restart the app (%s): %s", err, buf.String())
+		msg := fmt.Sprintf("Failed to restart the unit %s (%s): %s", unit.GetName(), err, buf.String())
 		app.Log(msg, "tsuru-provisioner")
 		return &provision.Error{Reason: buf.String(), Err: err}
 	}
@@ -178,7 +202,7 @@ func (p *JujuProvisioner) Destroy(app provision.App) error {
 		return err
 	}
 	if p.elbSupport() {
-		err = p.LoadBalancer().Destroy(app)
+		err = p.LoadBalancer().RemoveBackend(app.GetName())
 	}
 	go p.terminateMachines(app)
 	p.deleteUnits(app)
@@ -195,9 +219,16 @@ func setOption(serviceName, key, value string) error {
 	return nil
 }
 
-func (p *JujuProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+// AddUnits adds n units to the app, running all its processes. Units of a
+// single process type are not supported: juju starts all units of a service in
+// the same way, so they would run every process until restarted.
+func (p *JujuProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
 	if n < 1 {
-		return nil, errors.New("Cannot add zero units.")
+		return nil, stderrors.New("Cannot add zero units.")
+	}
+	if process != "" {
+		msg := "The juju provisioner does not support units of a single process type."
+		return nil, &errors.ValidationError{Message: msg}
 	}
 	var (
 		buf   bytes.Buffer
@@ -256,12 +287,8 @@ func (p *JujuProvisioner) removeUnit(app provision.App, unit provision.AppUnit)
 	if err != nil {
 		return cmdError(buf.String(), err, cmd)
 	}
-	if p.elbSupport() {
-		pUnit := provision.Unit{
-			Name:       unit.GetName(),
-			InstanceId: unit.GetInstanceId(),
-		}
-		err = p.LoadBalancer().Deregister(app, pUnit)
+	if p.elbSupport() && provision.IsWebProcess(unit.GetProcessName()) {
+		err = p.LoadBalancer().RemoveRoute(app.GetName(), unit.GetInstanceId())
 	}
 	conn, collection := p.unitsCollection()
 	defer conn.Close()
@@ -284,7 +311,6 @@ func (p *JujuProvisioner) RemoveUnit(app provision.App, name string) error {
 }
 
 func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
-	arguments := []string{"ssh", "-o", "StrictHostKeyChecking no", "-q"}
 	units := app.ProvisionUnits()
 	length := len(units)
 	for i, unit := range units {
@@ -299,11 +325,7 @@ func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 				continue
 			}
 		}
-		var cmdargs []string
-		cmdargs = append(cmdargs, arguments...)
-		cmdargs = append(cmdargs, strconv.Itoa(unit.GetMachine()), cmd)
-		cmdargs = append(cmdargs, args...)
-		err := runCmd(true, stdout, stderr, cmdargs...)
+		err := p.executeCommandOnUnit(stdout, stderr, unit, cmd, args...)
 		fmt.Fprintln(stdout)
 		if err != nil {
 			return err
@@ -312,6 +334,24 @@ func (p *JujuProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision
 	return nil
 }
 
+// restartArgs returns the arguments of the restart hook for the given unit:
+// the name of the process type run by the unit, if any.
+func restartArgs(unit provision.AppUnit) []string {
+	if name := unit.GetProcessName(); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// executeCommandOnUnit runs a command in the machine of the given unit, using
+// juju ssh.
+func (p *JujuProvisioner) executeCommandOnUnit(stdout, stderr io.Writer, unit provision.AppUnit, cmd string, args ...string) error {
+	cmdargs := []string{"ssh", "-o", "StrictHostKeyChecking no", "-q"}
+	cmdargs = append(cmdargs, strconv.Itoa(unit.GetMachine()), cmd)
+	cmdargs = append(cmdargs, args...)
+	return runCmd(true, stdout, stderr, cmdargs...)
+}
+
 func (p *JujuProvisioner) getOutput() (jujuOutput, error) {
 	output, err := execWithTimeout(30e9, "juju", "status")
 	if err != nil {
@@ -388,10 +428,9 @@ func (p *JujuProvisioner) heal(units []provision.Unit) {
 			format := "[juju] instance-id of unit %q changed from %q to %q. Healing."
 			log.Printf(format, unit.Name, inst.InstanceId, unit.InstanceId)
 			if p.elbSupport() {
-				a := qApp{unit.AppName}
-				manager := p.LoadBalancer()
-				manager.Deregister(&a, provision.Unit{InstanceId: inst.InstanceId})
-				err := manager.Register(&a, provision.Unit{InstanceId: unit.InstanceId})
+				r := p.LoadBalancer()
+				r.RemoveRoute(unit.AppName, inst.InstanceId)
+				err := r.AddRoute(unit.AppName, unit.InstanceId)
 				if err != nil {
 					format := "[juju] Could not register instance %q in the load balancer: %s."
 					log.Printf(format, unit.InstanceId, err)
@@ -422,7 +461,7 @@ func (p *JujuProvisioner) CollectStatus() ([]provision.Unit, error) {
 
 func (p *JujuProvisioner) Addr(app provision.App) (string, error) {
 	if p.elbSupport() {
-		return p.LoadBalancer().Addr(app)
+		return p.LoadBalancer().Addr(app.GetName())
 	}
 	units := app.ProvisionUnits()
 	if len(units) < 1 {
@@ -431,9 +470,24 @@ func (p *JujuProvisioner) Addr(app provision.App) (string, error) {
 	return units[0].GetIp(), nil
 }
 
-func (p *JujuProvisioner) LoadBalancer() *ELBManager {
+// LoadBalancer returns the router used for balancing requests between the
+// units of apps, or nil if juju:use-elb is false.
+func (p *JujuProvisioner) LoadBalancer() router.Router {
+	if p.elbSupport() {
+		r, err := router.Get("elb")
+		if err != nil {
+			log.Fatalf("FATAL: %s.", err)
+		}
+		return r
+	}
+	return nil
+}
+
+// SetCName sets the cname of the app in its load balancer. Without ELB there
+// is nothing to do, as the cname points directly to the unit.
+func (p *JujuProvisioner) SetCName(app provision.App, cname string) error {
 	if p.elbSupport() {
-		return &ELBManager{}
+		return p.LoadBalancer().SetCName(cname, app.GetName())
 	}
 	return nil
 }
@@ -6,9 +6,10 @@ package juju
 
 import (
 	"bytes"
-	"errors"
+	stderrors "errors"
 	"github.com/globocom/commandmocker"
 	"github.com/globocom/config"
+	"github.com/globocom/tsuru/errors"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/repository"
 	"github.com/globocom/tsuru/testing"
@@ -121,6 +122,49 @@ func (s *S) TestRestartFailure(c *gocheck.C) {
 	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
 }
 
+func (s *S) TestRestartUnit(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", "restart")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 3)
+	p := JujuProvisioner{}
+	err = p.RestartUnit(app, app.ProvisionUnits()[1])
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "2", "/var/lib/tsuru/hooks/restart",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRestartUnitWithProcess(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", "restart")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := JujuProvisioner{}
+	unit := testing.FakeUnit{Name: "cribcaged/1", Machine: 2, ProcessName: "worker"}
+	err = p.RestartUnit(app, &unit)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"ssh", "-o", "StrictHostKeyChecking no", "-q", "2", "/var/lib/tsuru/hooks/restart", "worker",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRestartUnitFailure(c *gocheck.C) {
+	tmpdir, err := commandmocker.Error("juju", "juju failed to run command", 25)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := JujuProvisioner{}
+	err = p.RestartUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.NotNil)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(pErr.Reason, gocheck.Equals, "juju failed to run command\n")
+	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
+}
+
 func (s *S) TestDestroy(c *gocheck.C) {
 	tmpdir, err := commandmocker.Add("juju", "$*")
 	c.Assert(err, gocheck.IsNil)
@@ -188,7 +232,7 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	defer commandmocker.Remove(tmpdir)
 	app := testing.NewFakeApp("resist", "rush", 0)
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(app, 4)
+	units, err := p.AddUnits(app, 4, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(units, gocheck.HasLen, 4)
 	names := make([]string, len(units))
@@ -206,9 +250,24 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 }
 
+func (s *S) TestAddUnitsWithProcess(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("juju", addUnitsOutput)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("resist", "rush", 0)
+	p := JujuProvisioner{}
+	units, err := p.AddUnits(app, 4, "worker")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.ValidationError)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Message, gocheck.Equals, "The juju provisioner does not support units of a single process type.")
+	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, false)
+}
+
 func (s *S) TestAddZeroUnits(c *gocheck.C) {
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(nil, 0)
+	units, err := p.AddUnits(nil, 0, "")
 	c.Assert(units, gocheck.IsNil)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add zero units.")
@@ -220,7 +279,7 @@ func (s *S) TestAddUnitsFailure(c *gocheck.C) {
 	defer commandmocker.Remove(tmpdir)
 	app := testing.NewFakeApp("headlong", "rush", 1)
 	p := JujuProvisioner{}
-	units, err := p.AddUnits(app, 1)
+	units, err := p.AddUnits(app, 1, "")
 	c.Assert(units, gocheck.IsNil)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*provision.Error)
@@ -648,7 +707,7 @@ func (s *S) TestExecWithTimeout(c *gocheck.C) {
 			cmd:     []string{"sleep", "2"},
 			timeout: 1e6,
 			out:     "",
-			err:     errors.New(`"sleep 2" ran for more than 1ms.`),
+			err:     stderrors.New(`"sleep 2" ran for more than 1ms.`),
 		},
 		{
 			cmd:     []string{"python", "-c", "import time; time.sleep(1); print 'hello world!'"},
@@ -660,7 +719,7 @@ func (s *S) TestExecWithTimeout(c *gocheck.C) {
 			cmd:     []string{"python", "-c", "import sys; print 'hello world!'; exit(1)"},
 			timeout: 5e9,
 			out:     "hello world!\n",
-			err:     errors.New("exit status 1"),
+			err:     stderrors.New("exit status 1"),
 		},
 	}
 	for _, d := range data {
@@ -732,8 +791,8 @@ func (s *ELBSuite) TestProvisionWithELB(c *gocheck.C) {
 	err = p.Provision(app)
 	c.Assert(err, gocheck.IsNil)
 	lb := p.LoadBalancer()
-	defer lb.Destroy(app)
-	addr, err := lb.Addr(app)
+	defer lb.RemoveBackend(app.GetName())
+	addr, err := lb.Addr(app.GetName())
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(addr, gocheck.Not(gocheck.Equals), "")
 	msg, err := getQueue(queueName).Get(1e9)
@@ -756,8 +815,8 @@ func (s *ELBSuite) TestDestroyWithELB(c *gocheck.C) {
 	err = p.Destroy(app)
 	c.Assert(err, gocheck.IsNil)
 	lb := p.LoadBalancer()
-	defer lb.Destroy(app) // sanity
-	addr, err := lb.Addr(app)
+	defer lb.RemoveBackend(app.GetName()) // sanity
+	addr, err := lb.Addr(app.GetName())
 	c.Assert(addr, gocheck.Equals, "")
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "not found")
@@ -777,7 +836,7 @@ func (s *ELBSuite) TestAddUnitsWithELB(c *gocheck.C) {
 	defer commandmocker.Remove(tmpdir)
 	app := testing.NewFakeApp("resist", "rush", 0)
 	p := JujuProvisioner{}
-	_, err = p.AddUnits(app, 4)
+	_, err = p.AddUnits(app, 4, "")
 	c.Assert(err, gocheck.IsNil)
 	expected := []string{
 		"resist", "resist/3", "resist/4",
@@ -806,14 +865,15 @@ func (s *ELBSuite) TestRemoveUnitWithELB(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer commandmocker.Remove(tmpdir)
 	app := testing.NewFakeApp("radio", "rush", 4)
-	manager := ELBManager{}
-	manager.e = s.client
-	err = manager.Create(app)
-	c.Assert(err, gocheck.IsNil)
-	defer manager.Destroy(app)
-	err = manager.Register(app, units...)
-	c.Assert(err, gocheck.IsNil)
 	p := JujuProvisioner{}
+	lb := p.LoadBalancer()
+	err = lb.AddBackend(app.GetName())
+	c.Assert(err, gocheck.IsNil)
+	defer lb.RemoveBackend(app.GetName())
+	for _, unit := range units {
+		err = lb.AddRoute(app.GetName(), unit.InstanceId)
+		c.Assert(err, gocheck.IsNil)
+	}
 	fUnit := testing.FakeUnit{Name: units[0].Name, InstanceId: units[0].InstanceId}
 	err = p.removeUnit(app, &fUnit)
 	c.Assert(err, gocheck.IsNil)
@@ -829,9 +889,9 @@ func (s *ELBSuite) TestCollectStatusWithELBAndIDChange(c *gocheck.C) {
 	a := testing.NewFakeApp("symfonia", "symfonia", 0)
 	p := JujuProvisioner{}
 	lb := p.LoadBalancer()
-	err := lb.Create(a)
+	err := lb.AddBackend(a.GetName())
 	c.Assert(err, gocheck.IsNil)
-	defer lb.Destroy(a)
+	defer lb.RemoveBackend(a.GetName())
 	id1 := s.server.NewInstance()
 	defer s.server.RemoveInstance(id1)
 	id2 := s.server.NewInstance()
@@ -842,7 +902,10 @@ func (s *ELBSuite) TestCollectStatusWithELBAndIDChange(c *gocheck.C) {
 	defer conn.Close()
 	err = collection.Insert(instance{UnitName: "symfonia/0", InstanceId: id3})
 	c.Assert(err, gocheck.IsNil)
-	err = lb.Register(a, provision.Unit{InstanceId: id3}, provision.Unit{InstanceId: id2})
+	err = lb.AddRoute(a.GetName(), id3)
+	c.Assert(err, gocheck.IsNil)
+	err = lb.AddRoute(a.GetName(), id2)
+	c.Assert(err, gocheck.IsNil)
 	q := bson.M{"_id": bson.M{"$in": []string{"symfonia/0", "symfonia/1", "symfonia/2", "raise/0"}}}
 	defer collection.Remove(q)
 	output := strings.Replace(simpleCollectOutput, "i-00004444", id1, 1)
@@ -883,12 +946,12 @@ func (s *ELBSuite) TestAddrWithELB(c *gocheck.C) {
 	app := testing.NewFakeApp("jimmy", "who", 0)
 	p := JujuProvisioner{}
 	lb := p.LoadBalancer()
-	err := lb.Create(app)
+	err := lb.AddBackend(app.GetName())
 	c.Assert(err, gocheck.IsNil)
-	defer lb.Destroy(app)
+	defer lb.RemoveBackend(app.GetName())
 	addr, err := p.Addr(app)
 	c.Assert(err, gocheck.IsNil)
-	lAddr, err := lb.Addr(app)
+	lAddr, err := lb.Addr(app.GetName())
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(addr, gocheck.Equals, lAddr)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
 	"github.com/globocom/tsuru/queue"
+	"github.com/globocom/tsuru/router"
 	"sort"
 	"sync"
 )
@@ -17,14 +18,6 @@ const (
 	queueName             = "tsuru-provision-juju"
 )
 
-type qApp struct {
-	name string
-}
-
-func (a *qApp) GetName() string {
-	return a.name
-}
-
 func handle(msg *queue.Message) {
 	if msg.Action == addUnitToLoadBalancer {
 		if len(msg.Args) < 1 {
@@ -32,7 +25,7 @@ func handle(msg *queue.Message) {
 			msg.Delete()
 			return
 		}
-		a := qApp{name: msg.Args[0]}
+		appName := msg.Args[0]
 		unitNames := msg.Args[1:]
 		sort.Strings(unitNames)
 		status, err := (&JujuProvisioner{}).collectStatus()
@@ -42,7 +35,7 @@ func handle(msg *queue.Message) {
 		}
 		var units []provision.Unit
 		for _, u := range status {
-			if u.AppName != a.name {
+			if u.AppName != appName {
 				continue
 			}
 			n := sort.SearchStrings(unitNames, u.Name)
@@ -68,11 +61,20 @@ func handle(msg *queue.Message) {
 		if len(noId) == len(units) {
 			getQueue(queueName).Release(msg, 0)
 		} else {
-			manager := ELBManager{}
-			manager.Register(&a, ok...)
+			r, err := router.Get("elb")
+			if err != nil {
+				log.Printf("Failed to handle %q: %s", msg.Action, err)
+				msg.Delete()
+				return
+			}
+			for _, u := range ok {
+				if err := r.AddRoute(appName, u.InstanceId); err != nil {
+					log.Printf("[juju] Could not register instance %q in the load balancer: %s.", u.InstanceId, err)
+				}
+			}
 			msg.Delete()
 			if len(noId) > 0 {
-				args := []string{a.name}
+				args := []string{appName}
 				args = append(args, noId...)
 				msg := queue.Message{
 					Action: msg.Action,
@@ -54,9 +54,10 @@ func (c *container) ip() string {
 			log.Print("dnsmasq.leases")
 			log.Print(string(data))
 			for _, line := range strings.Split(string(data), "\n") {
-				if strings.Index(line, c.name) != -1 {
+				fields := strings.Fields(line)
+				if len(fields) > 3 && fields[3] == c.name {
 					log.Printf("ip in %s", line)
-					return strings.Split(line, " ")[2]
+					return fields[2]
 				}
 			}
 		case <-quit:
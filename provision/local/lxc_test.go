@@ -77,6 +77,8 @@ func (s *S) TestContainerIP(c *gocheck.C) {
 	f.Close()
 	cont := container{name: "vm1"}
 	c.Assert(cont.ip(), gocheck.Equals, "10.10.10.10")
+	cont = container{name: "myapp-1"}
+	c.Assert(cont.ip(), gocheck.Equals, "10.10.10.16")
 	cont = container{name: "notfound"}
 	c.Assert(cont.ip(), gocheck.Equals, "")
 }
@@ -6,23 +6,42 @@ package local
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/db"
 	"github.com/globocom/tsuru/log"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	_ "github.com/globocom/tsuru/router/nginx"
 	"io"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 func init() {
 	provision.Register("local", &LocalProvisioner{})
 }
 
+// nameMut prevents two containers of the same app from getting the same name.
+var nameMut sync.Mutex
+
 type LocalProvisioner struct{}
 
+// router returns the router used by the local provisioner, defined in the
+// setting local:router. The default router is nginx.
+func (p *LocalProvisioner) router() (router.Router, error) {
+	name, err := config.GetString("local:router")
+	if err != nil {
+		name = "nginx"
+	}
+	return router.Get(name)
+}
+
 func (p *LocalProvisioner) setup(ip, framework string) error {
 	formulasPath, err := config.GetString("local:formulas-path")
 	if err != nil {
@@ -68,85 +87,149 @@ func (p *LocalProvisioner) install(ip string) error {
 	return nil
 }
 
-func (p *LocalProvisioner) start(ip string) error {
-	cmd := exec.Command("ssh", "-q", "-o", "StrictHostKeyChecking no", "-l", "ubuntu", ip, "sudo /var/lib/tsuru/hooks/start")
+// start runs the start hook in the given container. If process is not empty,
+// only the given process type is started.
+func (p *LocalProvisioner) start(ip, process string) error {
+	hook := "sudo /var/lib/tsuru/hooks/start"
+	if process != "" {
+		hook += " " + process
+	}
+	cmd := exec.Command("ssh", "-q", "-o", "StrictHostKeyChecking no", "-l", "ubuntu", ip, hook)
 	return cmd.Run()
 }
 
-func (p *LocalProvisioner) Provision(app provision.App) error {
-	go func(p *LocalProvisioner, app provision.App) {
-		c := container{name: app.GetName()}
-		log.Printf("creating container %s", c.name)
-		u := provision.Unit{
-			Name:       app.GetName(),
-			AppName:    app.GetName(),
-			Type:       app.GetFramework(),
-			Machine:    0,
-			InstanceId: app.GetName(),
-			Status:     provision.StatusCreating,
-			Ip:         "",
-		}
-		log.Printf("inserting container unit %s in the database", app.GetName())
-		err := p.collection().Insert(u)
-		if err != nil {
-			log.Print(err)
-		}
-		err = c.create()
-		if err != nil {
-			log.Printf("error on create container %s", app.GetName())
-			log.Print(err)
-		}
-		err = c.start()
-		if err != nil {
-			log.Printf("error on start container %s", app.GetName())
-			log.Print(err)
-		}
-		ip := c.ip()
-		u.Ip = ip
-		u.Status = provision.StatusInstalling
-		err = p.collection().Update(bson.M{"name": u.Name}, u)
-		if err != nil {
-			log.Print(err)
-		}
-		err = p.setup(ip, app.GetFramework())
-		if err != nil {
-			log.Printf("error on setup container %s", app.GetName())
-			log.Print(err)
+// newContainer creates a new container for the app, running the given process
+// type, with a unique name, and stores its unit in the database. The container
+// is not created in lxc, it's up to deploy to create and start it.
+func (p *LocalProvisioner) newContainer(app provision.App, process string) (container, provision.Unit, error) {
+	nameMut.Lock()
+	defer nameMut.Unlock()
+	var units []provision.Unit
+	err := p.collection().Find(bson.M{"appname": app.GetName()}).All(&units)
+	if err != nil {
+		return container{}, provision.Unit{}, err
+	}
+	next := 0
+	prefix := app.GetName() + "-"
+	for _, u := range units {
+		if !strings.HasPrefix(u.Name, prefix) {
+			continue
 		}
-		err = p.install(ip)
-		if err != nil {
-			log.Printf("error on install container %s", app.GetName())
-			log.Print(err)
+		if n, err := strconv.Atoi(u.Name[len(prefix):]); err == nil && n >= next {
+			next = n + 1
 		}
-		err = p.start(ip)
-		if err != nil {
-			log.Printf("error on start app for container %s", app.GetName())
-			log.Print(err)
+	}
+	c := container{name: prefix + strconv.Itoa(next)}
+	u := provision.Unit{
+		Name:        c.name,
+		AppName:     app.GetName(),
+		Type:        app.GetFramework(),
+		Machine:     0,
+		InstanceId:  c.name,
+		Status:      provision.StatusCreating,
+		Ip:          "",
+		ProcessName: process,
+	}
+	log.Printf("inserting container unit %s in the database", u.Name)
+	err = p.collection().Insert(u)
+	return c, u, err
+}
+
+// deploy creates and starts the given container, installing the app's
+// framework in it and adding it to the router.
+func (p *LocalProvisioner) deploy(c container, u provision.Unit, app provision.App) {
+	log.Printf("creating container %s", c.name)
+	err := c.create()
+	if err != nil {
+		log.Printf("error on create container %s", c.name)
+		log.Print(err)
+	}
+	err = c.start()
+	if err != nil {
+		log.Printf("error on start container %s", c.name)
+		log.Print(err)
+	}
+	ip := c.ip()
+	u.Ip = ip
+	u.Status = provision.StatusInstalling
+	err = p.collection().Update(bson.M{"name": u.Name}, u)
+	if err != nil {
+		log.Print(err)
+	}
+	err = p.setup(ip, app.GetFramework())
+	if err != nil {
+		log.Printf("error on setup container %s", c.name)
+		log.Print(err)
+	}
+	err = p.install(ip)
+	if err != nil {
+		log.Printf("error on install container %s", c.name)
+		log.Print(err)
+	}
+	err = p.start(ip, u.ProcessName)
+	if err != nil {
+		log.Printf("error on start app for container %s", c.name)
+		log.Print(err)
+	}
+	if provision.IsWebProcess(u.ProcessName) {
+		r, err := p.router()
+		if err == nil {
+			err = r.AddRoute(app.GetName(), ip)
 		}
-		err = AddRoute(app.GetName(), ip)
 		if err != nil {
-			log.Printf("error on add route for %s with ip %s", app.GetName(), ip)
+			log.Printf("error on add route for %s", app.GetName())
 			log.Print(err)
 		}
-		err = RestartRouter()
-		if err != nil {
-			log.Printf("error on restart router")
-			log.Print(err)
+	}
+	u.Status = provision.StatusStarted
+	err = p.collection().Update(bson.M{"name": u.Name}, u)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (p *LocalProvisioner) Provision(app provision.App) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if err = r.AddBackend(app.GetName()); err != nil {
+		return err
+	}
+	c, u, err := p.newContainer(app, "")
+	if err != nil {
+		return err
+	}
+	go p.deploy(c, u, app)
+	return nil
+}
+
+// Restart runs the restart hook in the containers of all started units of the
+// app. Units that are not started are skipped, unless the app has only one
+// unit.
+func (p *LocalProvisioner) Restart(app provision.App) error {
+	units := app.ProvisionUnits()
+	for _, unit := range units {
+		if len(units) > 1 && unit.GetStatus() != provision.StatusStarted {
+			continue
 		}
-		u.Status = provision.StatusStarted
-		err = p.collection().Update(bson.M{"name": u.Name}, u)
+		var buf bytes.Buffer
+		err := executeCommandOnUnit(&buf, &buf, unit, "/var/lib/tsuru/hooks/restart", restartArgs(unit)...)
 		if err != nil {
-			log.Print(err)
+			msg := fmt.Sprintf("Failed to restart the app (%s): %s", err, buf.String())
+			app.Log(msg, "tsuru-provisioner")
+			return &provision.Error{Reason: buf.String(), Err: err}
 		}
-	}(p, app)
+	}
 	return nil
 }
 
-func (p *LocalProvisioner) Restart(app provision.App) error {
+// RestartUnit runs the restart hook in the container of the given unit.
+func (p *LocalProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
 	var buf bytes.Buffer
-	err := p.ExecuteCommand(&buf, &buf, app, "/var/lib/tsuru/hooks/restart")
+	err := executeCommandOnUnit(&buf, &buf, unit, "/var/lib/tsuru/hooks/restart", restartArgs(unit)...)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to restart the app (%s): %s", err, buf.String())
+		msg := fmt.Sprintf("Failed to restart the unit %s (%s): %s", unit.GetName(), err, buf.String())
 		app.Log(msg, "tsuru-provisioner")
 		return &provision.Error{Reason: buf.String(), Err: err}
 	}
@@ -154,48 +237,136 @@ func (p *LocalProvisioner) Restart(app provision.App) error {
 }
 
 func (p *LocalProvisioner) Destroy(app provision.App) error {
-	c := container{name: app.GetName()}
-	go func(c container) {
-		log.Printf("stoping container %s", c.name)
-		c.stop()
+	var units []provision.Unit
+	err := p.collection().Find(bson.M{"appname": app.GetName()}).All(&units)
+	if err != nil {
+		return err
+	}
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	if err = r.RemoveBackend(app.GetName()); err != nil {
+		log.Printf("error on remove backend for %s", app.GetName())
+		log.Print(err)
+	}
+	for _, u := range units {
+		go func(c container) {
+			log.Printf("stoping container %s", c.name)
+			c.stop()
 
-		log.Printf("destroying container %s", c.name)
-		c.destroy()
+			log.Printf("destroying container %s", c.name)
+			c.destroy()
 
-		log.Printf("removing container %s from the database", c.name)
-		p.collection().Remove(bson.M{"name": c.name})
-	}(c)
+			log.Printf("removing container %s from the database", c.name)
+			p.collection().Remove(bson.M{"name": c.name})
+		}(container{name: u.Name})
+	}
 	return nil
 }
 
-func (*LocalProvisioner) Addr(app provision.App) (string, error) {
-	units := app.ProvisionUnits()
-	return units[0].GetIp(), nil
+func (p *LocalProvisioner) Addr(app provision.App) (string, error) {
+	r, err := p.router()
+	if err != nil {
+		return "", err
+	}
+	return r.Addr(app.GetName())
 }
 
-func (*LocalProvisioner) AddUnits(app provision.App, units uint) ([]provision.Unit, error) {
-	return []provision.Unit{}, nil
+func (p *LocalProvisioner) SetCName(app provision.App, cname string) error {
+	r, err := p.router()
+	if err != nil {
+		return err
+	}
+	return r.SetCName(cname, app.GetName())
 }
 
-func (*LocalProvisioner) RemoveUnit(app provision.App, unitName string) error {
-	return nil
+func (p *LocalProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
+	if n < 1 {
+		return nil, errors.New("Cannot add zero units.")
+	}
+	units := make([]provision.Unit, n)
+	for i := uint(0); i < n; i++ {
+		c, u, err := p.newContainer(app, process)
+		if err != nil {
+			return nil, err
+		}
+		go p.deploy(c, u, app)
+		units[i] = u
+	}
+	return units, nil
 }
 
-func (*LocalProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
-	arguments := []string{"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no"}
-	arguments = append(arguments, app.ProvisionUnits()[0].GetIp())
-	arguments = append(arguments, cmd)
-	arguments = append(arguments, args...)
-	c := exec.Command("ssh", arguments...)
-	c.Stdout = stdout
-	c.Stderr = stderr
-	err := c.Run()
+func (p *LocalProvisioner) RemoveUnit(app provision.App, name string) error {
+	var u provision.Unit
+	err := p.collection().Find(bson.M{"name": name, "appname": app.GetName()}).One(&u)
+	if err != nil {
+		return fmt.Errorf("App %q does not have a unit named %q.", app.GetName(), name)
+	}
+	c := container{name: u.Name}
+	log.Printf("stoping container %s", c.name)
+	c.stop()
+	log.Printf("destroying container %s", c.name)
+	if err = c.destroy(); err != nil {
+		return err
+	}
+	log.Printf("removing container %s from the database", c.name)
+	if err = p.collection().Remove(bson.M{"name": c.name}); err != nil {
+		return err
+	}
+	if !provision.IsWebProcess(u.ProcessName) {
+		return nil
+	}
+	r, err := p.router()
 	if err != nil {
 		return err
 	}
+	return r.RemoveRoute(app.GetName(), u.Ip)
+}
+
+func (*LocalProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provision.App, cmd string, args ...string) error {
+	units := app.ProvisionUnits()
+	length := len(units)
+	for i, unit := range units {
+		if length > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "Output from unit %q:\n\n", unit.GetName())
+			if status := unit.GetStatus(); status != provision.StatusStarted {
+				fmt.Fprintf(stdout, "Unit state is %q, it must be %q for running commands.\n",
+					status, provision.StatusStarted)
+				continue
+			}
+		}
+		if err := executeCommandOnUnit(stdout, stderr, unit, cmd, args...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// restartArgs returns the arguments of the restart hook for the given unit:
+// the name of the process type run by the unit, if any.
+func restartArgs(unit provision.AppUnit) []string {
+	if name := unit.GetProcessName(); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// executeCommandOnUnit runs a command in the container of the given unit,
+// using ssh.
+func executeCommandOnUnit(stdout, stderr io.Writer, unit provision.AppUnit, cmd string, args ...string) error {
+	cmdargs := []string{"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no"}
+	cmdargs = append(cmdargs, unit.GetIp(), cmd)
+	cmdargs = append(cmdargs, args...)
+	c := exec.Command("ssh", cmdargs...)
+	c.Stdout = stdout
+	c.Stderr = stderr
+	return c.Run()
+}
+
 func (p *LocalProvisioner) CollectStatus() ([]provision.Unit, error) {
 	var units []provision.Unit
 	err := p.collection().Find(nil).All(&units)
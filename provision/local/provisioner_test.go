@@ -11,6 +11,8 @@ import (
 	"github.com/globocom/config"
 	fstesting "github.com/globocom/tsuru/fs/testing"
 	"github.com/globocom/tsuru/provision"
+	"github.com/globocom/tsuru/router"
+	rtesting "github.com/globocom/tsuru/router/testing"
 	"github.com/globocom/tsuru/testing"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
@@ -50,13 +52,13 @@ func (s *S) TestProvisionerProvision(c *gocheck.C) {
 	defer commandmocker.Remove(scpTempDir)
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
-	defer p.collection().Remove(bson.M{"name": "myapp"})
+	defer p.collection().Remove(bson.M{"name": "myapp-0"})
 	c.Assert(p.Provision(app), gocheck.IsNil)
 	ok := make(chan bool, 1)
 	go func() {
 		for {
 			coll := s.conn.Collection(s.collName)
-			ct, err := coll.Find(bson.M{"name": "myapp", "status": provision.StatusStarted}).Count()
+			ct, err := coll.Find(bson.M{"name": "myapp-0", "status": provision.StatusStarted}).Count()
 			if err != nil {
 				c.Fatal(err)
 			}
@@ -73,14 +75,16 @@ func (s *S) TestProvisionerProvision(c *gocheck.C) {
 		c.Fatal("Timed out waiting for the container to be provisioned (10 seconds)")
 	}
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
-	expected := "lxc-create -t ubuntu-cloud -n myapp -- -S somepath"
-	expected += "lxc-start --daemon -n myapp"
-	expected += "service nginx restart"
+	expected := "lxc-create -t ubuntu-cloud -n myapp-0 -- -S somepath"
+	expected += "lxc-start --daemon -n myapp-0"
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
 	var unit provision.Unit
-	err = s.conn.Collection(s.collName).Find(bson.M{"name": "myapp"}).One(&unit)
+	err = s.conn.Collection(s.collName).Find(bson.M{"name": "myapp-0"}).One(&unit)
 	c.Assert(err, gocheck.IsNil)
+	c.Assert(unit.AppName, gocheck.Equals, "myapp")
 	c.Assert(unit.Ip, gocheck.Equals, "10.10.10.15")
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, true)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.15"), gocheck.Equals, true)
 }
 
 func (s *S) TestProvisionerRestart(c *gocheck.C) {
@@ -113,6 +117,35 @@ func (s *S) TestProvisionerRestartFailure(c *gocheck.C) {
 	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
 }
 
+func (s *S) TestProvisionerRestartUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	tmpdir, err := commandmocker.Add("ssh", "ok")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	unit := app.ProvisionUnits()[1]
+	err = p.RestartUnit(app, unit)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{
+		"-l", "ubuntu", "-q", "-o", "StrictHostKeyChecking no", unit.GetIp(), "/var/lib/tsuru/hooks/restart",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestProvisionerRestartUnitFailure(c *gocheck.C) {
+	tmpdir, err := commandmocker.Error("ssh", "fatal unexpected failure", 25)
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("cribcaged", "python", 1)
+	p := LocalProvisioner{}
+	err = p.RestartUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.NotNil)
+	pErr, ok := err.(*provision.Error)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(pErr.Reason, gocheck.Equals, "fatal unexpected failure")
+	c.Assert(pErr.Err.Error(), gocheck.Equals, "exit status 25")
+}
+
 func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	config.Set("local:authorized-key-path", "somepath")
 	rfs := &fstesting.RecordingFs{}
@@ -144,7 +177,7 @@ func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	go func() {
 		for {
 			coll := s.conn.Collection(s.collName)
-			ct, err := coll.Find(bson.M{"name": "myapp", "status": provision.StatusStarted}).Count()
+			ct, err := coll.Find(bson.M{"name": "myapp-0", "status": provision.StatusStarted}).Count()
 			if err != nil {
 				c.Fatal(err)
 			}
@@ -164,7 +197,7 @@ func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 	go func() {
 		for {
 			coll := s.conn.Collection(s.collName)
-			ct, err := coll.Find(bson.M{"name": "myapp", "status": provision.StatusStarted}).Count()
+			ct, err := coll.Find(bson.M{"name": "myapp-0", "status": provision.StatusStarted}).Count()
 			if err != nil {
 				c.Fatal(err)
 			}
@@ -181,38 +214,196 @@ func (s *S) TestProvisionerDestroy(c *gocheck.C) {
 		c.Fatal("Timed out waiting for the container to be provisioned (10 seconds)")
 	}
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
-	expected := "lxc-create -t ubuntu-cloud -n myapp -- -S somepath"
-	expected += "lxc-start --daemon -n myapp"
-	expected += "service nginx restart"
-	expected += "lxc-stop -n myapp"
-	expected += "lxc-destroy -n myapp"
+	expected := "lxc-create -t ubuntu-cloud -n myapp-0 -- -S somepath"
+	expected += "lxc-start --daemon -n myapp-0"
+	expected += "lxc-stop -n myapp-0"
+	expected += "lxc-destroy -n myapp-0"
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
-	length, err := p.collection().Find(bson.M{"name": "myapp"}).Count()
+	length, err := p.collection().Find(bson.M{"appname": "myapp"}).Count()
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(length, gocheck.Equals, 0)
+	c.Assert(rtesting.FakeRouter.HasBackend("myapp"), gocheck.Equals, false)
 }
 
 func (s *S) TestProvisionerAddr(c *gocheck.C) {
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 1)
+	err := rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
 	addr, err := p.Addr(app)
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(addr, gocheck.Equals, app.ProvisionUnits()[0].GetIp())
+	c.Assert(addr, gocheck.Equals, "myapp.fakerouter.com")
+}
+
+func (s *S) TestProvisionerAddrWithoutBackend(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	addr, err := p.Addr(app)
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.Equals, rtesting.ErrBackendNotFound)
+}
+
+func (s *S) TestProvisionerUsesNginxByDefault(c *gocheck.C) {
+	config.Unset("local:router")
+	defer config.Set("local:router", "fake")
+	var p LocalProvisioner
+	r, err := p.router()
+	c.Assert(err, gocheck.IsNil)
+	nginx, err := router.Get("nginx")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, nginx)
+}
+
+func (s *S) TestProvisionerSetCName(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 1)
+	err := rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	err = p.SetCName(app, "myapp.mycompany.com")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(rtesting.FakeRouter.CName("myapp"), gocheck.Equals, "myapp.mycompany.com")
 }
 
 func (s *S) TestProvisionerAddUnits(c *gocheck.C) {
+	config.Set("local:authorized-key-path", "somepath")
+	rfs := &fstesting.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	f, _ := os.Open("testdata/dnsmasq.leases")
+	data, err := ioutil.ReadAll(f)
+	c.Assert(err, gocheck.IsNil)
+	file, err := rfs.Create("/var/lib/misc/dnsmasq.leases")
+	c.Assert(err, gocheck.IsNil)
+	_, err = file.Write(data)
+	c.Assert(err, gocheck.IsNil)
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	sshTempDir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(sshTempDir)
+	scpTempDir, err := commandmocker.Add("scp", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(scpTempDir)
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err = rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	units, err := p.AddUnits(app, 2, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	c.Assert(units[0].Name, gocheck.Equals, "myapp-0")
+	c.Assert(units[0].Status, gocheck.Equals, provision.StatusCreating)
+	c.Assert(units[1].Name, gocheck.Equals, "myapp-1")
+	c.Assert(units[1].Status, gocheck.Equals, provision.StatusCreating)
+	ok := make(chan bool, 1)
+	go func() {
+		for {
+			coll := s.conn.Collection(s.collName)
+			ct, err := coll.Find(bson.M{"appname": "myapp", "status": provision.StatusStarted}).Count()
+			if err != nil {
+				c.Fatal(err)
+			}
+			if ct == 2 {
+				ok <- true
+				return
+			}
+			time.Sleep(1e3)
+		}
+	}()
+	select {
+	case <-ok:
+	case <-time.After(10e9):
+		c.Fatal("Timed out waiting for the containers to be provisioned (10 seconds)")
+	}
+	var unit provision.Unit
+	err = s.conn.Collection(s.collName).Find(bson.M{"name": "myapp-1"}).One(&unit)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(unit.Ip, gocheck.Equals, "10.10.10.16")
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.15"), gocheck.Equals, true)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.16"), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerAddZeroUnits(c *gocheck.C) {
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
-	units, err := p.AddUnits(app, 2)
+	units, err := p.AddUnits(app, 0, "")
+	c.Assert(units, gocheck.IsNil)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Cannot add zero units.")
+}
+
+func (s *S) TestProvisionerAddUnitsUsesUniqueNames(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err := p.collection().Insert(
+		provision.Unit{Name: "myapp-0", AppName: "myapp"},
+		provision.Unit{Name: "myapp-3", AppName: "myapp"},
+		provision.Unit{Name: "myapp-other-7", AppName: "myapp-other"},
+	)
+	c.Assert(err, gocheck.IsNil)
+	cont, unit, err := p.newContainer(app, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cont.name, gocheck.Equals, "myapp-4")
+	c.Assert(unit.Name, gocheck.Equals, "myapp-4")
+	c.Assert(unit.AppName, gocheck.Equals, "myapp")
+	c.Assert(unit.Status, gocheck.Equals, provision.StatusCreating)
+	n, err := p.collection().Find(bson.M{"name": "myapp-4"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+}
+
+func (s *S) TestProvisionerNewContainerWithProcess(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	_, unit, err := p.newContainer(app, "worker")
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(units, gocheck.DeepEquals, []provision.Unit{})
+	c.Assert(unit.ProcessName, gocheck.Equals, "worker")
+	var stored provision.Unit
+	err = p.collection().Find(bson.M{"name": unit.Name}).One(&stored)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(stored.ProcessName, gocheck.Equals, "worker")
 }
 
 func (s *S) TestProvisionerRemoveUnit(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
 	var p LocalProvisioner
 	app := testing.NewFakeApp("myapp", "python", 0)
-	err := p.RemoveUnit(app, "")
+	defer p.collection().RemoveAll(bson.M{"appname": "myapp"})
+	err = p.collection().Insert(
+		provision.Unit{Name: "myapp-0", AppName: "myapp", Ip: "10.10.10.15", Status: provision.StatusStarted},
+		provision.Unit{Name: "myapp-1", AppName: "myapp", Ip: "10.10.10.16", Status: provision.StatusStarted},
+	)
+	c.Assert(err, gocheck.IsNil)
+	err = rtesting.FakeRouter.AddBackend("myapp")
+	c.Assert(err, gocheck.IsNil)
+	rtesting.FakeRouter.AddRoute("myapp", "10.10.10.15")
+	rtesting.FakeRouter.AddRoute("myapp", "10.10.10.16")
+	err = p.RemoveUnit(app, "myapp-0")
+	c.Assert(err, gocheck.IsNil)
+	expected := "lxc-stop -n myapp-0"
+	expected += "lxc-destroy -n myapp-0"
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, expected)
+	n, err := p.collection().Find(bson.M{"appname": "myapp"}).Count()
 	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.15"), gocheck.Equals, false)
+	c.Assert(rtesting.FakeRouter.HasRoute("myapp", "10.10.10.16"), gocheck.Equals, true)
+}
+
+func (s *S) TestProvisionerRemoveUnknownUnit(c *gocheck.C) {
+	var p LocalProvisioner
+	app := testing.NewFakeApp("myapp", "python", 0)
+	err := p.RemoveUnit(app, "myapp-9")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `App "myapp" does not have a unit named "myapp-9".`)
 }
 
 func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
@@ -224,9 +415,27 @@ func (s *S) TestProvisionerExecuteCommand(c *gocheck.C) {
 	app := testing.NewFakeApp("almah", "static", 2)
 	err = p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
 	c.Assert(err, gocheck.IsNil)
-	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", app.ProvisionUnits()[0].GetIp())
+	units := app.ProvisionUnits()
+	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", units[0].GetIp())
+	cmdOutput += fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", units[1].GetIp())
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
 	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+	c.Assert(buf.String(), gocheck.Matches, `(?s)Output from unit "almah/0":.*Output from unit "almah/1":.*`)
+}
+
+func (s *S) TestProvisionerExecuteCommandSkipsUnitsNotStarted(c *gocheck.C) {
+	var p LocalProvisioner
+	var buf bytes.Buffer
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	app := testing.NewFakeApp("almah", "static", 2)
+	app.SetUnitStatus(provision.StatusDown, 1)
+	err = p.ExecuteCommand(&buf, &buf, app, "ls", "-lh")
+	c.Assert(err, gocheck.IsNil)
+	cmdOutput := fmt.Sprintf("-l ubuntu -q -o StrictHostKeyChecking no %s ls -lh", app.ProvisionUnits()[0].GetIp())
+	c.Assert(commandmocker.Output(tmpdir), gocheck.Equals, cmdOutput)
+	c.Assert(buf.String(), gocheck.Matches, `(?s).*Unit state is "down", it must be "started" for running commands.*`)
 }
 
 func (s *S) TestCollectStatus(c *gocheck.C) {
@@ -291,7 +500,7 @@ func (s *S) TestProvisionStart(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	defer commandmocker.Remove(tmpdir)
 	p := LocalProvisioner{}
-	err = p.start("10.10.10.10")
+	err = p.start("10.10.10.10", "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(commandmocker.Ran(tmpdir), gocheck.Equals, true)
 	cmds := []string{
@@ -306,6 +515,25 @@ func (s *S) TestProvisionStart(c *gocheck.C) {
 	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, cmds)
 }
 
+func (s *S) TestProvisionStartProcess(c *gocheck.C) {
+	tmpdir, err := commandmocker.Add("ssh", "$*")
+	c.Assert(err, gocheck.IsNil)
+	defer commandmocker.Remove(tmpdir)
+	p := LocalProvisioner{}
+	err = p.start("10.10.10.10", "worker")
+	c.Assert(err, gocheck.IsNil)
+	cmds := []string{
+		"-q",
+		"-o",
+		"StrictHostKeyChecking no",
+		"-l",
+		"ubuntu",
+		"10.10.10.10",
+		"sudo /var/lib/tsuru/hooks/start worker",
+	}
+	c.Assert(commandmocker.Parameters(tmpdir), gocheck.DeepEquals, cmds)
+}
+
 func (s *S) TestProvisionSetup(c *gocheck.C) {
 	tmpdir, err := commandmocker.Add("scp", "$*")
 	c.Assert(err, gocheck.IsNil)
@@ -7,6 +7,7 @@ package local
 import (
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/db"
+	rtesting "github.com/globocom/tsuru/router/testing"
 	"launchpad.net/gocheck"
 	"testing"
 )
@@ -23,6 +24,7 @@ var _ = gocheck.Suite(&S{})
 func (s *S) SetUpSuite(c *gocheck.C) {
 	s.collName = "collName"
 	config.Set("local:collection", s.collName)
+	config.Set("local:router", "fake")
 	config.Set("database:url", "127.0.0.1:27017")
 	config.Set("database:name", "juju_provision_tests_s")
 	var err error
@@ -33,3 +35,7 @@ func (s *S) SetUpSuite(c *gocheck.C) {
 func (s *S) TearDownSuite(c *gocheck.C) {
 	s.conn.Collection(s.collName).Database.DropDatabase()
 }
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	rtesting.FakeRouter.Reset()
+}
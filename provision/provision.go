@@ -26,16 +26,31 @@ const (
 	StatusCreating   = Status("creating")
 )
 
+// WebProcess is the name of the process type that handles the HTTP requests
+// sent to the app. Only units running this process type, or all processes,
+// should be added to routers and load balancers.
+const WebProcess = "web"
+
+// IsWebProcess reports whether units running the given process type handle
+// HTTP requests. An empty name means all process types, including web.
+func IsWebProcess(name string) bool {
+	return name == "" || name == WebProcess
+}
+
 // Unit represents a provision unit. Can be a machine, container or anything
 // IP-addressable.
+//
+// ProcessName is the name of the process type, declared in the Procfile of the
+// app, that the unit runs. Units without a process name run all processes.
 type Unit struct {
-	Name       string
-	AppName    string
-	Type       string
-	InstanceId string
-	Machine    int
-	Ip         string
-	Status     Status
+	Name        string
+	AppName     string
+	Type        string
+	InstanceId  string
+	Machine     int
+	Ip          string
+	Status      Status
+	ProcessName string
 }
 
 // Named is something that has a name, providing the GetName method.
@@ -58,6 +73,9 @@ type AppUnit interface {
 
 	// Returns the instance id of the unit.
 	GetInstanceId() string
+
+	// Returns the name of the process type run by the unit.
+	GetProcessName() string
 }
 
 // App represents a tsuru app.
@@ -92,10 +110,12 @@ type Provisioner interface {
 	Destroy(App) error
 
 	// AddUnits adds units to an app. The first parameter is the app, the
-	// second is the number of units to add.
+	// second is the number of units to add and the third is the name of the
+	// process type that the new units will run (an empty name means all
+	// processes).
 	//
 	// It returns a slice containing all added units
-	AddUnits(App, uint) ([]Unit, error)
+	AddUnits(App, uint, string) ([]Unit, error)
 
 	// RemoveUnit removes a unit from the app. It receives the app and the name
 	// of the unit to be removed.
@@ -104,7 +124,8 @@ type Provisioner interface {
 	// ExecuteCommand runs a command in all units of the app.
 	ExecuteCommand(stdout, stderr io.Writer, app App, cmd string, args ...string) error
 
-	// Restart restarts the app.
+	// Restart restarts the app. Units that run a specific process type
+	// should restart only that process.
 	Restart(App) error
 
 	// CollectStatus returns information about all provisioned units. It's used
@@ -120,6 +141,36 @@ type Provisioner interface {
 	Addr(App) (string, error)
 }
 
+// CNameManager represents a provisioner that supports cname on applications.
+//
+// Provisioners that delegate routing to a router (see the router package)
+// should implement this interface, so changes on the cname of an app are
+// reflected in the router.
+type CNameManager interface {
+	// SetCName sets the cname of the app, replacing the previous one. An
+	// empty cname unsets the cname of the app.
+	SetCName(app App, cname string) error
+}
+
+// UnitRestarter represents a provisioner that is able to restart the units of
+// an app one by one.
+//
+// tsuru uses this interface for rolling restarts: instead of restarting all
+// units of the app at the same time, it restarts them in batches, waiting for
+// the units of a batch to be started before moving on to the next one.
+type UnitRestarter interface {
+	// RestartUnit restarts the given unit of the app.
+	RestartUnit(app App, unit AppUnit) error
+}
+
+// WebPorter represents a provisioner whose units of web processes serve
+// requests in a port other than 80.
+type WebPorter interface {
+	// WebPort returns the port where the units of web processes serve
+	// requests.
+	WebPort() int
+}
+
 var provisioners = make(map[string]Provisioner)
 
 // Register registers a new provisioner in the Provisioner registry.
@@ -54,3 +54,20 @@ func TestStatusString(t *testing.T) {
 		t.Errorf("Status.String(). want \"pending\". Got %q.", got)
 	}
 }
+
+func TestIsWebProcess(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"", true},
+		{"web", true},
+		{"worker", false},
+		{"clock", false},
+	}
+	for _, tt := range tests {
+		if got := IsWebProcess(tt.name); got != tt.expected {
+			t.Errorf("IsWebProcess(%q): want %v, got %v.", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -6,10 +6,25 @@ package repository
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/globocom/config"
 	"github.com/globocom/tsuru/log"
 	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultRef is the ref deployed when no ref is given.
+const DefaultRef = "master"
+
+// ErrInvalidRef is the error returned when one tries to checkout a ref that
+// is not a valid git ref name.
+var ErrInvalidRef = errors.New("Invalid git ref.")
+
+var (
+	commitRegexp = regexp.MustCompile(`[0-9a-f]{40}`)
+	refRegexp    = regexp.MustCompile(`^\w[\w./-]*$`)
 )
 
 // Unit interface represents a unit of execution.
@@ -29,45 +44,149 @@ type Unit interface {
 //
 // Given a machine id (from juju), it runs a git clone into this machine,
 // cloning from the bare repository that is being served by git-daemon in the
-// tsuru server.
+// tsuru server. The whole history is cloned, so the unit is able to checkout
+// previous commits in a rollback.
 func clone(u Unit) ([]byte, error) {
 	var buf bytes.Buffer
 	p, err := GetPath()
 	if err != nil {
 		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
 	}
-	cmd := fmt.Sprintf("git clone %s %s --depth 1", GetReadOnlyUrl(u.GetName()), p)
+	cmd := fmt.Sprintf("git clone %s %s", GetReadOnlyUrl(u.GetName()), p)
 	err = u.Command(&buf, &buf, cmd)
 	b := buf.Bytes()
 	log.Printf(`"git clone" output: %s`, b)
 	return b, err
 }
 
-// Pull runs a git pull to update the code in a unit.
+// fetch runs a git fetch to update the repository in a unit.
 //
-// It works like Clone, pulling from the app bare repository.
-func pull(u Unit) ([]byte, error) {
+// It works like Clone, fetching from the app bare repository. The code in the
+// unit is not changed, see Checkout.
+func fetch(u Unit) ([]byte, error) {
 	var buf bytes.Buffer
 	p, err := GetPath()
 	if err != nil {
 		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
 	}
-	cmd := fmt.Sprintf("cd %s && git pull origin master", p)
+	cmd := fmt.Sprintf("cd %s && git fetch origin", p)
 	err = u.Command(&buf, &buf, cmd)
 	b := buf.Bytes()
-	log.Printf(`"git pull" output: %s`, b)
+	log.Printf(`"git fetch" output: %s`, b)
 	return b, err
 }
 
-// CloneOrPull runs a git clone or a git pull in a unit of the app.
+// CloneOrPull runs a git clone or a git fetch in a unit of the app, and then
+// checks out the given ref.
 //
 // First it tries to clone, and if the clone fail (meaning that the repository
-// is already cloned), it pulls changes from the bare repository.
-func CloneOrPull(u Unit) ([]byte, error) {
+// is already cloned), it fetches changes from the bare repository. The ref
+// may be a branch, a tag or a commit, and defaults to DefaultRef when empty.
+func CloneOrPull(u Unit, ref string) ([]byte, error) {
+	if !ValidRef(ref) {
+		return nil, ErrInvalidRef
+	}
 	b, err := clone(u)
 	if err != nil {
-		b, err = pull(u)
+		if b, err = fetch(u); err != nil {
+			return b, err
+		}
+	}
+	out, err := Checkout(u, ref)
+	return append(b, out...), err
+}
+
+// Head returns the SHA1 of the commit that is checked out in the unit.
+func Head(u Unit) (string, error) {
+	var buf bytes.Buffer
+	p, err := GetPath()
+	if err != nil {
+		return "", fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	cmd := fmt.Sprintf("cd %s && git rev-parse HEAD", p)
+	if err = u.Command(&buf, &buf, cmd); err != nil {
+		return "", fmt.Errorf("Failed to get the current commit (%s): %s", err, buf.Bytes())
+	}
+	commit := commitRegexp.Find(buf.Bytes())
+	if commit == nil {
+		return "", fmt.Errorf("Failed to get the current commit: %s", buf.Bytes())
+	}
+	return string(commit), nil
+}
+
+// SaveHead records, in each unit, the commit that is checked out, so it can be
+// restored later with RestoreHead. It returns the commit, or an empty string
+// if the repository is not cloned in the unit yet.
+func SaveHead(u Unit) (string, error) {
+	var buf bytes.Buffer
+	p, err := GetPath()
+	if err != nil {
+		return "", fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	cmd := fmt.Sprintf("if [ -d %s/.git ]; then cd %s && git rev-parse HEAD | tee .git/tsuru-previous-head; fi", p, p)
+	if err = u.Command(&buf, &buf, cmd); err != nil {
+		return "", fmt.Errorf("Failed to save the current commit (%s): %s", err, buf.Bytes())
+	}
+	return string(commitRegexp.Find(buf.Bytes())), nil
+}
+
+// RestoreHead puts each unit back in the commit recorded by SaveHead. Units
+// without a recorded commit are left untouched.
+func RestoreHead(u Unit) ([]byte, error) {
+	var buf bytes.Buffer
+	p, err := GetPath()
+	if err != nil {
+		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
+	}
+	cmd := fmt.Sprintf("cd %s && if [ -s .git/tsuru-previous-head ]; then git checkout -q $(cat .git/tsuru-previous-head); fi", p)
+	err = u.Command(&buf, &buf, cmd)
+	b := buf.Bytes()
+	log.Printf(`"git checkout" output: %s`, b)
+	return b, err
+}
+
+// ValidRef checks whether the given ref may be checked out in units. The empty
+// ref is valid, meaning DefaultRef.
+func ValidRef(ref string) bool {
+	return ref == "" || (refRegexp.MatchString(ref) && !strings.Contains(ref, ".."))
+}
+
+// revision returns the revision that must be given to git checkout in order to
+// checkout the given ref.
+//
+// Branches are checked out from the origin remote, as the unit does not track
+// them. Full ref names (like refs/tags/1.0) and commits are checked out as
+// they are. Other names are looked up in the origin remote first, falling back
+// to tags.
+func revision(ref string) string {
+	if ref == "" {
+		ref = DefaultRef
+	}
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return "origin/" + strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if strings.HasPrefix(ref, "refs/") || (len(ref) == 40 && commitRegexp.MatchString(ref)) {
+		return ref
+	}
+	return fmt.Sprintf("$(git rev-parse -q --verify origin/%s || echo %s)", ref, ref)
+}
+
+// Checkout runs a git checkout in a unit, putting its code in the given ref.
+// The ref may be a branch, a tag or a commit, and defaults to DefaultRef when
+// empty.
+func Checkout(u Unit, ref string) ([]byte, error) {
+	if !ValidRef(ref) {
+		return nil, ErrInvalidRef
+	}
+	var buf bytes.Buffer
+	p, err := GetPath()
+	if err != nil {
+		return nil, fmt.Errorf("Tsuru is misconfigured: %s", err)
 	}
+	cmd := fmt.Sprintf("cd %s && git checkout -q %s", p, revision(ref))
+	err = u.Command(&buf, &buf, cmd)
+	b := buf.Bytes()
+	log.Printf(`"git checkout" output: %s`, b)
 	return b, err
 }
 
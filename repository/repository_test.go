@@ -15,6 +15,7 @@ import (
 
 type FakeUnit struct {
 	name     string
+	output   string
 	commands []string
 }
 
@@ -33,6 +34,9 @@ func (u *FakeUnit) GetName() string {
 
 func (u *FakeUnit) Command(stdout, stderr io.Writer, cmd ...string) error {
 	u.commands = append(u.commands, cmd[0])
+	if stdout != nil {
+		stdout.Write([]byte(u.output))
+	}
 	return nil
 }
 
@@ -52,7 +56,7 @@ func (s *S) TestCloneRepository(c *gocheck.C) {
 	u := FakeUnit{name: "my-unit"}
 	_, err := clone(&u)
 	c.Assert(err, gocheck.IsNil)
-	expectedCommand := fmt.Sprintf("git clone %s /home/application/current --depth 1", GetReadOnlyUrl(u.GetName()))
+	expectedCommand := fmt.Sprintf("git clone %s /home/application/current", GetReadOnlyUrl(u.GetName()))
 	c.Assert(u.RanCommand(expectedCommand), gocheck.Equals, true)
 }
 
@@ -66,42 +70,210 @@ func (s *S) TestCloneRepositoryUndefinedPath(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
 }
 
-func (s *S) TestPullRepository(c *gocheck.C) {
+func (s *S) TestFetchRepository(c *gocheck.C) {
 	u := FakeUnit{name: "your-unit"}
-	_, err := pull(&u)
+	_, err := fetch(&u)
 	c.Assert(err, gocheck.IsNil)
-	expectedCommand := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	expectedCommand := "cd /home/application/current && git fetch origin"
 	c.Assert(u.RanCommand(expectedCommand), gocheck.Equals, true)
 }
 
-func (s *S) TestPullRepositoryUndefinedPath(c *gocheck.C) {
+func (s *S) TestFetchRepositoryUndefinedPath(c *gocheck.C) {
 	old, _ := config.Get("git:unit-repo")
 	config.Unset("git:unit-repo")
 	defer config.Set("git:unit-repo", old)
 	u := FakeUnit{name: "my-unit"}
-	_, err := pull(&u)
+	_, err := fetch(&u)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
 }
 
 func (s *S) TestCloneOrPullRepositoryRunsClone(c *gocheck.C) {
 	u := FakeUnit{name: "my-unit"}
-	_, err := CloneOrPull(&u)
+	_, err := CloneOrPull(&u, "")
 	c.Assert(err, gocheck.IsNil)
-	clone := fmt.Sprintf("git clone %s /home/application/current --depth 1", GetReadOnlyUrl(u.GetName()))
-	pull := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	clone := fmt.Sprintf("git clone %s /home/application/current", GetReadOnlyUrl(u.GetName()))
+	fetch := "cd /home/application/current && git fetch origin"
+	checkout := "cd /home/application/current && git checkout -q $(git rev-parse -q --verify origin/master || echo master)"
 	c.Assert(u.RanCommand(clone), gocheck.Equals, true)
-	c.Assert(u.RanCommand(pull), gocheck.Equals, false)
+	c.Assert(u.RanCommand(fetch), gocheck.Equals, false)
+	c.Assert(u.RanCommand(checkout), gocheck.Equals, true)
 }
 
-func (s *S) TestCloneOrPullRepositoryRunsPullIfCloneFail(c *gocheck.C) {
+func (s *S) TestCloneOrPullRepositoryRunsFetchIfCloneFail(c *gocheck.C) {
 	u := FailingCloneUnit{FakeUnit{name: "my-unit"}}
-	_, err := CloneOrPull(&u)
+	_, err := CloneOrPull(&u, "release-1.2")
 	c.Assert(err, gocheck.IsNil)
-	clone := fmt.Sprintf("git clone %s /home/application/current --depth 1", GetReadOnlyUrl(u.GetName()))
-	pull := fmt.Sprintf("cd /home/application/current && git pull origin master")
+	clone := fmt.Sprintf("git clone %s /home/application/current", GetReadOnlyUrl(u.GetName()))
+	fetch := "cd /home/application/current && git fetch origin"
+	checkout := "cd /home/application/current && git checkout -q $(git rev-parse -q --verify origin/release-1.2 || echo release-1.2)"
 	c.Assert(u.RanCommand(clone), gocheck.Equals, true)
-	c.Assert(u.RanCommand(pull), gocheck.Equals, true)
+	c.Assert(u.RanCommand(fetch), gocheck.Equals, true)
+	c.Assert(u.RanCommand(checkout), gocheck.Equals, true)
+}
+
+func (s *S) TestCloneOrPullRepositoryInvalidRef(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := CloneOrPull(&u, "master; rm -rf /")
+	c.Assert(err, gocheck.Equals, ErrInvalidRef)
+	c.Assert(u.commands, gocheck.HasLen, 0)
+}
+
+func (s *S) TestValidRef(c *gocheck.C) {
+	var tests = []struct {
+		ref   string
+		valid bool
+	}{
+		{"", true},
+		{"master", true},
+		{"release-1.2", true},
+		{"feature/login", true},
+		{"refs/heads/release_1.2", true},
+		{"refs/tags/1.0", true},
+		{"f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9", true},
+		{"-f", false},
+		{"/master", false},
+		{"master..other", false},
+		{"master; rm -rf /", false},
+		{"$(reboot)", false},
+	}
+	for _, t := range tests {
+		c.Check(ValidRef(t.ref), gocheck.Equals, t.valid, gocheck.Commentf("ref %q", t.ref))
+	}
+}
+
+func (s *S) TestRevision(c *gocheck.C) {
+	var tests = []struct {
+		ref      string
+		revision string
+	}{
+		{"", "$(git rev-parse -q --verify origin/master || echo master)"},
+		{"release", "$(git rev-parse -q --verify origin/release || echo release)"},
+		{"1.0", "$(git rev-parse -q --verify origin/1.0 || echo 1.0)"},
+		{"refs/heads/release", "origin/release"},
+		{"refs/tags/1.0", "refs/tags/1.0"},
+		{"f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9", "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9"},
+	}
+	for _, t := range tests {
+		c.Check(revision(t.ref), gocheck.Equals, t.revision, gocheck.Commentf("ref %q", t.ref))
+	}
+}
+
+func (s *S) TestHead(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit", output: "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9\n"}
+	commit, err := Head(&u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commit, gocheck.Equals, "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9")
+	c.Assert(u.RanCommand("cd /home/application/current && git rev-parse HEAD"), gocheck.Equals, true)
+}
+
+func (s *S) TestHeadWithMultipleUnits(c *gocheck.C) {
+	output := `Output from unit "my-unit-0":
+
+f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9
+
+Output from unit "my-unit-1":
+
+f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9
+`
+	u := FakeUnit{name: "my-unit", output: output}
+	commit, err := Head(&u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commit, gocheck.Equals, "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9")
+}
+
+func (s *S) TestHeadInvalidOutput(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit", output: "fatal: Not a git repository"}
+	_, err := Head(&u)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to get the current commit: fatal: Not a git repository")
+}
+
+func (s *S) TestHeadUndefinedPath(c *gocheck.C) {
+	old, _ := config.Get("git:unit-repo")
+	config.Unset("git:unit-repo")
+	defer config.Set("git:unit-repo", old)
+	u := FakeUnit{name: "my-unit"}
+	_, err := Head(&u)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
+}
+
+func (s *S) TestSaveHead(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit", output: "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9\n"}
+	commit, err := SaveHead(&u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commit, gocheck.Equals, "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9")
+	expected := "if [ -d /home/application/current/.git ]; then cd /home/application/current && git rev-parse HEAD | tee .git/tsuru-previous-head; fi"
+	c.Assert(u.RanCommand(expected), gocheck.Equals, true)
+}
+
+func (s *S) TestSaveHeadWithoutRepository(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	commit, err := SaveHead(&u)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commit, gocheck.Equals, "")
+}
+
+func (s *S) TestSaveHeadUndefinedPath(c *gocheck.C) {
+	old, _ := config.Get("git:unit-repo")
+	config.Unset("git:unit-repo")
+	defer config.Set("git:unit-repo", old)
+	u := FakeUnit{name: "my-unit"}
+	_, err := SaveHead(&u)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
+}
+
+func (s *S) TestRestoreHead(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := RestoreHead(&u)
+	c.Assert(err, gocheck.IsNil)
+	expected := "cd /home/application/current && if [ -s .git/tsuru-previous-head ]; then git checkout -q $(cat .git/tsuru-previous-head); fi"
+	c.Assert(u.RanCommand(expected), gocheck.Equals, true)
+}
+
+func (s *S) TestRestoreHeadUndefinedPath(c *gocheck.C) {
+	old, _ := config.Get("git:unit-repo")
+	config.Unset("git:unit-repo")
+	defer config.Set("git:unit-repo", old)
+	u := FakeUnit{name: "my-unit"}
+	_, err := RestoreHead(&u)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
+}
+
+func (s *S) TestCheckout(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9")
+	c.Assert(err, gocheck.IsNil)
+	expected := "cd /home/application/current && git checkout -q f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9"
+	c.Assert(u.RanCommand(expected), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckoutBranch(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "refs/heads/release")
+	c.Assert(err, gocheck.IsNil)
+	expected := "cd /home/application/current && git checkout -q origin/release"
+	c.Assert(u.RanCommand(expected), gocheck.Equals, true)
+}
+
+func (s *S) TestCheckoutInvalidRef(c *gocheck.C) {
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "--force")
+	c.Assert(err, gocheck.Equals, ErrInvalidRef)
+	c.Assert(u.commands, gocheck.HasLen, 0)
+}
+
+func (s *S) TestCheckoutUndefinedPath(c *gocheck.C) {
+	old, _ := config.Get("git:unit-repo")
+	config.Unset("git:unit-repo")
+	defer config.Set("git:unit-repo", old)
+	u := FakeUnit{name: "my-unit"}
+	_, err := Checkout(&u, "f2a5d5f4c4bd0fc9e2e1dd1e7fbd5e1e3f8ba1c9")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Tsuru is misconfigured: key "git:unit-repo" not found`)
 }
 
 func (s *S) TestGetRepositoryUrl(c *gocheck.C) {
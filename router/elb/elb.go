@@ -0,0 +1,158 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package elb provides a router implementation backed by Amazon Elastic Load
+// Balancing. Each backend is a load balancer, and each route is the id of an
+// EC2 instance registered in the load balancer.
+//
+// It uses db package and adds a new collection to tsuru's DB. The name of the
+// collection is defined in the configuration file (juju:elb-collection).
+package elb
+
+import (
+	"github.com/flaviamissi/go-elb/aws"
+	"github.com/flaviamissi/go-elb/elb"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+func init() {
+	router.Register("elb", elbRouter{})
+}
+
+// loadBalancer represents an ELB instance.
+type loadBalancer struct {
+	Name    string
+	DNSName string
+	CName   string
+}
+
+type elbRouter struct{}
+
+func (elbRouter) collection() (*db.Storage, *mgo.Collection) {
+	name, err := config.GetString("juju:elb-collection")
+	if err != nil {
+		log.Fatal("juju:elb-collection is undefined on config file.")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Fatalf("[elb] Failed to connect to the database: %s", err)
+	}
+	return conn, conn.Collection(name)
+}
+
+func (elbRouter) vpc() bool {
+	vpc, _ := config.GetBool("juju:elb-use-vpc")
+	return vpc
+}
+
+// AddBackend creates a new Elastic Load Balancing instance, identified by the
+// given name.
+func (r elbRouter) AddBackend(name string) error {
+	options := elb.CreateLoadBalancer{
+		Name: name,
+		Listeners: []elb.Listener{
+			{
+				InstancePort:     80,
+				InstanceProtocol: "HTTP",
+				LoadBalancerPort: 80,
+				Protocol:         "HTTP",
+			},
+		},
+	}
+	var err error
+	if r.vpc() {
+		options.Subnets, err = config.GetList("juju:elb-vpc-subnets")
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.SecurityGroups, err = config.GetList("juju:elb-vpc-secgroups")
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.Scheme = "internal"
+	} else {
+		options.AvailZones, err = config.GetList("juju:elb-avail-zones")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	resp, err := Client().CreateLoadBalancer(&options)
+	if err != nil {
+		return err
+	}
+	lb := loadBalancer{Name: name, DNSName: resp.DNSName}
+	conn, collection := r.collection()
+	defer conn.Close()
+	return collection.Insert(lb)
+}
+
+// RemoveBackend destroys the Elastic Load Balancing instance identified by
+// the given name.
+func (r elbRouter) RemoveBackend(name string) error {
+	_, err := Client().DeleteLoadBalancer(name)
+	if err != nil {
+		return err
+	}
+	conn, collection := r.collection()
+	defer conn.Close()
+	return collection.Remove(bson.M{"name": name})
+}
+
+// AddRoute registers the EC2 instance identified by address in the load
+// balancer.
+func (elbRouter) AddRoute(name, address string) error {
+	_, err := Client().RegisterInstancesWithLoadBalancer([]string{address}, name)
+	return err
+}
+
+// RemoveRoute deregisters the EC2 instance identified by address from the
+// load balancer.
+func (elbRouter) RemoveRoute(name, address string) error {
+	_, err := Client().DeregisterInstancesFromLoadBalancer([]string{address}, name)
+	return err
+}
+
+// SetCName stores the cname of the load balancer. Requests to the cname reach
+// the load balancer as long as the cname points to its DNS name, so there is
+// nothing to change in ELB.
+func (r elbRouter) SetCName(cname, name string) error {
+	conn, collection := r.collection()
+	defer conn.Close()
+	return collection.Update(bson.M{"name": name}, bson.M{"$set": bson.M{"cname": cname}})
+}
+
+// Addr returns the dns-name of a load balancer, which is also the DNS name of
+// the app.
+func (r elbRouter) Addr(name string) (string, error) {
+	var lb loadBalancer
+	conn, collection := r.collection()
+	defer conn.Close()
+	err := collection.Find(bson.M{"name": name}).One(&lb)
+	return lb.DNSName, err
+}
+
+// Client returns a client for the ELB API, using the settings
+// aws:access-key-id, aws:secret-access-key and juju:elb-endpoint.
+func Client() *elb.ELB {
+	access, err := config.GetString("aws:access-key-id")
+	if err != nil {
+		log.Fatal(err)
+	}
+	secret, err := config.GetString("aws:secret-access-key")
+	if err != nil {
+		log.Fatal(err)
+	}
+	endpoint, err := config.GetString("juju:elb-endpoint")
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth := aws.Auth{AccessKey: access, SecretKey: secret}
+	region := aws.Region{ELBEndpoint: endpoint}
+	return elb.New(auth, region)
+}
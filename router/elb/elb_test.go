@@ -0,0 +1,228 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elb
+
+import (
+	"github.com/flaviamissi/go-elb/aws"
+	"github.com/flaviamissi/go-elb/elb"
+	"github.com/flaviamissi/go-elb/elb/elbtest"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"sort"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	server *elbtest.Server
+	client *elb.ELB
+	conn   *db.Storage
+	cName  string
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	var err error
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_elb_tests")
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+	s.server, err = elbtest.NewServer()
+	c.Assert(err, gocheck.IsNil)
+	config.Set("juju:elb-endpoint", s.server.URL())
+	region := aws.SAEast
+	region.ELBEndpoint = s.server.URL()
+	s.client = elb.New(aws.Auth{AccessKey: "some", SecretKey: "thing"}, region)
+	s.cName = "router_test_elbs"
+	config.Set("juju:elb-collection", s.cName)
+	config.Set("juju:elb-avail-zones", []interface{}{"my-zone-1a", "my-zone-1b"})
+	config.Set("aws:access-key-id", "access")
+	config.Set("aws:secret-access-key", "s3cr3t")
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Collection(s.cName).Database.DropDatabase()
+	s.conn.Close()
+	s.server.Quit()
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("elb")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.FitsTypeOf, elbRouter{})
+}
+
+func (s *S) TestGetCollection(c *gocheck.C) {
+	var r elbRouter
+	conn, coll := r.collection()
+	defer conn.Close()
+	other := s.conn.Collection(s.cName)
+	c.Assert(coll.FullName, gocheck.Equals, other.FullName)
+}
+
+func (s *S) TestClient(c *gocheck.C) {
+	elb := Client()
+	c.Assert(elb.ELBEndpoint, gocheck.Equals, s.server.URL())
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("together")
+	c.Assert(err, gocheck.IsNil)
+	defer s.client.DeleteLoadBalancer("together")
+	conn, coll := r.collection()
+	defer conn.Close()
+	defer coll.Remove(bson.M{"name": "together"})
+	resp, err := s.client.DescribeLoadBalancers("together")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	c.Assert(resp.LoadBalancerDescriptions[0].ListenerDescriptions, gocheck.HasLen, 1)
+	listener := resp.LoadBalancerDescriptions[0].ListenerDescriptions[0].Listener
+	c.Assert(listener.InstancePort, gocheck.Equals, 80)
+	c.Assert(listener.LoadBalancerPort, gocheck.Equals, 80)
+	c.Assert(listener.InstanceProtocol, gocheck.Equals, "HTTP")
+	c.Assert(listener.Protocol, gocheck.Equals, "HTTP")
+	c.Assert(listener.SSLCertificateId, gocheck.Equals, "")
+	dnsName := resp.LoadBalancerDescriptions[0].DNSName
+	var lb loadBalancer
+	err = s.conn.Collection(s.cName).Find(bson.M{"name": "together"}).One(&lb)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(lb.DNSName, gocheck.Equals, dnsName)
+}
+
+func (s *S) TestAddBackendUsingVPC(c *gocheck.C) {
+	old, _ := config.Get("juju:elb-avail-zones")
+	config.Unset("juju:elb-avail-zones")
+	config.Set("juju:elb-use-vpc", true)
+	config.Set("juju:elb-vpc-subnets", []string{"subnet-a4a3a2a1", "subnet-002200"})
+	config.Set("juju:elb-vpc-secgroups", []string{"sg-0900"})
+	defer func() {
+		config.Set("juju:elb-avail-zones", old)
+		config.Unset("juju:elb-use-vpc")
+		config.Unset("juju:elb-vpc-subnets")
+		config.Unset("juju:elb-vpc-secgroups")
+	}()
+	var r elbRouter
+	err := r.AddBackend("relax")
+	c.Assert(err, gocheck.IsNil)
+	defer s.client.DeleteLoadBalancer("relax")
+	conn, coll := r.collection()
+	defer conn.Close()
+	defer coll.Remove(bson.M{"name": "relax"})
+	resp, err := s.client.DescribeLoadBalancers("relax")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	lbd := resp.LoadBalancerDescriptions[0]
+	c.Assert(lbd.Subnets, gocheck.DeepEquals, []string{"subnet-a4a3a2a1", "subnet-002200"})
+	c.Assert(lbd.SecurityGroups, gocheck.DeepEquals, []string{"sg-0900"})
+	c.Assert(lbd.Scheme, gocheck.Equals, "internal")
+	c.Assert(lbd.AvailZones, gocheck.HasLen, 0)
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("blue")
+	c.Assert(err, gocheck.IsNil)
+	defer s.client.DeleteLoadBalancer("blue") // sanity
+	conn, coll := r.collection()
+	defer conn.Close()
+	defer coll.Remove(bson.M{"name": "blue"}) // sanity
+	err = r.RemoveBackend("blue")
+	c.Assert(err, gocheck.IsNil)
+	_, err = s.client.DescribeLoadBalancers("blue")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, `^.*\(LoadBalancerNotFound\)$`)
+	n, err := coll.Find(bson.M{"name": "blue"}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddRoute(c *gocheck.C) {
+	id1 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id1)
+	id2 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id2)
+	var r elbRouter
+	err := r.AddBackend("fooled")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("fooled")
+	err = r.AddRoute("fooled", id1)
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("fooled", id2)
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers("fooled")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 2)
+	instances := resp.LoadBalancerDescriptions[0].Instances
+	ids := []string{instances[0].InstanceId, instances[1].InstanceId}
+	sort.Strings(ids)
+	expected := []string{id1, id2}
+	sort.Strings(expected)
+	c.Assert(ids, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestRemoveRoute(c *gocheck.C) {
+	id1 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id1)
+	id2 := s.server.NewInstance()
+	defer s.server.RemoveInstance(id2)
+	var r elbRouter
+	err := r.AddBackend("dirty")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("dirty")
+	err = r.AddRoute("dirty", id1)
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("dirty", id2)
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("dirty", id1)
+	c.Assert(err, gocheck.IsNil)
+	resp, err := s.client.DescribeLoadBalancers("dirty")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(resp.LoadBalancerDescriptions, gocheck.HasLen, 1)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances, gocheck.HasLen, 1)
+	c.Assert(resp.LoadBalancerDescriptions[0].Instances[0].InstanceId, gocheck.Equals, id2)
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("sunday")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("sunday")
+	err = r.SetCName("sunday.mycompany.com", "sunday")
+	c.Assert(err, gocheck.IsNil)
+	var lb loadBalancer
+	err = s.conn.Collection(s.cName).Find(bson.M{"name": "sunday"}).One(&lb)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(lb.CName, gocheck.Equals, "sunday.mycompany.com")
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	var r elbRouter
+	err := r.AddBackend("enough")
+	c.Assert(err, gocheck.IsNil)
+	defer r.RemoveBackend("enough")
+	var lb loadBalancer
+	conn, coll := r.collection()
+	defer conn.Close()
+	err = coll.Find(bson.M{"name": "enough"}).One(&lb)
+	c.Assert(err, gocheck.IsNil)
+	addr, err := r.Addr("enough")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, lb.DNSName)
+}
+
+func (s *S) TestAddrUnknownLoadBalancer(c *gocheck.C) {
+	var r elbRouter
+	addr, err := r.Addr("five")
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "not found")
+}
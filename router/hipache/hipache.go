@@ -0,0 +1,208 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hipache provides a router implementation that stores backends in
+// Redis, using the key layout of Hipache (https://github.com/dotcloud/hipache).
+//
+// Each backend is a list identified by the key "frontend:<name>.<domain>",
+// where the domain is defined in the setting hipache:domain. The first element
+// of the list is the name of the backend and the other elements are the
+// addresses of its routes. The cname of a backend, when set, has its own
+// frontend, holding the same routes. Hipache reads the keys on every request,
+// so changes take effect without restarting the proxy.
+package hipache
+
+import (
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/router"
+	"strings"
+)
+
+func init() {
+	router.Register("hipache", hipacheRouter{})
+}
+
+// conn connects to the Redis server defined in the setting
+// hipache:redis-server.
+func conn() (redis.Conn, error) {
+	server, err := config.GetString("hipache:redis-server")
+	if err != nil {
+		return nil, err
+	}
+	return redis.Dial("tcp", server)
+}
+
+type hipacheRouter struct{}
+
+// host returns the host of the backend, built from its name and the setting
+// hipache:domain.
+func (hipacheRouter) host(name string) (string, error) {
+	domain, err := config.GetString("hipache:domain")
+	if err != nil {
+		return "", err
+	}
+	return name + "." + domain, nil
+}
+
+// frontends returns the keys of all frontends of the backend: the frontend of
+// its host and, if the backend has a cname, the frontend of the cname.
+func (r hipacheRouter) frontends(c redis.Conn, name string) ([]string, error) {
+	host, err := r.host(name)
+	if err != nil {
+		return nil, err
+	}
+	n, err := redis.Int(c.Do("LLEN", "frontend:"+host))
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("Backend %q not found.", name)
+	}
+	frontends := []string{"frontend:" + host}
+	cname, err := redis.String(c.Do("GET", "cname:"+name))
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+	if cname != "" {
+		frontends = append(frontends, "frontend:"+cname)
+	}
+	return frontends, nil
+}
+
+// route converts an address to the format used by Hipache, that is an URL.
+func route(address string) string {
+	if strings.Contains(address, "://") {
+		return address
+	}
+	return "http://" + address
+}
+
+func (r hipacheRouter) AddBackend(name string) error {
+	host, err := r.host(name)
+	if err != nil {
+		return err
+	}
+	c, err := conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	n, err := redis.Int(c.Do("LLEN", "frontend:"+host))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("Backend %q already exists.", name)
+	}
+	_, err = c.Do("RPUSH", "frontend:"+host, name)
+	return err
+}
+
+func (r hipacheRouter) RemoveBackend(name string) error {
+	c, err := conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	frontends, err := r.frontends(c, name)
+	if err != nil {
+		return err
+	}
+	for _, frontend := range frontends {
+		if _, err = c.Do("DEL", frontend); err != nil {
+			return err
+		}
+	}
+	_, err = c.Do("DEL", "cname:"+name)
+	return err
+}
+
+func (r hipacheRouter) AddRoute(name, address string) error {
+	c, err := conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	frontends, err := r.frontends(c, name)
+	if err != nil {
+		return err
+	}
+	for _, frontend := range frontends {
+		if _, err = c.Do("RPUSH", frontend, route(address)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r hipacheRouter) RemoveRoute(name, address string) error {
+	c, err := conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	frontends, err := r.frontends(c, name)
+	if err != nil {
+		return err
+	}
+	for _, frontend := range frontends {
+		if _, err = c.Do("LREM", frontend, 0, route(address)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCName creates a frontend for the cname, with the same routes of the
+// backend, and removes the frontend of the previous cname.
+func (r hipacheRouter) SetCName(cname, name string) error {
+	c, err := conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	frontends, err := r.frontends(c, name)
+	if err != nil {
+		return err
+	}
+	if len(frontends) > 1 {
+		if _, err = c.Do("DEL", frontends[1]); err != nil {
+			return err
+		}
+	}
+	if cname == "" {
+		_, err = c.Do("DEL", "cname:"+name)
+		return err
+	}
+	routes, err := redis.Strings(c.Do("LRANGE", frontends[0], 0, -1))
+	if err != nil {
+		return err
+	}
+	args := []interface{}{"frontend:" + cname}
+	for _, r := range routes {
+		args = append(args, r)
+	}
+	if _, err = c.Do("DEL", "frontend:"+cname); err != nil {
+		return err
+	}
+	if _, err = c.Do("RPUSH", args...); err != nil {
+		return err
+	}
+	_, err = c.Do("SET", "cname:"+name, cname)
+	return err
+}
+
+func (r hipacheRouter) Addr(name string) (string, error) {
+	c, err := conn()
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+	if _, err = r.frontends(c, name); err != nil {
+		return "", err
+	}
+	return r.host(name)
+}
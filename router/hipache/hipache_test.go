@@ -0,0 +1,208 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hipache
+
+import (
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/router"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	redis *fakeRedisServer
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	config.Set("hipache:domain", "golang.org")
+}
+
+func (s *S) SetUpTest(c *gocheck.C) {
+	var err error
+	s.redis, err = newFakeRedisServer()
+	c.Assert(err, gocheck.IsNil)
+	config.Set("hipache:redis-server", s.redis.addr())
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	s.redis.close()
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("hipache")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.FitsTypeOf, hipacheRouter{})
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.DeepEquals, []string{"tip"})
+}
+
+func (s *S) TestAddDuplicateBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddBackend("tip")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "tip" already exists.`)
+}
+
+func (s *S) TestAddBackendRedisFailure(c *gocheck.C) {
+	s.redis.close()
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.HasLen, 0)
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.HasLen, 0)
+	c.Assert(s.redis.get("cname:tip"), gocheck.Equals, "")
+}
+
+func (s *S) TestRemoveUnknownBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.RemoveBackend("tip")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "tip" not found.`)
+}
+
+func (s *S) TestAddRoute(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "http://10.10.10.11:8080")
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{"tip", "http://10.10.10.10", "http://10.10.10.11:8080"}
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAddRouteWithCName(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{"tip", "http://10.10.10.10"}
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.DeepEquals, expected)
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestAddRouteUnknownBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "tip" not found.`)
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.HasLen, 0)
+}
+
+func (s *S) TestRemoveRoute(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{"tip", "http://10.10.10.11"}
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.DeepEquals, expected)
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{"tip", "http://10.10.10.10"}
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.DeepEquals, expected)
+	c.Assert(s.redis.get("cname:tip"), gocheck.Equals, "tip.mycompany.com")
+}
+
+func (s *S) TestSetCNameReplacesPreviousCName(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("tip", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.othercompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{"tip", "http://10.10.10.10"}
+	c.Assert(s.redis.list("frontend:tip.othercompany.com"), gocheck.DeepEquals, expected)
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.HasLen, 0)
+	c.Assert(s.redis.get("cname:tip"), gocheck.Equals, "tip.othercompany.com")
+}
+
+func (s *S) TestUnsetCName(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("", "tip")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.redis.list("frontend:tip.mycompany.com"), gocheck.HasLen, 0)
+	c.Assert(s.redis.get("cname:tip"), gocheck.Equals, "")
+	c.Assert(s.redis.list("frontend:tip.golang.org"), gocheck.DeepEquals, []string{"tip"})
+}
+
+func (s *S) TestSetCNameUnknownBackend(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.SetCName("tip.mycompany.com", "tip")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "tip" not found.`)
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	var r hipacheRouter
+	err := r.AddBackend("tip")
+	c.Assert(err, gocheck.IsNil)
+	addr, err := r.Addr("tip")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "tip.golang.org")
+}
+
+func (s *S) TestAddrUnknownBackend(c *gocheck.C) {
+	var r hipacheRouter
+	addr, err := r.Addr("tip")
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "tip" not found.`)
+}
+
+func (s *S) TestRoute(c *gocheck.C) {
+	c.Assert(route("10.10.10.10"), gocheck.Equals, "http://10.10.10.10")
+	c.Assert(route("10.10.10.10:8080"), gocheck.Equals, "http://10.10.10.10:8080")
+	c.Assert(route("https://10.10.10.10"), gocheck.Equals, "https://10.10.10.10")
+}
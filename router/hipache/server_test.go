@@ -0,0 +1,193 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hipache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeRedisServer is an in-process stand-in for Redis. It speaks the Redis
+// protocol and supports only the commands used by the hipache router.
+type fakeRedisServer struct {
+	listener net.Listener
+	lists    map[string][]string
+	strings  map[string]string
+	mut      sync.Mutex
+}
+
+func newFakeRedisServer() (*fakeRedisServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := fakeRedisServer{
+		listener: l,
+		lists:    make(map[string][]string),
+		strings:  make(map[string]string),
+	}
+	go s.serve()
+	return &s, nil
+}
+
+func (s *fakeRedisServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedisServer) close() {
+	s.listener.Close()
+}
+
+// list returns a copy of the list stored in the given key.
+func (s *fakeRedisServer) list(key string) []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]string(nil), s.lists[key]...)
+}
+
+// get returns the string stored in the given key.
+func (s *fakeRedisServer) get(key string) string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.strings[key]
+}
+
+func (s *fakeRedisServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedisServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mut.Lock()
+		reply := s.execute(strings.ToUpper(args[0]), args[1:])
+		s.mut.Unlock()
+		if _, err = conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent by the client, encoded as a multi-bulk
+// request.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, errors.New("invalid request")
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, errors.New("invalid request")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, errors.New("invalid request")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func integer(n int) []byte {
+	return []byte(fmt.Sprintf(":%d\r\n", n))
+}
+
+func bulk(s string) []byte {
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(s), s))
+}
+
+func (s *fakeRedisServer) execute(cmd string, args []string) []byte {
+	switch {
+	case cmd == "GET" && len(args) == 1:
+		if v, ok := s.strings[args[0]]; ok {
+			return bulk(v)
+		}
+		return []byte("$-1\r\n")
+	case cmd == "SET" && len(args) == 2:
+		s.strings[args[0]] = args[1]
+		return []byte("+OK\r\n")
+	case cmd == "DEL" && len(args) > 0:
+		n := 0
+		for _, key := range args {
+			if _, ok := s.lists[key]; ok {
+				delete(s.lists, key)
+				n++
+			}
+			if _, ok := s.strings[key]; ok {
+				delete(s.strings, key)
+				n++
+			}
+		}
+		return integer(n)
+	case cmd == "LLEN" && len(args) == 1:
+		return integer(len(s.lists[args[0]]))
+	case cmd == "RPUSH" && len(args) > 1:
+		s.lists[args[0]] = append(s.lists[args[0]], args[1:]...)
+		return integer(len(s.lists[args[0]]))
+	case cmd == "LREM" && len(args) == 3 && args[1] == "0":
+		var kept []string
+		for _, v := range s.lists[args[0]] {
+			if v != args[2] {
+				kept = append(kept, v)
+			}
+		}
+		n := len(s.lists[args[0]]) - len(kept)
+		if len(kept) == 0 {
+			delete(s.lists, args[0])
+		} else {
+			s.lists[args[0]] = kept
+		}
+		return integer(n)
+	case cmd == "LRANGE" && len(args) == 3 && args[1] == "0" && args[2] == "-1":
+		list := s.lists[args[0]]
+		reply := []byte(fmt.Sprintf("*%d\r\n", len(list)))
+		for _, v := range list {
+			reply = append(reply, bulk(v)...)
+		}
+		return reply
+	}
+	return []byte(fmt.Sprintf("-ERR unsupported command %q\r\n", cmd))
+}
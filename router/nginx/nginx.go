@@ -0,0 +1,190 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nginx provides a router implementation that writes one nginx
+// virtual host for each backend, in the directory defined by the setting
+// nginx:routes-path, restarting nginx after every change.
+//
+// The state of the backends is stored in tsuru's database, in the collection
+// defined by the setting nginx:collection.
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/fs"
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/router"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"os/exec"
+)
+
+func init() {
+	router.Register("nginx", nginxRouter{})
+}
+
+var fsystem fs.Fs
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+// backend is the representation of a virtual host in the database.
+type backend struct {
+	Name      string `bson:"_id"`
+	Addresses []string
+	CName     string
+}
+
+type nginxRouter struct{}
+
+func (nginxRouter) collection() (*db.Storage, *mgo.Collection) {
+	name, err := config.GetString("nginx:collection")
+	if err != nil {
+		log.Fatal("nginx:collection is undefined on config file.")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Fatalf("[nginx] Failed to connect to the database: %s", err)
+	}
+	return conn, conn.Collection(name)
+}
+
+func (nginxRouter) path(name string) (string, error) {
+	routesPath, err := config.GetString("nginx:routes-path")
+	if err != nil {
+		return "", err
+	}
+	return routesPath + "/" + name, nil
+}
+
+// update applies the given change to the backend and rewrites its virtual
+// host.
+//
+// Missing backends are created, as apps deployed before the introduction of
+// routers do not have one.
+func (r nginxRouter) update(name string, change bson.M) error {
+	conn, coll := r.collection()
+	defer conn.Close()
+	_, err := coll.UpsertId(name, change)
+	if err != nil {
+		return err
+	}
+	var b backend
+	if err = coll.FindId(name).One(&b); err != nil {
+		return err
+	}
+	return r.write(&b)
+}
+
+// write writes the virtual host of the given backend and restarts nginx.
+//
+// Backends without addresses answer all requests with 503, as nginx does not
+// accept empty upstreams.
+func (r nginxRouter) write(b *backend) error {
+	domain, err := config.GetString("nginx:domain")
+	if err != nil {
+		return err
+	}
+	path, err := r.path(b.Name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if len(b.Addresses) > 0 {
+		fmt.Fprintf(&buf, "upstream %s {\n", b.Name)
+		for _, address := range b.Addresses {
+			fmt.Fprintf(&buf, "\tserver %s;\n", address)
+		}
+		buf.WriteString("}\n\n")
+	}
+	serverName := b.Name + "." + domain
+	if b.CName != "" {
+		serverName += " " + b.CName
+	}
+	fmt.Fprintf(&buf, "server {\n\tlisten 80;\n\tserver_name %s;\n\tlocation / {\n", serverName)
+	if len(b.Addresses) > 0 {
+		fmt.Fprintf(&buf, "\t\tproxy_pass http://%s;\n", b.Name)
+	} else {
+		buf.WriteString("\t\treturn 503;\n")
+	}
+	buf.WriteString("\t}\n}")
+	file, err := filesystem().Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return restart()
+}
+
+func (r nginxRouter) AddBackend(name string) error {
+	b := backend{Name: name}
+	conn, coll := r.collection()
+	defer conn.Close()
+	if err := coll.Insert(b); err != nil {
+		return err
+	}
+	return r.write(&b)
+}
+
+func (r nginxRouter) RemoveBackend(name string) error {
+	conn, coll := r.collection()
+	defer conn.Close()
+	if err := coll.RemoveId(name); err != nil {
+		return err
+	}
+	path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	if err = filesystem().Remove(path); err != nil {
+		return err
+	}
+	return restart()
+}
+
+func (r nginxRouter) AddRoute(name, address string) error {
+	return r.update(name, bson.M{"$addToSet": bson.M{"addresses": address}})
+}
+
+func (r nginxRouter) RemoveRoute(name, address string) error {
+	return r.update(name, bson.M{"$pull": bson.M{"addresses": address}})
+}
+
+func (r nginxRouter) SetCName(cname, name string) error {
+	return r.update(name, bson.M{"$set": bson.M{"cname": cname}})
+}
+
+// Addr returns the host of the backend, built from its name and the setting
+// nginx:domain.
+func (r nginxRouter) Addr(name string) (string, error) {
+	domain, err := config.GetString("nginx:domain")
+	if err != nil {
+		return "", err
+	}
+	conn, coll := r.collection()
+	defer conn.Close()
+	n, err := coll.FindId(name).Count()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", fmt.Errorf("Backend %q not found.", name)
+	}
+	return name + "." + domain, nil
+}
+
+func restart() error {
+	cmd := exec.Command("sudo", "service", "nginx", "restart")
+	return cmd.Run()
+}
@@ -0,0 +1,230 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/tsuru/router"
+	"io/ioutil"
+	"launchpad.net/gocheck"
+)
+
+func (s *S) readRoute(c *gocheck.C, name string) string {
+	file, err := s.rfs.Open("testdata/" + name)
+	c.Assert(err, gocheck.IsNil)
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	c.Assert(err, gocheck.IsNil)
+	return string(data)
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.FitsTypeOf, nginxRouter{})
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	var b backend
+	err = s.conn.Collection("nginx_backends").FindId("name").One(&b)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.Addresses, gocheck.HasLen, 0)
+	expected := `server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		return 503;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+	c.Assert(commandmocker.Output(s.tmpdir), gocheck.Equals, "service nginx restart")
+}
+
+func (s *S) TestAddDuplicateBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddBackend("name")
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.rfs.HasAction("remove testdata/name"), gocheck.Equals, true)
+	n, err := s.conn.Collection("nginx_backends").FindId("name").Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 0)
+}
+
+func (s *S) TestAddRoute(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "127.0.0.1")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name {
+	server 127.0.0.1;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+}
+
+func (s *S) TestAddRouteMultipleAddresses(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name {
+	server 10.10.10.10;
+	server 10.10.10.11;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+}
+
+func (s *S) TestAddRouteUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	var b backend
+	err = s.conn.Collection("nginx_backends").FindId("name").One(&b)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.Addresses, gocheck.DeepEquals, []string{"10.10.10.10"})
+	expected := `upstream name {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com;
+	location / {
+		proxy_pass http://name;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+	c.Assert(commandmocker.Output(s.tmpdir), gocheck.Equals, "service nginx restart")
+}
+
+func (s *S) TestRemoveRouteUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	n, err := s.conn.Collection("nginx_backends").FindId("name").Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(n, gocheck.Equals, 1)
+	c.Assert(s.readRoute(c, "name"), gocheck.Matches, "(?s).*return 503;.*")
+}
+
+func (s *S) TestRemoveRoute(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	err = r.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	data := s.readRoute(c, "name")
+	c.Assert(data, gocheck.Matches, "(?s).*server 10.10.10.11;.*")
+	c.Assert(data, gocheck.Not(gocheck.Matches), "(?s).*server 10.10.10.10;.*")
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = r.SetCName("name.mycompany.com", "name")
+	c.Assert(err, gocheck.IsNil)
+	expected := `upstream name {
+	server 10.10.10.10;
+}
+
+server {
+	listen 80;
+	server_name name.andrewzito.com name.mycompany.com;
+	location / {
+		proxy_pass http://name;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+	err = r.SetCName("", "name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.readRoute(c, "name"), gocheck.Matches, "(?s).*server_name name.andrewzito.com;.*")
+}
+
+func (s *S) TestSetCNameUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	err := r.SetCName("name.mycompany.com", "name")
+	c.Assert(err, gocheck.IsNil)
+	var b backend
+	err = s.conn.Collection("nginx_backends").FindId("name").One(&b)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(b.CName, gocheck.Equals, "name.mycompany.com")
+	c.Assert(b.Addresses, gocheck.HasLen, 0)
+	expected := `server {
+	listen 80;
+	server_name name.andrewzito.com name.mycompany.com;
+	location / {
+		return 503;
+	}
+}`
+	c.Assert(s.readRoute(c, "name"), gocheck.Equals, expected)
+	err = r.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(s.readRoute(c, "name"), gocheck.Matches, "(?s).*server_name name.andrewzito.com name.mycompany.com;.*")
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	var r nginxRouter
+	err := r.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	addr, err := r.Addr("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "name.andrewzito.com")
+}
+
+func (s *S) TestAddrUnknownBackend(c *gocheck.C) {
+	var r nginxRouter
+	addr, err := r.Addr("name")
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Backend "name" not found.`)
+}
+
+func (s *S) TestRestart(c *gocheck.C) {
+	err := restart()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(commandmocker.Ran(s.tmpdir), gocheck.Equals, true)
+	c.Assert(commandmocker.Output(s.tmpdir), gocheck.Equals, "service nginx restart")
+}
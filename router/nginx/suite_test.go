@@ -0,0 +1,54 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"github.com/globocom/commandmocker"
+	"github.com/globocom/config"
+	"github.com/globocom/tsuru/db"
+	fstesting "github.com/globocom/tsuru/fs/testing"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct {
+	conn   *db.Storage
+	rfs    *fstesting.RecordingFs
+	tmpdir string
+}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) SetUpSuite(c *gocheck.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_nginx_tests")
+	config.Set("nginx:collection", "nginx_backends")
+	config.Set("nginx:domain", "andrewzito.com")
+	config.Set("nginx:routes-path", "testdata")
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TearDownSuite(c *gocheck.C) {
+	s.conn.Collection("nginx_backends").Database.DropDatabase()
+	s.conn.Close()
+}
+
+func (s *S) SetUpTest(c *gocheck.C) {
+	s.rfs = &fstesting.RecordingFs{}
+	fsystem = s.rfs
+	var err error
+	s.tmpdir, err = commandmocker.Add("sudo", "$*")
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	fsystem = nil
+	commandmocker.Remove(s.tmpdir)
+	s.conn.Collection("nginx_backends").RemoveAll(nil)
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package router provides interfaces that need to be satisfied in order to
+// implement a new router on tsuru.
+package router
+
+import "fmt"
+
+// Router is the basic interface of this package. It provides methods for
+// managing backends and routes. Each backend can have multiple routes.
+//
+// A backend is identified by a name, usually the name of the app, and each
+// route is an address that receives requests sent to the backend. The
+// address format depends on the router: it may be an IP, a host:port pair or
+// an instance id.
+type Router interface {
+	// AddBackend creates a new backend, identified by the given name.
+	AddBackend(name string) error
+
+	// RemoveBackend removes the backend and all its routes.
+	RemoveBackend(name string) error
+
+	// AddRoute adds the given address to the backend.
+	AddRoute(name, address string) error
+
+	// RemoveRoute removes the given address from the backend.
+	RemoveRoute(name, address string) error
+
+	// SetCName makes the backend respond to requests sent to the given
+	// cname, replacing any cname previously set. An empty cname removes
+	// the current cname from the backend.
+	SetCName(cname, name string) error
+
+	// Addr returns the address of the backend, that is the address users
+	// should use for reaching it.
+	Addr(name string) (string, error)
+}
+
+var routers = make(map[string]Router)
+
+// Register registers a new router in the Router registry.
+func Register(name string, r Router) {
+	routers[name] = r
+}
+
+// Get gets the named router from the registry.
+func Get(name string) (Router, error) {
+	r, ok := routers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown router: %q.", name)
+	}
+	return r, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testing provides a fake implementation of the router.Router
+// interface, that keeps backends, routes and cnames in memory.
+//
+// Importing this package registers the fake router under the name "fake".
+package testing
+
+import (
+	"errors"
+	"github.com/globocom/tsuru/router"
+	"sync"
+)
+
+var ErrBackendNotFound = errors.New("Backend not found.")
+
+// FakeRouter is the instance of the fake router registered as "fake".
+var FakeRouter = newFakeRouter()
+
+func init() {
+	router.Register("fake", FakeRouter)
+}
+
+// Fake implementation for router.Router.
+type fakeRouter struct {
+	backends map[string][]string
+	cnames   map[string]string
+	mutex    sync.Mutex
+}
+
+func newFakeRouter() *fakeRouter {
+	return &fakeRouter{
+		backends: make(map[string][]string),
+		cnames:   make(map[string]string),
+	}
+}
+
+// HasBackend checks whether the backend identified by name exists.
+func (r *fakeRouter) HasBackend(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.backends[name]
+	return ok
+}
+
+// HasRoute checks whether the given address is a route of the backend.
+func (r *fakeRouter) HasRoute(name, address string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, a := range r.backends[name] {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// CName returns the cname of the backend, or an empty string if it has no
+// cname.
+func (r *fakeRouter) CName(name string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cnames[name]
+}
+
+// Reset removes all backends from the router.
+func (r *fakeRouter) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backends = make(map[string][]string)
+	r.cnames = make(map[string]string)
+}
+
+func (r *fakeRouter) AddBackend(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; ok {
+		return errors.New("Backend already exists.")
+	}
+	r.backends[name] = nil
+	return nil
+}
+
+func (r *fakeRouter) RemoveBackend(name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return ErrBackendNotFound
+	}
+	delete(r.backends, name)
+	delete(r.cnames, name)
+	return nil
+}
+
+func (r *fakeRouter) AddRoute(name, address string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return ErrBackendNotFound
+	}
+	r.backends[name] = append(routes, address)
+	return nil
+}
+
+func (r *fakeRouter) RemoveRoute(name, address string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	routes, ok := r.backends[name]
+	if !ok {
+		return ErrBackendNotFound
+	}
+	index := -1
+	for i, a := range routes {
+		if a == address {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return errors.New("Route not found.")
+	}
+	routes[index] = routes[len(routes)-1]
+	r.backends[name] = routes[:len(routes)-1]
+	return nil
+}
+
+func (r *fakeRouter) SetCName(cname, name string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return ErrBackendNotFound
+	}
+	if cname == "" {
+		delete(r.cnames, name)
+	} else {
+		r.cnames[name] = cname
+	}
+	return nil
+}
+
+func (r *fakeRouter) Addr(name string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[name]; !ok {
+		return "", ErrBackendNotFound
+	}
+	return name + ".fakerouter.com", nil
+}
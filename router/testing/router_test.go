@@ -0,0 +1,119 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"github.com/globocom/tsuru/router"
+	"launchpad.net/gocheck"
+	"testing"
+)
+
+func Test(t *testing.T) { gocheck.TestingT(t) }
+
+type S struct{}
+
+var _ = gocheck.Suite(&S{})
+
+func (s *S) TearDownTest(c *gocheck.C) {
+	FakeRouter.Reset()
+}
+
+func (s *S) TestShouldBeRegistered(c *gocheck.C) {
+	r, err := router.Get("fake")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.Equals, router.Router(FakeRouter))
+}
+
+func (s *S) TestAddBackend(c *gocheck.C) {
+	err := FakeRouter.AddBackend("foo")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasBackend("foo"), gocheck.Equals, true)
+}
+
+func (s *S) TestAddDuplicateBackend(c *gocheck.C) {
+	err := FakeRouter.AddBackend("foo")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.AddBackend("foo")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Backend already exists.")
+}
+
+func (s *S) TestRemoveBackend(c *gocheck.C) {
+	err := FakeRouter.AddBackend("bar")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.RemoveBackend("bar")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasBackend("bar"), gocheck.Equals, false)
+}
+
+func (s *S) TestRemoveUnknownBackend(c *gocheck.C) {
+	err := FakeRouter.RemoveBackend("bar")
+	c.Assert(err, gocheck.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestAddRoute(c *gocheck.C) {
+	err := FakeRouter.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasRoute("name", "10.10.10.10"), gocheck.Equals, true)
+	c.Assert(FakeRouter.HasRoute("name", "10.10.10.11"), gocheck.Equals, false)
+}
+
+func (s *S) TestAddRouteUnknownBackend(c *gocheck.C) {
+	err := FakeRouter.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestRemoveRoute(c *gocheck.C) {
+	err := FakeRouter.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.AddRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.AddRoute("name", "10.10.10.11")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.HasRoute("name", "10.10.10.10"), gocheck.Equals, false)
+	c.Assert(FakeRouter.HasRoute("name", "10.10.10.11"), gocheck.Equals, true)
+}
+
+func (s *S) TestRemoveUnknownRoute(c *gocheck.C) {
+	err := FakeRouter.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.RemoveRoute("name", "10.10.10.10")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Route not found.")
+}
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	err := FakeRouter.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	err = FakeRouter.SetCName("name.mycompany.com", "name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.CName("name"), gocheck.Equals, "name.mycompany.com")
+	err = FakeRouter.SetCName("", "name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(FakeRouter.CName("name"), gocheck.Equals, "")
+}
+
+func (s *S) TestSetCNameUnknownBackend(c *gocheck.C) {
+	err := FakeRouter.SetCName("name.mycompany.com", "name")
+	c.Assert(err, gocheck.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestAddr(c *gocheck.C) {
+	err := FakeRouter.AddBackend("name")
+	c.Assert(err, gocheck.IsNil)
+	addr, err := FakeRouter.Addr("name")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(addr, gocheck.Equals, "name.fakerouter.com")
+}
+
+func (s *S) TestAddrUnknownBackend(c *gocheck.C) {
+	addr, err := FakeRouter.Addr("name")
+	c.Assert(addr, gocheck.Equals, "")
+	c.Assert(err, gocheck.Equals, ErrBackendNotFound)
+}
@@ -0,0 +1,361 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	stderrors "errors"
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/errors"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+)
+
+// bindParams extracts the service instance and the app from the parameters of
+// the bind and unbind pipelines.
+func bindParams(params []interface{}) (*ServiceInstance, bind.App, error) {
+	si, ok := params[0].(*ServiceInstance)
+	if !ok {
+		return nil, nil, stderrors.New("First parameter must be a *ServiceInstance.")
+	}
+	app, ok := params[1].(bind.App)
+	if !ok {
+		return nil, nil, stderrors.New("Second parameter must be a bind.App.")
+	}
+	return si, app, nil
+}
+
+// forEachUnit calls fn for each unit, concurrently. It returns the units for
+// which fn succeeded, along with the first error returned by fn.
+func forEachUnit(units []bind.Unit, fn func(bind.Unit) error) ([]bind.Unit, error) {
+	type result struct {
+		unit bind.Unit
+		err  error
+	}
+	results := make(chan result, len(units))
+	for _, unit := range units {
+		go func(unit bind.Unit) {
+			results <- result{unit: unit, err: fn(unit)}
+		}(unit)
+	}
+	var (
+		done []bind.Unit
+		err  error
+	)
+	for _ = range units {
+		r := <-results
+		if r.err == nil {
+			done = append(done, r.unit)
+		} else if err == nil {
+			err = r.err
+		}
+	}
+	return done, err
+}
+
+// instanceEnvVars converts the environment variables returned by the service
+// api to the environment variables of the instance in the app.
+func instanceEnvVars(si *ServiceInstance, envs map[string]string) []bind.EnvVar {
+	var envVars []bind.EnvVar
+	for k, v := range envs {
+		envVars = append(envVars, bind.EnvVar{
+			Name:         k,
+			Value:        v,
+			Public:       false,
+			InstanceName: si.Name,
+		})
+	}
+	return envVars
+}
+
+// addAppToServiceInstance is an action that adds the app to the list of apps
+// of the service instance in Forward and removes it in the Backward.
+//
+// The first argument in the context must be a pointer to a ServiceInstance,
+// and the second must be a bind.App.
+var addAppToServiceInstance = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		if err = si.AddApp(app.GetName()); err != nil {
+			return nil, &errors.Http{Code: http.StatusConflict, Message: "This app is already bound to this service instance."}
+		}
+		return nil, si.update()
+	},
+	Backward: func(ctx action.BWContext) {
+		si, app, _ := bindParams(ctx.Params)
+		if err := si.RemoveApp(app.GetName()); err == nil {
+			if err = si.update(); err != nil {
+				log.Printf("Failed to remove the app %q from the service instance %q: %s", app.GetName(), si.Name, err)
+			}
+		}
+	},
+	MinParams: 2,
+}
+
+// bindAppEndpoint is an action that binds the app in the service api in
+// Forward, returning the environment variables of the instance, and unbinds
+// it in the Backward.
+//
+// It requires the same parameters as addAppToServiceInstance.
+var bindAppEndpoint = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		endpoint, err := si.getClient()
+		if err != nil {
+			return nil, err
+		}
+		return endpoint.BindApp(si, app)
+	},
+	Backward: func(ctx action.BWContext) {
+		si, app, _ := bindParams(ctx.Params)
+		if err := si.unbindAppEndpoint(app); err != nil {
+			log.Printf("Failed to unbind the app %q from the service instance %q: %s", app.GetName(), si.Name, err)
+		}
+	},
+	MinParams: 2,
+}
+
+// bindUnits is an action that authorizes all units of the app in the service
+// api in Forward, and revokes the authorization in the Backward. If any of the
+// units fails to bind, the units that were bound are unbound before returning
+// the error.
+//
+// It requires the same parameters as addAppToServiceInstance, and passes the
+// result of the previous action (the environment variables of the instance)
+// along.
+var bindUnits = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		bound, err := forEachUnit(app.GetUnits(), func(unit bind.Unit) error {
+			return si.BindUnit(app, unit)
+		})
+		if err != nil {
+			si.unbindUnits(app, bound)
+			return nil, err
+		}
+		return ctx.Previous, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		si, app, _ := bindParams(ctx.Params)
+		si.unbindUnits(app, app.GetUnits())
+	},
+	MinParams: 2,
+}
+
+// setEnvironVariablesToApp is an action that sets the environment variables
+// returned by the service api in the app. It's the last step of the bind, so
+// it can't be undone.
+//
+// It requires the same parameters as addAppToServiceInstance, and the result
+// of the previous action must be the environment variables of the instance.
+var setEnvironVariablesToApp = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		envs, _ := ctx.Previous.(map[string]string)
+		return nil, app.SetEnvs(instanceEnvVars(si, envs), false)
+	},
+	MinParams: 2,
+}
+
+// removeAppFromServiceInstance is an action that removes the app from the
+// list of apps of the service instance in Forward and adds it back in the
+// Backward.
+//
+// It requires the same parameters as addAppToServiceInstance.
+var removeAppFromServiceInstance = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		if err = si.RemoveApp(app.GetName()); err != nil {
+			return nil, &errors.Http{Code: http.StatusPreconditionFailed, Message: "This app is not bound to this service instance."}
+		}
+		return nil, si.update()
+	},
+	Backward: func(ctx action.BWContext) {
+		si, app, _ := bindParams(ctx.Params)
+		if err := si.AddApp(app.GetName()); err == nil {
+			if err = si.update(); err != nil {
+				log.Printf("Failed to add the app %q back to the service instance %q: %s", app.GetName(), si.Name, err)
+			}
+		}
+	},
+	MinParams: 2,
+}
+
+// removeEnvironVariablesFromApp is an action that unsets the environment
+// variables of the service instance in the app in Forward, and restores them
+// in the Backward.
+//
+// It requires the same parameters as addAppToServiceInstance.
+var removeEnvironVariablesFromApp = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		envs := app.InstanceEnv(si.Name)
+		var names []string
+		for name := range envs {
+			names = append(names, name)
+		}
+		return envs, app.UnsetEnvs(names, false)
+	},
+	Backward: func(ctx action.BWContext) {
+		_, app, _ := bindParams(ctx.Params)
+		var envVars []bind.EnvVar
+		for _, env := range ctx.FWResult.(map[string]bind.EnvVar) {
+			envVars = append(envVars, env)
+		}
+		if err := app.SetEnvs(envVars, false); err != nil {
+			log.Printf("Failed to restore the environment variables of the app %q: %s", app.GetName(), err)
+		}
+	},
+	MinParams: 2,
+}
+
+// unbindUnits is an action that revokes the authorization of all units of the
+// app in the service api in Forward, and binds them again in the Backward. If
+// any of the units fails to unbind, the units that were unbound are bound
+// again before returning the error.
+//
+// It requires the same parameters as addAppToServiceInstance.
+var unbindUnits = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		unbound, err := forEachUnit(app.GetUnits(), func(unit bind.Unit) error {
+			return si.UnbindUnit(app, unit)
+		})
+		if err != nil {
+			si.bindUnits(app, unbound)
+			return nil, err
+		}
+		return nil, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		si, app, _ := bindParams(ctx.Params)
+		si.bindUnits(app, app.GetUnits())
+	},
+	MinParams: 2,
+}
+
+// unbindAppEndpoint is an action that unbinds the app in the service api,
+// revoking its credentials. It's the last step of the unbind, so it can't be
+// undone.
+//
+// It requires the same parameters as addAppToServiceInstance.
+var unbindAppEndpoint = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, app, err := bindParams(ctx.Params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, si.unbindAppEndpoint(app)
+	},
+	MinParams: 2,
+}
+
+// removeServiceInstance is an action that removes the service instance from
+// the database in Forward and inserts it back in the Backward.
+//
+// The first argument in the context must be a pointer to a ServiceInstance.
+var removeServiceInstance = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, ok := ctx.Params[0].(*ServiceInstance)
+		if !ok {
+			return nil, stderrors.New("First parameter must be a *ServiceInstance.")
+		}
+		conn, err := db.Conn()
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return nil, conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	},
+	Backward: func(ctx action.BWContext) {
+		si := ctx.Params[0].(*ServiceInstance)
+		conn, err := db.Conn()
+		if err != nil {
+			log.Printf("Could not connect to the database: %s", err)
+			return
+		}
+		defer conn.Close()
+		if err = conn.ServiceInstances().Insert(si); err != nil {
+			log.Printf("Failed to restore the service instance %q: %s", si.Name, err)
+		}
+	},
+	MinParams: 1,
+}
+
+// destroyServiceInstance is an action that destroys the service instance in
+// the service api. Instances of services without an endpoint are not
+// destroyed in any api. It's the last step of the removal, so it can't be
+// undone.
+//
+// It requires the same parameters as removeServiceInstance.
+var destroyServiceInstance = action.Action{
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		si, ok := ctx.Params[0].(*ServiceInstance)
+		if !ok {
+			return nil, stderrors.New("First parameter must be a *ServiceInstance.")
+		}
+		endpoint, err := si.getClient()
+		if err != nil {
+			log.Printf("Not destroying the service instance %q in the service api: %s", si.Name, err)
+			return nil, nil
+		}
+		return nil, endpoint.Destroy(si)
+	},
+	MinParams: 1,
+}
+
+// bindUnits authorizes the given units of the app, logging failures.
+func (si *ServiceInstance) bindUnits(app bind.App, units []bind.Unit) {
+	forEachUnit(units, func(unit bind.Unit) error {
+		err := si.BindUnit(app, unit)
+		if err != nil {
+			log.Printf("Failed to bind the unit %s to the service instance %q: %s", unit.GetIp(), si.Name, err)
+		}
+		return err
+	})
+}
+
+// unbindUnits revokes the authorization of the given units of the app,
+// logging failures.
+func (si *ServiceInstance) unbindUnits(app bind.App, units []bind.Unit) {
+	forEachUnit(units, func(unit bind.Unit) error {
+		err := si.UnbindUnit(app, unit)
+		if err != nil {
+			log.Printf("Failed to unbind the unit %s from the service instance %q: %s", unit.GetIp(), si.Name, err)
+		}
+		return err
+	})
+}
+
+func (si *ServiceInstance) unbindAppEndpoint(app bind.App) error {
+	endpoint, err := si.getClient()
+	if err != nil {
+		return err
+	}
+	return endpoint.UnbindApp(si, app)
+}
@@ -0,0 +1,307 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/globocom/tsuru/action"
+	"github.com/globocom/tsuru/app/bind"
+	"github.com/globocom/tsuru/errors"
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+)
+
+// envApp is a bind.App with many units that keeps its environment variables
+// in memory.
+type envApp struct {
+	name  string
+	units []string
+	env   map[string]bind.EnvVar
+}
+
+func (a *envApp) GetIp() string {
+	return "10.10.10.1"
+}
+
+func (a *envApp) GetName() string {
+	return a.name
+}
+
+func (a *envApp) GetUnits() []bind.Unit {
+	units := make([]bind.Unit, len(a.units))
+	for i, ip := range a.units {
+		units[i] = &FakeUnit{ip: ip}
+	}
+	return units
+}
+
+func (a *envApp) InstanceEnv(name string) map[string]bind.EnvVar {
+	envs := make(map[string]bind.EnvVar)
+	for k, env := range a.env {
+		if env.InstanceName == name {
+			envs[k] = env
+		}
+	}
+	return envs
+}
+
+func (a *envApp) SetEnvs(envs []bind.EnvVar, publicOnly bool) error {
+	for _, env := range envs {
+		a.env[env.Name] = env
+	}
+	return nil
+}
+
+func (a *envApp) UnsetEnvs(names []string, publicOnly bool) error {
+	for _, name := range names {
+		delete(a.env, name)
+	}
+	return nil
+}
+
+// unitsHandler records the units bound to the instance, failing the requests
+// for the units in fail.
+type unitsHandler struct {
+	sync.Mutex
+	bound map[string]bool
+	fail  map[string]bool
+}
+
+func (h *unitsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	defer h.Unlock()
+	r.ParseForm()
+	unit := r.Form.Get("unit-host")
+	if h.fail[unit] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.bound[unit] = r.Method == "POST"
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *unitsHandler) boundUnits() []string {
+	h.Lock()
+	defer h.Unlock()
+	var units []string
+	for unit, bound := range h.bound {
+		if bound {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+	return units
+}
+
+func (s *InstanceSuite) TestAddAppToServiceInstanceForward(c *gocheck.C) {
+	si := ServiceInstance{Name: "mysql"}
+	err := s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	ctx := action.FWContext{Params: []interface{}{&si, &FakeApp{name: "myapp"}}}
+	_, err = addAppToServiceInstance.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Apps, gocheck.DeepEquals, []string{"myapp"})
+}
+
+func (s *InstanceSuite) TestAddAppToServiceInstanceForwardReturnsConflictIfTheAppIsBound(c *gocheck.C) {
+	si := ServiceInstance{Name: "mysql", Apps: []string{"myapp"}}
+	ctx := action.FWContext{Params: []interface{}{&si, &FakeApp{name: "myapp"}}}
+	_, err := addAppToServiceInstance.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusConflict)
+}
+
+func (s *InstanceSuite) TestAddAppToServiceInstanceBackward(c *gocheck.C) {
+	si := ServiceInstance{Name: "mysql", Apps: []string{"otherapp", "myapp"}}
+	err := s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	ctx := action.BWContext{Params: []interface{}{&si, &FakeApp{name: "myapp"}}}
+	addAppToServiceInstance.Backward(ctx)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Apps, gocheck.DeepEquals, []string{"otherapp"})
+}
+
+func (s *InstanceSuite) TestAddAppToServiceInstanceMinParams(c *gocheck.C) {
+	c.Assert(addAppToServiceInstance.MinParams, gocheck.Equals, 2)
+}
+
+func (s *InstanceSuite) TestBindUnitsForward(c *gocheck.C) {
+	h := unitsHandler{bound: map[string]bool{}}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	a := envApp{name: "myapp", units: []string{"10.10.10.1", "10.10.10.2"}}
+	envs := map[string]string{"DATABASE_USER": "root"}
+	ctx := action.FWContext{Params: []interface{}{&si, &a}, Previous: envs}
+	r, err := bindUnits.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r, gocheck.DeepEquals, envs)
+	c.Assert(h.boundUnits(), gocheck.DeepEquals, []string{"10.10.10.1", "10.10.10.2"})
+}
+
+func (s *InstanceSuite) TestBindUnitsForwardUnbindsTheBoundUnitsIfAnUnitFails(c *gocheck.C) {
+	h := unitsHandler{bound: map[string]bool{}, fail: map[string]bool{"10.10.10.2": true}}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	a := envApp{name: "myapp", units: []string{"10.10.10.1", "10.10.10.2", "10.10.10.3"}}
+	ctx := action.FWContext{Params: []interface{}{&si, &a}}
+	_, err = bindUnits.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(h.boundUnits(), gocheck.HasLen, 0)
+}
+
+func (s *InstanceSuite) TestBindUnitsBackward(c *gocheck.C) {
+	h := unitsHandler{bound: map[string]bool{"10.10.10.1": true, "10.10.10.2": true}}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	a := envApp{name: "myapp", units: []string{"10.10.10.1", "10.10.10.2"}}
+	ctx := action.BWContext{Params: []interface{}{&si, &a}}
+	bindUnits.Backward(ctx)
+	c.Assert(h.boundUnits(), gocheck.HasLen, 0)
+}
+
+func (s *InstanceSuite) TestSetEnvironVariablesToAppForward(c *gocheck.C) {
+	si := ServiceInstance{Name: "my-mysql"}
+	a := envApp{name: "myapp", env: map[string]bind.EnvVar{}}
+	envs := map[string]string{"DATABASE_USER": "root"}
+	ctx := action.FWContext{Params: []interface{}{&si, &a}, Previous: envs}
+	_, err := setEnvironVariablesToApp.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]bind.EnvVar{
+		"DATABASE_USER": {Name: "DATABASE_USER", Value: "root", InstanceName: "my-mysql"},
+	}
+	c.Assert(a.env, gocheck.DeepEquals, expected)
+}
+
+func (s *InstanceSuite) TestRemoveAppFromServiceInstanceForwardReturnsPreconditionFailedIfTheAppIsNotBound(c *gocheck.C) {
+	si := ServiceInstance{Name: "mysql"}
+	ctx := action.FWContext{Params: []interface{}{&si, &FakeApp{name: "myapp"}}}
+	_, err := removeAppFromServiceInstance.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusPreconditionFailed)
+}
+
+func (s *InstanceSuite) TestRemoveAppFromServiceInstanceBackward(c *gocheck.C) {
+	si := ServiceInstance{Name: "mysql", Apps: []string{"otherapp"}}
+	err := s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	ctx := action.BWContext{Params: []interface{}{&si, &FakeApp{name: "myapp"}}}
+	removeAppFromServiceInstance.Backward(ctx)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Apps, gocheck.DeepEquals, []string{"otherapp", "myapp"})
+}
+
+func (s *InstanceSuite) TestRemoveEnvironVariablesFromAppForward(c *gocheck.C) {
+	si := ServiceInstance{Name: "my-mysql"}
+	a := envApp{
+		name: "myapp",
+		env: map[string]bind.EnvVar{
+			"DATABASE_USER": {Name: "DATABASE_USER", Value: "root", InstanceName: "my-mysql"},
+			"MY_VAR":        {Name: "MY_VAR", Value: "123", Public: true},
+		},
+	}
+	ctx := action.FWContext{Params: []interface{}{&si, &a}}
+	r, err := removeEnvironVariablesFromApp.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string]bind.EnvVar{
+		"DATABASE_USER": {Name: "DATABASE_USER", Value: "root", InstanceName: "my-mysql"},
+	}
+	c.Assert(r, gocheck.DeepEquals, expected)
+	c.Assert(a.env, gocheck.DeepEquals, map[string]bind.EnvVar{"MY_VAR": {Name: "MY_VAR", Value: "123", Public: true}})
+}
+
+func (s *InstanceSuite) TestRemoveEnvironVariablesFromAppBackward(c *gocheck.C) {
+	si := ServiceInstance{Name: "my-mysql"}
+	a := envApp{name: "myapp", env: map[string]bind.EnvVar{}}
+	removed := map[string]bind.EnvVar{
+		"DATABASE_USER": {Name: "DATABASE_USER", Value: "root", InstanceName: "my-mysql"},
+	}
+	ctx := action.BWContext{Params: []interface{}{&si, &a}, FWResult: removed}
+	removeEnvironVariablesFromApp.Backward(ctx)
+	c.Assert(a.env, gocheck.DeepEquals, removed)
+}
+
+func (s *InstanceSuite) TestUnbindUnitsForwardBindsTheUnboundUnitsIfAnUnitFails(c *gocheck.C) {
+	h := unitsHandler{
+		bound: map[string]bool{"10.10.10.1": true, "10.10.10.2": true},
+		fail:  map[string]bool{"10.10.10.2": true},
+	}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	a := envApp{name: "myapp", units: []string{"10.10.10.1", "10.10.10.2"}}
+	ctx := action.FWContext{Params: []interface{}{&si, &a}}
+	_, err = unbindUnits.Forward(ctx)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(h.boundUnits(), gocheck.DeepEquals, []string{"10.10.10.1", "10.10.10.2"})
+}
+
+func (s *InstanceSuite) TestUnbindUnitsBackward(c *gocheck.C) {
+	h := unitsHandler{bound: map[string]bool{}}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	srv := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	a := envApp{name: "myapp", units: []string{"10.10.10.1", "10.10.10.2"}}
+	ctx := action.BWContext{Params: []interface{}{&si, &a}}
+	unbindUnits.Backward(ctx)
+	c.Assert(h.boundUnits(), gocheck.DeepEquals, []string{"10.10.10.1", "10.10.10.2"})
+}
+
+func (s *InstanceSuite) TestRemoveServiceInstanceBackward(c *gocheck.C) {
+	si := ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{"Raul"}}
+	ctx := action.BWContext{Params: []interface{}{&si}}
+	removeServiceInstance.Backward(ctx)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Teams, gocheck.DeepEquals, []string{"Raul"})
+}
+
+func (s *InstanceSuite) TestDestroyServiceInstanceForwardIgnoresServicesWithoutEndpoint(c *gocheck.C) {
+	srv := Service{Name: "mysql"}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "my-mysql", ServiceName: srv.Name}
+	ctx := action.FWContext{Params: []interface{}{&si}}
+	_, err = destroyServiceInstance.Forward(ctx)
+	c.Assert(err, gocheck.IsNil)
+}
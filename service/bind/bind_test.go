@@ -64,10 +64,12 @@ func createTestApp(conn *db.Storage, name, framework string, teams []string, uni
 }
 
 func (s *S) TestBindUnit(c *gocheck.C) {
-	called := false
+	var called bool
+	var path string
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		called = true
-		w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+		path = r.URL.Path
+		w.WriteHeader(http.StatusCreated)
 	}))
 	defer ts.Close()
 	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
@@ -80,14 +82,10 @@ func (s *S) TestBindUnit(c *gocheck.C) {
 	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "10.10.10.10"}})
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
-	envs, err := instance.BindUnit(&a, a.GetUnits()[0])
+	err = instance.BindUnit(&a, a.GetUnits()[0])
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(called, gocheck.Equals, true)
-	expectedEnvs := map[string]string{
-		"DATABASE_USER":     "root",
-		"DATABASE_PASSWORD": "s3cr3t",
-	}
-	c.Assert(envs, gocheck.DeepEquals, expectedEnvs)
+	c.Assert(path, gocheck.Equals, "/resources/my-mysql/bind")
 }
 
 func (s *S) TestBindAddsWhenEndpointIsDown(c *gocheck.C) {
@@ -105,6 +103,50 @@ func (s *S) TestBindAddsWhenEndpointIsDown(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 }
 
+func (s *S) TestBindRefusesPendingInstances(c *gocheck.C) {
+	var called int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&called, 1)
+		w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}, State: service.StatePending}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "10.10.10.10"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.BindApp(&a)
+	c.Assert(err, gocheck.NotNil)
+	e, ok := err.(*errors.Http)
+	c.Assert(ok, gocheck.Equals, true)
+	c.Assert(e.Code, gocheck.Equals, http.StatusPreconditionFailed)
+	c.Assert(e.Message, gocheck.Equals, "You cannot bind any app to this service instance because it is not ready yet.")
+	c.Assert(atomic.LoadInt32(&called), gocheck.Equals, int32(0))
+	s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(instance.Apps, gocheck.HasLen, 0)
+}
+
+func (s *S) TestBindRefusesFailedInstances(c *gocheck.C) {
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": "http://localhost:1"}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}, State: service.StateFailed}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "10.10.10.10"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.BindApp(&a)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, "^You cannot bind any app to this service instance because it failed to be created.$")
+}
+
 func (s *S) TestBindAddsAppToTheServiceInstance(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
@@ -169,10 +211,15 @@ func (s *S) TestBindCallTheServiceAPIAndSetsEnvironmentVariableReturnedFromTheCa
 }
 
 func (s *S) TestBindAppMultiUnits(c *gocheck.C) {
-	var calls int32
+	var appCalls, unitCalls int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
-		calls++
+		if r.URL.Path == "/resources/my-mysql/bind-app" {
+			atomic.AddInt32(&appCalls, 1)
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+			return
+		}
+		atomic.AddInt32(&unitCalls, 1)
+		w.WriteHeader(http.StatusCreated)
 	}))
 	defer ts.Close()
 	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
@@ -192,19 +239,71 @@ func (s *S) TestBindAppMultiUnits(c *gocheck.C) {
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
 	err = instance.BindApp(&a)
 	c.Assert(err, gocheck.IsNil)
-	ok := make(chan bool)
-	go func() {
-		t := time.Tick(1)
-		for _ = <-t; atomic.LoadInt32(&calls) < 2; _ = <-t {
+	c.Assert(atomic.LoadInt32(&appCalls), gocheck.Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&unitCalls), gocheck.Equals, int32(2))
+}
+
+func (s *S) TestBindAppReturnsErrorIfAnUnitFailsToBind(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app" {
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+			return
 		}
-		ok <- true
-	}()
-	select {
-	case <-ok:
-	case <-time.After(2e9):
-		c.Errorf("Did not bind all units afters 2s.")
-	}
-	c.Assert(calls, gocheck.Equals, int32(2))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("firewall is down"))
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = instance.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "127.0.0.1"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.BindApp(&a)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to bind instance my-mysql to the unit 127.0.0.1: firewall is down$")
+}
+
+func (s *S) TestBindAppRollsBackIfAnUnitFailsToBind(c *gocheck.C) {
+	var unbound int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app" {
+			if r.Method == "DELETE" {
+				atomic.StoreInt32(&unbound, 1)
+			}
+			w.Write([]byte(`{"DATABASE_USER":"root","DATABASE_PASSWORD":"s3cr3t"}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("firewall is down"))
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{Name: "my-mysql", ServiceName: "mysql", Teams: []string{s.team.Name}}
+	err = instance.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "127.0.0.1"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.BindApp(&a)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(atomic.LoadInt32(&unbound), gocheck.Equals, int32(1))
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Apps, gocheck.HasLen, 0)
+	newApp := app.App{Name: a.Name}
+	err = newApp.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(newApp.InstanceEnv(instance.Name), gocheck.HasLen, 0)
 }
 
 func (s *S) TestBindReturnConflictIfTheAppIsAlreadyBound(c *gocheck.C) {
@@ -257,9 +356,11 @@ func (s *S) TestBindReturnsPreconditionFailedIfTheAppDoesNotHaveAnUnitAndService
 }
 
 func (s *S) TestUnbindUnit(c *gocheck.C) {
-	called := false
+	var called bool
+	var path string
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		called = true
+		path = r.URL.Path
 		w.WriteHeader(http.StatusNoContent)
 	}))
 	defer ts.Close()
@@ -278,9 +379,42 @@ func (s *S) TestUnbindUnit(c *gocheck.C) {
 	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "10.10.10.10"}})
 	c.Assert(err, gocheck.IsNil)
 	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
-	err = instance.UnbindUnit(a.GetUnits()[0])
+	err = instance.UnbindUnit(&a, a.GetUnits()[0])
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(called, gocheck.Equals, true)
+	c.Assert(path, gocheck.Equals, "/resources/my-mysql/bind")
+}
+
+func (s *S) TestUnbindAppRevokesTheCredentialsOnce(c *gocheck.C) {
+	var appCalls, unitCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/resources/my-mysql/bind-app" {
+			atomic.AddInt32(&appCalls, 1)
+		} else {
+			atomic.AddInt32(&unitCalls, 1)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		Apps:        []string{"painkiller"},
+	}
+	instance.Create()
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": "my-mysql"})
+	a, err := createTestApp(s.conn, "painkiller", "", []string{s.team.Name}, []app.Unit{{Ip: "10.10.10.10"}, {Ip: "9.9.9.9"}})
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.UnbindApp(&a)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(atomic.LoadInt32(&appCalls), gocheck.Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&unitCalls), gocheck.Equals, int32(2))
 }
 
 func (s *S) TestUnbindMultiUnits(c *gocheck.C) {
@@ -407,6 +541,60 @@ func (s *S) TestUnbindRemovesEnvironmentVariableFromApp(c *gocheck.C) {
 	c.Assert(a.Env, gocheck.DeepEquals, expected)
 }
 
+func (s *S) TestUnbindAppRollsBackIfTheServiceApiFails(c *gocheck.C) {
+	var rebound int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && r.URL.Path == "/resources/my-mysql/bind-app" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("database is down"))
+			return
+		}
+		if r.Method == "POST" && r.URL.Path == "/resources/my-mysql/bind" {
+			atomic.StoreInt32(&rebound, 1)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srvc := service.Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	err := srvc.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().Remove(bson.M{"_id": "mysql"})
+	instance := service.ServiceInstance{
+		Name:        "my-mysql",
+		ServiceName: "mysql",
+		Teams:       []string{s.team.Name},
+		Apps:        []string{"painkiller"},
+	}
+	err = instance.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"_id": "my-mysql"})
+	env := bind.EnvVar{
+		Name:         "DATABASE_HOST",
+		Value:        "arrea",
+		Public:       false,
+		InstanceName: instance.Name,
+	}
+	a := app.App{
+		Name:  "painkiller",
+		Teams: []string{s.team.Name},
+		Env:   map[string]bind.EnvVar{"DATABASE_HOST": env},
+		Units: []app.Unit{{Ip: "10.10.10.10"}},
+	}
+	err = s.conn.Apps().Insert(&a)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Apps().Remove(bson.M{"name": a.Name})
+	err = instance.UnbindApp(&a)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to unbind instance my-mysql from the app painkiller: database is down$")
+	c.Assert(atomic.LoadInt32(&rebound), gocheck.Equals, int32(1))
+	err = s.conn.ServiceInstances().Find(bson.M{"name": instance.Name}).One(&instance)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.Apps, gocheck.DeepEquals, []string{"painkiller"})
+	newApp := app.App{Name: a.Name}
+	err = newApp.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(newApp.Env, gocheck.DeepEquals, map[string]bind.EnvVar{"DATABASE_HOST": env})
+}
+
 func (s *S) TestUnbindCallsTheUnbindMethodFromAPI(c *gocheck.C) {
 	var called int32
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,77 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/globocom/tsuru/auth"
+	"github.com/globocom/tsuru/db"
+	"strings"
+)
+
+// CatalogEntry represents a service in the catalog of services.
+type CatalogEntry struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	DocUrl      string   `json:"doc_url"`
+	Maintainer  string   `json:"maintainer"`
+	Plans       []Plan   `json:"plans"`
+}
+
+// CatalogEntry returns the entry of the service in the catalog of services.
+// The plans of the entry are the plans declared in the manifest of the
+// service, the service api is not called.
+func (s *Service) CatalogEntry() CatalogEntry {
+	return CatalogEntry{
+		Name:        s.Name,
+		Description: s.Description,
+		Tags:        s.Tags,
+		DocUrl:      s.DocUrl,
+		Maintainer:  s.Maintainer,
+		Plans:       s.Plans,
+	}
+}
+
+// Matches reports whether the service matches the given query. The query is
+// split in words, and each word must be found (ignoring case) in the name, in
+// the description, in the maintainer or in one of the tags of the service. An
+// empty query matches all services.
+func (s *Service) Matches(query string) bool {
+	fields := append([]string{s.Name, s.Description, s.Maintainer}, s.Tags...)
+	text := strings.ToLower(strings.Join(fields, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchCatalog returns the catalog entries of the services available to the
+// user that match the given query, sorted by name.
+func SearchCatalog(u *auth.User, query string) ([]CatalogEntry, error) {
+	teams, err := u.Teams()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	q := availableServicesQuery("teams", auth.GetTeamsNames(teams))
+	var services []Service
+	err = conn.Services().Find(q).Sort("_id").All(&services)
+	if err != nil {
+		return nil, err
+	}
+	entries := []CatalogEntry{}
+	for _, s := range services {
+		if s.Matches(query) {
+			entries = append(entries, s.CatalogEntry())
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"launchpad.net/gocheck"
+)
+
+func (s *S) TestServiceMatches(c *gocheck.C) {
+	srv := Service{
+		Name:        "mysql",
+		Description: "MySQL databases",
+		Tags:        []string{"database", "sql"},
+		Maintainer:  "dba",
+	}
+	c.Assert(srv.Matches(""), gocheck.Equals, true)
+	c.Assert(srv.Matches("mysql"), gocheck.Equals, true)
+	c.Assert(srv.Matches("DATABASE"), gocheck.Equals, true)
+	c.Assert(srv.Matches("sql dba"), gocheck.Equals, true)
+	c.Assert(srv.Matches("databases"), gocheck.Equals, true)
+	c.Assert(srv.Matches("sql cache"), gocheck.Equals, false)
+	c.Assert(srv.Matches("redis"), gocheck.Equals, false)
+}
+
+func (s *S) TestServiceCatalogEntry(c *gocheck.C) {
+	srv := Service{
+		Name:        "mysql",
+		Description: "MySQL databases",
+		Tags:        []string{"database"},
+		DocUrl:      "http://mysql.tsuru.io",
+		Maintainer:  "dba",
+		Plans:       []Plan{{Name: "small", Description: "1 GB"}},
+		Password:    "s3cr3t",
+	}
+	expected := CatalogEntry{
+		Name:        "mysql",
+		Description: "MySQL databases",
+		Tags:        []string{"database"},
+		DocUrl:      "http://mysql.tsuru.io",
+		Maintainer:  "dba",
+		Plans:       []Plan{{Name: "small", Description: "1 GB"}},
+	}
+	c.Assert(srv.CatalogEntry(), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestSearchCatalog(c *gocheck.C) {
+	services := []Service{
+		{Name: "redis", Description: "Key-value store", Tags: []string{"cache"}},
+		{Name: "mysql", Description: "MySQL databases", Tags: []string{"database"}},
+		{Name: "postgresql", Description: "PostgreSQL databases", IsRestricted: true, Teams: []string{s.team.Name}},
+		{Name: "oracle", Description: "Oracle databases", IsRestricted: true},
+		{Name: "mongodb", Description: "MongoDB databases", Status: "deleted"},
+	}
+	for _, srv := range services {
+		err := s.conn.Services().Insert(srv)
+		c.Assert(err, gocheck.IsNil)
+	}
+	entries, err := SearchCatalog(s.user, "databases")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(entries, gocheck.HasLen, 2)
+	c.Assert(entries[0].Name, gocheck.Equals, "mysql")
+	c.Assert(entries[1].Name, gocheck.Equals, "postgresql")
+	entries, err = SearchCatalog(s.user, "")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(entries, gocheck.HasLen, 3)
+	entries, err = SearchCatalog(s.user, "riak")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(entries, gocheck.DeepEquals, []CatalogEntry{})
+}
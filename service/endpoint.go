@@ -13,13 +13,21 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
-	"regexp"
+	"path"
 	"strings"
 )
 
+// Client is a client of the api of a service.
+//
+// When the service has a password, the client authenticates all requests to
+// the api using HTTP basic authentication, with the name of the service as
+// the username.
 type Client struct {
 	endpoint string
+	username string
+	password string
 }
 
 func (c *Client) buildErrorMessage(err error, resp *http.Response) string {
@@ -45,11 +53,14 @@ func (c *Client) issueRequest(path, method string, params map[string][]string) (
 	}
 	url := strings.TrimRight(c.endpoint, "/") + "/" + strings.Trim(path, "/") + suffix
 	req, err := http.NewRequest(method, url, body)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	if err != nil {
 		log.Printf("Got error while creating request: %s", err)
 		return nil, err
 	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
 	return http.DefaultClient.Do(req)
 }
 
@@ -64,6 +75,10 @@ func (c *Client) jsonFromResponse(resp *http.Response, v interface{}) error {
 	return json.Unmarshal(body, &v)
 }
 
+// Create creates the instance in the service api. The api may create the
+// instance asynchronously, responding with 202 (accepted): in this case, the
+// state of the instance is set to pending, and tsuru polls its status until
+// it is ready. Otherwise, the state of the instance is set to ready.
 func (c *Client) Create(instance *ServiceInstance) error {
 	var err error
 	log.Print("Attempting to call creation of service instance " + instance.Name + " at " + instance.ServiceName + " api")
@@ -71,7 +86,15 @@ func (c *Client) Create(instance *ServiceInstance) error {
 	params := map[string][]string{
 		"name": {instance.Name},
 	}
+	if instance.PlanName != "" {
+		params["plan"] = []string{instance.PlanName}
+	}
 	if resp, err = c.issueRequest("/resources", "POST", params); err == nil && resp.StatusCode < 300 {
+		if resp.StatusCode == http.StatusAccepted {
+			instance.State = StatePending
+		} else {
+			instance.State = StateReady
+		}
 		return nil
 	} else {
 		msg := "Failed to create the instance " + instance.Name + ": " + c.buildErrorMessage(err, resp)
@@ -92,21 +115,44 @@ func (c *Client) Destroy(instance *ServiceInstance) error {
 	return err
 }
 
-func (c *Client) Bind(instance *ServiceInstance, app bind.App, unit bind.Unit) (map[string]string, error) {
-	log.Print("Attempting to call bind of service instance " + instance.Name + " and unit " + unit.GetIp() + " at " + instance.ServiceName + " api")
-	var resp *http.Response
+// legacyBind binds the unit of the app via POST on /resources/<name>, as
+// expected by service apis written before the introduction of bind-app.
+func (c *Client) legacyBind(instance *ServiceInstance, app bind.App, unit bind.Unit) (*http.Response, error) {
 	params := map[string][]string{
-		"unit-host": {unit.GetIp()},
-		"app-host":  {app.GetIp()},
+		"app-host": {app.GetIp()},
 	}
-	resp, err := c.issueRequest("/resources/"+instance.Name, "POST", params)
-	if err != nil {
-		if m, _ := regexp.MatchString("", err.Error()); m {
-			return nil, fmt.Errorf("%s api is down.", instance.Name)
+	if unit != nil {
+		params["unit-host"] = []string{unit.GetIp()}
+	}
+	return c.issueRequest("/resources/"+instance.Name, "POST", params)
+}
+
+// BindApp binds the app to the instance, returning the environment variables
+// (credentials) that the app will use to connect to the instance. The service
+// api is called once per app, via POST on /resources/<name>/bind-app.
+//
+// Service apis that respond with 404 don't support bind-app: the app is bound
+// via POST on /resources/<name>, with its first unit, as before.
+func (c *Client) BindApp(instance *ServiceInstance, app bind.App) (map[string]string, error) {
+	log.Print("Attempting to call bind of service instance " + instance.Name + " and app " + app.GetName() + " at " + instance.ServiceName + " api")
+	params := map[string][]string{
+		"app-name": {app.GetName()},
+		"app-host": {app.GetIp()},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.Name+"/bind-app", "POST", params)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		log.Print("The " + instance.ServiceName + " api does not support bind-app, falling back to the legacy bind")
+		var unit bind.Unit
+		if units := app.GetUnits(); len(units) > 0 {
+			unit = units[0]
 		}
-		return nil, err
+		resp, err = c.legacyBind(instance, app, unit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s api is down.", instance.Name)
 	}
-	if err == nil && resp.StatusCode < 300 {
+	if resp.StatusCode < 300 {
 		var result map[string]string
 		err = c.jsonFromResponse(resp, &result)
 		if err != nil {
@@ -117,16 +163,87 @@ func (c *Client) Bind(instance *ServiceInstance, app bind.App, unit bind.Unit) (
 	if resp.StatusCode == http.StatusPreconditionFailed {
 		return nil, &errors.Http{Code: resp.StatusCode, Message: "You cannot bind any app to this service instance because it is not ready yet."}
 	}
-	msg := "Failed to bind instance " + instance.Name + " to the unit " + unit.GetIp() + ": " + c.buildErrorMessage(err, resp)
+	msg := "Failed to bind instance " + instance.Name + " to the app " + app.GetName() + ": " + c.buildErrorMessage(err, resp)
 	log.Print(msg)
 	return nil, &errors.Http{Code: http.StatusInternalServerError, Message: msg}
 }
 
-func (c *Client) Unbind(instance *ServiceInstance, unit bind.Unit) error {
+// BindUnit authorizes the unit of the app to connect to the instance, via
+// POST on /resources/<name>/bind. It does not generate new credentials, units
+// use the credentials returned by BindApp.
+//
+// Service apis that respond with 404 don't support bind: the unit is bound
+// via POST on /resources/<name>, as before, ignoring the returned variables.
+func (c *Client) BindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
+	log.Print("Attempting to call bind of service instance " + instance.Name + " and unit " + unit.GetIp() + " at " + instance.ServiceName + " api")
+	params := map[string][]string{
+		"app-host":  {app.GetIp()},
+		"unit-host": {unit.GetIp()},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.Name+"/bind", "POST", params)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		log.Print("The " + instance.ServiceName + " api does not support bind, falling back to the legacy bind")
+		resp, err = c.legacyBind(instance, app, unit)
+	}
+	if err != nil {
+		return fmt.Errorf("%s api is down.", instance.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return &errors.Http{Code: resp.StatusCode, Message: "You cannot bind any app to this service instance because it is not ready yet."}
+	}
+	msg := "Failed to bind instance " + instance.Name + " to the unit " + unit.GetIp() + ": " + c.buildErrorMessage(err, resp)
+	log.Print(msg)
+	return &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+}
+
+// UnbindApp unbinds the app from the instance, revoking the credentials
+// returned by BindApp, via DELETE on /resources/<name>/bind-app.
+//
+// Service apis that respond with 404 don't support bind-app, and have nothing
+// to revoke besides the units of the app, so the response is ignored.
+func (c *Client) UnbindApp(instance *ServiceInstance, app bind.App) error {
+	log.Print("Attempting to call unbind of service instance " + instance.Name + " and app " + app.GetName() + " at " + instance.ServiceName + " api")
+	params := map[string][]string{
+		"app-name": {app.GetName()},
+		"app-host": {app.GetIp()},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.Name+"/bind-app", "DELETE", params)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		log.Print("The " + instance.ServiceName + " api does not support bind-app, skipping the unbind of the app")
+		return nil
+	}
+	if err == nil && resp.StatusCode > 299 {
+		msg := "Failed to unbind instance " + instance.Name + " from the app " + app.GetName() + ": " + c.buildErrorMessage(err, resp)
+		log.Print(msg)
+		return &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	}
+	return err
+}
+
+// UnbindUnit revokes the authorization of the unit to connect to the
+// instance, via DELETE on /resources/<name>/bind. The credentials of the app
+// are kept, as other units still use them.
+//
+// Service apis that respond with 404 don't support bind: the unit is unbound
+// via DELETE on /resources/<name>/hostname/<unit-host>, as before.
+func (c *Client) UnbindUnit(instance *ServiceInstance, app bind.App, unit bind.Unit) error {
 	log.Print("Attempting to call unbind of service instance " + instance.Name + " and unit " + unit.GetIp() + " at " + instance.ServiceName + " api")
-	var resp *http.Response
-	url := "/resources/" + instance.Name + "/hostname/" + unit.GetIp()
-	resp, err := c.issueRequest(url, "DELETE", nil)
+	params := map[string][]string{
+		"app-host":  {app.GetIp()},
+		"unit-host": {unit.GetIp()},
+	}
+	resp, err := c.issueRequest("/resources/"+instance.Name+"/bind", "DELETE", params)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		log.Print("The " + instance.ServiceName + " api does not support bind, falling back to the legacy unbind")
+		resp, err = c.issueRequest("/resources/"+instance.Name+"/hostname/"+unit.GetIp(), "DELETE", nil)
+	}
 	if err == nil && resp.StatusCode > 299 {
 		msg := "Failed to unbind instance " + instance.Name + " from the unit " + unit.GetIp() + ": " + c.buildErrorMessage(err, resp)
 		log.Print(msg)
@@ -182,3 +299,62 @@ func (c *Client) Info(instance *ServiceInstance) ([]map[string]string, error) {
 	}
 	return result, nil
 }
+
+// Plans returns the plans offered by the service.
+// The api should be prepared to receive the request,
+// like below:
+// GET /resources/plans
+// The response body must be a JSON list of plans, each one with a name and a
+// description. 404 means the service does not offer plans.
+func (c *Client) Plans() ([]Plan, error) {
+	log.Print("Attempting to call plans of service at " + c.endpoint)
+	resp, err := c.issueRequest("/resources/plans", "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := "Failed to get the plans of the service: " + c.buildErrorMessage(err, resp)
+		log.Print(msg)
+		return nil, &errors.Http{Code: http.StatusInternalServerError, Message: msg}
+	}
+	var plans []Plan
+	err = c.jsonFromResponse(resp, &plans)
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// Proxy forwards the request to the api of the service, on the given path
+// under /resources/<name>, and writes the response of the api to w. The
+// credentials of the user are not forwarded: the request is authenticated as
+// any other request issued by tsuru.
+func (c *Client) Proxy(instance *ServiceInstance, callback string, w http.ResponseWriter, r *http.Request) error {
+	target, err := url.Parse(c.endpoint)
+	if err != nil {
+		return err
+	}
+	log.Printf("Proxying request to %s on the service instance %s", callback, instance.Name)
+	resourcePath := "/resources/" + instance.Name + path.Clean("/"+callback)
+	director := func(req *http.Request) {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.URL.Path = strings.TrimRight(target.Path, "/") + resourcePath
+		q := req.URL.Query()
+		q.Del(":instance")
+		q.Del("callback")
+		req.URL.RawQuery = q.Encode()
+		req.Host = target.Host
+		req.Header.Del("Authorization")
+		if c.password != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+	}
+	proxy := &httputil.ReverseProxy{Director: director}
+	proxy.ServeHTTP(w, r)
+	return nil
+}
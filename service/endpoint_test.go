@@ -5,6 +5,7 @@
 package service
 
 import (
+	"encoding/base64"
 	stderrors "errors"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/errors"
@@ -117,6 +118,87 @@ func (s *S) TestCreateShouldSendTheNameOfTheResourceToTheEndpoint(c *gocheck.C)
 	c.Assert("application/x-www-form-urlencoded", gocheck.DeepEquals, h.request.Header.Get("Content-Type"))
 }
 
+func (s *S) TestCreateShouldSendThePlanToTheEndpoint(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis", PlanName: "small"}
+	client := &Client{endpoint: ts.URL}
+	err := client.Create(&instance)
+	c.Assert(err, gocheck.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string][]string{"name": {"my-redis"}, "plan": {"small"}}
+	c.Assert(map[string][]string(v), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCreateSetsTheInstanceAsReady(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL}
+	err := client.Create(&instance)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StateReady)
+}
+
+func (s *S) TestCreateSetsTheInstanceAsPendingWhenTheRequestIsAccepted(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL}
+	err := client.Create(&instance)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StatePending)
+}
+
+func (s *S) TestCreateShouldAuthenticateWithBasicAuth(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "redis", password: "s3cr3t"}
+	err := client.Create(&instance)
+	c.Assert(err, gocheck.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("redis:s3cr3t"))
+	c.Assert(h.request.Header.Get("Authorization"), gocheck.Equals, expected)
+}
+
+func (s *S) TestIssueRequestWithoutPasswordDoesNotAuthenticate(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL, username: "redis"}
+	resp, err := client.issueRequest("/resources/plans", "GET", nil)
+	c.Assert(err, gocheck.IsNil)
+	resp.Body.Close()
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(h.request.Header.Get("Authorization"), gocheck.Equals, "")
+}
+
+func (s *S) TestDestroyShouldAuthenticateWithBasicAuth(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "his-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "redis", password: "s3cr3t"}
+	err := client.Destroy(&instance)
+	c.Assert(err, gocheck.IsNil)
+	h.Lock()
+	defer h.Unlock()
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("redis:s3cr3t"))
+	c.Assert(h.request.Header.Get("Authorization"), gocheck.Equals, expected)
+}
+
 func (s *S) TestCreateShouldReturnErrorIfTheRequestFail(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
@@ -151,19 +233,19 @@ func (s *S) TestDestroyShouldReturnErrorIfTheRequestFails(c *gocheck.C) {
 	c.Assert(err, gocheck.ErrorMatches, "^Failed to destroy the instance "+instance.Name+": Server failed to do its job.$")
 }
 
-func (s *S) TestBindWithEndopintDown(c *gocheck.C) {
+func (s *S) TestBindAppWithEndopintDown(c *gocheck.C) {
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
 	a := FakeApp{
 		name: "her-app",
 		ip:   "10.0.10.1",
 	}
 	client := &Client{endpoint: "http://naoexites.com"}
-	_, err := client.Bind(&instance, &a, a.GetUnits()[0])
+	_, err := client.BindApp(&instance, &a)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err, gocheck.ErrorMatches, "^her-redis api is down.$")
 }
 
-func (s *S) TestBindShouldSendAPOSTToTheResourceURL(c *gocheck.C) {
+func (s *S) TestBindAppShouldSendAPOSTToTheResourceURL(c *gocheck.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
 	defer ts.Close()
@@ -173,19 +255,19 @@ func (s *S) TestBindShouldSendAPOSTToTheResourceURL(c *gocheck.C) {
 		ip:   "10.0.10.1",
 	}
 	client := &Client{endpoint: ts.URL}
-	_, err := client.Bind(&instance, &a, a.GetUnits()[0])
+	_, err := client.BindApp(&instance, &a)
 	h.Lock()
 	defer h.Unlock()
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(h.url, gocheck.Equals, "/resources/"+instance.Name)
+	c.Assert(h.url, gocheck.Equals, "/resources/"+instance.Name+"/bind-app")
 	c.Assert(h.method, gocheck.Equals, "POST")
 	v, err := url.ParseQuery(string(h.body))
 	c.Assert(err, gocheck.IsNil)
-	expected := map[string][]string{"unit-host": {"10.0.10.1"}, "app-host": {"10.0.10.1"}}
+	expected := map[string][]string{"app-name": {"her-app"}, "app-host": {"10.0.10.1"}}
 	c.Assert(map[string][]string(v), gocheck.DeepEquals, expected)
 }
 
-func (s *S) TestBindShouldReturnMapWithTheEnvironmentVariable(c *gocheck.C) {
+func (s *S) TestBindAppShouldReturnMapWithTheEnvironmentVariable(c *gocheck.C) {
 	expected := map[string]string{
 		"MYSQL_DATABASE_NAME": "CHICO",
 		"MYSQL_HOST":          "localhost",
@@ -200,12 +282,12 @@ func (s *S) TestBindShouldReturnMapWithTheEnvironmentVariable(c *gocheck.C) {
 		ip:   "10.0.10.1",
 	}
 	client := &Client{endpoint: ts.URL}
-	env, err := client.Bind(&instance, &a, a.GetUnits()[0])
+	env, err := client.BindApp(&instance, &a)
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(env, gocheck.DeepEquals, expected)
 }
 
-func (s *S) TestBindShouldReturnErrorIfTheRequestFail(c *gocheck.C) {
+func (s *S) TestBindAppShouldReturnErrorIfTheRequestFail(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
 	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
@@ -214,12 +296,12 @@ func (s *S) TestBindShouldReturnErrorIfTheRequestFail(c *gocheck.C) {
 		ip:   "10.0.10.1",
 	}
 	client := &Client{endpoint: ts.URL}
-	_, err := client.Bind(&instance, &a, a.GetUnits()[0])
+	_, err := client.BindApp(&instance, &a)
 	c.Assert(err, gocheck.NotNil)
-	c.Assert(err, gocheck.ErrorMatches, "^Failed to bind instance her-redis to the unit 10.0.10.1: Server failed to do its job.$")
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to bind instance her-redis to the app her-app: Server failed to do its job.$")
 }
 
-func (s *S) TestBindShouldReturnPreconditionFailedIfServiceAPIReturnPreconditionFailed(c *gocheck.C) {
+func (s *S) TestBindAppShouldReturnPreconditionFailedIfServiceAPIReturnPreconditionFailed(c *gocheck.C) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(412)
 	})
@@ -231,14 +313,82 @@ func (s *S) TestBindShouldReturnPreconditionFailedIfServiceAPIReturnPrecondition
 		ip:   "10.0.10.1",
 	}
 	client := &Client{endpoint: ts.URL}
-	_, err := client.Bind(&instance, &a, a.GetUnits()[0])
+	_, err := client.BindApp(&instance, &a)
 	c.Assert(err, gocheck.NotNil)
 	e, ok := err.(*errors.Http)
 	c.Assert(ok, gocheck.Equals, true)
 	c.Assert(e.Message, gocheck.Equals, "You cannot bind any app to this service instance because it is not ready yet.")
 }
 
-func (s *S) TestUnbindSendADELETERequestToTheResourceURL(c *gocheck.C) {
+func (s *S) TestBindUnitShouldSendAPOSTToTheResourceURL(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{
+		name: "her-app",
+		ip:   "10.0.10.1",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.BindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.url, gocheck.Equals, "/resources/"+instance.Name+"/bind")
+	c.Assert(h.method, gocheck.Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string][]string{"unit-host": {"10.0.10.2"}, "app-host": {"10.0.10.1"}}
+	c.Assert(map[string][]string(v), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestBindUnitShouldReturnErrorIfTheRequestFail(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{
+		name: "her-app",
+		ip:   "10.0.10.1",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.BindUnit(&instance, &a, a.GetUnits()[0])
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to bind instance her-redis to the unit 10.0.10.1: Server failed to do its job.$")
+}
+
+func (s *S) TestUnbindAppSendADELETERequestToTheResourceURL(c *gocheck.C) {
+	h := TestHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
+	a := FakeApp{
+		name: "arch-enemy",
+		ip:   "2.2.2.2",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.UnbindApp(&instance, &a)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.url, gocheck.Equals, "/resources/heaven-can-wait/bind-app?app-host=2.2.2.2&app-name=arch-enemy")
+	c.Assert(h.method, gocheck.Equals, "DELETE")
+}
+
+func (s *S) TestUnbindAppReturnsErrorIfTheRequestFails(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
+	a := FakeApp{
+		name: "arch-enemy",
+		ip:   "2.2.2.2",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.UnbindApp(&instance, &a)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to unbind instance heaven-can-wait from the app arch-enemy: Server failed to do its job.$")
+}
+
+func (s *S) TestUnbindUnitSendADELETERequestToTheResourceURL(c *gocheck.C) {
 	h := TestHandler{}
 	ts := httptest.NewServer(&h)
 	defer ts.Close()
@@ -248,15 +398,15 @@ func (s *S) TestUnbindSendADELETERequestToTheResourceURL(c *gocheck.C) {
 		ip:   "2.2.2.2",
 	}
 	client := &Client{endpoint: ts.URL}
-	err := client.Unbind(&instance, a.GetUnits()[0])
+	err := client.UnbindUnit(&instance, &a, &FakeUnit{ip: "2.2.2.3"})
 	h.Lock()
 	defer h.Unlock()
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(h.url, gocheck.Equals, "/resources/heaven-can-wait/hostname/2.2.2.2")
+	c.Assert(h.url, gocheck.Equals, "/resources/heaven-can-wait/bind?app-host=2.2.2.2&unit-host=2.2.2.3")
 	c.Assert(h.method, gocheck.Equals, "DELETE")
 }
 
-func (s *S) TestUnbindReturnsErrorIfTheRequestFails(c *gocheck.C) {
+func (s *S) TestUnbindUnitReturnsErrorIfTheRequestFails(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(failHandler))
 	defer ts.Close()
 	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
@@ -265,11 +415,101 @@ func (s *S) TestUnbindReturnsErrorIfTheRequestFails(c *gocheck.C) {
 		ip:   "2.2.2.2",
 	}
 	client := &Client{endpoint: ts.URL}
-	err := client.Unbind(&instance, a.GetUnits()[0])
+	err := client.UnbindUnit(&instance, &a, a.GetUnits()[0])
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err, gocheck.ErrorMatches, "^Failed to unbind instance heaven-can-wait from the unit 2.2.2.2: Server failed to do its job.$")
 }
 
+// legacyHandler emulates a service api written before the introduction of
+// bind-app, that doesn't know the bind and bind-app urls.
+type legacyHandler struct {
+	TestHandler
+}
+
+func (h *legacyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/bind") || strings.HasSuffix(r.URL.Path, "/bind-app") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.TestHandler.ServeHTTP(w, r)
+}
+
+func (s *S) TestBindAppFallsBackToTheLegacyBind(c *gocheck.C) {
+	h := legacyHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{
+		name: "her-app",
+		ip:   "10.0.10.1",
+	}
+	client := &Client{endpoint: ts.URL}
+	env, err := client.BindApp(&instance, &a)
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(env["MYSQL_HOST"], gocheck.Equals, "localhost")
+	c.Assert(h.url, gocheck.Equals, "/resources/her-redis")
+	c.Assert(h.method, gocheck.Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string][]string{"unit-host": {"10.0.10.1"}, "app-host": {"10.0.10.1"}}
+	c.Assert(map[string][]string(v), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestBindUnitFallsBackToTheLegacyBind(c *gocheck.C) {
+	h := legacyHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "her-redis", ServiceName: "redis"}
+	a := FakeApp{
+		name: "her-app",
+		ip:   "10.0.10.1",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.BindUnit(&instance, &a, &FakeUnit{ip: "10.0.10.2"})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.url, gocheck.Equals, "/resources/her-redis")
+	c.Assert(h.method, gocheck.Equals, "POST")
+	v, err := url.ParseQuery(string(h.body))
+	c.Assert(err, gocheck.IsNil)
+	expected := map[string][]string{"unit-host": {"10.0.10.2"}, "app-host": {"10.0.10.1"}}
+	c.Assert(map[string][]string(v), gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestUnbindAppWithLegacyAPI(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
+	a := FakeApp{
+		name: "arch-enemy",
+		ip:   "2.2.2.2",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.UnbindApp(&instance, &a)
+	c.Assert(err, gocheck.IsNil)
+}
+
+func (s *S) TestUnbindUnitFallsBackToTheLegacyUnbind(c *gocheck.C) {
+	h := legacyHandler{}
+	ts := httptest.NewServer(&h)
+	defer ts.Close()
+	instance := ServiceInstance{Name: "heaven-can-wait", ServiceName: "heaven"}
+	a := FakeApp{
+		name: "arch-enemy",
+		ip:   "2.2.2.2",
+	}
+	client := &Client{endpoint: ts.URL}
+	err := client.UnbindUnit(&instance, &a, &FakeUnit{ip: "2.2.2.3"})
+	h.Lock()
+	defer h.Unlock()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(h.request.URL.Path, gocheck.Equals, "/resources/heaven-can-wait/hostname/2.2.2.3")
+	c.Assert(h.method, gocheck.Equals, "DELETE")
+}
+
 func (s *S) TestBuildErrorMessageWithNilResponse(c *gocheck.C) {
 	cli := Client{}
 	err := stderrors.New("epic fail")
@@ -354,3 +594,85 @@ func (s *S) TestInfoNotFound(c *gocheck.C) {
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(result, gocheck.IsNil)
 }
+
+func (s *S) TestPlans(c *gocheck.C) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`[{"name": "small", "description": "1 GB"}, {"name": "large", "description": "8 GB"}]`))
+	}))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL}
+	plans, err := client.Plans()
+	c.Assert(err, gocheck.IsNil)
+	expected := []Plan{{Name: "small", Description: "1 GB"}, {Name: "large", Description: "8 GB"}}
+	c.Assert(plans, gocheck.DeepEquals, expected)
+	c.Assert(path, gocheck.Equals, "/resources/plans")
+}
+
+func (s *S) TestPlansNotFound(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(notFoundHandler))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL}
+	plans, err := client.Plans()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(plans, gocheck.IsNil)
+}
+
+func (s *S) TestPlansFailure(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	client := &Client{endpoint: ts.URL}
+	_, err := client.Plans()
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to get the plans of the service: Server failed to do its job.")
+}
+
+func (s *S) TestProxyForwardsTheRequestToTheServiceApi(c *gocheck.C) {
+	var (
+		method, path, query, body, auth string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		query = r.URL.RawQuery
+		auth = r.Header.Get("Authorization")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("backup scheduled"))
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL, username: "redis", password: "s3cr3t"}
+	request, err := http.NewRequest("POST", "/services/proxy/my-redis?:instance=my-redis&callback=/backup&full=true", strings.NewReader("when=now"))
+	c.Assert(err, gocheck.IsNil)
+	request.Header.Set("Authorization", "user-token")
+	recorder := httptest.NewRecorder()
+	err = client.Proxy(&instance, "/backup", recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(recorder.Code, gocheck.Equals, http.StatusCreated)
+	c.Assert(recorder.Body.String(), gocheck.Equals, "backup scheduled")
+	c.Assert(method, gocheck.Equals, "POST")
+	c.Assert(path, gocheck.Equals, "/resources/my-redis/backup")
+	c.Assert(query, gocheck.Equals, "full=true")
+	c.Assert(body, gocheck.Equals, "when=now")
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("redis:s3cr3t"))
+	c.Assert(auth, gocheck.Equals, expected)
+}
+
+func (s *S) TestProxyDoesNotLeaveTheResourcesOfTheInstance(c *gocheck.C) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer ts.Close()
+	instance := ServiceInstance{Name: "my-redis", ServiceName: "redis"}
+	client := &Client{endpoint: ts.URL}
+	request, err := http.NewRequest("GET", "/services/proxy/my-redis", nil)
+	c.Assert(err, gocheck.IsNil)
+	recorder := httptest.NewRecorder()
+	err = client.Proxy(&instance, "../../your-redis/backup", recorder, request)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(path, gocheck.Equals, "/resources/my-redis/your-redis/backup")
+}
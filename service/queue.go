@@ -0,0 +1,133 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"github.com/globocom/tsuru/log"
+	"github.com/globocom/tsuru/queue"
+	"sync"
+	"time"
+)
+
+const (
+	// queue actions
+	checkInstanceState = "check-instance-state"
+
+	queueName = "tsuru-service"
+)
+
+// stateCheckInterval is the interval between two checks of the state of a
+// pending instance.
+var stateCheckInterval = 10 * time.Second
+
+// pendingTimeout is the maximum time an instance may stay pending. Instances
+// that are not up after this time are considered failed.
+var pendingTimeout = 30 * time.Minute
+
+// checkState checks the state of a pending instance, asking the service api
+// for its status. It returns false if the instance is still pending.
+//
+// While provisioning, the service api may report the instance as down, or
+// fail to answer. The instance stays pending until the api reports it as up,
+// or until pendingTimeout expires, when it's marked as failed.
+func checkState(name string) (bool, error) {
+	si, err := GetInstance(name)
+	if err != nil {
+		return true, err
+	}
+	if si.State != StatePending {
+		return true, nil
+	}
+	if si.PendingSince.IsZero() {
+		si.PendingSince = time.Now()
+		if err = si.update(); err != nil {
+			return false, err
+		}
+	}
+	status, err := si.Status()
+	if err == nil && status == "up" {
+		si.State = StateReady
+		return true, si.update()
+	}
+	if time.Since(si.PendingSince) < pendingTimeout {
+		return false, err
+	}
+	log.Printf("The instance %q is not up after %s, giving up.", si.Name, pendingTimeout)
+	si.State = StateFailed
+	if uerr := si.update(); uerr != nil {
+		return true, uerr
+	}
+	return true, err
+}
+
+// handle is the function called by the queue handler on each message.
+func handle(msg *queue.Message) {
+	switch msg.Action {
+	case checkInstanceState:
+		msg.Delete()
+		if len(msg.Args) < 1 {
+			log.Printf("Error handling %q: this action requires at least 1 argument.", msg.Action)
+			return
+		}
+		done, err := checkState(msg.Args[0])
+		if err != nil {
+			log.Printf("Error handling %q for the instance %q: %s", msg.Action, msg.Args[0], err)
+		}
+		if !done {
+			enqueueStateCheck(msg.Args[0], stateCheckInterval)
+		}
+	default:
+		log.Printf("Error handling %q: invalid action.", msg.Action)
+		msg.Delete()
+	}
+}
+
+var (
+	_queue   queue.Q
+	_handler queue.Handler
+	o        sync.Once
+)
+
+func setQueue() {
+	qfactory, err := queue.Factory()
+	if err != nil {
+		log.Fatalf("Failed to get the queue instance: %s", err)
+	}
+	_handler, err = qfactory.Handler(handle, queueName)
+	if err != nil {
+		log.Fatalf("Failed to create the queue handler: %s", err)
+	}
+	_queue, err = qfactory.Get(queueName)
+	if err != nil {
+		log.Fatalf("Failed to get the queue instance: %s", err)
+	}
+}
+
+func handler() queue.Handler {
+	o.Do(setQueue)
+	return _handler
+}
+
+func squeue() queue.Q {
+	o.Do(setQueue)
+	return _queue
+}
+
+// StartHandler starts the handler of the service queue. The API starts it
+// when it starts, so the state checks of pending instances scheduled before a
+// restart of the API are resumed.
+func StartHandler() {
+	handler().Start()
+}
+
+// enqueueStateCheck schedules a check of the state of the given instance,
+// after the given delay.
+func enqueueStateCheck(name string, delay time.Duration) {
+	msg := queue.Message{Action: checkInstanceState, Args: []string{name}}
+	if err := squeue().Put(&msg, delay); err != nil {
+		log.Printf("Failed to schedule the state check of the instance %q: %s", name, err)
+	}
+	handler().Start()
+}
@@ -5,13 +5,28 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
 	"labix.org/v2/mgo/bson"
 	"strings"
 )
 
+// Plan represents a plan offered by a service, like "small" or "large". The
+// name of the plan is sent to the service api when creating instances.
+type Plan struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// Service represents a service registered in tsuru.
+//
+// Description, Tags, DocUrl and Maintainer are the metadata displayed in the
+// catalog of services. Maintainer is the name of the team that maintains the
+// service.
 type Service struct {
 	Name         string `bson:"_id"`
 	Endpoint     map[string]string
@@ -19,7 +34,14 @@ type Service struct {
 	Teams        []string
 	Status       string
 	Doc          string
-	IsRestricted bool `bson:"is_restricted"`
+	IsRestricted bool     `bson:"is_restricted"`
+	Plans        []Plan   `bson:",omitempty"`
+	Password     string   `json:"-"`
+	TestTeams    []string `bson:"test_teams,omitempty"`
+	Description  string
+	Tags         []string `bson:",omitempty"`
+	DocUrl       string   `bson:"doc_url"`
+	Maintainer   string
 }
 
 func (s *Service) Get() error {
@@ -32,7 +54,16 @@ func (s *Service) Get() error {
 	return conn.Services().Find(query).One(&s)
 }
 
+// Create stores the service in the database. If the service does not have a
+// password, a random one is generated.
 func (s *Service) Create() error {
+	if s.Password == "" {
+		password, err := generatePassword()
+		if err != nil {
+			return err
+		}
+		s.Password = password
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -66,13 +97,65 @@ func (s *Service) getClient(endpoint string) (cli *Client, err error) {
 		if !strings.HasPrefix(e, "http://") {
 			e = "http://" + e
 		}
-		cli = &Client{endpoint: e}
+		cli = &Client{endpoint: e, username: s.Name, password: s.Password}
 	} else {
 		err = errors.New("Unknown endpoint: " + endpoint)
 	}
 	return
 }
 
+// environmentFor returns the name of the endpoint used by the instances owned
+// by the given team: teams declared as test teams use the test endpoint of the
+// service, when it has one. All other teams use the production endpoint.
+func (s *Service) environmentFor(team string) string {
+	if _, ok := s.Endpoint["test"]; ok {
+		for _, t := range s.TestTeams {
+			if t == team {
+				return "test"
+			}
+		}
+	}
+	return "production"
+}
+
+// GetPlans returns the plans offered by the service. Plans declared in the
+// manifest of the service take precedence, otherwise they are retrieved from
+// the service api.
+func (s *Service) GetPlans() ([]Plan, error) {
+	if len(s.Plans) > 0 {
+		return s.Plans, nil
+	}
+	endpoint, err := s.getClient("production")
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.Plans()
+}
+
+// FindPlan returns the plan of the service with the given name.
+func (s *Service) FindPlan(name string) (Plan, error) {
+	plans, err := s.GetPlans()
+	if err != nil {
+		return Plan{}, err
+	}
+	for _, p := range plans {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Plan{}, fmt.Errorf("Plan %q does not exist in the service %q.", name, s.Name)
+}
+
+// generatePassword generates a random password for a service, used to
+// authenticate the requests sent to its api.
+func generatePassword() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (s *Service) findTeam(team *auth.Team) int {
 	for i, t := range s.Teams {
 		if team.Name == t {
@@ -122,16 +205,21 @@ func GetServicesByTeamKindAndNoRestriction(teamKind string, u *auth.User) ([]Ser
 		return nil, err
 	}
 	defer conn.Close()
-	teamsNames := auth.GetTeamsNames(teams)
-	q := bson.M{"$or": []bson.M{
+	q := availableServicesQuery(teamKind, auth.GetTeamsNames(teams))
+	var services []Service
+	err = conn.Services().Find(q).Select(bson.M{"name": 1}).All(&services)
+	return services, err
+}
+
+// availableServicesQuery returns the query that finds the services that are
+// not restricted or that the given teams have access to.
+func availableServicesQuery(teamKind string, teamsNames []string) bson.M {
+	return bson.M{"$or": []bson.M{
 		{teamKind: bson.M{"$in": teamsNames}},
 		{"is_restricted": false},
 	},
 		"status": bson.M{"$ne": "deleted"},
 	}
-	var services []Service
-	err = conn.Services().Find(q).Select(bson.M{"name": 1}).All(&services)
-	return services, err
 }
 
 func GetServicesByOwnerTeams(teamKind string, u *auth.User) ([]Service, error) {
@@ -151,7 +239,21 @@ func GetServicesByOwnerTeams(teamKind string, u *auth.User) ([]Service, error) {
 	return services, err
 }
 
+// ServiceModel represents a service and the names of its instances. States
+// maps the name of each instance that is not ready to its state.
 type ServiceModel struct {
 	Service   string
 	Instances []string
+	States    map[string]string `json:",omitempty"`
+}
+
+// AddInstance adds the given instance to the model.
+func (m *ServiceModel) AddInstance(si ServiceInstance) {
+	m.Instances = append(m.Instances, si.Name)
+	if state := si.GetState(); state != StateReady {
+		if m.States == nil {
+			m.States = make(map[string]string)
+		}
+		m.States[si.Name] = state
+	}
 }
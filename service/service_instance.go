@@ -7,6 +7,7 @@ package service
 import (
 	"encoding/json"
 	stderrors "errors"
+	"github.com/globocom/tsuru/action"
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
@@ -14,13 +15,40 @@ import (
 	"github.com/globocom/tsuru/log"
 	"labix.org/v2/mgo/bson"
 	"net/http"
+	"time"
 )
 
+// States of a service instance. Instances created asynchronously by the
+// service api are pending until the api reports them as up (ready) or down
+// (failed).
+const (
+	StatePending = "pending"
+	StateReady   = "ready"
+	StateFailed  = "failed"
+)
+
+// ServiceInstance represents an instance of a service.
+//
+// Teams are the teams that have access to the instance: their members can
+// bind the instance to apps of these teams. TeamOwner is the team that owns
+// the instance, its members are able to grant and revoke the access of other
+// teams to the instance. Environment is the name of the endpoint of the
+// service that holds the instance ("production" or "test"). LastStatus is
+// the status of the instance in the last periodic check, made at
+// LastStatusCheck. PendingSince is the time when the instance became pending,
+// used to give up waiting for instances that never get ready.
 type ServiceInstance struct {
-	Name        string
-	ServiceName string `bson:"service_name"`
-	Apps        []string
-	Teams       []string
+	Name            string
+	ServiceName     string    `bson:"service_name"`
+	PlanName        string    `bson:"plan_name"`
+	State           string    `bson:"state"`
+	PendingSince    time.Time `bson:"pending_since,omitempty"`
+	TeamOwner       string    `bson:"team_owner"`
+	Environment     string    `bson:"environment,omitempty"`
+	LastStatus      string    `bson:"last_status,omitempty"`
+	LastStatusCheck time.Time `bson:"last_status_check,omitempty"`
+	Apps            []string
+	Teams           []string
 }
 
 // GetInstance gets the service instance by name from database.
@@ -41,21 +69,18 @@ func DeleteInstance(si *ServiceInstance) error {
 		msg := "This service instance is bound to at least one app. Unbind them before removing it"
 		return stderrors.New(msg)
 	}
-	endpoint, err := si.Service().getClient("production")
-	if err == nil {
-		endpoint.Destroy(si)
-	}
-	conn, err := db.Conn()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	return conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	return action.NewPipeline(&removeServiceInstance, &destroyServiceInstance).Execute(si)
 }
 
 // CreateInstance store a service instance into the database.
+//
+// If the service api creates the instance asynchronously, the instance is
+// stored as pending and its state is checked through the queue.
 func CreateInstance(si *ServiceInstance) error {
-	endpoint, err := si.Service().getClient("production")
+	if si.Environment == "" {
+		si.Environment = si.Service().environmentFor(si.TeamOwner)
+	}
+	endpoint, err := si.getClient()
 	if err != nil {
 		return err
 	}
@@ -63,12 +88,22 @@ func CreateInstance(si *ServiceInstance) error {
 	if err != nil {
 		return err
 	}
+	if si.State == StatePending {
+		si.PendingSince = time.Now()
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	return conn.ServiceInstances().Insert(si)
+	err = conn.ServiceInstances().Insert(si)
+	if err != nil {
+		return err
+	}
+	if si.State == StatePending {
+		enqueueStateCheck(si.Name, 0)
+	}
+	return nil
 }
 
 // MarshalJSON marshals the ServiceName in json format.
@@ -82,13 +117,17 @@ func (si *ServiceInstance) MarshalJSON() ([]byte, error) {
 		"Teams":       si.Teams,
 		"Apps":        si.Apps,
 		"ServiceName": si.ServiceName,
+		"PlanName":    si.PlanName,
+		"State":       si.GetState(),
+		"TeamOwner":   si.TeamOwner,
+		"LastStatus":  si.LastStatus,
 		"Info":        info,
 	}
 	return json.Marshal(&data)
 }
 
 func (si *ServiceInstance) Info() (map[string]string, error) {
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.getClient()
 	if err != nil {
 		return nil, stderrors.New("endpoint does not exists")
 	}
@@ -103,6 +142,29 @@ func (si *ServiceInstance) Info() (map[string]string, error) {
 	return info, nil
 }
 
+// GetEnvironment returns the name of the endpoint of the service that holds
+// the instance. Instances stored before the introduction of test endpoints
+// are in production.
+func (si *ServiceInstance) GetEnvironment() string {
+	if si.Environment == "" {
+		return "production"
+	}
+	return si.Environment
+}
+
+func (si *ServiceInstance) getClient() (*Client, error) {
+	return si.Service().getClient(si.GetEnvironment())
+}
+
+// GetState returns the state of the instance. Instances stored before the
+// introduction of states are ready.
+func (si *ServiceInstance) GetState() string {
+	if si.State == "" {
+		return StateReady
+	}
+	return si.State
+}
+
 func (si *ServiceInstance) Create() error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -154,6 +216,53 @@ func (si *ServiceInstance) RemoveApp(appName string) error {
 	return nil
 }
 
+// HasTeam reports whether the given team has access to the instance.
+func (si *ServiceInstance) HasTeam(team string) bool {
+	for _, t := range si.Teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyTeam reports whether any of the given teams has access to the
+// instance.
+func (si *ServiceInstance) HasAnyTeam(teams []string) bool {
+	for _, team := range teams {
+		if si.HasTeam(team) {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantAccess grants the given team access to the instance. It does not
+// save the instance in the database.
+func (si *ServiceInstance) GrantAccess(team string) error {
+	if si.HasTeam(team) {
+		return stderrors.New("This team already has access to this service instance.")
+	}
+	si.Teams = append(si.Teams, team)
+	return nil
+}
+
+// RevokeAccess revokes the access of the given team to the instance. The
+// access of the owner team cannot be revoked. It does not save the instance
+// in the database.
+func (si *ServiceInstance) RevokeAccess(team string) error {
+	if team == si.TeamOwner {
+		return stderrors.New("You cannot revoke the access of the team that owns this service instance.")
+	}
+	for i, t := range si.Teams {
+		if t == team {
+			si.Teams = append(si.Teams[:i], si.Teams[i+1:]...)
+			return nil
+		}
+	}
+	return stderrors.New("This team does not have access to this service instance.")
+}
+
 func (si *ServiceInstance) update() error {
 	conn, err := db.Conn()
 	if err != nil {
@@ -164,90 +273,78 @@ func (si *ServiceInstance) update() error {
 }
 
 // BindApp makes the bind between the service instance and an app.
+//
+// The bind is atomic: if the service api fails to bind the app or any of its
+// units, the app is unbound and removed from the instance.
 func (si *ServiceInstance) BindApp(app bind.App) error {
-	err := si.AddApp(app.GetName())
-	if err != nil {
-		return &errors.Http{Code: http.StatusConflict, Message: "This app is already bound to this service instance."}
-	}
-	err = si.update()
-	if err != nil {
-		return err
+	switch si.GetState() {
+	case StatePending:
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "You cannot bind any app to this service instance because it is not ready yet."}
+	case StateFailed:
+		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "You cannot bind any app to this service instance because it failed to be created."}
 	}
 	if len(app.GetUnits()) == 0 {
 		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "This app does not have an IP yet."}
 	}
-	envsChan := make(chan map[string]string, len(app.GetUnits())+1)
-	errChan := make(chan error, len(app.GetUnits())+1)
-	for _, unit := range app.GetUnits() {
-		go func(unit bind.Unit) {
-			vars, err := si.BindUnit(app, unit)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			envsChan <- vars
-		}(unit)
-	}
-	var envVars []bind.EnvVar
-	select {
-	case envs := <-envsChan:
-		for k, v := range envs {
-			envVars = append(envVars, bind.EnvVar{
-				Name:         k,
-				Value:        v,
-				Public:       false,
-				InstanceName: si.Name,
-			})
-		}
-		return app.SetEnvs(envVars, false)
-	case err = <-errChan:
+	actions := []*action.Action{
+		&addAppToServiceInstance,
+		&bindAppEndpoint,
+		&bindUnits,
+		&setEnvironVariablesToApp,
 	}
-	return err
+	return action.NewPipeline(actions...).Execute(si, app)
 }
 
-// BindUnit makes the bind between the binder and an unit.
-func (si *ServiceInstance) BindUnit(app bind.App, unit bind.Unit) (map[string]string, error) {
-	endpoint, err := si.Service().getClient("production")
+// BindUnit authorizes the unit to connect to the service instance. The unit
+// uses the credentials returned when the app was bound to the instance.
+func (si *ServiceInstance) BindUnit(app bind.App, unit bind.Unit) error {
+	endpoint, err := si.getClient()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return endpoint.Bind(si, app, unit)
+	return endpoint.BindUnit(si, app, unit)
 }
 
 // UnbindApp makes the unbind between the service instance and an app.
+//
+// It removes the environment variables of the instance from the app, revokes
+// the authorization of each unit of the app, and then the credentials of the
+// app. The unbind is atomic: if the service api fails to unbind the app or
+// any of its units, the units are bound again, the environment variables are
+// restored and the app is added back to the instance.
 func (si *ServiceInstance) UnbindApp(app bind.App) error {
-	err := si.RemoveApp(app.GetName())
-	if err != nil {
-		return &errors.Http{Code: http.StatusPreconditionFailed, Message: "This app is not bound to this service instance."}
+	actions := []*action.Action{
+		&removeAppFromServiceInstance,
+		&removeEnvironVariablesFromApp,
+		&unbindUnits,
+		&unbindAppEndpoint,
 	}
-	err = si.update()
+	return action.NewPipeline(actions...).Execute(si, app)
+}
+
+// UnbindUnit revokes the authorization of the unit to connect to the service
+// instance. The credentials of the app are not revoked.
+func (si *ServiceInstance) UnbindUnit(app bind.App, unit bind.Unit) error {
+	endpoint, err := si.getClient()
 	if err != nil {
 		return err
 	}
-	for _, unit := range app.GetUnits() {
-		go func(unit bind.Unit) {
-			si.UnbindUnit(unit)
-		}(unit)
-	}
-	var envVars []string
-	for k := range app.InstanceEnv(si.Name) {
-		envVars = append(envVars, k)
-	}
-	return app.UnsetEnvs(envVars, false)
+	return endpoint.UnbindUnit(si, app, unit)
 }
 
-// UnbindUnit makes the unbind between the service instance and an unit.
-func (si *ServiceInstance) UnbindUnit(unit bind.Unit) error {
-	endpoint, err := si.Service().getClient("production")
+// Proxy forwards the request to the api of the service of the instance, on the
+// given path under /resources/<name>.
+func (si *ServiceInstance) Proxy(callback string, w http.ResponseWriter, r *http.Request) error {
+	endpoint, err := si.getClient()
 	if err != nil {
 		return err
 	}
-	return endpoint.Unbind(si, unit)
+	return endpoint.Proxy(si, callback, w, r)
 }
 
 // Status returns the service instance status.
 func (si *ServiceInstance) Status() (string, error) {
-	endpoint, err := si.Service().getClient("production")
+	endpoint, err := si.getClient()
 	if err != nil {
 		return "", err
 	}
@@ -255,7 +352,7 @@ func (si *ServiceInstance) Status() (string, error) {
 }
 
 func genericServiceInstancesFilter(services interface{}, teams []string) (q, f bson.M) {
-	f = bson.M{"name": 1, "service_name": 1, "apps": 1}
+	f = bson.M{"name": 1, "service_name": 1, "state": 1, "apps": 1}
 	q = bson.M{}
 	if len(teams) != 0 {
 		q["teams"] = bson.M{"$in": teams}
@@ -278,7 +375,7 @@ func GetServiceInstancesByServices(services []Service) ([]ServiceInstance, error
 	}
 	defer conn.Close()
 	q, _ := genericServiceInstancesFilter(services, []string{})
-	f := bson.M{"name": 1, "service_name": 1}
+	f := bson.M{"name": 1, "service_name": 1, "state": 1}
 	err = conn.ServiceInstances().Find(q).Select(f).All(&instances)
 	return instances, err
 }
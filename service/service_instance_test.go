@@ -10,10 +10,12 @@ import (
 	"github.com/globocom/tsuru/app/bind"
 	"github.com/globocom/tsuru/auth"
 	"github.com/globocom/tsuru/db"
+	_ "github.com/globocom/tsuru/testing"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
 	"net/http"
 	"net/http/httptest"
+	"time"
 )
 
 type InstanceSuite struct {
@@ -30,6 +32,7 @@ func (s *InstanceSuite) SetUpSuite(c *gocheck.C) {
 	var err error
 	config.Set("database:url", "127.0.0.1:27017")
 	config.Set("database:name", "tsuru_service_instance_test")
+	config.Set("queue", "fake")
 	s.conn, err = db.Conn()
 	c.Assert(err, gocheck.IsNil)
 	s.user = &auth.User{Email: "cidade@raul.com", Password: "123"}
@@ -327,6 +330,10 @@ func (s *InstanceSuite) TestMarshalJSON(c *gocheck.C) {
 		"Teams":       nil,
 		"Apps":        nil,
 		"ServiceName": "mysql",
+		"PlanName":    "",
+		"State":       "ready",
+		"TeamOwner":   "",
+		"LastStatus":  "",
 		"Info":        map[string]interface{}{"key": "value"},
 	}
 	c.Assert(result, gocheck.DeepEquals, expected)
@@ -348,6 +355,10 @@ func (s *InstanceSuite) TestMarshalJSONWithoutInfo(c *gocheck.C) {
 		"Teams":       nil,
 		"Apps":        nil,
 		"ServiceName": "mysql",
+		"PlanName":    "",
+		"State":       "ready",
+		"TeamOwner":   "",
+		"LastStatus":  "",
 		"Info":        nil,
 	}
 	c.Assert(result, gocheck.DeepEquals, expected)
@@ -369,6 +380,10 @@ func (s *InstanceSuite) TestMarshalJSONWithoutEndpoint(c *gocheck.C) {
 		"Teams":       nil,
 		"Apps":        nil,
 		"ServiceName": "mysql",
+		"PlanName":    "",
+		"State":       "ready",
+		"TeamOwner":   "",
+		"LastStatus":  "",
 		"Info":        nil,
 	}
 	c.Assert(result, gocheck.DeepEquals, expected)
@@ -420,6 +435,24 @@ func (s *InstanceSuite) TestDeleteInstanceWithApps(c *gocheck.C) {
 	c.Assert(err, gocheck.ErrorMatches, "^This service instance is bound to at least one app. Unbind them before removing it$")
 }
 
+func (s *InstanceSuite) TestDeleteInstanceKeepsTheInstanceIfTheServiceApiFails(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name}
+	err = s.conn.ServiceInstances().Insert(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	err = DeleteInstance(&si)
+	c.Assert(err, gocheck.ErrorMatches, "^Failed to destroy the instance instance: Server failed to do its job.$")
+	l, err := s.conn.ServiceInstances().Find(bson.M{"name": si.Name}).Count()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(l, gocheck.Equals, 1)
+}
+
 func (s *InstanceSuite) TestCreateInstance(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
@@ -438,6 +471,224 @@ func (s *InstanceSuite) TestCreateInstance(c *gocheck.C) {
 	c.Assert(si, gocheck.DeepEquals, expected)
 }
 
+func (s *InstanceSuite) TestCreateInstanceAsynchronously(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name}
+	err = CreateInstance(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StatePending)
+	c.Assert(time.Since(instance.PendingSince) < time.Minute, gocheck.Equals, true)
+}
+
+func (s *InstanceSuite) TestCreateInstanceOfATestTeam(c *gocheck.C) {
+	var production, test bool
+	prod := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		production = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer prod.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		test = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := Service{
+		Name:      "mongodb",
+		Endpoint:  map[string]string{"production": prod.URL, "test": ts.URL},
+		TestTeams: []string{"qa"},
+	}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, TeamOwner: "qa"}
+	err = CreateInstance(&si)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	c.Assert(test, gocheck.Equals, true)
+	c.Assert(production, gocheck.Equals, false)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.GetEnvironment(), gocheck.Equals, "test")
+}
+
+func (s *InstanceSuite) TestGetEnvironment(c *gocheck.C) {
+	si := ServiceInstance{Name: "instance"}
+	c.Assert(si.GetEnvironment(), gocheck.Equals, "production")
+	si.Environment = "test"
+	c.Assert(si.GetEnvironment(), gocheck.Equals, "test")
+}
+
+func (s *InstanceSuite) TestCheckState(c *gocheck.C) {
+	status := http.StatusAccepted
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, State: StatePending}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	done, err := checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, false)
+	status = http.StatusNoContent
+	done, err = checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, true)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StateReady)
+}
+
+func (s *InstanceSuite) TestCheckStateDownWhilePending(c *gocheck.C) {
+	status := http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, State: StatePending, PendingSince: time.Now()}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	done, err := checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, false)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StatePending)
+	status = http.StatusNoContent
+	done, err = checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, true)
+	instance, err = GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StateReady)
+}
+
+func (s *InstanceSuite) TestCheckStateFailed(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	since := time.Now().Add(-pendingTimeout - time.Minute)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, State: StatePending, PendingSince: since}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	done, err := checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, true)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StateFailed)
+}
+
+func (s *InstanceSuite) TestCheckStateUnreachableApi(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": url}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, State: StatePending, PendingSince: time.Now()}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	done, err := checkState(si.Name)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(done, gocheck.Equals, false)
+	since := time.Now().Add(-pendingTimeout - time.Minute)
+	err = s.conn.ServiceInstances().Update(bson.M{"name": si.Name}, bson.M{"$set": bson.M{"pending_since": since}})
+	c.Assert(err, gocheck.IsNil)
+	done, err = checkState(si.Name)
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(done, gocheck.Equals, true)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StateFailed)
+}
+
+func (s *InstanceSuite) TestCheckStateSetsPendingSince(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, State: StatePending}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	done, err := checkState(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(done, gocheck.Equals, false)
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.State, gocheck.Equals, StatePending)
+	c.Assert(time.Since(instance.PendingSince) < time.Minute, gocheck.Equals, true)
+}
+
+func (s *InstanceSuite) TestCheckStateOfUnknownInstance(c *gocheck.C) {
+	done, err := checkState("unknown")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(done, gocheck.Equals, true)
+}
+
+func (s *InstanceSuite) TestHasTeam(c *gocheck.C) {
+	si := ServiceInstance{Name: "instance", Teams: []string{"team1", "team2"}}
+	c.Assert(si.HasTeam("team1"), gocheck.Equals, true)
+	c.Assert(si.HasTeam("team3"), gocheck.Equals, false)
+	c.Assert(si.HasAnyTeam([]string{"team3", "team2"}), gocheck.Equals, true)
+	c.Assert(si.HasAnyTeam([]string{"team3"}), gocheck.Equals, false)
+	c.Assert(si.HasAnyTeam(nil), gocheck.Equals, false)
+}
+
+func (s *InstanceSuite) TestGrantAccess(c *gocheck.C) {
+	si := ServiceInstance{Name: "instance", TeamOwner: "team1", Teams: []string{"team1"}}
+	err := si.GrantAccess("team2")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{"team1", "team2"})
+	err = si.GrantAccess("team2")
+	c.Assert(err, gocheck.ErrorMatches, "^This team already has access to this service instance.$")
+}
+
+func (s *InstanceSuite) TestRevokeAccess(c *gocheck.C) {
+	si := ServiceInstance{Name: "instance", TeamOwner: "team1", Teams: []string{"team1", "team2"}}
+	err := si.RevokeAccess("team2")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{"team1"})
+	err = si.RevokeAccess("team2")
+	c.Assert(err, gocheck.ErrorMatches, "^This team does not have access to this service instance.$")
+	err = si.RevokeAccess("team1")
+	c.Assert(err, gocheck.ErrorMatches, "^You cannot revoke the access of the team that owns this service instance.$")
+	c.Assert(si.Teams, gocheck.DeepEquals, []string{"team1"})
+}
+
 func (s *InstanceSuite) TestStatus(c *gocheck.C) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
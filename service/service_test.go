@@ -5,8 +5,12 @@
 package service
 
 import (
+	"encoding/json"
 	"labix.org/v2/mgo/bson"
 	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 )
 
 func (s *S) createService() {
@@ -51,6 +55,24 @@ func (s *S) TestCreateService(c *gocheck.C) {
 	c.Assert(se.OwnerTeams, gocheck.DeepEquals, []string{s.team.Name})
 	c.Assert(se.Status, gocheck.Equals, "created")
 	c.Assert(se.IsRestricted, gocheck.Equals, false)
+	c.Assert(se.Password, gocheck.Matches, "^[0-9a-f]{32}$")
+}
+
+func (s *S) TestCreateServiceKeepsThePassword(c *gocheck.C) {
+	service := &Service{Name: "my_service", Password: "s3cr3t"}
+	err := service.Create()
+	c.Assert(err, gocheck.IsNil)
+	se := Service{Name: service.Name}
+	err = se.Get()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(se.Password, gocheck.Equals, "s3cr3t")
+}
+
+func (s *S) TestServiceJSONDoesNotIncludeThePassword(c *gocheck.C) {
+	service := Service{Name: "my_service", Password: "s3cr3t"}
+	data, err := json.Marshal(service)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(strings.Contains(string(data), "s3cr3t"), gocheck.Equals, false)
 }
 
 func (s *S) TestDeleteService(c *gocheck.C) {
@@ -71,7 +93,24 @@ func (s *S) TestGetClient(c *gocheck.C) {
 	service := Service{Name: "redis", Endpoint: endpoints}
 	cli, err := service.getClient("production")
 	c.Assert(err, gocheck.IsNil)
-	c.Assert(cli, gocheck.DeepEquals, &Client{endpoint: endpoints["production"]})
+	c.Assert(cli, gocheck.DeepEquals, &Client{endpoint: endpoints["production"], username: "redis"})
+}
+
+func (s *S) TestServiceModelAddInstance(c *gocheck.C) {
+	var m ServiceModel
+	m.AddInstance(ServiceInstance{Name: "old"})
+	m.AddInstance(ServiceInstance{Name: "ready", State: StateReady})
+	m.AddInstance(ServiceInstance{Name: "pending", State: StatePending})
+	c.Assert(m.Instances, gocheck.DeepEquals, []string{"old", "ready", "pending"})
+	c.Assert(m.States, gocheck.DeepEquals, map[string]string{"pending": StatePending})
+}
+
+func (s *S) TestGetClientWithPassword(c *gocheck.C) {
+	service := Service{Name: "redis", Endpoint: map[string]string{"production": "http://mysql.api.com"}, Password: "s3cr3t"}
+	cli, err := service.getClient("production")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(cli.username, gocheck.Equals, "redis")
+	c.Assert(cli.password, gocheck.Equals, "s3cr3t")
 }
 
 func (s *S) TestGetClientWithouHttp(c *gocheck.C) {
@@ -97,6 +136,55 @@ func (s *S) TestGetClientWithUnknownEndpoint(c *gocheck.C) {
 	c.Assert(cli, gocheck.IsNil)
 }
 
+func (s *S) TestEnvironmentFor(c *gocheck.C) {
+	endpoints := map[string]string{
+		"production": "http://mysql.api.com",
+		"test":       "http://localhost:9090",
+	}
+	service := Service{Name: "redis", Endpoint: endpoints, TestTeams: []string{"qa"}}
+	c.Assert(service.environmentFor("qa"), gocheck.Equals, "test")
+	c.Assert(service.environmentFor("ops"), gocheck.Equals, "production")
+	c.Assert(service.environmentFor(""), gocheck.Equals, "production")
+}
+
+func (s *S) TestEnvironmentForWithoutTestEndpoint(c *gocheck.C) {
+	service := Service{Name: "redis", Endpoint: map[string]string{"production": "http://mysql.api.com"}, TestTeams: []string{"qa"}}
+	c.Assert(service.environmentFor("qa"), gocheck.Equals, "production")
+}
+
+func (s *S) TestGetPlansFromTheManifest(c *gocheck.C) {
+	plans := []Plan{{Name: "small", Description: "1 GB"}, {Name: "large", Description: "8 GB"}}
+	srvc := Service{Name: "mysql", Plans: plans}
+	got, err := srvc.GetPlans()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.DeepEquals, plans)
+}
+
+func (s *S) TestGetPlansFromTheServiceApi(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name": "small", "description": "1 GB"}]`))
+	}))
+	defer ts.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": ts.URL}}
+	got, err := srvc.GetPlans()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(got, gocheck.DeepEquals, []Plan{{Name: "small", Description: "1 GB"}})
+}
+
+func (s *S) TestFindPlan(c *gocheck.C) {
+	srvc := Service{Name: "mysql", Plans: []Plan{{Name: "small"}, {Name: "large", Description: "8 GB"}}}
+	plan, err := srvc.FindPlan("large")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(plan, gocheck.DeepEquals, Plan{Name: "large", Description: "8 GB"})
+}
+
+func (s *S) TestFindPlanNotFound(c *gocheck.C) {
+	srvc := Service{Name: "mysql", Plans: []Plan{{Name: "small"}}}
+	_, err := srvc.FindPlan("huge")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, `Plan "huge" does not exist in the service "mysql".`)
+}
+
 func (s *S) TestGrantAccessShouldAddTeamToTheService(c *gocheck.C) {
 	s.createService()
 	err := s.service.GrantAccess(s.team)
@@ -0,0 +1,71 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"github.com/globocom/tsuru/db"
+	"github.com/globocom/tsuru/log"
+	"labix.org/v2/mgo/bson"
+	"sync"
+	"time"
+)
+
+// CheckStatus asks the service api for the status of the instance, and stores
+// it as the last status of the instance, along with the time of the check.
+// Instances whose api can't be reached are considered down.
+//
+// It returns the previous status of the instance.
+func (si *ServiceInstance) CheckStatus() (string, error) {
+	status, err := si.Status()
+	if err != nil {
+		log.Printf("Failed to check the status of the service instance %q: %s", si.Name, err)
+		status = "down"
+	}
+	previous := si.LastStatus
+	si.LastStatus = status
+	si.LastStatusCheck = time.Now()
+	conn, err := db.Conn()
+	if err != nil {
+		return previous, err
+	}
+	defer conn.Close()
+	update := bson.M{"$set": bson.M{"last_status": si.LastStatus, "last_status_check": si.LastStatusCheck}}
+	return previous, conn.ServiceInstances().Update(bson.M{"name": si.Name}, update)
+}
+
+// CheckInstancesStatus checks the status of all ready service instances (see
+// CheckStatus). When an instance goes down, or comes back up, alert is called
+// with the instance and a message describing the change.
+func CheckInstancesStatus(alert func(si *ServiceInstance, message string)) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var instances []ServiceInstance
+	q := bson.M{"state": bson.M{"$nin": []string{StatePending, StateFailed}}}
+	if err = conn.ServiceInstances().Find(q).All(&instances); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for i := range instances {
+		wg.Add(1)
+		go func(si *ServiceInstance) {
+			defer wg.Done()
+			previous, err := si.CheckStatus()
+			if err != nil {
+				log.Printf("Failed to store the status of the service instance %q: %s", si.Name, err)
+			}
+			if si.LastStatus == "down" && previous != "down" {
+				alert(si, fmt.Sprintf("The service instance %q is down.", si.Name))
+			} else if si.LastStatus == "up" && previous == "down" {
+				alert(si, fmt.Sprintf("The service instance %q is up again.", si.Name))
+			}
+		}(&instances[i])
+	}
+	wg.Wait()
+	return nil
+}
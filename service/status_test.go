@@ -0,0 +1,105 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"labix.org/v2/mgo/bson"
+	"launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+)
+
+func (s *InstanceSuite) TestCheckStatusStoresTheLastStatus(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	previous, err := si.CheckStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(previous, gocheck.Equals, "")
+	instance, err := GetInstance(si.Name)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(instance.LastStatus, gocheck.Equals, "up")
+	c.Assert(instance.LastStatusCheck.IsZero(), gocheck.Equals, false)
+	previous, err = instance.CheckStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(previous, gocheck.Equals, "up")
+}
+
+func (s *InstanceSuite) TestCheckStatusWhenTheApiIsUnreachable(c *gocheck.C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	si := ServiceInstance{Name: "instance", ServiceName: srv.Name, LastStatus: "up"}
+	err = si.Create()
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	previous, err := si.CheckStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(previous, gocheck.Equals, "up")
+	c.Assert(si.LastStatus, gocheck.Equals, "down")
+}
+
+func (s *InstanceSuite) TestCheckInstancesStatus(c *gocheck.C) {
+	var mut sync.Mutex
+	status := http.StatusInternalServerError
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	srv := Service{Name: "mongodb", Endpoint: map[string]string{"production": ts.URL}}
+	err := s.conn.Services().Insert(&srv)
+	c.Assert(err, gocheck.IsNil)
+	defer s.conn.Services().RemoveId(srv.Name)
+	instances := []ServiceInstance{
+		{Name: "ready", ServiceName: srv.Name, Apps: []string{"myapp"}},
+		{Name: "pending", ServiceName: srv.Name, State: StatePending},
+		{Name: "failed", ServiceName: srv.Name, State: StateFailed},
+	}
+	for _, si := range instances {
+		err = si.Create()
+		c.Assert(err, gocheck.IsNil)
+		defer s.conn.ServiceInstances().Remove(bson.M{"name": si.Name})
+	}
+	var messages []string
+	alert := func(si *ServiceInstance, message string) {
+		mut.Lock()
+		defer mut.Unlock()
+		c.Check(si.Apps, gocheck.DeepEquals, []string{"myapp"})
+		messages = append(messages, message)
+	}
+	err = CheckInstancesStatus(alert)
+	c.Assert(err, gocheck.IsNil)
+	err = CheckInstancesStatus(alert)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(messages, gocheck.DeepEquals, []string{`The service instance "ready" is down.`})
+	mut.Lock()
+	status = http.StatusNoContent
+	mut.Unlock()
+	err = CheckInstancesStatus(alert)
+	c.Assert(err, gocheck.IsNil)
+	expected := []string{`The service instance "ready" is down.`, `The service instance "ready" is up again.`}
+	c.Assert(messages, gocheck.DeepEquals, expected)
+	var checked []string
+	err = s.conn.ServiceInstances().Find(bson.M{"last_status": bson.M{"$exists": true}}).Distinct("name", &checked)
+	c.Assert(err, gocheck.IsNil)
+	sort.Strings(checked)
+	c.Assert(checked, gocheck.DeepEquals, []string{"ready"})
+}
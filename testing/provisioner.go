@@ -20,11 +20,12 @@ func init() {
 
 // Fake implementation for provision.Unit.
 type FakeUnit struct {
-	Name       string
-	Ip         string
-	InstanceId string
-	Machine    int
-	Status     provision.Status
+	Name        string
+	Ip          string
+	InstanceId  string
+	Machine     int
+	Status      provision.Status
+	ProcessName string
 }
 
 func (u *FakeUnit) GetName() string {
@@ -47,6 +48,10 @@ func (u *FakeUnit) GetIp() string {
 	return u.Ip
 }
 
+func (u *FakeUnit) GetProcessName() string {
+	return u.ProcessName
+}
+
 // Fake implementation for provision.App.
 type FakeApp struct {
 	name      string
@@ -110,24 +115,32 @@ type failure struct {
 
 // Fake implementation for provision.Provisioner.
 type FakeProvisioner struct {
-	apps     []provision.App
-	units    map[string][]provision.Unit
-	unitLen  uint
-	cmds     []Cmd
-	outputs  chan []byte
-	failures chan failure
-	cmdMut   sync.Mutex
-	unitMut  sync.Mutex
-	restarts map[string]int
-	restMut  sync.Mutex
+	apps         []provision.App
+	units        map[string][]provision.Unit
+	unitLen      uint
+	cmds         []Cmd
+	outputs      chan []byte
+	failures     chan failure
+	cmdMut       sync.Mutex
+	unitMut      sync.Mutex
+	restarts     map[string]int
+	unitRestarts map[string][]string
+	restMut      sync.Mutex
+	statuses     map[string][]provision.Unit
+	statusMut    sync.Mutex
+	cnames       map[string]string
+	cnameMut     sync.Mutex
 }
 
 func NewFakeProvisioner() *FakeProvisioner {
 	p := FakeProvisioner{}
-	p.outputs = make(chan []byte, 8)
+	p.outputs = make(chan []byte, 16)
 	p.failures = make(chan failure, 8)
 	p.units = make(map[string][]provision.Unit)
 	p.restarts = make(map[string]int)
+	p.unitRestarts = make(map[string][]string)
+	p.statuses = make(map[string][]provision.Unit)
+	p.cnames = make(map[string]string)
 	p.unitLen = 0
 	return &p
 }
@@ -150,6 +163,40 @@ func (p *FakeProvisioner) Restarts(app provision.App) int {
 	return p.restarts[app.GetName()]
 }
 
+// RestartedUnits returns the names of the units of the given app restarted
+// with RestartUnit, in the order they were restarted.
+func (p *FakeProvisioner) RestartedUnits(app provision.App) []string {
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	return p.unitRestarts[app.GetName()]
+}
+
+// SetUnitStatus defines the status of a unit of the given app, as reported by
+// CollectStatus.
+func (p *FakeProvisioner) SetUnitStatus(app provision.App, name string, status provision.Status) {
+	p.statusMut.Lock()
+	defer p.statusMut.Unlock()
+	if p.statuses == nil {
+		p.statuses = make(map[string][]provision.Unit)
+	}
+	units := p.statuses[app.GetName()]
+	for i := range units {
+		if units[i].Name == name {
+			units[i].Status = status
+			return
+		}
+	}
+	unit := provision.Unit{Name: name, AppName: app.GetName(), Type: app.GetFramework(), Status: status}
+	p.statuses[app.GetName()] = append(units, unit)
+}
+
+// CName returns the cname set in the given app, using SetCName.
+func (p *FakeProvisioner) CName(app provision.App) string {
+	p.cnameMut.Lock()
+	defer p.cnameMut.Unlock()
+	return p.cnames[app.GetName()]
+}
+
 // Returns the number of calls to restart.
 // GetCmds returns a list of commands executed in an app. If you don't specify
 // the command (an empty string), it will return all commands executed in the
@@ -200,8 +247,17 @@ func (p *FakeProvisioner) Reset() {
 
 	p.restMut.Lock()
 	p.restarts = make(map[string]int)
+	p.unitRestarts = make(map[string][]string)
 	p.restMut.Unlock()
 
+	p.statusMut.Lock()
+	p.statuses = make(map[string][]provision.Unit)
+	p.statusMut.Unlock()
+
+	p.cnameMut.Lock()
+	p.cnames = make(map[string]string)
+	p.cnameMut.Unlock()
+
 	for {
 		select {
 		case <-p.outputs:
@@ -250,6 +306,19 @@ func (p *FakeProvisioner) Restart(app provision.App) error {
 	return nil
 }
 
+func (p *FakeProvisioner) RestartUnit(app provision.App, unit provision.AppUnit) error {
+	if err := p.getError("RestartUnit"); err != nil {
+		return err
+	}
+	p.restMut.Lock()
+	defer p.restMut.Unlock()
+	if p.unitRestarts == nil {
+		p.unitRestarts = make(map[string][]string)
+	}
+	p.unitRestarts[app.GetName()] = append(p.unitRestarts[app.GetName()], unit.GetName())
+	return nil
+}
+
 func (p *FakeProvisioner) Destroy(app provision.App) error {
 	if err := p.getError("Destroy"); err != nil {
 		return err
@@ -270,7 +339,7 @@ func (p *FakeProvisioner) Destroy(app provision.App) error {
 	return nil
 }
 
-func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit, error) {
+func (p *FakeProvisioner) AddUnits(app provision.App, n uint, process string) ([]provision.Unit, error) {
 	if err := p.getError("AddUnits"); err != nil {
 		return nil, err
 	}
@@ -288,13 +357,14 @@ func (p *FakeProvisioner) AddUnits(app provision.App, n uint) ([]provision.Unit,
 	length := uint(len(p.units[name]))
 	for i := uint(0); i < n; i++ {
 		unit := provision.Unit{
-			Name:       fmt.Sprintf("%s/%d", name, p.unitLen),
-			AppName:    name,
-			Type:       framework,
-			Status:     provision.StatusStarted,
-			InstanceId: fmt.Sprintf("i-08%d", length+i),
-			Ip:         fmt.Sprintf("10.10.10.%d", length+i),
-			Machine:    int(length + i),
+			Name:        fmt.Sprintf("%s/%d", name, p.unitLen),
+			AppName:     name,
+			Type:        framework,
+			Status:      provision.StatusStarted,
+			InstanceId:  fmt.Sprintf("i-08%d", length+i),
+			Ip:          fmt.Sprintf("10.10.10.%d", length+i),
+			Machine:     int(length + i),
+			ProcessName: process,
 		}
 		p.units[name] = append(p.units[name], unit)
 		p.unitLen++
@@ -388,6 +458,11 @@ func (p *FakeProvisioner) CollectStatus() ([]provision.Unit, error) {
 		}
 		units[i] = unit
 	}
+	p.statusMut.Lock()
+	defer p.statusMut.Unlock()
+	for _, us := range p.statuses {
+		units = append(units, us...)
+	}
 	return units, nil
 }
 
@@ -397,3 +472,16 @@ func (p *FakeProvisioner) Addr(app provision.App) (string, error) {
 	}
 	return fmt.Sprintf("%s.fake-lb.tsuru.io", app.GetName()), nil
 }
+
+func (p *FakeProvisioner) SetCName(app provision.App, cname string) error {
+	if err := p.getError("SetCName"); err != nil {
+		return err
+	}
+	p.cnameMut.Lock()
+	defer p.cnameMut.Unlock()
+	if p.cnames == nil {
+		p.cnames = make(map[string]string)
+	}
+	p.cnames[app.GetName()] = cname
+	return nil
+}
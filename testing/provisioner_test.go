@@ -43,6 +43,14 @@ func (s *S) TestRestarts(c *gocheck.C) {
 	c.Assert(p.Restarts(NewFakeApp("pride", "shaman", 1)), gocheck.Equals, 0)
 }
 
+func (s *S) TestRestartedUnits(c *gocheck.C) {
+	app := NewFakeApp("fairy-tale", "shaman", 1)
+	p := NewFakeProvisioner()
+	p.unitRestarts = map[string][]string{app.GetName(): {"fairy-tale/1", "fairy-tale/0"}}
+	c.Assert(p.RestartedUnits(app), gocheck.DeepEquals, []string{"fairy-tale/1", "fairy-tale/0"})
+	c.Assert(p.RestartedUnits(NewFakeApp("pride", "shaman", 1)), gocheck.IsNil)
+}
+
 func (s *S) TestGetCmds(c *gocheck.C) {
 	app := NewFakeApp("enemy-within", "rush", 1)
 	p := NewFakeProvisioner()
@@ -61,8 +69,8 @@ func (s *S) TestGetCmds(c *gocheck.C) {
 
 func (s *S) TestGetUnits(c *gocheck.C) {
 	list := []provision.Unit{
-		{"chain-lighting/0", "chain-lighting", "django", "i-0801", 1, "10.10.10.10", provision.StatusStarted},
-		{"chain-lighting/1", "chain-lighting", "django", "i-0802", 2, "10.10.10.15", provision.StatusStarted},
+		{"chain-lighting/0", "chain-lighting", "django", "i-0801", 1, "10.10.10.10", provision.StatusStarted, ""},
+		{"chain-lighting/1", "chain-lighting", "django", "i-0802", 2, "10.10.10.15", provision.StatusStarted, ""},
 	}
 	app := NewFakeApp("chain-lighting", "rush", 1)
 	p := NewFakeProvisioner()
@@ -144,6 +152,27 @@ func (s *S) TestRestartWithPreparedFailure(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, "Failed to restart.")
 }
 
+func (s *S) TestRestartUnit(c *gocheck.C) {
+	app := NewFakeApp("kid-gloves", "rush", 2)
+	p := NewFakeProvisioner()
+	err := p.RestartUnit(app, app.ProvisionUnits()[1])
+	c.Assert(err, gocheck.IsNil)
+	err = p.RestartUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.unitRestarts[app.GetName()], gocheck.DeepEquals, []string{"kid-gloves/1", "kid-gloves/0"})
+	c.Assert(p.restarts[app.GetName()], gocheck.Equals, 0)
+}
+
+func (s *S) TestRestartUnitWithPreparedFailure(c *gocheck.C) {
+	app := NewFakeApp("fairy-tale", "shaman", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("RestartUnit", errors.New("Failed to restart."))
+	err := p.RestartUnit(app, app.ProvisionUnits()[0])
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Failed to restart.")
+	c.Assert(p.unitRestarts[app.GetName()], gocheck.HasLen, 0)
+}
+
 func (s *S) TestDestroy(c *gocheck.C) {
 	app := NewFakeApp("kid-gloves", "rush", 1)
 	p := NewFakeProvisioner()
@@ -178,15 +207,26 @@ func (s *S) TestAddUnits(c *gocheck.C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	units, err := p.AddUnits(app, 2)
+	units, err := p.AddUnits(app, 2, "")
 	c.Assert(err, gocheck.IsNil)
 	c.Assert(p.units["mystic-rhythms"], gocheck.HasLen, 3)
 	c.Assert(units, gocheck.HasLen, 2)
 }
 
+func (s *S) TestAddUnitsWithProcess(c *gocheck.C) {
+	app := NewFakeApp("mystic-rhythms", "rush", 0)
+	p := NewFakeProvisioner()
+	p.Provision(app)
+	units, err := p.AddUnits(app, 2, "worker")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.HasLen, 2)
+	c.Assert(units[0].ProcessName, gocheck.Equals, "worker")
+	c.Assert(units[1].ProcessName, gocheck.Equals, "worker")
+}
+
 func (s *S) TestAddZeroUnits(c *gocheck.C) {
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(nil, 0)
+	units, err := p.AddUnits(nil, 0, "")
 	c.Assert(units, gocheck.IsNil)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add 0 units.")
@@ -195,7 +235,7 @@ func (s *S) TestAddZeroUnits(c *gocheck.C) {
 func (s *S) TestAddUnitsUnprovisionedApp(c *gocheck.C) {
 	app := NewFakeApp("mystic-rhythms", "rush", 0)
 	p := NewFakeProvisioner()
-	units, err := p.AddUnits(app, 1)
+	units, err := p.AddUnits(app, 1, "")
 	c.Assert(units, gocheck.IsNil)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "App is not provisioned.")
@@ -204,7 +244,7 @@ func (s *S) TestAddUnitsUnprovisionedApp(c *gocheck.C) {
 func (s *S) TestAddUnitsFailure(c *gocheck.C) {
 	p := NewFakeProvisioner()
 	p.PrepareFailure("AddUnits", errors.New("Cannot add more units."))
-	units, err := p.AddUnits(nil, 10)
+	units, err := p.AddUnits(nil, 10, "")
 	c.Assert(units, gocheck.IsNil)
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot add more units.")
@@ -214,7 +254,7 @@ func (s *S) TestRemoveUnit(c *gocheck.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 2)
+	_, err := p.AddUnits(app, 2, "")
 	c.Assert(err, gocheck.IsNil)
 	err = p.RemoveUnit(app, "hemispheres/1")
 	c.Assert(err, gocheck.IsNil)
@@ -234,7 +274,7 @@ func (s *S) TestRemoveUnknownUnit(c *gocheck.C) {
 	app := NewFakeApp("hemispheres", "rush", 0)
 	p := NewFakeProvisioner()
 	p.Provision(app)
-	_, err := p.AddUnits(app, 2)
+	_, err := p.AddUnits(app, 2, "")
 	c.Assert(err, gocheck.IsNil)
 	err = p.RemoveUnit(app, "hemispheres/3")
 	c.Assert(err, gocheck.NotNil)
@@ -300,10 +340,25 @@ func (s *S) TestCollectStatus(c *gocheck.C) {
 		NewFakeApp("grand-designs", "rush", 1),
 	}
 	expected := []provision.Unit{
-		{"red-lenses/0", "red-lenses", "rush", "i-0801", 1, "10.10.10.1", "started"},
-		{"between-the-wheels/0", "between-the-wheels", "rush", "i-0802", 2, "10.10.10.2", "started"},
-		{"the-big-money/0", "the-big-money", "rush", "i-0803", 3, "10.10.10.3", "started"},
-		{"grand-designs/0", "grand-designs", "rush", "i-0804", 4, "10.10.10.4", "started"},
+		{"red-lenses/0", "red-lenses", "rush", "i-0801", 1, "10.10.10.1", "started", ""},
+		{"between-the-wheels/0", "between-the-wheels", "rush", "i-0802", 2, "10.10.10.2", "started", ""},
+		{"the-big-money/0", "the-big-money", "rush", "i-0803", 3, "10.10.10.3", "started", ""},
+		{"grand-designs/0", "grand-designs", "rush", "i-0804", 4, "10.10.10.4", "started", ""},
+	}
+	units, err := p.CollectStatus()
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(units, gocheck.DeepEquals, expected)
+}
+
+func (s *S) TestCollectStatusWithUnitStatus(c *gocheck.C) {
+	app := NewFakeApp("red-lenses", "rush", 1)
+	p := NewFakeProvisioner()
+	p.SetUnitStatus(app, "red-lenses/1", provision.StatusDown)
+	p.SetUnitStatus(app, "red-lenses/2", provision.StatusStarted)
+	p.SetUnitStatus(app, "red-lenses/1", provision.StatusStarted)
+	expected := []provision.Unit{
+		{Name: "red-lenses/1", AppName: "red-lenses", Type: "rush", Status: provision.StatusStarted},
+		{Name: "red-lenses/2", AppName: "red-lenses", Type: "rush", Status: provision.StatusStarted},
 	}
 	units, err := p.CollectStatus()
 	c.Assert(err, gocheck.IsNil)
@@ -341,3 +396,23 @@ func (s *S) TestAddrFailure(c *gocheck.C) {
 	c.Assert(err, gocheck.NotNil)
 	c.Assert(err.Error(), gocheck.Equals, "Cannot get addr of this app.")
 }
+
+func (s *S) TestSetCName(c *gocheck.C) {
+	app := NewFakeApp("quick", "who", 1)
+	p := NewFakeProvisioner()
+	err := p.SetCName(app, "quick.mycompany.com")
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(p.CName(app), gocheck.Equals, "quick.mycompany.com")
+	p.Reset()
+	c.Assert(p.CName(app), gocheck.Equals, "")
+}
+
+func (s *S) TestSetCNameFailure(c *gocheck.C) {
+	app := NewFakeApp("quick", "who", 1)
+	p := NewFakeProvisioner()
+	p.PrepareFailure("SetCName", errors.New("Cannot set cname."))
+	err := p.SetCName(app, "quick.mycompany.com")
+	c.Assert(err, gocheck.NotNil)
+	c.Assert(err.Error(), gocheck.Equals, "Cannot set cname.")
+	c.Assert(p.CName(app), gocheck.Equals, "")
+}
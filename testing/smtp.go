@@ -0,0 +1,120 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Mail is a message received by the SMTPServer.
+type Mail struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// SMTPServer is a fake SMTP server that listens on a random local port. It
+// stores the messages it receives instead of delivering them, so tests can
+// check them.
+type SMTPServer struct {
+	listener net.Listener
+	mut      sync.Mutex
+	messages []Mail
+}
+
+// NewSMTPServer starts a new fake SMTP server. Use the Addr method to get the
+// address of the server, and call Stop when you're done with it.
+func NewSMTPServer() (*SMTPServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := SMTPServer{listener: l}
+	go s.serve()
+	return &s, nil
+}
+
+// Addr returns the address of the server, in the format host:port.
+func (s *SMTPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Messages returns the messages received by the server.
+func (s *SMTPServer) Messages() []Mail {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	messages := make([]Mail, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Stop stops the server.
+func (s *SMTPServer) Stop() error {
+	return s.listener.Close()
+}
+
+func (s *SMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(textproto.NewConn(conn))
+	}
+}
+
+func (s *SMTPServer) handle(conn *textproto.Conn) {
+	defer conn.Close()
+	conn.PrintfLine("220 localhost fake SMTP server ready")
+	var mail Mail
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			conn.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail.From = address(line[len("MAIL FROM:"):])
+			conn.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.To = append(mail.To, address(line[len("RCPT TO:"):]))
+			conn.PrintfLine("250 OK")
+		case command == "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			if mail.Data, err = conn.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mut.Lock()
+			s.messages = append(s.messages, mail)
+			s.mut.Unlock()
+			mail = Mail{}
+			conn.PrintfLine("250 OK")
+		case command == "RSET":
+			mail = Mail{}
+			conn.PrintfLine("250 OK")
+		case command == "NOOP":
+			conn.PrintfLine("250 OK")
+		case command == "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func address(param string) string {
+	param = strings.TrimSpace(param)
+	if i := strings.Index(param, " "); i > -1 {
+		param = param[:i]
+	}
+	return strings.Trim(param, "<>")
+}
@@ -0,0 +1,39 @@
+// Copyright 2013 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testing
+
+import (
+	"launchpad.net/gocheck"
+	"net/smtp"
+)
+
+func (s *S) TestSMTPServer(c *gocheck.C) {
+	server, err := NewSMTPServer()
+	c.Assert(err, gocheck.IsNil)
+	defer server.Stop()
+	msg := []byte("Subject: hello\r\n\r\nHello world!\r\n.hidden dot\r\n")
+	err = smtp.SendMail(server.Addr(), nil, "tsuru@globo.com", []string{"gopher@golang.org", "rob@golang.org"}, msg)
+	c.Assert(err, gocheck.IsNil)
+	messages := server.Messages()
+	c.Assert(messages, gocheck.HasLen, 1)
+	c.Assert(messages[0].From, gocheck.Equals, "tsuru@globo.com")
+	c.Assert(messages[0].To, gocheck.DeepEquals, []string{"gopher@golang.org", "rob@golang.org"})
+	c.Assert(string(messages[0].Data), gocheck.Equals, "Subject: hello\n\nHello world!\n.hidden dot\n")
+}
+
+func (s *S) TestSMTPServerStop(c *gocheck.C) {
+	server, err := NewSMTPServer()
+	c.Assert(err, gocheck.IsNil)
+	err = server.Stop()
+	c.Assert(err, gocheck.IsNil)
+	err = smtp.SendMail(server.Addr(), nil, "tsuru@globo.com", []string{"gopher@golang.org"}, []byte("hello"))
+	c.Assert(err, gocheck.NotNil)
+}
+
+func (s *S) TestAddress(c *gocheck.C) {
+	c.Assert(address("<gopher@golang.org>"), gocheck.Equals, "gopher@golang.org")
+	c.Assert(address(" <gopher@golang.org> BODY=8BITMIME"), gocheck.Equals, "gopher@golang.org")
+	c.Assert(address("gopher@golang.org"), gocheck.Equals, "gopher@golang.org")
+}
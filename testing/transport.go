@@ -37,3 +37,18 @@ func (t *ConditionalTransport) RoundTrip(req *http.Request) (*http.Response, err
 	}
 	return t.Transport.RoundTrip(req)
 }
+
+// MultiConditionalTransport is a transport that handles a sequence of requests,
+// using one ConditionalTransport for each request, in order.
+type MultiConditionalTransport struct {
+	ConditionalTransports []ConditionalTransport
+}
+
+func (m *MultiConditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(m.ConditionalTransports) == 0 {
+		return &http.Response{Body: nil, StatusCode: 500}, errors.New("no more transports")
+	}
+	t := m.ConditionalTransports[0]
+	m.ConditionalTransports = m.ConditionalTransports[1:]
+	return t.RoundTrip(req)
+}
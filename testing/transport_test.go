@@ -49,3 +49,34 @@ func (s *S) TestConditionalTransport(c *gocheck.C) {
 	c.Assert(err.Error(), gocheck.Equals, "condition failed")
 	c.Assert(r.StatusCode, gocheck.Equals, http.StatusInternalServerError)
 }
+
+func (s *S) TestMultiConditionalTransport(c *gocheck.C) {
+	t1 := ConditionalTransport{
+		Transport: Transport{Message: "first", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/first"
+		},
+	}
+	t2 := ConditionalTransport{
+		Transport: Transport{Message: "second", Status: http.StatusCreated},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/second"
+		},
+	}
+	var t http.RoundTripper = &MultiConditionalTransport{
+		ConditionalTransports: []ConditionalTransport{t1, t2},
+	}
+	req, _ := http.NewRequest("GET", "/first", nil)
+	r, err := t.RoundTrip(req)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r.StatusCode, gocheck.Equals, http.StatusOK)
+	req, _ = http.NewRequest("GET", "/second", nil)
+	r, err = t.RoundTrip(req)
+	c.Assert(err, gocheck.IsNil)
+	c.Assert(r.StatusCode, gocheck.Equals, http.StatusCreated)
+	b, _ := ioutil.ReadAll(r.Body)
+	c.Assert(string(b), gocheck.Equals, "second")
+	req, _ = http.NewRequest("GET", "/third", nil)
+	_, err = t.RoundTrip(req)
+	c.Assert(err, gocheck.NotNil)
+}